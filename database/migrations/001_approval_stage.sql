@@ -0,0 +1,31 @@
+-- Approval stages per department / item type (sd_id or sas_item_type NULL = applies to all)
+-- sas_type is written to info_approval.ia_type, sas_source decides who approves:
+--   workflow = sys_workflow rows of the owner's department (ordered by sw_order)
+--   creator  = user who created the item (ipid_created_by)
+--   user     = fixed su_id
+CREATE TABLE IF NOT EXISTS sys_approval_stage (
+    sas_id          INT AUTO_INCREMENT PRIMARY KEY,
+    sd_id           INT NULL,
+    sas_item_type   VARCHAR(10) NULL,
+    sas_order       INT NOT NULL,
+    sas_type        VARCHAR(20) NOT NULL,
+    sas_source      VARCHAR(20) NOT NULL DEFAULT 'workflow',
+    su_id           INT NULL,
+    sas_status      VARCHAR(10) NOT NULL DEFAULT 'active',
+    sas_created_at  DATETIME NULL,
+    sas_created_by  VARCHAR(20) NULL,
+    sas_updated_at  DATETIME NULL,
+    sas_updated_by  VARCHAR(20) NULL,
+    KEY idx_sas_lookup (sd_id, sas_item_type, sas_status)
+);
+
+-- default flow: Leader (workflow) -> PJ (item creator)
+INSERT INTO sys_approval_stage (sd_id, sas_item_type, sas_order, sas_type, sas_source, sas_status, sas_created_at, sas_created_by)
+SELECT NULL, NULL, 1, 'Leader', 'workflow', 'active', NOW(), 'system'
+WHERE NOT EXISTS (SELECT 1 FROM sys_approval_stage WHERE sd_id IS NULL AND sas_item_type IS NULL);
+INSERT INTO sys_approval_stage (sd_id, sas_item_type, sas_order, sas_type, sas_source, sas_status, sas_created_at, sas_created_by)
+SELECT NULL, NULL, 2, 'PJ', 'creator', 'active', NOW(), 'system'
+WHERE NOT EXISTS (SELECT 1 FROM sys_approval_stage WHERE sd_id IS NULL AND sas_item_type IS NULL AND sas_order = 2);
+
+-- statuses are lowercase from now on ('Approve' -> 'approve')
+UPDATE info_approval SET ia_status = LOWER(ia_status) WHERE BINARY ia_status <> BINARY LOWER(ia_status);
@@ -0,0 +1,16 @@
+-- Level rules for sys_workflow: rows of the same sd_id + sw_order are one level.
+-- swr_rule: any = one approval passes the level, all = every approver, n_of_m = swr_quorum approvals
+-- No row = all.
+CREATE TABLE IF NOT EXISTS sys_workflow_rule (
+    swr_id          INT AUTO_INCREMENT PRIMARY KEY,
+    sd_id           INT NOT NULL,
+    sw_order        INT NOT NULL,
+    swr_rule        VARCHAR(10) NOT NULL DEFAULT 'all',
+    swr_quorum      INT NULL,
+    swr_status      VARCHAR(10) NOT NULL DEFAULT 'active',
+    swr_created_at  DATETIME NULL,
+    swr_created_by  VARCHAR(20) NULL,
+    swr_updated_at  DATETIME NULL,
+    swr_updated_by  VARCHAR(20) NULL,
+    UNIQUE KEY uq_swr_level (sd_id, sw_order)
+);
@@ -0,0 +1,21 @@
+-- Approval delegation: su_id is away, sdl_delegate_su_id may act on su_id's approvals
+-- between sdl_start_date and sdl_end_date (sd_id NULL = all departments)
+CREATE TABLE IF NOT EXISTS sys_delegation (
+    sdl_id              INT AUTO_INCREMENT PRIMARY KEY,
+    su_id               INT NOT NULL,
+    sdl_delegate_su_id  INT NOT NULL,
+    sd_id               INT NULL,
+    sdl_start_date      DATE NOT NULL,
+    sdl_end_date        DATE NOT NULL,
+    sdl_note            VARCHAR(255) NULL,
+    sdl_status          VARCHAR(10) NOT NULL DEFAULT 'active',
+    sdl_created_at      DATETIME NULL,
+    sdl_created_by      VARCHAR(20) NULL,
+    sdl_updated_at      DATETIME NULL,
+    sdl_updated_by      VARCHAR(20) NULL,
+    KEY idx_sdl_delegate (sdl_delegate_su_id, sdl_status),
+    KEY idx_sdl_owner (su_id, sdl_status)
+);
+
+-- who actually made the decision (differs from su_id when acting on behalf)
+ALTER TABLE info_approval ADD COLUMN ia_action_su_id INT NULL AFTER su_id;
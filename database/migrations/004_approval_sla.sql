@@ -0,0 +1,48 @@
+-- SLA per workflow (department of the item owner, optionally per ia_type); NULL sd_id = default
+CREATE TABLE IF NOT EXISTS sys_workflow_sla (
+    sws_id             INT AUTO_INCREMENT PRIMARY KEY,
+    sd_id              INT NULL,
+    ia_type            VARCHAR(20) NULL,
+    sws_remind_days    INT NOT NULL,
+    sws_escalate_days  INT NOT NULL,
+    sws_status         VARCHAR(10) NOT NULL DEFAULT 'active',
+    sws_created_at     DATETIME NULL,
+    sws_created_by     VARCHAR(20) NULL,
+    sws_updated_at     DATETIME NULL,
+    sws_updated_by     VARCHAR(20) NULL
+);
+
+INSERT INTO sys_workflow_sla (sd_id, ia_type, sws_remind_days, sws_escalate_days, sws_status, sws_created_at, sws_created_by)
+SELECT NULL, NULL, 2, 4, 'active', NOW(), 'system'
+WHERE NOT EXISTS (SELECT 1 FROM sys_workflow_sla WHERE sd_id IS NULL AND ia_type IS NULL);
+
+-- plant holidays (weekends are always non-working)
+CREATE TABLE IF NOT EXISTS mst_holiday (
+    mh_id          INT AUTO_INCREMENT PRIMARY KEY,
+    mh_date        DATE NOT NULL,
+    mh_name        VARCHAR(100) NULL,
+    mh_status      VARCHAR(10) NOT NULL DEFAULT 'active',
+    mh_created_at  DATETIME NULL,
+    mh_created_by  VARCHAR(20) NULL,
+    mh_updated_at  DATETIME NULL,
+    mh_updated_by  VARCHAR(20) NULL,
+    UNIQUE KEY uq_mh_date (mh_date)
+);
+
+-- department head, last escalation target
+ALTER TABLE sys_department ADD COLUMN sd_head_su_id INT NULL;
+
+-- approval history events (remind / escalate)
+CREATE TABLE IF NOT EXISTS info_approval_event (
+    iae_id          INT AUTO_INCREMENT PRIMARY KEY,
+    ia_id           INT NOT NULL,
+    ipid_id         INT NOT NULL,
+    iae_type        VARCHAR(20) NOT NULL,
+    iae_from_su_id  INT NULL,
+    iae_to_su_id    INT NULL,
+    iae_note        VARCHAR(255) NULL,
+    iae_created_at  DATETIME NOT NULL,
+    iae_created_by  VARCHAR(20) NULL,
+    KEY idx_iae_ia (ia_id, iae_type),
+    KEY idx_iae_ipid (ipid_id)
+);
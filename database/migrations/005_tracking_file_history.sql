@@ -0,0 +1,23 @@
+-- every uploaded version of a tracking file, one row per submission round
+CREATE TABLE IF NOT EXISTS info_tracking_file_history (
+    itfh_id          INT AUTO_INCREMENT PRIMARY KEY,
+    ip_id            INT NOT NULL,
+    ipid_id          INT NOT NULL,
+    itfh_round       INT NOT NULL,
+    itfh_file_name   VARCHAR(255) NULL,
+    itfh_file_path   VARCHAR(500) NULL,
+    itfh_created_at  DATETIME NULL,
+    itfh_created_by  VARCHAR(20) NULL,
+    KEY idx_itfh_ipid (ipid_id, itfh_round),
+    KEY idx_itfh_path (itfh_file_path)
+);
+
+-- chains opened before round numbering count as round 1
+UPDATE info_approval SET ia_round = 1 WHERE ia_status_flg = 'active' AND (ia_round IS NULL OR ia_round = 0);
+
+-- current files become round 1 history
+INSERT INTO info_tracking_file_history (ip_id, ipid_id, itfh_round, itfh_file_name, itfh_file_path, itfh_created_at, itfh_created_by)
+SELECT tf.ip_id, tf.ipid_id, 1, tf.itf_file_name, tf.itf_file_path, COALESCE(tf.itf_updated_at, tf.itf_created_at), COALESCE(tf.itf_updated_by, tf.itf_created_by)
+FROM info_tracking_file tf
+WHERE tf.ipid_id IS NOT NULL
+  AND NOT EXISTS (SELECT 1 FROM info_tracking_file_history h WHERE h.ipid_id = tf.ipid_id);
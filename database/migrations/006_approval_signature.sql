@@ -0,0 +1,17 @@
+-- electronic signature of approval decisions (HMAC-SHA256 with APPROVAL_SIGN_KEY)
+CREATE TABLE IF NOT EXISTS info_approval_signature (
+    ias_id           INT AUTO_INCREMENT PRIMARY KEY,
+    ia_id            INT NOT NULL,
+    ipid_id          INT NOT NULL,
+    su_id            INT NOT NULL,
+    ias_decision     VARCHAR(20) NOT NULL,
+    ias_meaning      VARCHAR(255) NOT NULL,
+    ias_signed_at    DATETIME NOT NULL,
+    ias_file_name    VARCHAR(255) NULL,
+    ias_file_path    VARCHAR(500) NULL,
+    ias_file_sha256  CHAR(64) NULL,
+    ias_hmac         CHAR(64) NOT NULL,
+    KEY idx_ias_ia (ia_id),
+    KEY idx_ias_ipid (ipid_id),
+    KEY idx_ias_path (ias_file_path)
+);
@@ -0,0 +1,4 @@
+-- version column for project master plan rows (optimistic locking / ETag)
+ALTER TABLE info_project_master_plan
+    ADD COLUMN ipmp_updated_at DATETIME NULL,
+    ADD COLUMN ipmp_updated_by VARCHAR(20) NULL;
@@ -0,0 +1,19 @@
+-- notifications written in the same transaction as the business change, sent by the dispatcher
+CREATE TABLE IF NOT EXISTS info_notification_outbox (
+    ino_id               BIGINT AUTO_INCREMENT PRIMARY KEY,
+    ino_channel          VARCHAR(20) NOT NULL DEFAULT 'email',
+    ino_to               TEXT NOT NULL,
+    ino_subject          VARCHAR(255) NOT NULL,
+    ino_body             MEDIUMTEXT NOT NULL,
+    ino_content_type     VARCHAR(100) NOT NULL,
+    ino_status           VARCHAR(20) NOT NULL DEFAULT 'pending',
+    ino_attempts         INT NOT NULL DEFAULT 0,
+    ino_next_attempt_at  DATETIME NOT NULL,
+    ino_last_error       TEXT NULL,
+    ino_sent_at          DATETIME NULL,
+    ino_created_at       DATETIME NOT NULL,
+    ino_created_by       VARCHAR(20) NULL,
+    ino_updated_at       DATETIME NULL,
+    ino_updated_by       VARCHAR(20) NULL,
+    KEY idx_ino_due (ino_status, ino_next_attempt_at)
+);
@@ -0,0 +1,17 @@
+-- language of the notification mails (th / en); NULL uses MAIL_DEFAULT_LANG
+ALTER TABLE sys_user ADD COLUMN su_language VARCHAR(2) NULL;
+
+-- admin overrides of the built-in mail templates; empty columns fall back to the built-in text
+CREATE TABLE IF NOT EXISTS mst_email_template (
+    met_id          INT AUTO_INCREMENT PRIMARY KEY,
+    met_key         VARCHAR(50) NOT NULL,
+    met_lang        VARCHAR(2) NOT NULL,
+    met_subject     VARCHAR(255) NULL,
+    met_body        MEDIUMTEXT NULL,
+    met_status      VARCHAR(10) NOT NULL DEFAULT 'active',
+    met_created_at  DATETIME NULL,
+    met_created_by  VARCHAR(20) NULL,
+    met_updated_at  DATETIME NULL,
+    met_updated_by  VARCHAR(20) NULL,
+    UNIQUE KEY uq_met_key_lang (met_key, met_lang)
+);
@@ -0,0 +1,30 @@
+-- notification preference per user and event (mail template key); no row = immediate, all projects
+CREATE TABLE IF NOT EXISTS sys_notification_pref (
+    snp_id          INT AUTO_INCREMENT PRIMARY KEY,
+    su_id           INT NOT NULL,
+    snp_event       VARCHAR(50) NOT NULL,
+    snp_mode        VARCHAR(10) NOT NULL DEFAULT 'immediate',
+    snp_scope       VARCHAR(10) NOT NULL DEFAULT 'all',
+    snp_created_at  DATETIME NULL,
+    snp_created_by  VARCHAR(20) NULL,
+    snp_updated_at  DATETIME NULL,
+    snp_updated_by  VARCHAR(20) NULL,
+    UNIQUE KEY uq_snp_user_event (su_id, snp_event)
+);
+
+-- events held back for a daily / weekly digest
+CREATE TABLE IF NOT EXISTS info_notification_digest (
+    ind_id          BIGINT AUTO_INCREMENT PRIMARY KEY,
+    su_id           INT NOT NULL,
+    ind_email       VARCHAR(255) NOT NULL,
+    ind_event       VARCHAR(50) NOT NULL,
+    ind_mode        VARCHAR(10) NOT NULL,
+    ind_subject     VARCHAR(255) NOT NULL,
+    ind_data        MEDIUMTEXT NOT NULL,
+    ind_status      VARCHAR(10) NOT NULL DEFAULT 'pending',
+    ind_due_at      DATETIME NOT NULL,
+    ind_sent_at     DATETIME NULL,
+    ind_created_at  DATETIME NOT NULL,
+    KEY idx_ind_due (ind_status, ind_due_at),
+    KEY idx_ind_user (su_id, ind_status)
+);
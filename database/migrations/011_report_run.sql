@@ -0,0 +1,29 @@
+-- runs of the scheduled / manual tracking report
+CREATE TABLE IF NOT EXISTS info_report_run (
+    irr_id           BIGINT AUTO_INCREMENT PRIMARY KEY,
+    irr_report       VARCHAR(50) NOT NULL,
+    irr_trigger      VARCHAR(10) NOT NULL,
+    irr_status       VARCHAR(10) NOT NULL DEFAULT 'running',
+    irr_recipients   INT NOT NULL DEFAULT 0,
+    irr_sent         INT NOT NULL DEFAULT 0,
+    irr_failed       INT NOT NULL DEFAULT 0,
+    irr_error        TEXT NULL,
+    irr_started_at   DATETIME NOT NULL,
+    irr_finished_at  DATETIME NULL,
+    irr_created_by   VARCHAR(20) NULL,
+    KEY idx_irr_started (irr_report, irr_started_at)
+);
+
+-- one row per recipient of a run
+CREATE TABLE IF NOT EXISTS info_report_run_recipient (
+    irrr_id        BIGINT AUTO_INCREMENT PRIMARY KEY,
+    irr_id         BIGINT NOT NULL,
+    su_id          INT NOT NULL,
+    irrr_email     VARCHAR(255) NOT NULL,
+    irrr_projects  INT NOT NULL DEFAULT 0,
+    irrr_items     INT NOT NULL DEFAULT 0,
+    irrr_status    VARCHAR(10) NOT NULL,
+    irrr_error     TEXT NULL,
+    irrr_sent_at   DATETIME NULL,
+    KEY idx_irrr_run (irr_id)
+);
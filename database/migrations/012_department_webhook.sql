@@ -0,0 +1,4 @@
+-- department chat channel (Teams / Slack / LINE Notify / generic JSON incoming webhook)
+ALTER TABLE sys_department ADD COLUMN sd_webhook_type VARCHAR(10) NULL;
+ALTER TABLE sys_department ADD COLUMN sd_webhook_url VARCHAR(500) NULL;
+ALTER TABLE sys_department ADD COLUMN sd_webhook_token VARCHAR(255) NULL;
@@ -0,0 +1,14 @@
+-- in-app notification inbox; one row per user and event (written with every event mail)
+CREATE TABLE IF NOT EXISTS info_notification (
+    in_id          BIGINT AUTO_INCREMENT PRIMARY KEY,
+    su_id          INT NOT NULL,
+    in_type        VARCHAR(50) NOT NULL,
+    ip_id          INT NULL,
+    ipid_id        INT NULL,
+    in_title       VARCHAR(255) NOT NULL,
+    in_message     TEXT NULL,
+    in_is_read     TINYINT(1) NOT NULL DEFAULT 0,
+    in_read_at     DATETIME NULL,
+    in_created_at  DATETIME NOT NULL,
+    KEY idx_in_user (su_id, in_is_read, in_id)
+);
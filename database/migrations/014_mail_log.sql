@@ -0,0 +1,17 @@
+-- outbound mail log; every message handed to SMTP (or captured by MAIL_MODE=capture) gets a row
+CREATE TABLE IF NOT EXISTS info_mail_log (
+    iml_id            BIGINT AUTO_INCREMENT PRIMARY KEY,
+    iml_mode          VARCHAR(20) NOT NULL,
+    iml_to            TEXT NOT NULL,
+    iml_delivered_to  TEXT NULL,
+    iml_subject       VARCHAR(500) NOT NULL,
+    iml_content_type  VARCHAR(100) NOT NULL,
+    iml_body          MEDIUMTEXT NULL,
+    iml_attachments   TEXT NULL,
+    iml_status        VARCHAR(20) NOT NULL,
+    iml_message_id    VARCHAR(255) NULL,
+    iml_error         TEXT NULL,
+    iml_created_at    DATETIME NOT NULL,
+    KEY idx_iml_status (iml_status, iml_id),
+    KEY idx_iml_created (iml_created_at)
+);
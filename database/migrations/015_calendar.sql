@@ -0,0 +1,38 @@
+-- plant calendars; mst_holiday stays the shared (Thai public) holiday list a calendar can include
+CREATE TABLE IF NOT EXISTS mst_calendar (
+    mc_id              INT AUTO_INCREMENT PRIMARY KEY,
+    mc_code            VARCHAR(20) NOT NULL,
+    mc_name            VARCHAR(100) NOT NULL,
+    mc_weekend         VARCHAR(20) NOT NULL DEFAULT '0,6',
+    mc_public_holiday  TINYINT(1) NOT NULL DEFAULT 1,
+    mc_is_default      TINYINT(1) NOT NULL DEFAULT 0,
+    mc_status          VARCHAR(10) NOT NULL DEFAULT 'active',
+    mc_created_at      DATETIME NULL,
+    mc_created_by      VARCHAR(20) NULL,
+    mc_updated_at      DATETIME NULL,
+    mc_updated_by      VARCHAR(20) NULL,
+    UNIQUE KEY uq_mc_code (mc_code)
+);
+
+INSERT INTO mst_calendar (mc_code, mc_name, mc_weekend, mc_public_holiday, mc_is_default, mc_status, mc_created_at, mc_created_by)
+SELECT 'DEFAULT', 'Default (Mon-Fri)', '0,6', 1, 1, 'active', NOW(), 'system'
+WHERE NOT EXISTS (SELECT 1 FROM mst_calendar WHERE mc_is_default = 1);
+
+-- plant holidays and shutdown periods (one row per range)
+CREATE TABLE IF NOT EXISTS mst_calendar_holiday (
+    mch_id          INT AUTO_INCREMENT PRIMARY KEY,
+    mc_id           INT NOT NULL,
+    mch_type        VARCHAR(10) NOT NULL DEFAULT 'holiday',
+    mch_start_date  DATE NOT NULL,
+    mch_end_date    DATE NOT NULL,
+    mch_name        VARCHAR(100) NULL,
+    mch_status      VARCHAR(10) NOT NULL DEFAULT 'active',
+    mch_created_at  DATETIME NULL,
+    mch_created_by  VARCHAR(20) NULL,
+    mch_updated_at  DATETIME NULL,
+    mch_updated_by  VARCHAR(20) NULL,
+    KEY idx_mch_calendar (mc_id, mch_start_date)
+);
+
+-- calendar of the plant that runs the project (NULL = default calendar)
+ALTER TABLE info_project ADD COLUMN mc_id INT NULL;
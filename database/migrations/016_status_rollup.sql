@@ -0,0 +1,19 @@
+-- project health, set by the status roll-up job (on_track / at_risk / delayed)
+ALTER TABLE info_project ADD COLUMN ip_health VARCHAR(20) NULL;
+ALTER TABLE info_project ADD COLUMN ip_health_updated_at DATETIME NULL;
+
+-- status changes of items, master plan rows and projects (job, approval, upload, manual)
+CREATE TABLE IF NOT EXISTS info_status_event (
+    ise_id          BIGINT AUTO_INCREMENT PRIMARY KEY,
+    ise_entity      VARCHAR(10) NOT NULL,
+    ise_ref_id      INT NOT NULL,
+    ip_id           INT NULL,
+    ise_field       VARCHAR(20) NOT NULL DEFAULT 'status',
+    ise_from        VARCHAR(20) NULL,
+    ise_to          VARCHAR(20) NOT NULL,
+    ise_source      VARCHAR(20) NOT NULL,
+    ise_created_at  DATETIME NOT NULL,
+    ise_created_by  VARCHAR(20) NULL,
+    KEY idx_ise_project (ip_id, ise_id),
+    KEY idx_ise_ref (ise_entity, ise_ref_id)
+);
@@ -0,0 +1,28 @@
+-- predecessor links between master plan milestones (template defaults, matched to projects by mmp_name)
+-- mmpl_type: FS finish-to-start, SS start-to-start, FF finish-to-finish; mmpl_lag in working days
+CREATE TABLE IF NOT EXISTS mst_master_plan_link (
+    mmpl_id           INT AUTO_INCREMENT PRIMARY KEY,
+    mmp_id            INT NOT NULL,
+    mmpl_pred_mmp_id  INT NOT NULL,
+    mmpl_type         VARCHAR(2) NOT NULL DEFAULT 'FS',
+    mmpl_lag          INT NOT NULL DEFAULT 0,
+    mmpl_created_at   DATETIME NULL,
+    mmpl_created_by   VARCHAR(20) NULL,
+    mmpl_updated_at   DATETIME NULL,
+    mmpl_updated_by   VARCHAR(20) NULL,
+    UNIQUE KEY uq_mmpl (mmp_id, mmpl_pred_mmp_id)
+);
+
+-- predecessor links of one project's plan rows (seeded from the template, editable per project)
+CREATE TABLE IF NOT EXISTS info_project_master_plan_link (
+    ipmpl_id            INT AUTO_INCREMENT PRIMARY KEY,
+    ip_id               INT NOT NULL,
+    ipmp_id             INT NOT NULL,
+    ipmpl_pred_ipmp_id  INT NOT NULL,
+    ipmpl_type          VARCHAR(2) NOT NULL DEFAULT 'FS',
+    ipmpl_lag           INT NOT NULL DEFAULT 0,
+    ipmpl_created_at    DATETIME NULL,
+    ipmpl_created_by    VARCHAR(20) NULL,
+    UNIQUE KEY uq_ipmpl (ipmp_id, ipmpl_pred_ipmp_id),
+    KEY idx_ipmpl_project (ip_id)
+);
@@ -0,0 +1,19 @@
+-- standard schedule of a template, used to back-schedule a new project from its SOP / customer events
+-- ma_id NULL: the milestone ends mts_offset working days before the anchor date
+--   (mts_anchor: sop, k_ken_1, k_ken_2, 1pp, 2pp, pp; a negative offset is after the anchor)
+-- ma_id set: the APQP item ends mts_offset working days before its milestone ends (mts_anchor unused)
+-- mts_duration is in working days, both ends included
+CREATE TABLE IF NOT EXISTS mst_template_schedule (
+    mts_id          INT AUTO_INCREMENT PRIMARY KEY,
+    mt_id           INT NOT NULL,
+    mmp_id          INT NOT NULL,
+    ma_id           INT NULL,
+    mts_anchor      VARCHAR(10) NOT NULL DEFAULT 'sop',
+    mts_offset      INT NOT NULL DEFAULT 0,
+    mts_duration    INT NOT NULL DEFAULT 1,
+    mts_created_at  DATETIME NULL,
+    mts_created_by  VARCHAR(20) NULL,
+    mts_updated_at  DATETIME NULL,
+    mts_updated_by  VARCHAR(20) NULL,
+    KEY idx_mts_template (mt_id, mmp_id)
+);
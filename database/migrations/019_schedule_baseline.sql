@@ -0,0 +1,27 @@
+-- actual dates of an item: first upload / final approval (cleared when the item leaves done)
+ALTER TABLE info_project_item_detail ADD COLUMN ipid_actual_start_date DATETIME NULL;
+ALTER TABLE info_project_item_detail ADD COLUMN ipid_actual_end_date DATETIME NULL;
+
+-- frozen copies of a project schedule (ipb_no counts up per project, the highest is the current baseline)
+CREATE TABLE IF NOT EXISTS info_project_baseline (
+    ipb_id          INT AUTO_INCREMENT PRIMARY KEY,
+    ip_id           INT NOT NULL,
+    ipb_no          INT NOT NULL,
+    ipb_name        VARCHAR(100) NULL,
+    ipb_note        VARCHAR(500) NULL,
+    ipb_created_at  DATETIME NOT NULL,
+    ipb_created_by  VARCHAR(20) NULL,
+    UNIQUE KEY uq_ipb_project (ip_id, ipb_no)
+);
+
+-- the plan rows (ipbr_entity plan, ref ipmp_id) and item rows (item, ref ipid_id) of a baseline
+CREATE TABLE IF NOT EXISTS info_project_baseline_row (
+    ipbr_id          BIGINT AUTO_INCREMENT PRIMARY KEY,
+    ipb_id           INT NOT NULL,
+    ipbr_entity      VARCHAR(10) NOT NULL,
+    ipbr_ref_id      INT NOT NULL,
+    ipbr_name        VARCHAR(255) NULL,
+    ipbr_start_date  DATE NULL,
+    ipbr_end_date    DATE NULL,
+    KEY idx_ipbr_baseline (ipb_id, ipbr_entity, ipbr_ref_id)
+);
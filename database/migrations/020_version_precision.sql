@@ -0,0 +1,23 @@
+-- version columns keep microseconds so two edits within one second get different versions
+ALTER TABLE info_project MODIFY ip_created_at DATETIME(6) NULL, MODIFY ip_updated_at DATETIME(6) NULL;
+ALTER TABLE info_customer_event MODIFY ice_created_at DATETIME(6) NULL, MODIFY ice_updated_at DATETIME(6) NULL;
+ALTER TABLE info_project_master_plan MODIFY ipmp_created_at DATETIME(6) NULL, MODIFY ipmp_updated_at DATETIME(6) NULL;
+ALTER TABLE info_project_item_detail MODIFY ipid_created_at DATETIME(6) NULL, MODIFY ipid_updated_at DATETIME(6) NULL;
+ALTER TABLE mst_master_plan MODIFY mmp_created_at DATETIME(6) NULL, MODIFY mmp_updated_at DATETIME(6) NULL;
+ALTER TABLE mst_model_master MODIFY mmm_created_at DATETIME(6) NULL, MODIFY mmm_updated_at DATETIME(6) NULL;
+ALTER TABLE mst_template MODIFY mt_created_at DATETIME(6) NULL, MODIFY mt_updated_at DATETIME(6) NULL;
+ALTER TABLE mst_template_detail MODIFY mtpd_created_at DATETIME(6) NULL, MODIFY mtpd_updated_at DATETIME(6) NULL;
+ALTER TABLE mst_ppap_detail MODIFY mpd_created_at DATETIME(6) NULL, MODIFY mpd_updated_at DATETIME(6) NULL;
+ALTER TABLE mst_apqp MODIFY ma_created_at DATETIME(6) NULL, MODIFY ma_updated_at DATETIME(6) NULL;
+ALTER TABLE mst_ppap_item MODIFY mpi_created_at DATETIME(6) NULL, MODIFY mpi_updated_at DATETIME(6) NULL;
+ALTER TABLE mst_project_phase MODIFY mpp_created_at DATETIME(6) NULL, MODIFY mpp_updated_at DATETIME(6) NULL;
+ALTER TABLE sys_workflow MODIFY sw_created_at DATETIME(6) NULL, MODIFY sw_updated_at DATETIME(6) NULL;
+ALTER TABLE sys_approval_stage MODIFY sas_created_at DATETIME(6) NULL, MODIFY sas_updated_at DATETIME(6) NULL;
+ALTER TABLE sys_department MODIFY sd_created_at DATETIME(6) NULL, MODIFY sd_updated_at DATETIME(6) NULL;
+ALTER TABLE sys_menu MODIFY sm_created_at DATETIME(6) NULL, MODIFY sm_updated_at DATETIME(6) NULL;
+ALTER TABLE sys_submenu MODIFY ss_created_at DATETIME(6) NULL, MODIFY ss_updated_at DATETIME(6) NULL;
+ALTER TABLE sys_permission_group MODIFY spg_created_at DATETIME(6) NULL, MODIFY spg_updated_at DATETIME(6) NULL;
+ALTER TABLE mst_holiday MODIFY mh_created_at DATETIME(6) NULL, MODIFY mh_updated_at DATETIME(6) NULL;
+ALTER TABLE mst_calendar MODIFY mc_created_at DATETIME(6) NULL, MODIFY mc_updated_at DATETIME(6) NULL;
+ALTER TABLE mst_calendar_holiday MODIFY mch_created_at DATETIME(6) NULL, MODIFY mch_updated_at DATETIME(6) NULL;
+ALTER TABLE mst_email_template MODIFY met_created_at DATETIME(6) NULL, MODIFY met_updated_at DATETIME(6) NULL;
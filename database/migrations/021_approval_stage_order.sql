@@ -0,0 +1,3 @@
+-- sas_order of the stage a row belongs to, so the chain moves on by stage position instead of
+-- by ia_type (two stages may share a type). NULL on rows written before: matched by ia_type.
+ALTER TABLE info_approval ADD COLUMN ia_stage_order INT NULL;
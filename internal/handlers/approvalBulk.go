@@ -0,0 +1,314 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jmoiron/sqlx"
+)
+
+// bulk item results
+const (
+	bulkSuccess         = "success"
+	bulkAlreadyActioned = "already_actioned"
+	bulkNotAuthorized   = "not_authorized"
+	bulkNotFound        = "not_found"
+)
+
+type bulkApprovalResult struct {
+	IpidID    int64  `json:"ipid_id"`
+	Result    string `json:"result"`
+	Stage     string `json:"stage,omitempty"`
+	NextStage string `json:"next_stage,omitempty"`
+	Completed bool   `json:"completed"`
+}
+
+// approvalMailItem is one row of a consolidated approval mail
+type approvalMailItem struct {
+	IpidID      int64          `db:"ipid_id"`
+	IpID        sql.NullInt64  `db:"ip_id"`
+	ProjectCode sql.NullString `db:"ip_code"`
+	PartNo      sql.NullString `db:"ip_part_no"`
+	ItemName    sql.NullString `db:"item_name"`
+	ItemType    sql.NullString `db:"item_type"`
+	OwnerSuID   sql.NullInt64  `db:"su_id"`
+	SdID        sql.NullInt64  `db:"sd_id"`
+	Status      string         `db:"-"`
+}
+
+// BulkUpdateApprovalStatus approves / rejects many items in one transaction; like a single decision,
+// it also decides the other items of each group (same ref_id + ipid_type) waiting on the same stage.
+// Body: { "ipid_ids": [..], "status": "done|approve|reject", "note": "", "updated_by": "<emp code>", "password": "" }
+func BulkUpdateApprovalStatus(c *fiber.Ctx, db *sqlx.DB) error {
+	var body struct {
+		IpidIDs   []int64 `json:"ipid_ids"`
+		Status    string  `json:"status"`
+		Note      string  `json:"note"`
+		UpdatedBy string  `json:"updated_by"`
+		Password  string  `json:"password"`
+	}
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid request", "detail": err.Error()})
+	}
+	if len(body.IpidIDs) == 0 {
+		return c.Status(400).JSON(fiber.Map{"error": "ipid_ids is required"})
+	}
+	if strings.TrimSpace(body.UpdatedBy) == "" {
+		return c.Status(400).JSON(fiber.Map{"error": "updated_by is required"})
+	}
+	decision := normalizeApprovalStatus(body.Status)
+	if decision != approvalApprove && decision != approvalReject {
+		return c.Status(400).JSON(fiber.Map{"error": "status must be 'done', 'approve' or 'reject'"})
+	}
+	if decision == approvalReject && strings.TrimSpace(body.Note) == "" {
+		return c.Status(400).JSON(fiber.Map{"error": "note is required when rejecting"})
+	}
+
+	// one signature confirmation covers the whole batch
+	sign, err := requireApprovalSigning()
+	if err != nil {
+		return c.Status(503).JSON(fiber.Map{"error": "approval signing unavailable", "detail": err.Error()})
+	}
+	if sign {
+		if err := confirmSigner(db, body.UpdatedBy, body.Password); err != nil {
+			return c.Status(signerErrorStatus(err)).JSON(fiber.Map{"error": "signature not confirmed", "detail": err.Error()})
+		}
+	}
+
+	now := time.Now()
+	tx, err := db.Beginx()
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "transaction error", "detail": err.Error()})
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	seen := map[int64]bool{}
+	// items decided together with an earlier item of their group (same ref_id + ipid_type)
+	bySibling := map[int64]approvalOutcome{}
+	results := make([]bulkApprovalResult, 0, len(body.IpidIDs))
+	var outcomes []approvalOutcome
+	for _, id := range body.IpidIDs {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		if out, ok := bySibling[id]; ok {
+			results = append(results, bulkApprovalResult{IpidID: id, Result: bulkSuccess, Stage: out.Stage, NextStage: out.NextStage, Completed: out.Completed})
+			continue
+		}
+
+		var item struct {
+			RefID    int64          `db:"ref_id"`
+			IpidType sql.NullString `db:"ipid_type"`
+		}
+		if err := tx.Get(&item, `SELECT ref_id, ipid_type FROM info_project_item_detail WHERE ipid_id = ? FOR UPDATE`, id); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				results = append(results, bulkApprovalResult{IpidID: id, Result: bulkNotFound})
+				continue
+			}
+			return c.Status(500).JSON(fiber.Map{"error": "failed to verify ipid existence", "detail": err.Error()})
+		}
+		var group []int64
+		if err := tx.Select(&group, `SELECT ipid_id FROM info_project_item_detail WHERE ref_id = ? AND ipid_type = ? ORDER BY ipid_id FOR UPDATE`, item.RefID, item.IpidType.String); err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "failed to lock item group", "ipid_id": id, "detail": err.Error()})
+		}
+
+		// guard errors are raised before anything is written, so the item is just skipped
+		out, err := decideApproval(tx, id, body.UpdatedBy, decision, body.Note, now)
+		switch {
+		case errors.Is(err, errApprovalNotAuthorized):
+			results = append(results, bulkApprovalResult{IpidID: id, Result: bulkNotAuthorized})
+			continue
+		case errors.Is(err, errApprovalNoAction), errors.Is(err, errApprovalInvalid):
+			results = append(results, bulkApprovalResult{IpidID: id, Result: bulkAlreadyActioned})
+			continue
+		case err != nil:
+			return c.Status(500).JSON(fiber.Map{"error": "failed to update approval status", "ipid_id": id, "detail": err.Error()})
+		}
+		if err := signApproval(tx, out, now); err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "failed to sign approval", "ipid_id": id, "detail": err.Error()})
+		}
+		outcomes = append(outcomes, out)
+		results = append(results, bulkApprovalResult{IpidID: id, Result: bulkSuccess, Stage: out.Stage, NextStage: out.NextStage, Completed: out.Completed})
+
+		// the same decision applies to the other items of this ref_id waiting on the same stage
+		siblings, err := decideItemGroup(tx, group, id, item.RefID, item.IpidType.String, body.UpdatedBy, decision, body.Note, now)
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "failed to update approval status", "ipid_id": id, "detail": err.Error()})
+		}
+		for _, sib := range siblings {
+			bySibling[sib.IpidID] = sib
+		}
+		outcomes = append(outcomes, siblings...)
+	}
+
+	if len(outcomes) > 0 {
+		if err := notifyBulkApproval(tx, outcomes, body.UpdatedBy, body.Note, now); err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "queue notification failed", "detail": err.Error()})
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "commit error", "detail": err.Error()})
+	}
+	decided := make([]int64, 0, len(outcomes))
+	for _, o := range outcomes {
+		decided = append(decided, o.IpidID)
+	}
+	publishItemEvents(db, streamItemStatus, decided, body.UpdatedBy)
+
+	summary := map[string]int{bulkSuccess: 0, bulkAlreadyActioned: 0, bulkNotAuthorized: 0, bulkNotFound: 0}
+	for _, r := range results {
+		summary[r.Result]++
+	}
+	return c.Status(200).JSON(fiber.Map{"results": results, "summary": summary})
+}
+
+// notifyBulkApproval queues one mail per owner (final decisions) and one per approver who got new items
+func notifyBulkApproval(tx *sqlx.Tx, outcomes []approvalOutcome, updatedBy, note string, now time.Time) error {
+	ids := make([]int64, 0, len(outcomes))
+	for _, o := range outcomes {
+		ids = append(ids, o.IpidID)
+	}
+	q, args, err := sqlx.In(`SELECT pid.ipid_id, ip.ip_id, ip.ip_code, ip.ip_part_no,
+			COALESCE(ai.iai_name, pi.ipi_name) AS item_name, pid.ipid_type AS item_type, pid.su_id, pid.sd_id
+		FROM info_project_item_detail pid
+		LEFT JOIN info_apqp_item ai ON ai.iai_id = pid.ref_id AND pid.ipid_type = 'apqp'
+		LEFT JOIN info_ppap_item pi ON pi.ipi_id = pid.ref_id AND pid.ipid_type = 'ppap'
+		LEFT JOIN info_project ip ON ip.ip_id = COALESCE(ai.ip_id, pi.ip_id)
+		WHERE pid.ipid_id IN (?)`, ids)
+	if err != nil {
+		return err
+	}
+	var rows []approvalMailItem
+	if err := tx.Select(&rows, tx.Rebind(q), args...); err != nil {
+		return err
+	}
+	byID := map[int64]approvalMailItem{}
+	for _, r := range rows {
+		byID[r.IpidID] = r
+	}
+
+	ownerItems := map[int64][]approvalMailItem{}
+	approverItems := map[int64][]approvalMailItem{}
+	queued := map[[2]int64]bool{} // approver, ipid_id
+	addApprover := func(su int64, it approvalMailItem) {
+		if !queued[[2]int64{su, it.IpidID}] {
+			queued[[2]int64{su, it.IpidID}] = true
+			approverItems[su] = append(approverItems[su], it)
+		}
+	}
+	// department channels get the rejects and the items waiting for the next approver
+	deptRejected := map[int64][]approvalMailItem{}
+	deptWaiting := map[int64][]approvalMailItem{}
+	for _, o := range outcomes {
+		it, ok := byID[o.IpidID]
+		if !ok {
+			continue
+		}
+		switch {
+		case o.Rejected:
+			it.Status = "Rejected"
+		case o.Completed:
+			it.Status = "Approved"
+		default:
+			it.Status = "Approved - waiting " + o.NextStage
+			if o.NextStage == "" {
+				it.Status = "Approved - waiting next approver"
+			}
+			// the next approvers and whoever stands in for them today
+			for _, su := range o.Approvers {
+				addApprover(su, it)
+				delegates, err := activeDelegates(tx, su, it.SdID)
+				if err != nil {
+					return err
+				}
+				for _, d := range delegates {
+					addApprover(d, it)
+				}
+			}
+		}
+		if (o.Rejected || o.Completed) && o.OnBehalf != 0 {
+			it.Status += " on behalf of " + onBehalfName(tx, o.OnBehalf)
+		}
+		if (o.Rejected || o.Completed) && it.OwnerSuID.Valid {
+			ownerItems[it.OwnerSuID.Int64] = append(ownerItems[it.OwnerSuID.Int64], it)
+		}
+		if it.SdID.Valid {
+			switch {
+			case o.Rejected:
+				deptRejected[it.SdID.Int64] = append(deptRejected[it.SdID.Int64], it)
+			case !o.Completed:
+				deptWaiting[it.SdID.Int64] = append(deptWaiting[it.SdID.Int64], it)
+			}
+		}
+	}
+
+	actorName := updatedBy
+	var first, last sql.NullString
+	if err := tx.QueryRow(`SELECT su_firstname, su_lastname FROM sys_user `+actorMatch, updatedBy, updatedBy, updatedBy).Scan(&first, &last); err == nil {
+		actorName = strings.TrimSpace(getStringValue(first) + " " + getStringValue(last))
+	}
+
+	for su, items := range ownerItems {
+		data := mailData{ActorName: actorName, Note: strings.TrimSpace(note)}
+		if err := queueApprovalListMail(tx, su, mailApprovalResult, data, items, now); err != nil {
+			return err
+		}
+	}
+	for su, items := range approverItems {
+		if err := queueApprovalListMail(tx, su, mailWaitingApproval, mailData{}, items, now); err != nil {
+			return err
+		}
+	}
+	for sd, items := range deptRejected {
+		data := mailData{ActorName: actorName, Note: strings.TrimSpace(note), Items: approvalMailItems(items)}
+		if err := notifyDepartment(tx, sd, mailItemRejected, data, now); err != nil {
+			return err
+		}
+	}
+	for sd, items := range deptWaiting {
+		if err := notifyDepartment(tx, sd, mailWaitingApproval, mailData{Items: approvalMailItems(items)}, now); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// approvalMailItems converts the item rows to the rows of the mail table
+func approvalMailItems(items []approvalMailItem) []mailItem {
+	res := make([]mailItem, 0, len(items))
+	for _, it := range items {
+		res = append(res, mailItem{
+			IpID:        it.IpID.Int64,
+			ProjectCode: getStringValue(it.ProjectCode),
+			PartNo:      getStringValue(it.PartNo),
+			Name:        getStringValue(it.ItemName),
+			Type:        getStringValue(it.ItemType),
+			Status:      it.Status,
+		})
+	}
+	return res
+}
+
+// queueApprovalListMail queues a consolidated item list to one user
+func queueApprovalListMail(q sqlx.Ext, suID int64, key string, data mailData, items []approvalMailItem, now time.Time) error {
+	var u struct {
+		Email     sql.NullString `db:"su_email"`
+		FirstName sql.NullString `db:"su_firstname"`
+	}
+	if err := sqlx.Get(q, &u, `SELECT su_email, su_firstname FROM sys_user WHERE su_id = ? AND su_status = 'active' AND su_email IS NOT NULL AND su_email <> '' LIMIT 1`, suID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+		return err
+	}
+
+	data.RecipientName = getStringValue(u.FirstName)
+	data.ShowProjectColumns, data.ShowStatus = true, true
+	data.Items = approvalMailItems(items)
+	return notifyUser(q, u.Email.String, key, data, now)
+}
@@ -0,0 +1,521 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// approval statuses stored in info_approval.ia_status (always lowercase)
+const (
+	approvalWaiting = "waiting"
+	approvalApprove = "approve"
+	approvalReject  = "reject"
+	approvalSkip    = "skip" // level already passed without this approver
+)
+
+// level rules for sys_workflow_rule.swr_rule
+const (
+	workflowRuleAny  = "any"
+	workflowRuleAll  = "all"
+	workflowRuleNofM = "n_of_m"
+)
+
+// built-in stage types (info_approval.ia_type)
+const (
+	approvalStageLeader = "Leader"
+	approvalStagePJ     = "PJ"
+)
+
+// approver sources for sys_approval_stage.sas_source
+const (
+	stageSourceWorkflow = "workflow"
+	stageSourceCreator  = "creator"
+	stageSourceUser     = "user"
+)
+
+var (
+	errApprovalNoAction      = errors.New("no pending approval for this item")
+	errApprovalNotAuthorized = errors.New("user is not the assigned approver")
+	errApprovalInvalid       = errors.New("invalid approval transition")
+)
+
+// approvalTransitions lists the allowed ia_status changes
+var approvalTransitions = map[string]map[string]bool{
+	approvalWaiting: {approvalApprove: true, approvalReject: true},
+}
+
+// approvalStage is one step of the approval chain
+type approvalStage struct {
+	Order    int64          `db:"sas_order"`
+	Type     string         `db:"sas_type"`
+	Source   string         `db:"sas_source"`
+	SuID     sql.NullInt64  `db:"su_id"`
+	SdID     sql.NullInt64  `db:"sd_id"`
+	ItemType sql.NullString `db:"sas_item_type"`
+}
+
+// defaultApprovalStages is used when sys_approval_stage has no matching rows
+var defaultApprovalStages = []approvalStage{
+	{Order: 1, Type: approvalStageLeader, Source: stageSourceWorkflow},
+	{Order: 2, Type: approvalStagePJ, Source: stageSourceCreator},
+}
+
+// approvalItem is the item context needed to build / move the approval chain
+type approvalItem struct {
+	IpidID    int64          `db:"ipid_id"`
+	RefID     int64          `db:"ref_id"`
+	IpidType  sql.NullString `db:"ipid_type"`
+	CreatedBy sql.NullString `db:"ipid_created_by"`
+	OwnerSuID sql.NullInt64  `db:"su_id"`
+	OwnerSdID sql.NullInt64  `db:"owner_sd_id"`
+	ItemSdID  sql.NullInt64  `db:"item_sd_id"`
+}
+
+// approvalRow is a row of info_approval
+type approvalRow struct {
+	IaID     int64          `db:"ia_id"`
+	SuID     sql.NullInt64  `db:"su_id"`
+	Level    sql.NullInt64  `db:"ia_level"`
+	Status   sql.NullString `db:"ia_status"`
+	Type     sql.NullString `db:"ia_type"`
+	Stage    sql.NullInt64  `db:"ia_stage_order"`
+	Round    sql.NullInt64  `db:"ia_round"`
+	IsAction int64          `db:"ia_is_action"`
+}
+
+// stageApprover is one approver row to create for a stage
+type stageApprover struct {
+	SuID  int64 `db:"su_id"`
+	Level int64 `db:"sw_order"`
+}
+
+// approvalOutcome describes what a decision did to the chain
+type approvalOutcome struct {
+	IpidID    int64
+	IaID      int64 // row the decision was written to
+	Stage     string
+	Decision  string
+	NextStage string  // stage opened by this decision ("" if none)
+	Approvers []int64 // su_id now holding the action
+	Completed bool    // every stage approved -> ipid done
+	Rejected  bool
+	OnBehalf  int64 // su_id the actor acted for (delegation), 0 if own row
+}
+
+// normalizeApprovalStatus maps UI values ("done", "Approve", "rejected") to ia_status values
+func normalizeApprovalStatus(s string) string {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "done", "approve", "approved":
+		return approvalApprove
+	case "reject", "rejected":
+		return approvalReject
+	case "waiting":
+		return approvalWaiting
+	}
+	return ""
+}
+
+func loadApprovalItem(q sqlx.Queryer, ipidID int64) (approvalItem, error) {
+	var it approvalItem
+	err := sqlx.Get(q, &it, `SELECT pid.ipid_id, pid.ref_id, pid.ipid_type, pid.ipid_created_by, pid.su_id, su.sd_id AS owner_sd_id, pid.sd_id AS item_sd_id
+		FROM info_project_item_detail pid
+		LEFT JOIN sys_user su ON su.su_id = pid.su_id
+		WHERE pid.ipid_id = ? LIMIT 1`, ipidID)
+	return it, err
+}
+
+// loadApprovalStages returns the most specific stage list for a department and item type
+func loadApprovalStages(q sqlx.Queryer, sdID sql.NullInt64, itemType string) ([]approvalStage, error) {
+	var rows []approvalStage
+	err := sqlx.Select(q, &rows, `SELECT sas_order, sas_type, sas_source, su_id, sd_id, sas_item_type
+		FROM sys_approval_stage
+		WHERE sas_status = 'active'
+		  AND (sd_id = ? OR sd_id IS NULL)
+		  AND (sas_item_type = ? OR sas_item_type IS NULL)
+		ORDER BY sas_order ASC`, sdID, itemType)
+	if err != nil {
+		return nil, err
+	}
+
+	// department+type > department > type > global
+	score := func(s approvalStage) int {
+		n := 0
+		if s.SdID.Valid {
+			n += 2
+		}
+		if s.ItemType.Valid {
+			n++
+		}
+		return n
+	}
+	best := -1
+	for _, r := range rows {
+		if sc := score(r); sc > best {
+			best = sc
+		}
+	}
+	var stages []approvalStage
+	for _, r := range rows {
+		if score(r) == best {
+			stages = append(stages, r)
+		}
+	}
+	if len(stages) == 0 {
+		return defaultApprovalStages, nil
+	}
+	return stages, nil
+}
+
+// resolveStageApprovers returns the approvers of a stage ordered by level
+func resolveStageApprovers(q sqlx.Queryer, stage approvalStage, it approvalItem) ([]stageApprover, error) {
+	var list []stageApprover
+	switch stage.Source {
+	case stageSourceWorkflow:
+		if !it.OwnerSdID.Valid {
+			return nil, nil
+		}
+		err := sqlx.Select(q, &list, `SELECT su_id, sw_order FROM sys_workflow
+			WHERE sd_id = ? AND sw_status = 'active' AND su_id IS NOT NULL AND sw_order IS NOT NULL
+			ORDER BY sw_order ASC`, it.OwnerSdID.Int64)
+		return list, err
+	case stageSourceCreator:
+		var suID int64
+		err := sqlx.Get(q, &suID, `SELECT su_id FROM sys_user WHERE su_emp_code = ? AND su_status = 'active' LIMIT 1`, it.CreatedBy)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		return []stageApprover{{SuID: suID, Level: 1}}, nil
+	case stageSourceUser:
+		if !stage.SuID.Valid {
+			return nil, nil
+		}
+		return []stageApprover{{SuID: stage.SuID.Int64, Level: 1}}, nil
+	}
+	return nil, nil
+}
+
+// openApprovalStage inserts the approvers of stages[from:] starting at the first stage that has approvers.
+// Returns the opened stage type and the su_id holding the action.
+func openApprovalStage(tx *sqlx.Tx, it approvalItem, stages []approvalStage, from int, round int64, actor string, now time.Time) (string, []int64, error) {
+	for i := from; i < len(stages); i++ {
+		approvers, err := resolveStageApprovers(tx, stages[i], it)
+		if err != nil {
+			return "", nil, err
+		}
+		if len(approvers) == 0 {
+			continue
+		}
+		var actionSu []int64
+		for _, a := range approvers {
+			isAction := 0
+			if a.Level == approvers[0].Level {
+				isAction = 1
+				actionSu = append(actionSu, a.SuID)
+			}
+			if _, err := tx.Exec(`INSERT INTO info_approval (ipid_id, su_id, ia_level, ia_status, ia_is_action, ia_round, ia_created_at, ia_created_by, ia_updated_at, ia_updated_by, ia_status_flg, ia_type, ia_stage_order) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+				it.IpidID, a.SuID, a.Level, approvalWaiting, isAction, round, now, actor, now, actor, "active", stages[i].Type, stages[i].Order); err != nil {
+				return "", nil, err
+			}
+		}
+		return stages[i].Type, actionSu, nil
+	}
+	return "", nil, nil
+}
+
+// startApproval archives the current chain of an item (decision times are kept for the timeline) and opens the first configured stage
+// in a new round (1 = first submission, +1 on every resubmission)
+func startApproval(tx *sqlx.Tx, ipidID int64, actor string, now time.Time) (int64, string, []int64, error) {
+	it, err := loadApprovalItem(tx, ipidID)
+	if err != nil {
+		return 0, "", nil, err
+	}
+	var round int64
+	if err := tx.Get(&round, `SELECT GREATEST(
+			COALESCE((SELECT MAX(ia_round) FROM info_approval WHERE ipid_id = ?), 0),
+			COALESCE((SELECT MAX(itfh_round) FROM info_tracking_file_history WHERE ipid_id = ?), 0)
+		) + 1`, ipidID, ipidID); err != nil {
+		return 0, "", nil, err
+	}
+	if _, err := tx.Exec(`UPDATE info_approval SET ia_status_flg = 'inactive', ia_is_action = 0 WHERE ipid_id = ? AND ia_status_flg = 'active'`, ipidID); err != nil {
+		return 0, "", nil, err
+	}
+	stages, err := loadApprovalStages(tx, it.OwnerSdID, it.IpidType.String)
+	if err != nil {
+		return 0, "", nil, err
+	}
+	stage, approvers, err := openApprovalStage(tx, it, stages, 0, round, actor, now)
+	return round, stage, approvers, err
+}
+
+// actorMatch finds the user of updated_by (emp code or su_id); an emp code match wins over a su_id match,
+// so a numeric emp code never resolves to the user whose su_id it happens to equal (args: actor x3)
+const actorMatch = `WHERE su_emp_code = ? OR su_id = CAST(? AS UNSIGNED) ORDER BY su_emp_code = ? DESC LIMIT 1`
+
+// resolveActorSuID maps updated_by (emp code or su_id) to su_id
+func resolveActorSuID(q sqlx.Queryer, actor string) (int64, error) {
+	var suID int64
+	err := sqlx.Get(q, &suID, `SELECT su_id FROM sys_user `+actorMatch, actor, actor, actor)
+	return suID, err
+}
+
+// decideApproval applies approve/reject by actor on the actor's action row of an item.
+// Rows at the same ia_level are evaluated together using the level rule (any / all / n_of_m).
+func decideApproval(tx *sqlx.Tx, ipidID int64, actor, decision, note string, now time.Time) (approvalOutcome, error) {
+	out := approvalOutcome{IpidID: ipidID, Decision: normalizeApprovalStatus(decision)}
+
+	var actions []approvalRow
+	if err := tx.Select(&actions, `SELECT ia_id, su_id, ia_level, ia_status, ia_type, ia_stage_order, ia_round, ia_is_action FROM info_approval
+		WHERE ipid_id = ? AND ia_is_action = 1 AND ia_status_flg = 'active'
+		ORDER BY ia_level ASC, ia_id ASC FOR UPDATE`, ipidID); err != nil {
+		return out, err
+	}
+	if len(actions) == 0 {
+		return out, errApprovalNoAction
+	}
+
+	// guards: assigned approver + allowed transition
+	actorSu, err := resolveActorSuID(tx, actor)
+	if errors.Is(err, sql.ErrNoRows) {
+		return out, errApprovalNotAuthorized
+	}
+	if err != nil {
+		return out, err
+	}
+	it, err := loadApprovalItem(tx, ipidID)
+	if err != nil {
+		return out, err
+	}
+	var curr *approvalRow
+	for i := range actions {
+		if actions[i].SuID.Valid && actions[i].SuID.Int64 == actorSu {
+			curr = &actions[i]
+			break
+		}
+	}
+	// not assigned: allowed when the assigned approver delegated to the actor
+	if curr == nil {
+		for i := range actions {
+			if !actions[i].SuID.Valid {
+				continue
+			}
+			ok, err := isDelegateOf(tx, actions[i].SuID.Int64, actorSu, it.ItemSdID)
+			if err != nil {
+				return out, err
+			}
+			if ok {
+				curr = &actions[i]
+				out.OnBehalf = actions[i].SuID.Int64
+				break
+			}
+		}
+	}
+	if curr == nil {
+		return out, errApprovalNotAuthorized
+	}
+	out.Stage = curr.Type.String
+	out.IaID = curr.IaID
+	if !approvalTransitions[normalizeApprovalStatus(curr.Status.String)][out.Decision] {
+		return out, errApprovalInvalid
+	}
+	stages, err := loadApprovalStages(tx, it.OwnerSdID, it.IpidType.String)
+	if err != nil {
+		return out, err
+	}
+
+	if _, err := tx.Exec(`UPDATE info_approval SET ia_status = ?, ia_note = ?, ia_action_su_id = ?, ia_updated_at = ?, ia_updated_by = ? WHERE ia_id = ?`,
+		out.Decision, note, actorSu, now, actor, curr.IaID); err != nil {
+		return out, err
+	}
+
+	// evaluate the level
+	var tally struct {
+		Total    int `db:"total"`
+		Approved int `db:"approved"`
+		Waiting  int `db:"waiting"`
+	}
+	if err := tx.Get(&tally, `SELECT COALESCE(SUM(ia_status IN ('waiting', 'approve', 'reject')), 0) AS total,
+			COALESCE(SUM(ia_status = 'approve'), 0) AS approved,
+			COALESCE(SUM(ia_status = 'waiting'), 0) AS waiting
+		FROM info_approval
+		WHERE ipid_id = ? AND ia_type = ? AND ia_stage_order <=> ? AND ia_level <=> ? AND ia_status_flg = 'active'`,
+		ipidID, curr.Type.String, curr.Stage, curr.Level); err != nil {
+		return out, err
+	}
+	stageIdx := currentStageIndex(stages, *curr)
+	rule, quorum, err := approvalLevelRule(tx, it, stageIdx >= 0 && stages[stageIdx].Source == stageSourceWorkflow, curr.Level)
+	if err != nil {
+		return out, err
+	}
+	required := requiredApprovals(rule, quorum, tally.Total)
+
+	// the deciding row keeps the action only when it closes the chain
+	releaseLevel := func(keep int64) error {
+		_, err := tx.Exec(`UPDATE info_approval SET ia_is_action = 0 WHERE ipid_id = ? AND ia_type = ? AND ia_stage_order <=> ? AND ia_level <=> ? AND ia_status_flg = 'active' AND ia_id <> ?`,
+			ipidID, curr.Type.String, curr.Stage, curr.Level, keep)
+		return err
+	}
+
+	if out.Decision == approvalReject {
+		if tally.Approved+tally.Waiting >= required {
+			// level can still pass
+			_, err := tx.Exec(`UPDATE info_approval SET ia_is_action = 0 WHERE ia_id = ?`, curr.IaID)
+			return out, err
+		}
+		if _, err := tx.Exec(`UPDATE info_approval SET ia_status = ?, ia_note = ?, ia_updated_at = ?, ia_updated_by = ? WHERE ipid_id = ? AND ia_status = 'waiting' AND ia_status_flg = 'active'`,
+			approvalReject, note, now, actor, ipidID); err != nil {
+			return out, err
+		}
+		if err := releaseLevel(curr.IaID); err != nil {
+			return out, err
+		}
+		out.Rejected = true
+		return out, setItemGroupStatus(tx, it, approvalReject, actor, now)
+	}
+
+	if tally.Approved < required {
+		_, err := tx.Exec(`UPDATE info_approval SET ia_is_action = 0 WHERE ia_id = ?`, curr.IaID)
+		return out, err
+	}
+
+	// level passed: approvers not needed anymore are skipped
+	if _, err := tx.Exec(`UPDATE info_approval SET ia_status = ?, ia_updated_at = ?, ia_updated_by = ? WHERE ipid_id = ? AND ia_type = ? AND ia_stage_order <=> ? AND ia_level <=> ? AND ia_status = 'waiting' AND ia_status_flg = 'active'`,
+		approvalSkip, now, actor, ipidID, curr.Type.String, curr.Stage, curr.Level); err != nil {
+		return out, err
+	}
+
+	// next level of the same stage
+	var nextLevel sql.NullInt64
+	if err := tx.Get(&nextLevel, `SELECT MIN(ia_level) FROM info_approval WHERE ipid_id = ? AND ia_type = ? AND ia_stage_order <=> ? AND ia_status = 'waiting' AND ia_status_flg = 'active'`,
+		ipidID, curr.Type.String, curr.Stage); err != nil {
+		return out, err
+	}
+	if nextLevel.Valid {
+		if err := releaseLevel(0); err != nil {
+			return out, err
+		}
+		if _, err := tx.Exec(`UPDATE info_approval SET ia_is_action = 1, ia_updated_at = ?, ia_updated_by = ? WHERE ipid_id = ? AND ia_type = ? AND ia_stage_order <=> ? AND ia_level = ? AND ia_status = 'waiting' AND ia_status_flg = 'active'`,
+			now, actor, ipidID, curr.Type.String, curr.Stage, nextLevel.Int64); err != nil {
+			return out, err
+		}
+		if err := tx.Select(&out.Approvers, `SELECT su_id FROM info_approval WHERE ipid_id = ? AND ia_type = ? AND ia_stage_order <=> ? AND ia_level = ? AND ia_is_action = 1 AND ia_status_flg = 'active'`,
+			ipidID, curr.Type.String, curr.Stage, nextLevel.Int64); err != nil {
+			return out, err
+		}
+		return out, nil
+	}
+
+	// stage finished: open the next configured stage
+	next, approvers, err := openApprovalStage(tx, it, stages, nextStageIndex(stages, *curr), curr.Round.Int64, actor, now)
+	if err != nil {
+		return out, err
+	}
+	if next != "" {
+		if err := releaseLevel(0); err != nil {
+			return out, err
+		}
+		out.NextStage = next
+		out.Approvers = approvers
+		return out, nil
+	}
+
+	// last stage approved -> the deciding row keeps the action, item is done
+	if err := releaseLevel(curr.IaID); err != nil {
+		return out, err
+	}
+	out.Completed = true
+	return out, setItemGroupStatus(tx, it, "done", actor, now)
+}
+
+// currentStageIndex finds the stage of an approval row by sas_order (-1 when the stage is gone);
+// rows without ia_stage_order (written before it existed) are matched by ia_type
+func currentStageIndex(stages []approvalStage, row approvalRow) int {
+	for i, st := range stages {
+		if (row.Stage.Valid && st.Order == row.Stage.Int64) || (!row.Stage.Valid && strings.EqualFold(st.Type, row.Type.String)) {
+			return i
+		}
+	}
+	return -1
+}
+
+// nextStageIndex is where the chain continues after the stage of row: the stage after it, or the first
+// stage ordered after it when its stage was removed meanwhile (len(stages) = none left)
+func nextStageIndex(stages []approvalStage, row approvalRow) int {
+	if i := currentStageIndex(stages, row); i >= 0 {
+		return i + 1
+	}
+	if row.Stage.Valid {
+		for i, st := range stages {
+			if st.Order > row.Stage.Int64 {
+				return i
+			}
+		}
+	}
+	return len(stages)
+}
+
+// approvalLevelRule returns the rule for a level; only workflow stages can have rules (default all-of)
+func approvalLevelRule(q sqlx.Queryer, it approvalItem, workflow bool, level sql.NullInt64) (string, int, error) {
+	if !workflow || !it.OwnerSdID.Valid || !level.Valid {
+		return workflowRuleAll, 0, nil
+	}
+	var r struct {
+		Rule   string        `db:"swr_rule"`
+		Quorum sql.NullInt64 `db:"swr_quorum"`
+	}
+	err := sqlx.Get(q, &r, `SELECT swr_rule, swr_quorum FROM sys_workflow_rule WHERE sd_id = ? AND sw_order = ? AND swr_status = 'active' LIMIT 1`,
+		it.OwnerSdID.Int64, level.Int64)
+	if errors.Is(err, sql.ErrNoRows) {
+		return workflowRuleAll, 0, nil
+	}
+	if err != nil {
+		return "", 0, err
+	}
+	return r.Rule, int(r.Quorum.Int64), nil
+}
+
+// requiredApprovals is how many approvals a level of total approvers needs
+func requiredApprovals(rule string, quorum, total int) int {
+	switch rule {
+	case workflowRuleAny:
+		return 1
+	case workflowRuleNofM:
+		if quorum < 1 {
+			return 1
+		}
+		if quorum > total {
+			return total
+		}
+		return quorum
+	}
+	return total
+}
+
+// setItemGroupStatus updates every ipid that shares ref_id + ipid_type with the item
+func setItemGroupStatus(tx *sqlx.Tx, it approvalItem, status, actor string, now time.Time) error {
+	if err := recordItemGroupStatus(tx, it.IpidID, status, statusSourceApproval, actor, now); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`UPDATE info_project_item_detail SET ipid_status = ?, ipid_updated_at = ?, ipid_updated_by = ? WHERE ref_id = ? AND ipid_type = ?`,
+		status, now, actor, it.RefID, it.IpidType.String); err != nil {
+		return err
+	}
+	return recordItemGroupActual(tx, it.IpidID, status, now)
+}
+
+// approvalErrorStatus maps engine errors to HTTP status codes
+func approvalErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, errApprovalNotAuthorized):
+		return 403
+	case errors.Is(err, errApprovalNoAction), errors.Is(err, errApprovalInvalid):
+		return 409
+	}
+	return 500
+}
@@ -0,0 +1,40 @@
+package handlers
+
+import (
+	"database/sql"
+	"testing"
+)
+
+func TestNextStageIndex(t *testing.T) {
+	// two Leader stages: the department leaders, then a fixed quality leader
+	stages := []approvalStage{
+		{Order: 1, Type: approvalStageLeader, Source: stageSourceWorkflow},
+		{Order: 3, Type: approvalStageLeader, Source: stageSourceUser},
+		{Order: 5, Type: approvalStagePJ, Source: stageSourceCreator},
+	}
+	row := func(order int64, typ string) approvalRow {
+		return approvalRow{Stage: sql.NullInt64{Int64: order, Valid: order > 0}, Type: sql.NullString{String: typ, Valid: true}}
+	}
+	tests := []struct {
+		name string
+		row  approvalRow
+		curr int
+		next int
+	}{
+		{"first leader stage", row(1, approvalStageLeader), 0, 1},
+		{"second leader stage moves on to PJ", row(3, approvalStageLeader), 1, 2},
+		{"last stage", row(5, approvalStagePJ), 2, 3},
+		{"removed stage continues after its order", row(2, approvalStageLeader), -1, 1},
+		{"removed last stage", row(9, approvalStagePJ), -1, 3},
+		{"legacy row matched by type", row(0, approvalStagePJ), 2, 3},
+		{"legacy row of an unknown type", row(0, "QA"), -1, 3},
+	}
+	for _, tt := range tests {
+		if got := currentStageIndex(stages, tt.row); got != tt.curr {
+			t.Errorf("%s: currentStageIndex = %d, want %d", tt.name, got, tt.curr)
+		}
+		if got := nextStageIndex(stages, tt.row); got != tt.next {
+			t.Errorf("%s: nextStageIndex = %d, want %d", tt.name, got, tt.next)
+		}
+	}
+}
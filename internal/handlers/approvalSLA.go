@@ -0,0 +1,401 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"apiTrackingSystem/internal/utils"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jmoiron/sqlx"
+)
+
+// approval event types (info_approval_event.iae_type)
+const (
+	approvalEventRemind   = "remind"
+	approvalEventEscalate = "escalate"
+)
+
+// approvalEscalated marks a row whose action was handed to another user
+const approvalEscalated = "escalated"
+
+// errApprovalSettled: the row was decided or escalated while the SLA job was running
+var errApprovalSettled = errors.New("approval row no longer waiting")
+
+// slaRule is the SLA of one workflow (sys_workflow_sla)
+type slaRule struct {
+	SdID         sql.NullInt64  `db:"sd_id"`
+	IaType       sql.NullString `db:"ia_type"`
+	RemindDays   int            `db:"sws_remind_days"`
+	EscalateDays int            `db:"sws_escalate_days"`
+}
+
+// pendingApproval is a waiting action row checked by the SLA job
+type pendingApproval struct {
+	IaID      int64          `db:"ia_id"`
+	IpidID    int64          `db:"ipid_id"`
+	SuID      sql.NullInt64  `db:"su_id"`
+	Level     sql.NullInt64  `db:"ia_level"`
+	Type      sql.NullString `db:"ia_type"`
+	Stage     sql.NullInt64  `db:"ia_stage_order"`
+	Round     sql.NullInt64  `db:"ia_round"`
+	Since     time.Time      `db:"since"`
+	OwnerSdID sql.NullInt64  `db:"owner_sd_id"`
+	ItemSdID  sql.NullInt64  `db:"item_sd_id"`
+	McID      sql.NullInt64  `db:"mc_id"` // calendar of the project
+	Reminded  int            `db:"reminded"`
+}
+
+// slaResult is the summary of one SLA run
+type slaResult struct {
+	Checked   int      `json:"checked"`
+	Reminded  int      `json:"reminded"`
+	Escalated int      `json:"escalated"`
+	Errors    []string `json:"errors"`
+}
+
+// StartApprovalSLAScheduler checks approval SLAs every APPROVAL_SLA_INTERVAL (default 1h, "off" disables)
+func StartApprovalSLAScheduler(db *sqlx.DB) {
+	raw := strings.TrimSpace(os.Getenv("APPROVAL_SLA_INTERVAL"))
+	if strings.EqualFold(raw, "off") || raw == "0" {
+		log.Printf("approval SLA scheduler disabled")
+		return
+	}
+	interval := time.Hour
+	if raw != "" {
+		d, err := time.ParseDuration(raw)
+		if err != nil || d < time.Minute {
+			log.Printf("approval SLA scheduler: invalid APPROVAL_SLA_INTERVAL %q, using 1h", raw)
+		} else {
+			interval = d
+		}
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			res := runApprovalSLA(db, time.Now())
+			if res.Reminded > 0 || res.Escalated > 0 || len(res.Errors) > 0 {
+				log.Printf("approval SLA: checked=%d reminded=%d escalated=%d errors=%d", res.Checked, res.Reminded, res.Escalated, len(res.Errors))
+			}
+			<-ticker.C
+		}
+	}()
+}
+
+// RunApprovalSLA runs the SLA check once (manual trigger)
+func RunApprovalSLA(c *fiber.Ctx, db *sqlx.DB) error {
+	return c.Status(200).JSON(runApprovalSLA(db, time.Now()))
+}
+
+func runApprovalSLA(db *sqlx.DB, now time.Time) slaResult {
+	res := slaResult{Errors: []string{}}
+
+	var rows []pendingApproval
+	if err := db.Select(&rows, `SELECT ia.ia_id, ia.ipid_id, ia.su_id, ia.ia_level, ia.ia_type, ia.ia_stage_order, ia.ia_round,
+			COALESCE(ia.ia_updated_at, ia.ia_created_at) AS since,
+			su.sd_id AS owner_sd_id, pid.sd_id AS item_sd_id, ip.mc_id,
+			(SELECT COUNT(*) FROM info_approval_event e WHERE e.ia_id = ia.ia_id AND e.iae_type = 'remind') AS reminded
+		FROM info_approval ia
+		JOIN info_project_item_detail pid ON pid.ipid_id = ia.ipid_id
+		LEFT JOIN info_apqp_item ai ON ai.iai_id = pid.ref_id AND pid.ipid_type = 'apqp'
+		LEFT JOIN info_ppap_item pi ON pi.ipi_id = pid.ref_id AND pid.ipid_type = 'ppap'
+		LEFT JOIN info_project ip ON ip.ip_id = COALESCE(ai.ip_id, pi.ip_id)
+		LEFT JOIN sys_user su ON su.su_id = pid.su_id
+		WHERE ia.ia_status = 'waiting' AND ia.ia_is_action = 1 AND ia.ia_status_flg = 'active'
+		ORDER BY since ASC`); err != nil {
+		res.Errors = append(res.Errors, "query pending approvals: "+err.Error())
+		return res
+	}
+	res.Checked = len(rows)
+	if len(rows) == 0 {
+		return res
+	}
+
+	var rules []slaRule
+	if err := db.Select(&rules, `SELECT sd_id, ia_type, sws_remind_days, sws_escalate_days FROM sys_workflow_sla WHERE sws_status = 'active'`); err != nil {
+		res.Errors = append(res.Errors, "query sla: "+err.Error())
+		return res
+	}
+
+	// working days are counted on the calendar of each project (mc_id 0 = default calendar)
+	calendars := map[int64]*workCalendar{}
+	for _, r := range rows {
+		rule, ok := matchSLARule(rules, r.OwnerSdID, r.Type.String)
+		if !ok {
+			continue
+		}
+		cal, ok := calendars[r.McID.Int64]
+		if !ok {
+			var err error
+			if cal, err = loadCalendar(db, r.McID.Int64); err != nil {
+				res.Errors = append(res.Errors, "query calendar: "+err.Error())
+				return res
+			}
+			calendars[r.McID.Int64] = cal
+		}
+		days := cal.WorkingDaysBetween(r.Since, now)
+		if rule.EscalateDays > 0 && days >= rule.EscalateDays {
+			done, err := escalateApproval(db, r, days, now)
+			if errors.Is(err, errApprovalSettled) {
+				continue
+			}
+			if err != nil {
+				res.Errors = append(res.Errors, err.Error())
+				continue
+			}
+			if done {
+				res.Escalated++
+				continue
+			}
+			// nobody to escalate to: the row still gets its reminder
+		}
+		// reminders are counted per row, so an escalated row is reminded again on its own schedule
+		if rule.RemindDays > 0 && days >= rule.RemindDays && r.Reminded == 0 {
+			if err := remindApproval(db, r, days, now); err != nil {
+				res.Errors = append(res.Errors, err.Error())
+			} else {
+				res.Reminded++
+			}
+		}
+	}
+	return res
+}
+
+// matchSLARule picks department+type > department > type > default
+func matchSLARule(rules []slaRule, sdID sql.NullInt64, iaType string) (slaRule, bool) {
+	best, bestScore := slaRule{}, -1
+	for _, r := range rules {
+		if r.SdID.Valid && (!sdID.Valid || r.SdID.Int64 != sdID.Int64) {
+			continue
+		}
+		if r.IaType.Valid && !strings.EqualFold(r.IaType.String, iaType) {
+			continue
+		}
+		score := 0
+		if r.SdID.Valid {
+			score += 2
+		}
+		if r.IaType.Valid {
+			score++
+		}
+		if score > bestScore {
+			best, bestScore = r, score
+		}
+	}
+	return best, bestScore >= 0
+}
+
+func insertApprovalEvent(q sqlx.Execer, iaID, ipidID int64, typ string, from, to sql.NullInt64, note string, now time.Time) error {
+	_, err := q.Exec(`INSERT INTO info_approval_event (ia_id, ipid_id, iae_type, iae_from_su_id, iae_to_su_id, iae_note, iae_created_at, iae_created_by) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		iaID, ipidID, typ, from, to, utils.NewNullString(note), now, "system")
+	return err
+}
+
+func remindApproval(db *sqlx.DB, r pendingApproval, days int, now time.Time) error {
+	tx, err := db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if err := insertApprovalEvent(tx, r.IaID, r.IpidID, approvalEventRemind, r.SuID, r.SuID, "", now); err != nil {
+		return err
+	}
+	if r.SuID.Valid {
+		if err := queueSLAMail(tx, r.SuID.Int64, r.IpidID, mailApprovalReminder, days, now); err != nil {
+			return err
+		}
+		// whoever stands in for the approver today can act on the row too
+		delegates, err := activeDelegates(tx, r.SuID.Int64, r.ItemSdID)
+		if err != nil {
+			return err
+		}
+		for _, d := range delegates {
+			if err := queueSLAMail(tx, d, r.IpidID, mailApprovalReminder, days, now); err != nil {
+				return err
+			}
+		}
+	}
+	return tx.Commit()
+}
+
+// escalateApproval hands the action to the next sw_order user, or the department head.
+// Users who already decided the item in this round or hold its action are skipped.
+func escalateApproval(db *sqlx.DB, r pendingApproval, days int, now time.Time) (bool, error) {
+	tx, err := db.Beginx()
+	if err != nil {
+		return false, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	res, err := tx.Exec(`UPDATE info_approval SET ia_status = ?, ia_is_action = 0, ia_updated_at = ?, ia_updated_by = 'system' WHERE ia_id = ? AND ia_status = 'waiting' AND ia_is_action = 1`,
+		approvalEscalated, now, r.IaID)
+	if err != nil {
+		return false, err
+	}
+	if ra, _ := res.RowsAffected(); ra == 0 {
+		return false, errApprovalSettled
+	}
+	// looked up after the row update so a parallel run cannot pick the same target
+	target, err := escalationTarget(tx, r)
+	if err != nil || !target.Valid {
+		return false, err
+	}
+	if _, err := tx.Exec(`INSERT INTO info_approval (ipid_id, su_id, ia_level, ia_status, ia_is_action, ia_round, ia_created_at, ia_created_by, ia_updated_at, ia_updated_by, ia_status_flg, ia_type, ia_stage_order) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		r.IpidID, target.Int64, r.Level, approvalWaiting, 1, r.Round.Int64, now, "system", now, "system", "active", r.Type.String, r.Stage); err != nil {
+		return false, err
+	}
+	if err := insertApprovalEvent(tx, r.IaID, r.IpidID, approvalEventEscalate, r.SuID, target, "overdue "+strconv.Itoa(days)+" working day(s)", now); err != nil {
+		return false, err
+	}
+	if err := queueSLAMail(tx, target.Int64, r.IpidID, mailApprovalEscalated, days, now); err != nil {
+		return false, err
+	}
+	if err := tx.Commit(); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// notDecidedInRound excludes users who already decided the item in the round (the escalated
+// current approver included) or already hold its action; later approvers still waiting for their
+// level stay eligible (args: ipid_id, round)
+const notDecidedInRound = ` NOT IN (SELECT su_id FROM info_approval WHERE ipid_id = ? AND COALESCE(ia_round, 0) = ? AND ia_status_flg = 'active' AND su_id IS NOT NULL
+	AND (ia_status <> 'waiting' OR ia_is_action = 1))`
+
+func escalationTarget(q sqlx.Queryer, r pendingApproval) (sql.NullInt64, error) {
+	var target sql.NullInt64
+	if r.OwnerSdID.Valid && r.Level.Valid {
+		err := sqlx.Get(q, &target, `SELECT su_id FROM sys_workflow WHERE sd_id = ? AND sw_status = 'active' AND sw_order > ? AND su_id`+notDecidedInRound+` ORDER BY sw_order ASC LIMIT 1`,
+			r.OwnerSdID.Int64, r.Level.Int64, r.IpidID, r.Round.Int64)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return target, err
+		}
+		if target.Valid {
+			return target, nil
+		}
+	}
+	sdID := r.OwnerSdID
+	if !sdID.Valid {
+		sdID = r.ItemSdID
+	}
+	if sdID.Valid {
+		err := sqlx.Get(q, &target, `SELECT sd_head_su_id FROM sys_department WHERE sd_id = ? AND sd_head_su_id IS NOT NULL AND sd_head_su_id`+notDecidedInRound+` LIMIT 1`,
+			sdID.Int64, r.IpidID, r.Round.Int64)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return target, err
+		}
+	}
+	return target, nil
+}
+
+// queueSLAMail queues a short item notice to one user
+func queueSLAMail(q sqlx.Ext, suID, ipidID int64, key string, days int, now time.Time) error {
+	var u struct {
+		Email     sql.NullString `db:"su_email"`
+		FirstName sql.NullString `db:"su_firstname"`
+	}
+	if err := sqlx.Get(q, &u, `SELECT su_email, su_firstname FROM sys_user WHERE su_id = ? AND su_status = 'active' AND su_email IS NOT NULL AND su_email <> '' LIMIT 1`, suID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+		return err
+	}
+	var d struct {
+		IpID        sql.NullInt64  `db:"ip_id"`
+		ProjectCode sql.NullString `db:"ip_code"`
+		PartNo      sql.NullString `db:"ip_part_no"`
+		ItemName    sql.NullString `db:"item_name"`
+		ItemType    sql.NullString `db:"item_type"`
+	}
+	_ = sqlx.Get(q, &d, `SELECT ip.ip_id, ip.ip_code, ip.ip_part_no, COALESCE(ai.iai_name, pi.ipi_name) AS item_name, pid.ipid_type AS item_type
+		FROM info_project_item_detail pid
+		LEFT JOIN info_apqp_item ai ON ai.iai_id = pid.ref_id AND pid.ipid_type = 'apqp'
+		LEFT JOIN info_ppap_item pi ON pi.ipi_id = pid.ref_id AND pid.ipid_type = 'ppap'
+		LEFT JOIN info_project ip ON ip.ip_id = COALESCE(ai.ip_id, pi.ip_id)
+		WHERE pid.ipid_id = ? LIMIT 1`, ipidID)
+
+	data := mailData{
+		IpID:               d.IpID.Int64,
+		IpidID:             ipidID,
+		RecipientName:      getStringValue(u.FirstName),
+		Days:               days,
+		Items:              []mailItem{{IpID: d.IpID.Int64, ProjectCode: getStringValue(d.ProjectCode), PartNo: getStringValue(d.PartNo), Name: getStringValue(d.ItemName), Type: getStringValue(d.ItemType)}},
+		ShowProjectColumns: true,
+	}
+	return notifyUser(q, u.Email.String, key, data, now)
+}
+
+// SysWorkflowSLA represents a row in sys_workflow_sla
+type SysWorkflowSLA struct {
+	ID           int64            `db:"sws_id" json:"sws_id"`
+	SdID         utils.NullInt64  `db:"sd_id" json:"sd_id"`
+	SdName       utils.NullString `db:"sd_name" json:"sd_name"`
+	IaType       utils.NullString `db:"ia_type" json:"ia_type"`
+	RemindDays   int              `db:"sws_remind_days" json:"sws_remind_days"`
+	EscalateDays int              `db:"sws_escalate_days" json:"sws_escalate_days"`
+	Status       string           `db:"sws_status" json:"sws_status"`
+	UpdatedAt    *time.Time       `db:"sws_updated_at" json:"sws_updated_at"`
+	UpdatedBy    utils.NullString `db:"sws_updated_by" json:"sws_updated_by"`
+}
+
+func ListWorkflowSLA(c *fiber.Ctx, db *sqlx.DB) error {
+	var res []SysWorkflowSLA
+	if err := db.Select(&res, `SELECT s.sws_id, s.sd_id, sd.sd_name, s.ia_type, s.sws_remind_days, s.sws_escalate_days, s.sws_status, s.sws_updated_at, s.sws_updated_by
+		FROM sys_workflow_sla s
+		LEFT JOIN sys_department sd ON sd.sd_id = s.sd_id
+		ORDER BY s.sd_id ASC, s.ia_type ASC`); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "query error", "detail": err.Error()})
+	}
+	return c.Status(200).JSON(res)
+}
+
+// SaveWorkflowSLA inserts or updates the SLA of a workflow (sd_id + ia_type, both optional)
+func SaveWorkflowSLA(c *fiber.Ctx, db *sqlx.DB) error {
+	var body struct {
+		SdID         *int64  `json:"sd_id"`
+		IaType       *string `json:"ia_type"`
+		RemindDays   int     `json:"sws_remind_days"`
+		EscalateDays int     `json:"sws_escalate_days"`
+		Status       string  `json:"sws_status"`
+		UpdatedBy    string  `json:"sws_updated_by"`
+	}
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid request", "detail": err.Error()})
+	}
+	if body.RemindDays < 0 || body.EscalateDays < 0 {
+		return c.Status(400).JSON(fiber.Map{"error": "days must not be negative"})
+	}
+	if body.EscalateDays > 0 && body.RemindDays > body.EscalateDays {
+		return c.Status(400).JSON(fiber.Map{"error": "sws_remind_days must not exceed sws_escalate_days"})
+	}
+	if body.Status == "" {
+		body.Status = "active"
+	}
+	if body.Status != "active" && body.Status != "inactive" {
+		return c.Status(400).JSON(fiber.Map{"error": "sws_status must be 'active' or 'inactive'"})
+	}
+
+	now := time.Now()
+	var id int64
+	err := db.Get(&id, `SELECT sws_id FROM sys_workflow_sla WHERE sd_id <=> ? AND ia_type <=> ? LIMIT 1`, body.SdID, body.IaType)
+	switch {
+	case err == nil:
+		_, err = db.Exec(`UPDATE sys_workflow_sla SET sws_remind_days = ?, sws_escalate_days = ?, sws_status = ?, sws_updated_at = ?, sws_updated_by = ? WHERE sws_id = ?`,
+			body.RemindDays, body.EscalateDays, body.Status, now, body.UpdatedBy, id)
+	case errors.Is(err, sql.ErrNoRows):
+		_, err = db.Exec(`INSERT INTO sys_workflow_sla (sd_id, ia_type, sws_remind_days, sws_escalate_days, sws_status, sws_created_at, sws_created_by, sws_updated_at, sws_updated_by) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			body.SdID, body.IaType, body.RemindDays, body.EscalateDays, body.Status, now, body.UpdatedBy, now, body.UpdatedBy)
+	}
+	if err != nil {
+		return c.Status(500).JSON(5)
+	}
+	return c.Status(200).JSON(1)
+}
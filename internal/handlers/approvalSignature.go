@@ -0,0 +1,305 @@
+package handlers
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"apiTrackingSystem/internal/utils"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jmoiron/sqlx"
+)
+
+// signature errors
+var (
+	errSignaturePassword  = errors.New("password is required to sign the decision")
+	errSignatureDenied    = errors.New("credentials could not be confirmed")
+	errSigningUnavailable = errors.New("approval signing is required but APPROVAL_SIGN_KEY is not set")
+)
+
+// signing states (GetApprovalSigningStatus)
+const (
+	signingEnabled     = "enabled"
+	signingDisabled    = "disabled"    // no key and APPROVAL_SIGN_REQUIRED=false
+	signingUnavailable = "unavailable" // no key while signing is required: decisions are refused
+)
+
+// approvalSignKey is the server HMAC key (APPROVAL_SIGN_KEY); signing is enforced once it is set
+func approvalSignKey() []byte {
+	return []byte(strings.TrimSpace(os.Getenv("APPROVAL_SIGN_KEY")))
+}
+
+func approvalSigningEnabled() bool {
+	return len(approvalSignKey()) > 0
+}
+
+// approvalSigningRequired is true unless APPROVAL_SIGN_REQUIRED=false (local development without a key)
+func approvalSigningRequired() bool {
+	v, err := strconv.ParseBool(strings.TrimSpace(os.Getenv("APPROVAL_SIGN_REQUIRED")))
+	return err != nil || v
+}
+
+func approvalSigningState() string {
+	switch {
+	case approvalSigningEnabled():
+		return signingEnabled
+	case approvalSigningRequired():
+		return signingUnavailable
+	}
+	return signingDisabled
+}
+
+// requireApprovalSigning tells whether a decision has to be signed;
+// errSigningUnavailable when it has to but there is no key, so the decision is refused instead of going unsigned
+func requireApprovalSigning() (bool, error) {
+	switch approvalSigningState() {
+	case signingEnabled:
+		return true, nil
+	case signingUnavailable:
+		return false, errSigningUnavailable
+	}
+	return false, nil
+}
+
+// LogApprovalSigning reports the signing state at startup
+func LogApprovalSigning() {
+	switch approvalSigningState() {
+	case signingUnavailable:
+		log.Printf("!!! approval signing: APPROVAL_SIGN_KEY is not set, approve / reject requests will be refused (503) until it is configured")
+	case signingDisabled:
+		log.Printf("!!! approval signing: DISABLED (APPROVAL_SIGN_REQUIRED=false), decisions are not signed")
+	default:
+		log.Printf("approval signing: enabled")
+	}
+}
+
+// GetApprovalSigningStatus shows whether approval decisions are signed
+func GetApprovalSigningStatus(c *fiber.Ctx) error {
+	return c.JSON(fiber.Map{
+		"state":    approvalSigningState(),
+		"enabled":  approvalSigningEnabled(),
+		"required": approvalSigningRequired(),
+	})
+}
+
+// signatureMeaning is the statement the approver signs for a decision
+func signatureMeaning(decision string) string {
+	if decision == approvalReject {
+		return "Rejected: document returned to the owner for correction"
+	}
+	return "Approved: document reviewed and released"
+}
+
+// signaturePassword reads the password from the form or JSON body (never from the query string)
+func signaturePassword(c *fiber.Ctx) string {
+	if p := c.FormValue("password"); p != "" {
+		return p
+	}
+	var body struct {
+		Password string `json:"password"`
+	}
+	_ = c.BodyParser(&body)
+	return body.Password
+}
+
+// confirmSigner re-confirms the actor's credentials at the auth service before a signed decision
+func confirmSigner(db *sqlx.DB, actor, password string) error {
+	if strings.TrimSpace(password) == "" {
+		return errSignaturePassword
+	}
+	// the same su_id decideApproval records the decision under
+	suID, err := resolveActorSuID(db, actor)
+	if errors.Is(err, sql.ErrNoRows) {
+		return errSignatureDenied
+	}
+	if err != nil {
+		return err
+	}
+	var u struct {
+		Username sql.NullString `db:"su_username"`
+		EmpCode  sql.NullString `db:"su_emp_code"`
+	}
+	if err := db.Get(&u, `SELECT su_username, su_emp_code FROM sys_user WHERE su_id = ?`, suID); err != nil {
+		return err
+	}
+	if strings.TrimSpace(u.Username.String) == "" {
+		return errSignatureDenied
+	}
+	ext, err := externalLogin(u.Username.String, password)
+	if err != nil {
+		if errors.Is(err, errAuthRejected) {
+			return errSignatureDenied
+		}
+		return err
+	}
+	if !strings.EqualFold(strings.TrimSpace(ext.User.Username), strings.TrimSpace(u.Username.String)) {
+		return errSignatureDenied
+	}
+	return nil
+}
+
+// signerErrorStatus maps confirmSigner errors to HTTP status codes
+func signerErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, errSignaturePassword):
+		return 400
+	case errors.Is(err, errSignatureDenied):
+		return 401
+	case errors.Is(err, errAuthUnreachable), errors.Is(err, errAuthInvalid):
+		return 502
+	}
+	return 500
+}
+
+// fileSHA256 hashes a file of the upload store
+func fileSHA256(dbPath string) (string, error) {
+	f, err := os.Open(uploadDiskPath(dbPath))
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// signaturePayload is the canonical text covered by the HMAC
+func signaturePayload(iaID, ipidID, suID int64, decision, meaning string, signedAt time.Time, fileSHA string) string {
+	return strings.Join([]string{
+		strconv.FormatInt(iaID, 10),
+		strconv.FormatInt(ipidID, 10),
+		strconv.FormatInt(suID, 10),
+		decision,
+		meaning,
+		signedAt.UTC().Format(time.RFC3339),
+		fileSHA,
+	}, "|")
+}
+
+func signatureHMAC(payload string) string {
+	m := hmac.New(sha256.New, approvalSignKey())
+	m.Write([]byte(payload))
+	return hex.EncodeToString(m.Sum(nil))
+}
+
+// signApproval stores the signature of a decision written by decideApproval (same transaction)
+func signApproval(tx *sqlx.Tx, out approvalOutcome, now time.Time) error {
+	if sign, err := requireApprovalSigning(); err != nil || !sign || out.IaID == 0 {
+		return err
+	}
+	var signer int64
+	if err := tx.Get(&signer, `SELECT COALESCE(ia_action_su_id, su_id) FROM info_approval WHERE ia_id = ?`, out.IaID); err != nil {
+		return err
+	}
+
+	var file struct {
+		Name sql.NullString `db:"itf_file_name"`
+		Path sql.NullString `db:"itf_file_path"`
+	}
+	if err := tx.Get(&file, `SELECT itf_file_name, itf_file_path FROM info_tracking_file WHERE ipid_id = ? ORDER BY itf_id DESC LIMIT 1`, out.IpidID); err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+	sum := ""
+	if file.Path.Valid && file.Path.String != "" {
+		s, err := fileSHA256(file.Path.String)
+		if err != nil {
+			return fmt.Errorf("hash %s: %w", file.Path.String, err)
+		}
+		sum = s
+	}
+
+	signedAt := now.Truncate(time.Second)
+	meaning := signatureMeaning(out.Decision)
+	payload := signaturePayload(out.IaID, out.IpidID, signer, out.Decision, meaning, signedAt, sum)
+	_, err := tx.Exec(`INSERT INTO info_approval_signature (ia_id, ipid_id, su_id, ias_decision, ias_meaning, ias_signed_at, ias_file_name, ias_file_path, ias_file_sha256, ias_hmac) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		out.IaID, out.IpidID, signer, out.Decision, meaning, signedAt, file.Name, file.Path, utils.NewNullString(sum), signatureHMAC(payload))
+	return err
+}
+
+// InfoApprovalSignature is one signed decision
+type InfoApprovalSignature struct {
+	IasID      int64            `db:"ias_id" json:"ias_id"`
+	IaID       int64            `db:"ia_id" json:"ia_id"`
+	IpidID     int64            `db:"ipid_id" json:"ipid_id"`
+	SuID       int64            `db:"su_id" json:"su_id"`
+	SignerName utils.NullString `db:"signer_name" json:"signer_name"`
+	Decision   string           `db:"ias_decision" json:"ias_decision"`
+	Meaning    string           `db:"ias_meaning" json:"ias_meaning"`
+	SignedAt   time.Time        `db:"ias_signed_at" json:"ias_signed_at"`
+	FileName   utils.NullString `db:"ias_file_name" json:"ias_file_name"`
+	FilePath   utils.NullString `db:"ias_file_path" json:"ias_file_path"`
+	FileSHA256 utils.NullString `db:"ias_file_sha256" json:"ias_file_sha256"`
+	HMAC       string           `db:"ias_hmac" json:"ias_hmac"`
+}
+
+const approvalSignatureSelect = `SELECT s.ias_id, s.ia_id, s.ipid_id, s.su_id, CONCAT_WS(' ', su.su_firstname, su.su_lastname) AS signer_name,
+		s.ias_decision, s.ias_meaning, s.ias_signed_at, s.ias_file_name, s.ias_file_path, s.ias_file_sha256, s.ias_hmac
+	FROM info_approval_signature s
+	LEFT JOIN sys_user su ON su.su_id = s.su_id`
+
+// ListApprovalSignature lists the signatures of an item (?ipid_id=)
+func ListApprovalSignature(c *fiber.Ctx, db *sqlx.DB) error {
+	ipidID, err := strconv.ParseInt(c.Query("ipid_id"), 10, 64)
+	if err != nil || ipidID <= 0 {
+		return c.Status(400).JSON(fiber.Map{"error": "ipid_id is required"})
+	}
+	var rows []InfoApprovalSignature
+	if err := db.Select(&rows, approvalSignatureSelect+` WHERE s.ipid_id = ? ORDER BY s.ias_signed_at, s.ias_id`, ipidID); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "query error", "detail": err.Error()})
+	}
+	return c.JSON(rows)
+}
+
+// VerifyApprovalSignature re-computes the HMAC of a signature and re-hashes the signed file (?ias_id=)
+func VerifyApprovalSignature(c *fiber.Ctx, db *sqlx.DB) error {
+	iasID, err := strconv.ParseInt(c.Query("ias_id"), 10, 64)
+	if err != nil || iasID <= 0 {
+		return c.Status(400).JSON(fiber.Map{"error": "ias_id is required"})
+	}
+	if !approvalSigningEnabled() {
+		return c.Status(503).JSON(fiber.Map{"error": "signature key not configured"})
+	}
+	var s InfoApprovalSignature
+	if err := db.Get(&s, approvalSignatureSelect+` WHERE s.ias_id = ?`, iasID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return c.Status(404).JSON(fiber.Map{"error": "signature not found"})
+		}
+		return c.Status(500).JSON(fiber.Map{"error": "query error", "detail": err.Error()})
+	}
+
+	payload := signaturePayload(s.IaID, s.IpidID, s.SuID, s.Decision, s.Meaning, s.SignedAt, s.FileSHA256.StringValue())
+	hmacValid := hmac.Equal([]byte(signatureHMAC(payload)), []byte(s.HMAC))
+
+	fileValid := true
+	currentSHA := ""
+	fileErr := ""
+	if s.FilePath.StringValue() != "" {
+		sum, err := fileSHA256(s.FilePath.StringValue())
+		if err != nil {
+			fileErr = err.Error()
+		}
+		currentSHA = sum
+		fileValid = err == nil && sum == s.FileSHA256.StringValue()
+	}
+
+	return c.JSON(fiber.Map{
+		"signature":      s,
+		"valid":          hmacValid && fileValid,
+		"hmac_valid":     hmacValid,
+		"file_valid":     fileValid,
+		"current_sha256": currentSHA,
+		"file_error":     fileErr,
+	})
+}
@@ -0,0 +1,33 @@
+package handlers
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestRequireApprovalSigning(t *testing.T) {
+	tests := []struct {
+		key, required string
+		state         string
+		sign          bool
+		err           error
+	}{
+		{"k", "", signingEnabled, true, nil},
+		{"k", "false", signingEnabled, true, nil},
+		{"", "", signingUnavailable, false, errSigningUnavailable},
+		{"", "true", signingUnavailable, false, errSigningUnavailable},
+		{"", "yes please", signingUnavailable, false, errSigningUnavailable},
+		{"", "false", signingDisabled, false, nil},
+	}
+	for _, tt := range tests {
+		t.Setenv("APPROVAL_SIGN_KEY", tt.key)
+		t.Setenv("APPROVAL_SIGN_REQUIRED", tt.required)
+		if got := approvalSigningState(); got != tt.state {
+			t.Errorf("key %q required %q: state = %q, want %q", tt.key, tt.required, got, tt.state)
+		}
+		sign, err := requireApprovalSigning()
+		if sign != tt.sign || !errors.Is(err, tt.err) {
+			t.Errorf("key %q required %q: requireApprovalSigning = %v, %v; want %v, %v", tt.key, tt.required, sign, err, tt.sign, tt.err)
+		}
+	}
+}
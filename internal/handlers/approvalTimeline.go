@@ -0,0 +1,253 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jmoiron/sqlx"
+)
+
+// timeline entry types
+const (
+	timelineUpload   = "upload"
+	timelineResubmit = "resubmit"
+	timelineApprove  = "approve"
+	timelineReject   = "reject"
+	timelineDone     = "done"
+)
+
+// approvalTimelineEntry is one step in the history of a project item
+type approvalTimelineEntry struct {
+	Event      string    `json:"event"`
+	At         time.Time `json:"at"`
+	Round      int64     `json:"round"`
+	Stage      string    `json:"stage,omitempty"`
+	Level      *int64    `json:"level,omitempty"`
+	Actor      string    `json:"actor,omitempty"`
+	ActorSuID  *int64    `json:"actor_su_id,omitempty"`
+	ActorName  string    `json:"actor_name,omitempty"`
+	OnBehalfOf string    `json:"on_behalf_of,omitempty"`
+	TargetName string    `json:"target_name,omitempty"`
+	Note       string    `json:"note,omitempty"`
+	FileName   string    `json:"file_name,omitempty"`
+	FilePath   string    `json:"file_path,omitempty"`
+}
+
+type timelineFile struct {
+	Round     int64          `db:"itfh_round"`
+	FileName  sql.NullString `db:"itfh_file_name"`
+	FilePath  sql.NullString `db:"itfh_file_path"`
+	CreatedAt sql.NullTime   `db:"itfh_created_at"`
+	CreatedBy sql.NullString `db:"itfh_created_by"`
+	FirstName sql.NullString `db:"su_firstname"`
+	LastName  sql.NullString `db:"su_lastname"`
+}
+
+type timelineDecision struct {
+	IaID        int64          `db:"ia_id"`
+	Round       sql.NullInt64  `db:"ia_round"`
+	Type        sql.NullString `db:"ia_type"`
+	Level       sql.NullInt64  `db:"ia_level"`
+	Status      sql.NullString `db:"ia_status"`
+	Note        sql.NullString `db:"ia_note"`
+	At          sql.NullTime   `db:"ia_updated_at"`
+	SuID        sql.NullInt64  `db:"su_id"`
+	ActionSuID  sql.NullInt64  `db:"ia_action_su_id"`
+	UpdatedSuID sql.NullInt64  `db:"upd_su_id"`
+	FirstName   sql.NullString `db:"act_firstname"`
+	LastName    sql.NullString `db:"act_lastname"`
+	OwnFirst    sql.NullString `db:"own_firstname"`
+	OwnLast     sql.NullString `db:"own_lastname"`
+	UpdatedBy   sql.NullString `db:"ia_updated_by"`
+	RoundOpen   int            `db:"round_waiting"`
+	RoundReject int            `db:"round_rejected"`
+}
+
+type timelineEvent struct {
+	Type      string         `db:"iae_type"`
+	Note      sql.NullString `db:"iae_note"`
+	At        time.Time      `db:"iae_created_at"`
+	Round     sql.NullInt64  `db:"ia_round"`
+	Stage     sql.NullString `db:"ia_type"`
+	Level     sql.NullInt64  `db:"ia_level"`
+	FromFirst sql.NullString `db:"from_firstname"`
+	FromLast  sql.NullString `db:"from_lastname"`
+	ToFirst   sql.NullString `db:"to_firstname"`
+	ToLast    sql.NullString `db:"to_lastname"`
+}
+
+func fullName(first, last sql.NullString) string {
+	return strings.TrimSpace(getStringValue(first) + " " + getStringValue(last))
+}
+
+// GetApprovalTimeline returns the chronological history of an item:
+// uploads / resubmits, every Leader / PJ decision, reminders, escalations and the final done.
+// Query: ipid_id
+func GetApprovalTimeline(c *fiber.Ctx, db *sqlx.DB) error {
+	ipidID, err := strconv.ParseInt(strings.TrimSpace(c.Query("ipid_id")), 10, 64)
+	if err != nil || ipidID <= 0 {
+		return c.Status(400).JSON(fiber.Map{"error": "ipid_id is required"})
+	}
+
+	if _, err := loadApprovalItem(db, ipidID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return c.Status(404).JSON(fiber.Map{"error": "item not found"})
+		}
+		return c.Status(500).JSON(fiber.Map{"error": "query error", "detail": err.Error()})
+	}
+
+	var files []timelineFile
+	if err := db.Select(&files, `SELECT h.itfh_round, h.itfh_file_name, h.itfh_file_path, h.itfh_created_at, h.itfh_created_by,
+			su.su_firstname, su.su_lastname
+		FROM info_tracking_file_history h
+		LEFT JOIN sys_user su ON su.su_emp_code = h.itfh_created_by
+		WHERE h.ipid_id = ?
+		ORDER BY h.itfh_round, h.itfh_id`, ipidID); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "query error", "detail": err.Error()})
+	}
+
+	// approve rows are always real decisions; reject rows without an actor were closed by someone else's reject,
+	// unless they were written before ia_action_su_id existed: then the row's approver (or, without one, the
+	// ia_updated_by user) rejected it when ia_updated_by is that same user
+	var decisions []timelineDecision
+	if err := db.Select(&decisions, `SELECT ia.ia_id, ia.ia_round, ia.ia_type, ia.ia_level, ia.ia_status, ia.ia_note, ia.ia_updated_at,
+			ia.su_id, ia.ia_action_su_id, ia.ia_updated_by, upd.su_id AS upd_su_id,
+			act.su_firstname AS act_firstname, act.su_lastname AS act_lastname,
+			own.su_firstname AS own_firstname, own.su_lastname AS own_lastname,
+			(SELECT COUNT(*) FROM info_approval w WHERE w.ipid_id = ia.ipid_id AND w.ia_round <=> ia.ia_round AND w.ia_status = 'waiting') AS round_waiting,
+			(SELECT COUNT(*) FROM info_approval r WHERE r.ipid_id = ia.ipid_id AND r.ia_round <=> ia.ia_round AND r.ia_status = 'reject') AS round_rejected
+		FROM info_approval ia
+		LEFT JOIN sys_user upd ON upd.su_id = (SELECT u.su_id FROM sys_user u
+			WHERE u.su_emp_code = ia.ia_updated_by OR u.su_id = CAST(ia.ia_updated_by AS UNSIGNED)
+			ORDER BY u.su_emp_code = ia.ia_updated_by DESC LIMIT 1)
+		LEFT JOIN sys_user act ON act.su_id = COALESCE(ia.ia_action_su_id, ia.su_id, upd.su_id)
+		LEFT JOIN sys_user own ON own.su_id = ia.su_id
+		WHERE ia.ipid_id = ?
+		  AND (ia.ia_status = 'approve'
+			OR (ia.ia_status = 'reject' AND ia.ia_action_su_id IS NOT NULL)
+			OR (ia.ia_status = 'reject' AND ia.ia_action_su_id IS NULL AND upd.su_id IS NOT NULL AND (ia.su_id IS NULL OR ia.su_id = upd.su_id)))
+		ORDER BY ia.ia_updated_at, ia.ia_id`, ipidID); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "query error", "detail": err.Error()})
+	}
+
+	var events []timelineEvent
+	if err := db.Select(&events, `SELECT e.iae_type, e.iae_note, e.iae_created_at, ia.ia_round, ia.ia_type, ia.ia_level,
+			fu.su_firstname AS from_firstname, fu.su_lastname AS from_lastname,
+			tu.su_firstname AS to_firstname, tu.su_lastname AS to_lastname
+		FROM info_approval_event e
+		JOIN info_approval ia ON ia.ia_id = e.ia_id
+		LEFT JOIN sys_user fu ON fu.su_id = e.iae_from_su_id
+		LEFT JOIN sys_user tu ON tu.su_id = e.iae_to_su_id
+		WHERE e.ipid_id = ?
+		ORDER BY e.iae_created_at, e.iae_id`, ipidID); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "query error", "detail": err.Error()})
+	}
+
+	fileByRound := map[int64]timelineFile{}
+	for _, f := range files {
+		fileByRound[f.Round] = f
+	}
+
+	entries := make([]approvalTimelineEntry, 0, len(files)+len(decisions)+len(events)+1)
+	for i, f := range files {
+		ev := timelineUpload
+		if i > 0 {
+			ev = timelineResubmit
+		}
+		entries = append(entries, approvalTimelineEntry{
+			Event:     ev,
+			At:        f.CreatedAt.Time,
+			Round:     f.Round,
+			Actor:     getStringValue(f.CreatedBy),
+			ActorName: fullName(f.FirstName, f.LastName),
+			FileName:  getStringValue(f.FileName),
+			FilePath:  getStringValue(f.FilePath),
+		})
+	}
+
+	// the last approve of a round without waiting or rejected rows closed the chain
+	lastApprove := map[int64]int{}
+	for _, d := range decisions {
+		e := approvalTimelineEntry{
+			Event:     normalizeApprovalStatus(d.Status.String),
+			At:        d.At.Time,
+			Round:     d.Round.Int64,
+			Stage:     d.Type.String,
+			Actor:     getStringValue(d.UpdatedBy),
+			ActorName: fullName(d.FirstName, d.LastName),
+			Note:      getStringValue(d.Note),
+		}
+		if d.Level.Valid {
+			lv := d.Level.Int64
+			e.Level = &lv
+		}
+		if d.ActionSuID.Valid {
+			su := d.ActionSuID.Int64
+			e.ActorSuID = &su
+		} else if d.SuID.Valid {
+			su := d.SuID.Int64
+			e.ActorSuID = &su
+		} else if d.UpdatedSuID.Valid {
+			su := d.UpdatedSuID.Int64
+			e.ActorSuID = &su
+		}
+		if d.ActionSuID.Valid && d.SuID.Valid && d.ActionSuID.Int64 != d.SuID.Int64 {
+			e.OnBehalfOf = fullName(d.OwnFirst, d.OwnLast)
+		}
+		if f, ok := fileByRound[e.Round]; ok {
+			e.FileName = getStringValue(f.FileName)
+			e.FilePath = getStringValue(f.FilePath)
+		}
+		entries = append(entries, e)
+		if e.Event == timelineApprove && d.RoundOpen == 0 && d.RoundReject == 0 {
+			lastApprove[e.Round] = len(entries) - 1
+		}
+	}
+	for _, idx := range lastApprove {
+		src := entries[idx]
+		entries = append(entries, approvalTimelineEntry{
+			Event:    timelineDone,
+			At:       src.At,
+			Round:    src.Round,
+			Stage:    src.Stage,
+			FileName: src.FileName,
+			FilePath: src.FilePath,
+		})
+	}
+
+	for _, ev := range events {
+		e := approvalTimelineEntry{
+			Event:      ev.Type,
+			At:         ev.At,
+			Round:      ev.Round.Int64,
+			Stage:      ev.Stage.String,
+			Actor:      "system",
+			ActorName:  fullName(ev.FromFirst, ev.FromLast),
+			TargetName: fullName(ev.ToFirst, ev.ToLast),
+			Note:       getStringValue(ev.Note),
+		}
+		if ev.Level.Valid {
+			lv := ev.Level.Int64
+			e.Level = &lv
+		}
+		entries = append(entries, e)
+	}
+
+	// chronological; on equal timestamps keep round order and put "done" after the decision
+	sort.SliceStable(entries, func(i, j int) bool {
+		if !entries[i].At.Equal(entries[j].At) {
+			return entries[i].At.Before(entries[j].At)
+		}
+		if entries[i].Round != entries[j].Round {
+			return entries[i].Round < entries[j].Round
+		}
+		return entries[j].Event == timelineDone && entries[i].Event != timelineDone
+	})
+
+	return c.JSON(fiber.Map{"ipid_id": ipidID, "timeline": entries})
+}
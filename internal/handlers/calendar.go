@@ -0,0 +1,707 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"apiTrackingSystem/internal/utils"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jmoiron/sqlx"
+)
+
+const dateKey = "2006-01-02"
+
+// calendar day types (mst_calendar_holiday.mch_type)
+const (
+	calendarHoliday  = "holiday"
+	calendarShutdown = "shutdown"
+)
+
+// workCalendar answers working-day questions for one plant calendar:
+// its weekend days, the public holidays (mst_holiday, when included) and its own holidays / shutdowns.
+type workCalendar struct {
+	ID      int64
+	weekend [7]bool
+	closed  map[string]string // "2006-01-02" -> name of the holiday / shutdown
+}
+
+// calendarDay is a non-working date and why
+type calendarDay struct {
+	Date           string `json:"date"`
+	Reason         string `json:"reason"`
+	NextWorkingDay string `json:"next_working_day,omitempty"`
+}
+
+// parseWeekend reads mc_weekend, comma separated weekdays (0 = Sunday .. 6 = Saturday)
+func parseWeekend(s string) ([7]bool, error) {
+	var w [7]bool
+	for _, p := range strings.Split(s, ",") {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+		n, err := strconv.Atoi(p)
+		if err != nil || n < 0 || n > 6 {
+			return w, fmt.Errorf("invalid weekday %q (0 = Sunday .. 6 = Saturday)", p)
+		}
+		w[n] = true
+	}
+	return w, nil
+}
+
+// loadCalendar loads a calendar with its closed days; mcID <= 0 (or an unknown id) gives the default
+// calendar, and without one Saturday / Sunday plus mst_holiday.
+func loadCalendar(q sqlx.Queryer, mcID int64) (*workCalendar, error) {
+	var row struct {
+		ID      int64  `db:"mc_id"`
+		Weekend string `db:"mc_weekend"`
+		Public  bool   `db:"mc_public_holiday"`
+	}
+	var err error
+	if mcID > 0 {
+		err = sqlx.Get(q, &row, `SELECT mc_id, mc_weekend, mc_public_holiday FROM mst_calendar WHERE mc_id = ?`, mcID)
+	}
+	if mcID <= 0 || errors.Is(err, sql.ErrNoRows) {
+		err = sqlx.Get(q, &row, `SELECT mc_id, mc_weekend, mc_public_holiday FROM mst_calendar WHERE mc_is_default = 1 AND mc_status = 'active' ORDER BY mc_id LIMIT 1`)
+		if errors.Is(err, sql.ErrNoRows) {
+			row.ID, row.Weekend, row.Public, err = 0, "0,6", true, nil
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	cal := &workCalendar{ID: row.ID, closed: map[string]string{}}
+	if cal.weekend, err = parseWeekend(row.Weekend); err != nil {
+		return nil, err
+	}
+	if row.Public {
+		var hs []struct {
+			Date Date             `db:"mh_date"`
+			Name utils.NullString `db:"mh_name"`
+		}
+		if err := sqlx.Select(q, &hs, `SELECT mh_date, mh_name FROM mst_holiday WHERE mh_status = 'active'`); err != nil {
+			return nil, err
+		}
+		for _, h := range hs {
+			cal.closed[h.Date.Format(dateKey)] = nameOr(h.Name, calendarHoliday)
+		}
+	}
+	if cal.ID > 0 {
+		var rs []struct {
+			Type  string           `db:"mch_type"`
+			Start Date             `db:"mch_start_date"`
+			End   Date             `db:"mch_end_date"`
+			Name  utils.NullString `db:"mch_name"`
+		}
+		if err := sqlx.Select(q, &rs, `SELECT mch_type, mch_start_date, mch_end_date, mch_name FROM mst_calendar_holiday WHERE mc_id = ? AND mch_status = 'active'`, cal.ID); err != nil {
+			return nil, err
+		}
+		for _, r := range rs {
+			end := dayOf(r.End.Time)
+			for d := dayOf(r.Start.Time); !d.After(end); d = d.AddDate(0, 0, 1) {
+				cal.closed[d.Format(dateKey)] = nameOr(r.Name, r.Type)
+			}
+		}
+	}
+	return cal, nil
+}
+
+// projectCalendar loads the calendar of a project (info_project.mc_id)
+func projectCalendar(q sqlx.Queryer, ipID int64) (*workCalendar, error) {
+	var mcID sql.NullInt64
+	if err := sqlx.Get(q, &mcID, `SELECT mc_id FROM info_project WHERE ip_id = ?`, ipID); err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+	return loadCalendar(q, mcID.Int64)
+}
+
+func nameOr(n utils.NullString, def string) string {
+	if n.Valid && strings.TrimSpace(n.String) != "" {
+		return n.String
+	}
+	return def
+}
+
+// dayOf drops the time of day (dates from the DB and from requests compare as local dates)
+func dayOf(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.Local)
+}
+
+// IsWorkingDay - not a weekend day of the calendar and not closed
+func (cal *workCalendar) IsWorkingDay(d time.Time) bool {
+	return cal.NonWorkingReason(d) == ""
+}
+
+// NonWorkingReason is "" on a working day, else "weekend" or the holiday / shutdown name
+func (cal *workCalendar) NonWorkingReason(d time.Time) string {
+	if name, ok := cal.closed[d.Format(dateKey)]; ok {
+		return name
+	}
+	if cal.weekend[d.Weekday()] {
+		return "weekend"
+	}
+	return ""
+}
+
+// WorkingDaysBetween counts working days after the date of from, up to and including the date of to
+// (negative when to is before from)
+func (cal *workCalendar) WorkingDaysBetween(from, to time.Time) int {
+	start, end := dayOf(from), dayOf(to)
+	if end.Before(start) {
+		return -cal.WorkingDaysBetween(end, start)
+	}
+	n := 0
+	for d := start.AddDate(0, 0, 1); !d.After(end); d = d.AddDate(0, 0, 1) {
+		if cal.IsWorkingDay(d) {
+			n++
+		}
+	}
+	return n
+}
+
+// WorkingDays is the duration of start..end in working days, both dates included
+func (cal *workCalendar) WorkingDays(start, end time.Time) int {
+	n := cal.WorkingDaysBetween(start, end)
+	if !dayOf(end).Before(dayOf(start)) && cal.IsWorkingDay(dayOf(start)) {
+		n++
+	}
+	return n
+}
+
+// maxCalendarScan stops a shift on a calendar without working days
+const maxCalendarScan = 3660
+
+// AddWorkingDays moves n working days forward (n < 0 backward); n = 0 gives the date itself
+// when it is a working day, else the next working day
+func (cal *workCalendar) AddWorkingDays(d time.Time, n int) time.Time {
+	d = dayOf(d)
+	if n == 0 {
+		return cal.NextWorkingDay(d)
+	}
+	step := 1
+	if n < 0 {
+		step, n = -1, -n
+	}
+	for i := 0; n > 0 && i < maxCalendarScan; i++ {
+		d = d.AddDate(0, 0, step)
+		if cal.IsWorkingDay(d) {
+			n--
+		}
+	}
+	return d
+}
+
+// NextWorkingDay returns d when it is a working day, else the first working day after it
+func (cal *workCalendar) NextWorkingDay(d time.Time) time.Time {
+	d = dayOf(d)
+	for i := 0; !cal.IsWorkingDay(d) && i < maxCalendarScan; i++ {
+		d = d.AddDate(0, 0, 1)
+	}
+	return d
+}
+
+// PrevWorkingDay returns d when it is a working day, else the last working day before it
+func (cal *workCalendar) PrevWorkingDay(d time.Time) time.Time {
+	d = dayOf(d)
+	for i := 0; !cal.IsWorkingDay(d) && i < maxCalendarScan; i++ {
+		d = d.AddDate(0, 0, -1)
+	}
+	return d
+}
+
+// nonWorkingDates lists the given dates (nil / zero skipped) that fall on non-working days
+func (cal *workCalendar) nonWorkingDates(dates ...*Date) []calendarDay {
+	var out []calendarDay
+	seen := map[string]bool{}
+	for _, d := range dates {
+		if d == nil || d.IsZero() {
+			continue
+		}
+		key := d.Format(dateKey)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		if reason := cal.NonWorkingReason(dayOf(d.Time)); reason != "" {
+			out = append(out, calendarDay{Date: key, Reason: reason, NextWorkingDay: cal.NextWorkingDay(d.Time).Format(dateKey)})
+		}
+	}
+	return out
+}
+
+// MstHoliday represents a row in mst_holiday
+type MstHoliday struct {
+	ID        int64            `db:"mh_id" json:"mh_id"`
+	Date      *Date            `db:"mh_date" json:"mh_date"`
+	Name      utils.NullString `db:"mh_name" json:"mh_name"`
+	Status    string           `db:"mh_status" json:"mh_status"`
+	UpdatedAt *time.Time       `db:"mh_updated_at" json:"mh_updated_at"`
+	UpdatedBy utils.NullString `db:"mh_updated_by" json:"mh_updated_by"`
+}
+
+// ListHoliday lists holidays, optionally of one year (?year=2025)
+func ListHoliday(c *fiber.Ctx, db *sqlx.DB) error {
+	query := `SELECT mh_id, mh_date, mh_name, mh_status, mh_updated_at, mh_updated_by FROM mst_holiday`
+	var args []interface{}
+	if y := strings.TrimSpace(c.Query("year")); y != "" {
+		year, err := strconv.Atoi(y)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "invalid year"})
+		}
+		query += ` WHERE YEAR(mh_date) = ?`
+		args = append(args, year)
+	}
+	query += ` ORDER BY mh_date ASC`
+	var res []MstHoliday
+	if err := db.Select(&res, query, args...); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "query error", "detail": err.Error()})
+	}
+	return c.Status(200).JSON(res)
+}
+
+func InsertHoliday(c *fiber.Ctx, db *sqlx.DB) error {
+	var body struct {
+		Date      Date   `json:"mh_date"`
+		Name      string `json:"mh_name"`
+		CreatedBy string `json:"mh_created_by"`
+	}
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid request", "detail": err.Error()})
+	}
+	if body.Date.IsZero() {
+		return c.Status(400).JSON(fiber.Map{"error": "mh_date is required"})
+	}
+	var count int
+	if err := db.Get(&count, `SELECT COUNT(*) FROM mst_holiday WHERE mh_date = ?`, body.Date); err != nil {
+		return c.Status(500).JSON(5)
+	}
+	if count > 0 {
+		return c.Status(200).JSON(2)
+	}
+	now := time.Now()
+	if _, err := db.Exec(`INSERT INTO mst_holiday (mh_date, mh_name, mh_status, mh_created_at, mh_created_by, mh_updated_at, mh_updated_by) VALUES (?, ?, 'active', ?, ?, ?, ?)`,
+		body.Date, utils.NewNullString(body.Name), now, body.CreatedBy, now, body.CreatedBy); err != nil {
+		return c.Status(500).JSON(5)
+	}
+	return c.Status(201).JSON(1)
+}
+
+func UpdateHolidayStatus(c *fiber.Ctx, db *sqlx.DB) error {
+	var body struct {
+		ID        int64  `json:"mh_id"`
+		Status    string `json:"mh_status"`
+		UpdatedBy string `json:"mh_updated_by"`
+	}
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid request body", "detail": err.Error()})
+	}
+	if body.ID == 0 {
+		return c.Status(400).JSON(fiber.Map{"error": "mh_id is required"})
+	}
+	if body.Status != "active" && body.Status != "inactive" {
+		return c.Status(400).JSON(fiber.Map{"error": "mh_status must be 'active' or 'inactive'"})
+	}
+	res, err := execVersioned(c, db, holidayVersion, body.ID, `UPDATE mst_holiday SET mh_status = ?, mh_updated_at = ?, mh_updated_by = ? WHERE mh_id = ?`, body.Status, time.Now(), body.UpdatedBy, body.ID)
+	if err != nil {
+		if isVersionError(err) {
+			return versionError(c, err)
+		}
+		return c.Status(500).JSON(5)
+	}
+	ra, _ := res.RowsAffected()
+	if ra == 0 {
+		return c.Status(404).JSON(fiber.Map{"error": "holiday not found"})
+	}
+	return c.Status(200).JSON(1)
+}
+
+// MstCalendar represents a row in mst_calendar
+type MstCalendar struct {
+	ID            int64            `db:"mc_id" json:"mc_id"`
+	Code          string           `db:"mc_code" json:"mc_code"`
+	Name          string           `db:"mc_name" json:"mc_name"`
+	Weekend       string           `db:"mc_weekend" json:"mc_weekend"`
+	PublicHoliday bool             `db:"mc_public_holiday" json:"mc_public_holiday"`
+	IsDefault     bool             `db:"mc_is_default" json:"mc_is_default"`
+	Status        string           `db:"mc_status" json:"mc_status"`
+	UpdatedAt     *time.Time       `db:"mc_updated_at" json:"mc_updated_at"`
+	UpdatedBy     utils.NullString `db:"mc_updated_by" json:"mc_updated_by"`
+}
+
+// ListCalendar lists the plant calendars (?status=active)
+func ListCalendar(c *fiber.Ctx, db *sqlx.DB) error {
+	query := `SELECT mc_id, mc_code, mc_name, mc_weekend, mc_public_holiday, mc_is_default, mc_status, mc_updated_at, mc_updated_by FROM mst_calendar`
+	var args []interface{}
+	if status := strings.TrimSpace(c.Query("status")); status != "" {
+		query += ` WHERE mc_status = ?`
+		args = append(args, status)
+	}
+	query += ` ORDER BY mc_is_default DESC, mc_code ASC`
+	res := []MstCalendar{}
+	if err := db.Select(&res, query, args...); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "query error", "detail": err.Error()})
+	}
+	return c.Status(200).JSON(res)
+}
+
+// InsertCalendar adds a plant calendar.
+// Body: { "mc_code", "mc_name", "mc_weekend": "0,6", "mc_public_holiday": true, "mc_is_default": false, "mc_created_by" }
+func InsertCalendar(c *fiber.Ctx, db *sqlx.DB) error {
+	var body struct {
+		Code          string `json:"mc_code"`
+		Name          string `json:"mc_name"`
+		Weekend       string `json:"mc_weekend"`
+		PublicHoliday *bool  `json:"mc_public_holiday"`
+		IsDefault     bool   `json:"mc_is_default"`
+		CreatedBy     string `json:"mc_created_by"`
+	}
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid request", "detail": err.Error()})
+	}
+	body.Code = strings.TrimSpace(body.Code)
+	if body.Code == "" || strings.TrimSpace(body.Name) == "" {
+		return c.Status(400).JSON(fiber.Map{"error": "mc_code and mc_name are required"})
+	}
+	if strings.TrimSpace(body.Weekend) == "" {
+		body.Weekend = "0,6"
+	}
+	if _, err := parseWeekend(body.Weekend); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid mc_weekend", "detail": err.Error()})
+	}
+	public := body.PublicHoliday == nil || *body.PublicHoliday
+
+	var count int
+	if err := db.Get(&count, `SELECT COUNT(*) FROM mst_calendar WHERE mc_code = ?`, body.Code); err != nil {
+		return c.Status(500).JSON(5)
+	}
+	if count > 0 {
+		return c.Status(200).JSON(2)
+	}
+
+	tx, err := db.Beginx()
+	if err != nil {
+		return c.Status(500).JSON(5)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	now := time.Now()
+	if body.IsDefault {
+		if _, err := tx.Exec(`UPDATE mst_calendar SET mc_is_default = 0, mc_updated_at = ?, mc_updated_by = ? WHERE mc_is_default = 1`, now, body.CreatedBy); err != nil {
+			return c.Status(500).JSON(5)
+		}
+	}
+	if _, err := tx.Exec(`INSERT INTO mst_calendar (mc_code, mc_name, mc_weekend, mc_public_holiday, mc_is_default, mc_status, mc_created_at, mc_created_by, mc_updated_at, mc_updated_by) VALUES (?, ?, ?, ?, ?, 'active', ?, ?, ?, ?)`,
+		body.Code, strings.TrimSpace(body.Name), body.Weekend, public, body.IsDefault, now, body.CreatedBy, now, body.CreatedBy); err != nil {
+		return c.Status(500).JSON(5)
+	}
+	if err := tx.Commit(); err != nil {
+		return c.Status(500).JSON(5)
+	}
+	return c.Status(201).JSON(1)
+}
+
+// UpdateCalendar changes a plant calendar; making it the default clears the flag on the others.
+// Body: { "mc_id", "mc_name", "mc_weekend", "mc_public_holiday", "mc_is_default", "mc_status", "mc_updated_by" }
+// An omitted mc_weekend is "0,6" as in InsertCalendar; an omitted mc_public_holiday keeps the current value.
+func UpdateCalendar(c *fiber.Ctx, db *sqlx.DB) error {
+	var body struct {
+		ID            int64  `json:"mc_id"`
+		Name          string `json:"mc_name"`
+		Weekend       string `json:"mc_weekend"`
+		PublicHoliday *bool  `json:"mc_public_holiday"`
+		IsDefault     bool   `json:"mc_is_default"`
+		Status        string `json:"mc_status"`
+		UpdatedBy     string `json:"mc_updated_by"`
+	}
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid request body", "detail": err.Error()})
+	}
+	if body.ID == 0 {
+		return c.Status(400).JSON(fiber.Map{"error": "mc_id is required"})
+	}
+	if strings.TrimSpace(body.Name) == "" {
+		return c.Status(400).JSON(fiber.Map{"error": "mc_name is required"})
+	}
+	if body.Status == "" {
+		body.Status = "active"
+	}
+	if body.Status != "active" && body.Status != "inactive" {
+		return c.Status(400).JSON(fiber.Map{"error": "mc_status must be 'active' or 'inactive'"})
+	}
+	if body.IsDefault && body.Status != "active" {
+		return c.Status(400).JSON(fiber.Map{"error": "the default calendar must be active"})
+	}
+	if strings.TrimSpace(body.Weekend) == "" {
+		body.Weekend = "0,6"
+	}
+	if _, err := parseWeekend(body.Weekend); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid mc_weekend", "detail": err.Error()})
+	}
+
+	tx, err := db.Beginx()
+	if err != nil {
+		return c.Status(500).JSON(5)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if err := checkVersion(c, tx, calendarVersion, body.ID); err != nil {
+		return versionError(c, err)
+	}
+	now := time.Now()
+	if body.IsDefault {
+		if _, err := tx.Exec(`UPDATE mst_calendar SET mc_is_default = 0, mc_updated_at = ?, mc_updated_by = ? WHERE mc_is_default = 1 AND mc_id <> ?`, now, body.UpdatedBy, body.ID); err != nil {
+			return c.Status(500).JSON(5)
+		}
+	}
+	res, err := tx.Exec(`UPDATE mst_calendar SET mc_name = ?, mc_weekend = ?, mc_public_holiday = COALESCE(?, mc_public_holiday), mc_is_default = ?, mc_status = ?, mc_updated_at = ?, mc_updated_by = ? WHERE mc_id = ?`,
+		strings.TrimSpace(body.Name), body.Weekend, body.PublicHoliday, body.IsDefault, body.Status, now, body.UpdatedBy, body.ID)
+	if err != nil {
+		return c.Status(500).JSON(5)
+	}
+	if ra, _ := res.RowsAffected(); ra == 0 {
+		return c.Status(404).JSON(fiber.Map{"error": "calendar not found"})
+	}
+	if err := tx.Commit(); err != nil {
+		return c.Status(500).JSON(5)
+	}
+	return c.Status(200).JSON(1)
+}
+
+// MstCalendarHoliday represents a row in mst_calendar_holiday
+type MstCalendarHoliday struct {
+	ID        int64            `db:"mch_id" json:"mch_id"`
+	McID      int64            `db:"mc_id" json:"mc_id"`
+	Type      string           `db:"mch_type" json:"mch_type"`
+	StartDate *Date            `db:"mch_start_date" json:"mch_start_date"`
+	EndDate   *Date            `db:"mch_end_date" json:"mch_end_date"`
+	Name      utils.NullString `db:"mch_name" json:"mch_name"`
+	Status    string           `db:"mch_status" json:"mch_status"`
+	UpdatedAt *time.Time       `db:"mch_updated_at" json:"mch_updated_at"`
+	UpdatedBy utils.NullString `db:"mch_updated_by" json:"mch_updated_by"`
+}
+
+// calendarHolidayBody is the request of InsertCalendarHoliday / UpdateCalendarHoliday
+type calendarHolidayBody struct {
+	ID        int64  `json:"mch_id"`
+	McID      int64  `json:"mc_id"`
+	Type      string `json:"mch_type"`
+	StartDate Date   `json:"mch_start_date"`
+	EndDate   Date   `json:"mch_end_date"`
+	Name      string `json:"mch_name"`
+	Status    string `json:"mch_status"`
+	CreatedBy string `json:"mch_created_by"`
+	UpdatedBy string `json:"mch_updated_by"`
+}
+
+// validate fills the defaults (type holiday, one day) and checks the range (at most a year)
+func (b *calendarHolidayBody) validate() string {
+	if b.Type == "" {
+		b.Type = calendarHoliday
+	}
+	if b.Type != calendarHoliday && b.Type != calendarShutdown {
+		return "mch_type must be 'holiday' or 'shutdown'"
+	}
+	if b.StartDate.IsZero() {
+		return "mch_start_date is required"
+	}
+	if b.EndDate.IsZero() {
+		b.EndDate = b.StartDate
+	}
+	if dayOf(b.EndDate.Time).Before(dayOf(b.StartDate.Time)) {
+		return "mch_end_date is before mch_start_date"
+	}
+	if dayOf(b.EndDate.Time).Sub(dayOf(b.StartDate.Time)) > 366*24*time.Hour {
+		return "a holiday / shutdown can not be longer than a year"
+	}
+	return ""
+}
+
+// ListCalendarHoliday lists the holidays and shutdowns of a calendar (?mc_id=, optional ?year=2025)
+func ListCalendarHoliday(c *fiber.Ctx, db *sqlx.DB) error {
+	mcID, err := strconv.ParseInt(c.Query("mc_id"), 10, 64)
+	if err != nil || mcID <= 0 {
+		return c.Status(400).JSON(fiber.Map{"error": "mc_id is required"})
+	}
+	query := `SELECT mch_id, mc_id, mch_type, mch_start_date, mch_end_date, mch_name, mch_status, mch_updated_at, mch_updated_by FROM mst_calendar_holiday WHERE mc_id = ?`
+	args := []interface{}{mcID}
+	if y := strings.TrimSpace(c.Query("year")); y != "" {
+		year, err := strconv.Atoi(y)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "invalid year"})
+		}
+		query += ` AND YEAR(mch_start_date) <= ? AND YEAR(mch_end_date) >= ?`
+		args = append(args, year, year)
+	}
+	query += ` ORDER BY mch_start_date ASC`
+	res := []MstCalendarHoliday{}
+	if err := db.Select(&res, query, args...); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "query error", "detail": err.Error()})
+	}
+	return c.Status(200).JSON(res)
+}
+
+// InsertCalendarHoliday adds a holiday or shutdown period to a calendar.
+// Body: { "mc_id", "mch_type": "holiday|shutdown", "mch_start_date", "mch_end_date", "mch_name", "mch_created_by" }
+func InsertCalendarHoliday(c *fiber.Ctx, db *sqlx.DB) error {
+	var body calendarHolidayBody
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid request", "detail": err.Error()})
+	}
+	if body.McID <= 0 {
+		return c.Status(400).JSON(fiber.Map{"error": "mc_id is required"})
+	}
+	if msg := body.validate(); msg != "" {
+		return c.Status(400).JSON(fiber.Map{"error": msg})
+	}
+	var count int
+	if err := db.Get(&count, `SELECT COUNT(*) FROM mst_calendar WHERE mc_id = ?`, body.McID); err != nil {
+		return c.Status(500).JSON(5)
+	}
+	if count == 0 {
+		return c.Status(404).JSON(fiber.Map{"error": "calendar not found"})
+	}
+	now := time.Now()
+	if _, err := db.Exec(`INSERT INTO mst_calendar_holiday (mc_id, mch_type, mch_start_date, mch_end_date, mch_name, mch_status, mch_created_at, mch_created_by, mch_updated_at, mch_updated_by) VALUES (?, ?, ?, ?, ?, 'active', ?, ?, ?, ?)`,
+		body.McID, body.Type, body.StartDate, body.EndDate, utils.NewNullString(body.Name), now, body.CreatedBy, now, body.CreatedBy); err != nil {
+		return c.Status(500).JSON(5)
+	}
+	return c.Status(201).JSON(1)
+}
+
+// UpdateCalendarHoliday changes a holiday / shutdown (dates, name, type, status)
+func UpdateCalendarHoliday(c *fiber.Ctx, db *sqlx.DB) error {
+	var body calendarHolidayBody
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid request body", "detail": err.Error()})
+	}
+	if body.ID == 0 {
+		return c.Status(400).JSON(fiber.Map{"error": "mch_id is required"})
+	}
+	if msg := body.validate(); msg != "" {
+		return c.Status(400).JSON(fiber.Map{"error": msg})
+	}
+	if body.Status == "" {
+		body.Status = "active"
+	}
+	if body.Status != "active" && body.Status != "inactive" {
+		return c.Status(400).JSON(fiber.Map{"error": "mch_status must be 'active' or 'inactive'"})
+	}
+	res, err := execVersioned(c, db, calendarHolidayVersion, body.ID, `UPDATE mst_calendar_holiday SET mch_type = ?, mch_start_date = ?, mch_end_date = ?, mch_name = ?, mch_status = ?, mch_updated_at = ?, mch_updated_by = ? WHERE mch_id = ?`,
+		body.Type, body.StartDate, body.EndDate, utils.NewNullString(body.Name), body.Status, time.Now(), body.UpdatedBy, body.ID)
+	if err != nil {
+		if isVersionError(err) {
+			return versionError(c, err)
+		}
+		return c.Status(500).JSON(5)
+	}
+	if ra, _ := res.RowsAffected(); ra == 0 {
+		return c.Status(404).JSON(fiber.Map{"error": "holiday not found"})
+	}
+	return c.Status(200).JSON(1)
+}
+
+// calendarFromQuery loads the calendar named by ?mc_id=, else the one of ?ip_id=, else the default
+func calendarFromQuery(c *fiber.Ctx, db *sqlx.DB) (*workCalendar, error) {
+	if id, err := strconv.ParseInt(c.Query("mc_id"), 10, 64); err == nil && id > 0 {
+		return loadCalendar(db, id)
+	}
+	if id, err := strconv.ParseInt(c.Query("ip_id"), 10, 64); err == nil && id > 0 {
+		return projectCalendar(db, id)
+	}
+	return loadCalendar(db, 0)
+}
+
+// CalendarWorkingDays counts the working days of from..to (both included) and lists the non-working days.
+// Query: from, to (2006-01-02), mc_id or ip_id (default calendar otherwise)
+func CalendarWorkingDays(c *fiber.Ctx, db *sqlx.DB) error {
+	from, to := parseDatePtr(c.Query("from")), parseDatePtr(c.Query("to"))
+	if from == nil || to == nil {
+		return c.Status(400).JSON(fiber.Map{"error": "from and to are required (YYYY-MM-DD)"})
+	}
+	if to.Before(from.Time) {
+		return c.Status(400).JSON(fiber.Map{"error": "to is before from"})
+	}
+	if to.Sub(from.Time) > maxCalendarScan*24*time.Hour {
+		return c.Status(400).JSON(fiber.Map{"error": "range is too long"})
+	}
+	cal, err := calendarFromQuery(c, db)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "query error", "detail": err.Error()})
+	}
+	nonWorking := []calendarDay{}
+	for d := dayOf(from.Time); !d.After(dayOf(to.Time)); d = d.AddDate(0, 0, 1) {
+		if reason := cal.NonWorkingReason(d); reason != "" {
+			nonWorking = append(nonWorking, calendarDay{Date: d.Format(dateKey), Reason: reason})
+		}
+	}
+	return c.Status(200).JSON(fiber.Map{
+		"mc_id":        cal.ID,
+		"from":         from,
+		"to":           to,
+		"working_days": cal.WorkingDays(from.Time, to.Time),
+		"non_working":  nonWorking,
+	})
+}
+
+// CalendarShiftDate moves a date by a number of working days (negative = back; 0 = next working day).
+// Query: date, days, mc_id or ip_id
+func CalendarShiftDate(c *fiber.Ctx, db *sqlx.DB) error {
+	date := parseDatePtr(c.Query("date"))
+	if date == nil {
+		return c.Status(400).JSON(fiber.Map{"error": "date is required (YYYY-MM-DD)"})
+	}
+	days, err := strconv.Atoi(c.Query("days", "0"))
+	if err != nil || days > maxCalendarScan || days < -maxCalendarScan {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid days"})
+	}
+	cal, err := calendarFromQuery(c, db)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "query error", "detail": err.Error()})
+	}
+	return c.Status(200).JSON(fiber.Map{
+		"mc_id":  cal.ID,
+		"date":   date,
+		"days":   days,
+		"result": Date{cal.AddWorkingDays(date.Time, days)},
+	})
+}
+
+// CheckCalendarDates returns the dates that fall on non-working days, with the next working day.
+// Body: { "mc_id" or "ip_id", "dates": ["2025-04-14", ...] }
+func CheckCalendarDates(c *fiber.Ctx, db *sqlx.DB) error {
+	var body struct {
+		McID  int64  `json:"mc_id"`
+		IpID  int64  `json:"ip_id"`
+		Dates []Date `json:"dates"`
+	}
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid request", "detail": err.Error()})
+	}
+	var (
+		cal *workCalendar
+		err error
+	)
+	if body.McID > 0 || body.IpID <= 0 {
+		cal, err = loadCalendar(db, body.McID)
+	} else {
+		cal, err = projectCalendar(db, body.IpID)
+	}
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "query error", "detail": err.Error()})
+	}
+	dates := make([]*Date, 0, len(body.Dates))
+	for i := range body.Dates {
+		dates = append(dates, &body.Dates[i])
+	}
+	nonWorking := cal.nonWorkingDates(dates...)
+	if nonWorking == nil {
+		nonWorking = []calendarDay{}
+	}
+	return c.Status(200).JSON(fiber.Map{"mc_id": cal.ID, "non_working": nonWorking})
+}
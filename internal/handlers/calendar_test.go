@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"testing"
+	"time"
+)
+
+// songkranCalendar is testCalendar with Mon 2026-04-13 .. Wed 2026-04-15 closed
+func songkranCalendar() *workCalendar {
+	cal := testCalendar()
+	cal.closed = map[string]string{"2026-04-13": "Songkran", "2026-04-14": "Songkran", "2026-04-15": "Songkran"}
+	return cal
+}
+
+func TestWorkingDaysBetween(t *testing.T) {
+	cal := songkranCalendar()
+	tests := []struct {
+		from, to time.Time
+		want     int
+	}{
+		{day("2026-04-06"), day("2026-04-10"), 4}, // Mon -> Fri, from not counted
+		{day("2026-04-10"), day("2026-04-16"), 1}, // over the weekend and the holiday
+		{day("2026-04-10"), day("2026-04-10"), 0},
+		{day("2026-04-10"), day("2026-04-06"), -4},
+		{day("2026-04-11"), day("2026-04-15"), 0}, // weekend to holiday
+		{day("2026-04-06").Add(23 * time.Hour), day("2026-04-07").Add(time.Hour), 1},
+	}
+	for _, tt := range tests {
+		if got := cal.WorkingDaysBetween(tt.from, tt.to); got != tt.want {
+			t.Errorf("WorkingDaysBetween(%s, %s) = %d, want %d", tt.from.Format(time.DateTime), tt.to.Format(time.DateTime), got, tt.want)
+		}
+	}
+	if got := cal.WorkingDays(day("2026-04-06"), day("2026-04-10")); got != 5 {
+		t.Errorf("WorkingDays(Mon, Fri) = %d, want 5", got)
+	}
+}
+
+func TestAddWorkingDays(t *testing.T) {
+	cal := songkranCalendar()
+	tests := []struct {
+		from string
+		n    int
+		want string
+	}{
+		{"2026-04-08", 0, "2026-04-08"},
+		{"2026-04-11", 0, "2026-04-16"}, // Saturday: next working day
+		{"2026-04-10", 1, "2026-04-16"},
+		{"2026-04-11", 1, "2026-04-16"},
+		{"2026-04-06", 5, "2026-04-16"},
+		{"2026-04-16", -1, "2026-04-10"},
+		{"2026-04-13", -1, "2026-04-10"},
+		{"2026-04-16", -5, "2026-04-06"},
+	}
+	for _, tt := range tests {
+		if got := cal.AddWorkingDays(day(tt.from), tt.n).Format(dateKey); got != tt.want {
+			t.Errorf("AddWorkingDays(%s, %d) = %s, want %s", tt.from, tt.n, got, tt.want)
+		}
+	}
+}
+
+func TestNextWorkingDay(t *testing.T) {
+	cal := songkranCalendar()
+	tests := []struct{ in, next, prev string }{
+		{"2026-04-08", "2026-04-08", "2026-04-08"},
+		{"2026-04-11", "2026-04-16", "2026-04-10"},
+		{"2026-04-14", "2026-04-16", "2026-04-10"},
+	}
+	for _, tt := range tests {
+		if got := cal.NextWorkingDay(day(tt.in)).Format(dateKey); got != tt.next {
+			t.Errorf("NextWorkingDay(%s) = %s, want %s", tt.in, got, tt.next)
+		}
+		if got := cal.PrevWorkingDay(day(tt.in)).Format(dateKey); got != tt.prev {
+			t.Errorf("PrevWorkingDay(%s) = %s, want %s", tt.in, got, tt.prev)
+		}
+	}
+	if got := cal.NonWorkingReason(day("2026-04-14")); got != "Songkran" {
+		t.Errorf("NonWorkingReason(holiday) = %q", got)
+	}
+
+	// a calendar without working days gives up instead of looping forever
+	closed := &workCalendar{}
+	for i := range closed.weekend {
+		closed.weekend[i] = true
+	}
+	start := day("2026-04-08")
+	want := dayOf(start).AddDate(0, 0, maxCalendarScan).Format(dateKey)
+	if got := closed.NextWorkingDay(start).Format(dateKey); got != want {
+		t.Errorf("NextWorkingDay on a closed calendar = %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,274 @@
+package handlers
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"apiTrackingSystem/internal/utils"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// webhook kinds (sys_department.sd_webhook_type)
+const (
+	webhookTeams   = "teams"
+	webhookSlack   = "slack"
+	webhookLine    = "line"
+	webhookGeneric = "generic"
+)
+
+const webhookContentText = "text/plain; charset=utf-8"
+
+var webhookHTTPClient = &http.Client{Timeout: 10 * time.Second}
+
+func validWebhookType(kind string) bool {
+	switch kind {
+	case webhookTeams, webhookSlack, webhookLine, webhookGeneric:
+		return true
+	}
+	return false
+}
+
+// notifyChannel delivers one outbox message
+type notifyChannel interface {
+	Send(m outboxMessage) error
+}
+
+// smtpChannel sends the message as an email to the comma separated ino_to
+type smtpChannel struct {
+	DB sqlx.Execer // mail log
+}
+
+// Send fails with *recipientsDeferredError when a recipient was only rejected temporarily,
+// so the outbox retries the row for those recipients
+func (s smtpChannel) Send(m outboxMessage) error {
+	res, err := sendMailMessage(s.DB, utils.MailMessage{To: strings.Split(m.To, ","), Subject: m.Subject, Body: m.Body, ContentType: m.ContentType})
+	if to := res.Deferred(); len(to) > 0 {
+		return &recipientsDeferredError{To: to, Result: res}
+	}
+	return err
+}
+
+// recipientsDeferredError lists the recipients of a send that answered with a 4xx reply
+type recipientsDeferredError struct {
+	To     []string
+	Result utils.MailResult
+}
+
+func (e *recipientsDeferredError) Error() string {
+	var msgs []string
+	for _, r := range e.Result.Rejected {
+		if r.Temporary() {
+			msgs = append(msgs, r.Error())
+		}
+	}
+	return "recipients temporarily rejected: " + strings.Join(msgs, "; ")
+}
+
+// webhookChannel posts the message to an incoming webhook (Teams / Slack / LINE Notify / generic JSON)
+type webhookChannel struct {
+	Kind   string
+	URL    string
+	Token  string
+	Client *http.Client
+}
+
+func (w webhookChannel) Send(m outboxMessage) error {
+	var (
+		body        []byte
+		contentType = "application/json"
+		err         error
+	)
+	switch w.Kind {
+	case webhookTeams:
+		body, err = json.Marshal(map[string]string{
+			"@type":    "MessageCard",
+			"@context": "http://schema.org/extensions",
+			"summary":  m.Subject,
+			"title":    m.Subject,
+			"text":     strings.ReplaceAll(m.Body, "\n", "  \n"),
+		})
+	case webhookSlack:
+		body, err = json.Marshal(map[string]string{"text": "*" + m.Subject + "*\n" + m.Body})
+	case webhookLine:
+		// LINE Notify takes a form with the message and the token as bearer
+		body = []byte(url.Values{"message": {"\n" + m.Subject + "\n" + m.Body}}.Encode())
+		contentType = "application/x-www-form-urlencoded"
+	default:
+		body, err = json.Marshal(map[string]string{"title": m.Subject, "text": m.Body})
+	}
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, w.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	if w.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+w.Token)
+	}
+	client := w.Client
+	if client == nil {
+		client = webhookHTTPClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("webhook %s: status %d: %s", w.Kind, resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
+
+// departmentWebhook is the channel configured on a department
+type departmentWebhook struct {
+	Type   sql.NullString `db:"sd_webhook_type"`
+	URL    sql.NullString `db:"sd_webhook_url"`
+	Token  sql.NullString `db:"sd_webhook_token"`
+	Status sql.NullString `db:"sd_status"`
+}
+
+// loadDepartmentWebhook returns the webhook of a department (false when none is configured or the department is inactive)
+func loadDepartmentWebhook(q sqlx.Queryer, sdID int64) (webhookChannel, bool, error) {
+	var d departmentWebhook
+	err := sqlx.Get(q, &d, `SELECT sd_webhook_type, sd_webhook_url, sd_webhook_token, sd_status FROM sys_department WHERE sd_id = ? LIMIT 1`, sdID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return webhookChannel{}, false, nil
+	}
+	if err != nil {
+		return webhookChannel{}, false, err
+	}
+	if strings.TrimSpace(d.URL.String) == "" || (d.Status.Valid && d.Status.String != "active") {
+		return webhookChannel{}, false, nil
+	}
+	kind := d.Type.String
+	if !validWebhookType(kind) {
+		kind = webhookGeneric
+	}
+	return webhookChannel{Kind: kind, URL: strings.TrimSpace(d.URL.String), Token: d.Token.String}, true, nil
+}
+
+// outboxChannel picks the channel of an outbox row; webhook rows hold the sd_id in ino_to and
+// read the department settings at send time, so a changed URL / token applies to queued rows too
+func outboxChannel(q sqlx.Ext, m outboxMessage) (notifyChannel, error) {
+	switch m.Channel {
+	case outboxChannelEmail, "":
+		return smtpChannel{DB: q}, nil
+	case outboxChannelWebhook:
+		sdID, err := strconv.ParseInt(m.To, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("webhook row without department: %q", m.To)
+		}
+		ch, ok, err := loadDepartmentWebhook(q, sdID)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, fmt.Errorf("department %d has no active webhook", sdID)
+		}
+		return webhookForMode(q, ch, sdID), nil
+	}
+	return nil, fmt.Errorf("unknown channel %q", m.Channel)
+}
+
+// webhookForMode applies MAIL_MODE to a department webhook: capture writes the message to
+// info_mail_log instead of posting, redirect posts to WEBHOOK_REDIRECT_URL without the department token.
+// redirect without WEBHOOK_REDIRECT_URL captures, like mail without MAIL_REDIRECT_TO.
+func webhookForMode(db sqlx.Execer, ch webhookChannel, sdID int64) notifyChannel {
+	to := fmt.Sprintf("webhook %s (department %d)", ch.Kind, sdID)
+	switch strings.ToLower(strings.TrimSpace(os.Getenv("MAIL_MODE"))) {
+	case mailModeRedirect:
+		if u := strings.TrimSpace(os.Getenv("WEBHOOK_REDIRECT_URL")); u != "" {
+			return redirectedWebhook{Channel: webhookChannel{Kind: ch.Kind, URL: u, Client: ch.Client}, To: to}
+		}
+		return capturedWebhook{DB: db, To: to}
+	case mailModeCapture:
+		return capturedWebhook{DB: db, To: to}
+	}
+	return ch
+}
+
+// capturedWebhook keeps the message in info_mail_log and posts nothing
+type capturedWebhook struct {
+	DB sqlx.Execer
+	To string
+}
+
+func (w capturedWebhook) Send(m outboxMessage) error {
+	logMail(w.DB, mailModeCapture, []string{w.To}, utils.MailMessage{Subject: m.Subject, Body: m.Body, ContentType: m.ContentType}, utils.MailResult{}, nil)
+	return nil
+}
+
+// redirectedWebhook posts to the test webhook with the real target in the subject
+type redirectedWebhook struct {
+	Channel webhookChannel
+	To      string
+}
+
+func (w redirectedWebhook) Send(m outboxMessage) error {
+	m.Subject = "[to: " + w.To + "] " + m.Subject
+	return w.Channel.Send(m)
+}
+
+// notifyDepartment posts an event to the department channel when the department has a webhook.
+// The text is the subject of the mail template plus the project / items / note as plain lines.
+func notifyDepartment(q sqlx.Ext, sdID int64, event string, data mailData, now time.Time) error {
+	if sdID <= 0 {
+		return nil
+	}
+	if _, ok, err := loadDepartmentWebhook(q, sdID); err != nil || !ok {
+		return err
+	}
+	subject, _, err := renderMail(q, event, defaultMailLang(), data)
+	if err != nil {
+		return err
+	}
+	_, err = q.Exec(`INSERT INTO info_notification_outbox (ino_channel, ino_to, ino_subject, ino_body, ino_content_type, ino_status, ino_attempts, ino_next_attempt_at, ino_created_at, ino_created_by) VALUES (?, ?, ?, ?, ?, ?, 0, ?, ?, ?)`,
+		outboxChannelWebhook, strconv.FormatInt(sdID, 10), subject, notificationText(data), webhookContentText, outboxPending, now, now, "system")
+	return err
+}
+
+// notificationText is the plain text version of a notification (webhooks, inbox)
+func notificationText(d mailData) string {
+	var b strings.Builder
+	if d.ActorName != "" {
+		b.WriteString("By: " + d.ActorName)
+		if d.OnBehalfName != "" {
+			b.WriteString(" on behalf of " + d.OnBehalfName)
+		}
+		b.WriteString("\n")
+	}
+	if p := d.Project; p != nil {
+		fmt.Fprintf(&b, "Project: #%s / %s / %s %s\n", p.Code, p.Model, p.PartNo, p.PartName)
+	}
+	for _, it := range d.Items {
+		b.WriteString("- ")
+		if d.Project == nil && it.ProjectCode != "" {
+			b.WriteString(it.ProjectCode + " / ")
+		}
+		b.WriteString(it.Name + " (" + it.Type + ")")
+		if it.Status != "" {
+			b.WriteString(" - " + it.Status)
+		}
+		b.WriteString("\n")
+	}
+	if d.Note != "" {
+		b.WriteString("Note: " + d.Note + "\n")
+	}
+	return strings.TrimSpace(b.String())
+}
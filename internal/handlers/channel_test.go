@@ -0,0 +1,210 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// webhookRequest is what the stub received
+type webhookRequest struct {
+	ContentType   string
+	Authorization string
+	Body          []byte
+}
+
+// webhookStub answers every POST with status and records the requests
+func webhookStub(t *testing.T, status int) (*httptest.Server, *[]webhookRequest) {
+	t.Helper()
+	got := &[]webhookRequest{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			t.Errorf("method = %s, want POST", r.Method)
+		}
+		body, _ := io.ReadAll(r.Body)
+		*got = append(*got, webhookRequest{ContentType: r.Header.Get("Content-Type"), Authorization: r.Header.Get("Authorization"), Body: body})
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte("stub says no"))
+	}))
+	t.Cleanup(srv.Close)
+	return srv, got
+}
+
+func TestWebhookChannelPayload(t *testing.T) {
+	msg := outboxMessage{Subject: "Item approved", Body: "Project: #P1\n- DFMEA (apqp)"}
+	tests := []struct {
+		kind  string
+		token string
+		check func(t *testing.T, r webhookRequest)
+	}{
+		{webhookTeams, "", func(t *testing.T, r webhookRequest) {
+			var p map[string]string
+			if err := json.Unmarshal(r.Body, &p); err != nil {
+				t.Fatal(err)
+			}
+			if p["@type"] != "MessageCard" || p["title"] != msg.Subject || p["summary"] != msg.Subject {
+				t.Errorf("payload = %v", p)
+			}
+			if p["text"] != "Project: #P1  \n- DFMEA (apqp)" {
+				t.Errorf("text = %q, want markdown line breaks", p["text"])
+			}
+		}},
+		{webhookSlack, "", func(t *testing.T, r webhookRequest) {
+			var p map[string]string
+			if err := json.Unmarshal(r.Body, &p); err != nil {
+				t.Fatal(err)
+			}
+			if want := "*Item approved*\n" + msg.Body; p["text"] != want || len(p) != 1 {
+				t.Errorf("payload = %v, want text %q", p, want)
+			}
+		}},
+		{webhookLine, "line-token", func(t *testing.T, r webhookRequest) {
+			if r.ContentType != "application/x-www-form-urlencoded" {
+				t.Errorf("content type = %q", r.ContentType)
+			}
+			if r.Authorization != "Bearer line-token" {
+				t.Errorf("authorization = %q", r.Authorization)
+			}
+			form, err := url.ParseQuery(string(r.Body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := "\nItem approved\n" + msg.Body; form.Get("message") != want {
+				t.Errorf("message = %q, want %q", form.Get("message"), want)
+			}
+		}},
+		{webhookGeneric, "", func(t *testing.T, r webhookRequest) {
+			var p map[string]string
+			if err := json.Unmarshal(r.Body, &p); err != nil {
+				t.Fatal(err)
+			}
+			if p["title"] != msg.Subject || p["text"] != msg.Body {
+				t.Errorf("payload = %v", p)
+			}
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.kind, func(t *testing.T) {
+			srv, got := webhookStub(t, http.StatusOK)
+			ch := webhookChannel{Kind: tt.kind, URL: srv.URL, Token: tt.token, Client: srv.Client()}
+			if err := ch.Send(msg); err != nil {
+				t.Fatalf("Send: %v", err)
+			}
+			if len(*got) != 1 {
+				t.Fatalf("stub got %d requests, want 1", len(*got))
+			}
+			r := (*got)[0]
+			if tt.kind != webhookLine {
+				if r.ContentType != "application/json" {
+					t.Errorf("content type = %q", r.ContentType)
+				}
+				if r.Authorization != "" {
+					t.Errorf("authorization = %q, want none without a token", r.Authorization)
+				}
+			}
+			tt.check(t, r)
+		})
+	}
+}
+
+func TestWebhookChannelErrorStatus(t *testing.T) {
+	for _, status := range []int{http.StatusBadRequest, http.StatusInternalServerError, http.StatusMultipleChoices} {
+		srv, _ := webhookStub(t, status)
+		ch := webhookChannel{Kind: webhookSlack, URL: srv.URL, Client: srv.Client()}
+		err := ch.Send(outboxMessage{Subject: "s", Body: "b"})
+		if err == nil {
+			t.Fatalf("status %d: Send returned nil", status)
+		}
+		if msg := err.Error(); !strings.Contains(msg, "status "+strconv.Itoa(status)) || !strings.Contains(msg, "stub says no") {
+			t.Errorf("status %d: error = %q, want the status and response text", status, msg)
+		}
+	}
+	srv, _ := webhookStub(t, http.StatusNoContent)
+	if err := (webhookChannel{Kind: webhookGeneric, URL: srv.URL, Client: srv.Client()}).Send(outboxMessage{}); err != nil {
+		t.Errorf("204: Send = %v, want nil", err)
+	}
+}
+
+func TestWebhookChannelTimeout(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	client := srv.Client()
+	client.Timeout = 50 * time.Millisecond
+	start := time.Now()
+	err := webhookChannel{Kind: webhookTeams, URL: srv.URL, Client: client}.Send(outboxMessage{Subject: "s"})
+	if err == nil {
+		t.Fatal("Send returned nil for a server that never answers")
+	}
+	if d := time.Since(start); d > 2*time.Second {
+		t.Errorf("Send took %s, want the client timeout", d)
+	}
+}
+
+// execRecorder is a sqlx.Execer that keeps the statements instead of running them
+type execRecorder struct {
+	queries []string
+	args    [][]interface{}
+}
+
+func (e *execRecorder) Exec(query string, args ...interface{}) (sql.Result, error) {
+	e.queries = append(e.queries, query)
+	e.args = append(e.args, args)
+	return nil, nil
+}
+
+func TestWebhookForMode(t *testing.T) {
+	dept, deptGot := webhookStub(t, http.StatusOK)
+	test, testGot := webhookStub(t, http.StatusOK)
+	ch := webhookChannel{Kind: webhookLine, URL: dept.URL, Token: "dept-token", Client: dept.Client()}
+	msg := outboxMessage{Subject: "Item approved", Body: "b", ContentType: webhookContentText}
+
+	t.Setenv("MAIL_MODE", "capture")
+	db := &execRecorder{}
+	if err := webhookForMode(db, ch, 7).Send(msg); err != nil {
+		t.Fatalf("capture: %v", err)
+	}
+	if len(*deptGot) != 0 {
+		t.Errorf("capture posted %d requests", len(*deptGot))
+	}
+	if len(db.args) != 1 || db.args[0][0] != mailModeCapture || db.args[0][1] != "webhook line (department 7)" || db.args[0][3] != msg.Subject {
+		t.Errorf("mail log rows = %v", db.args)
+	}
+
+	t.Setenv("MAIL_MODE", "redirect")
+	t.Setenv("WEBHOOK_REDIRECT_URL", test.URL)
+	if err := webhookForMode(db, ch, 7).Send(msg); err != nil {
+		t.Fatalf("redirect: %v", err)
+	}
+	if len(*deptGot) != 0 || len(*testGot) != 1 {
+		t.Fatalf("redirect: department got %d, test got %d requests", len(*deptGot), len(*testGot))
+	}
+	r := (*testGot)[0]
+	if r.Authorization != "" {
+		t.Errorf("redirect sent the department token: %q", r.Authorization)
+	}
+	form, _ := url.ParseQuery(string(r.Body))
+	if !strings.Contains(form.Get("message"), "[to: webhook line (department 7)] Item approved") {
+		t.Errorf("message = %q, want the real target in the subject", form.Get("message"))
+	}
+
+	t.Setenv("WEBHOOK_REDIRECT_URL", "")
+	if _, ok := webhookForMode(db, ch, 7).(capturedWebhook); !ok {
+		t.Error("redirect without WEBHOOK_REDIRECT_URL does not capture")
+	}
+	t.Setenv("MAIL_MODE", "")
+	if _, ok := webhookForMode(db, ch, 7).(webhookChannel); !ok {
+		t.Error("live mode does not post to the department webhook")
+	}
+}
@@ -0,0 +1,166 @@
+package handlers
+
+import (
+	"database/sql"
+	"strconv"
+	"strings"
+	"time"
+
+	"apiTrackingSystem/internal/utils"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jmoiron/sqlx"
+)
+
+// delegationActiveSQL is the condition for a sys_delegation row (alias dl) in effect today
+const delegationActiveSQL = `dl.sdl_status = 'active' AND CURDATE() BETWEEN dl.sdl_start_date AND dl.sdl_end_date`
+
+// SysDelegation represents a row in sys_delegation
+type SysDelegation struct {
+	ID                int64            `db:"sdl_id" json:"sdl_id"`
+	SuID              int64            `db:"su_id" json:"su_id"`
+	SuFirstName       utils.NullString `db:"su_firstname" json:"su_firstname"`
+	SuLastName        utils.NullString `db:"su_lastname" json:"su_lastname"`
+	DelegateSuID      int64            `db:"sdl_delegate_su_id" json:"sdl_delegate_su_id"`
+	DelegateFirstName utils.NullString `db:"delegate_firstname" json:"delegate_firstname"`
+	DelegateLastName  utils.NullString `db:"delegate_lastname" json:"delegate_lastname"`
+	SdID              utils.NullInt64  `db:"sd_id" json:"sd_id"`
+	SdName            utils.NullString `db:"sd_name" json:"sd_name"`
+	StartDate         *Date            `db:"sdl_start_date" json:"sdl_start_date"`
+	EndDate           *Date            `db:"sdl_end_date" json:"sdl_end_date"`
+	Note              utils.NullString `db:"sdl_note" json:"sdl_note"`
+	Status            string           `db:"sdl_status" json:"sdl_status"`
+	UpdatedAt         *time.Time       `db:"sdl_updated_at" json:"sdl_updated_at"`
+	UpdatedBy         utils.NullString `db:"sdl_updated_by" json:"sdl_updated_by"`
+}
+
+// ListDelegation lists delegations given by or to su_id
+func ListDelegation(c *fiber.Ctx, db *sqlx.DB) error {
+	query := `SELECT dl.sdl_id, dl.su_id, su.su_firstname, su.su_lastname,
+					 dl.sdl_delegate_su_id, dsu.su_firstname AS delegate_firstname, dsu.su_lastname AS delegate_lastname,
+					 dl.sd_id, sd.sd_name, dl.sdl_start_date, dl.sdl_end_date, dl.sdl_note, dl.sdl_status,
+					 dl.sdl_updated_at, dl.sdl_updated_by
+				FROM sys_delegation dl
+				LEFT JOIN sys_user su ON su.su_id = dl.su_id
+				LEFT JOIN sys_user dsu ON dsu.su_id = dl.sdl_delegate_su_id
+				LEFT JOIN sys_department sd ON sd.sd_id = dl.sd_id`
+	var args []interface{}
+	if suStr := strings.TrimSpace(c.Query("su_id")); suStr != "" {
+		suID, err := strconv.ParseInt(suStr, 10, 64)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "invalid su_id"})
+		}
+		query += ` WHERE dl.su_id = ? OR dl.sdl_delegate_su_id = ?`
+		args = append(args, suID, suID)
+	}
+	query += ` ORDER BY dl.sdl_start_date DESC, dl.sdl_id DESC`
+
+	var res []SysDelegation
+	if err := db.Select(&res, query, args...); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "query error", "detail": err.Error()})
+	}
+	return c.Status(200).JSON(res)
+}
+
+func InsertDelegation(c *fiber.Ctx, db *sqlx.DB) error {
+	var body struct {
+		SuID         int64  `json:"su_id"`
+		DelegateSuID int64  `json:"sdl_delegate_su_id"`
+		SdID         *int64 `json:"sd_id"`
+		StartDate    Date   `json:"sdl_start_date"`
+		EndDate      Date   `json:"sdl_end_date"`
+		Note         string `json:"sdl_note"`
+		CreatedBy    string `json:"sdl_created_by"`
+	}
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid request", "detail": err.Error()})
+	}
+	if body.SuID == 0 || body.DelegateSuID == 0 {
+		return c.Status(400).JSON(fiber.Map{"error": "su_id and sdl_delegate_su_id are required"})
+	}
+	if body.SuID == body.DelegateSuID {
+		return c.Status(400).JSON(fiber.Map{"error": "cannot delegate to yourself"})
+	}
+	if body.StartDate.IsZero() || body.EndDate.IsZero() {
+		return c.Status(400).JSON(fiber.Map{"error": "sdl_start_date and sdl_end_date are required"})
+	}
+	if body.EndDate.Before(body.StartDate.Time) {
+		return c.Status(400).JSON(fiber.Map{"error": "sdl_end_date must be on or after sdl_start_date"})
+	}
+
+	// duplicate check: overlapping active period for the same user + scope
+	var count int
+	if err := db.Get(&count, `SELECT COUNT(*) FROM sys_delegation
+		WHERE su_id = ? AND sd_id <=> ? AND sdl_status = 'active'
+		  AND sdl_start_date <= ? AND sdl_end_date >= ?`, body.SuID, body.SdID, body.EndDate, body.StartDate); err != nil {
+		return c.Status(500).JSON(5)
+	}
+	if count > 0 {
+		return c.Status(200).JSON(2)
+	}
+
+	now := time.Now()
+	if _, err := db.Exec(`INSERT INTO sys_delegation (su_id, sdl_delegate_su_id, sd_id, sdl_start_date, sdl_end_date, sdl_note, sdl_status, sdl_created_at, sdl_created_by, sdl_updated_at, sdl_updated_by)
+		VALUES (?, ?, ?, ?, ?, ?, 'active', ?, ?, ?, ?)`,
+		body.SuID, body.DelegateSuID, body.SdID, body.StartDate, body.EndDate, utils.NewNullString(body.Note), now, body.CreatedBy, now, body.CreatedBy); err != nil {
+		return c.Status(500).JSON(5)
+	}
+	return c.Status(201).JSON(1)
+}
+
+func UpdateDelegationStatus(c *fiber.Ctx, db *sqlx.DB) error {
+	var body struct {
+		ID        int64  `json:"sdl_id"`
+		Status    string `json:"sdl_status"`
+		UpdatedBy string `json:"sdl_updated_by"`
+	}
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid request body", "detail": err.Error()})
+	}
+	if body.ID == 0 {
+		return c.Status(400).JSON(fiber.Map{"error": "sdl_id is required"})
+	}
+	if body.Status != "active" && body.Status != "inactive" {
+		return c.Status(400).JSON(fiber.Map{"error": "sdl_status must be 'active' or 'inactive'"})
+	}
+	res, err := db.Exec(`UPDATE sys_delegation SET sdl_status = ?, sdl_updated_at = ?, sdl_updated_by = ? WHERE sdl_id = ?`, body.Status, time.Now(), body.UpdatedBy, body.ID)
+	if err != nil {
+		return c.Status(500).JSON(5)
+	}
+	ra, _ := res.RowsAffected()
+	if ra == 0 {
+		return c.Status(404).JSON(fiber.Map{"error": "delegation not found"})
+	}
+	return c.Status(200).JSON(1)
+}
+
+// isDelegateOf reports whether delegateSu may act for suID today on an item of sdID
+func isDelegateOf(q sqlx.Queryer, suID, delegateSu int64, sdID interface{}) (bool, error) {
+	var n int
+	err := sqlx.Get(q, &n, `SELECT COUNT(*) FROM sys_delegation dl
+		WHERE dl.su_id = ? AND dl.sdl_delegate_su_id = ? AND `+delegationActiveSQL+`
+		  AND (dl.sd_id IS NULL OR dl.sd_id = ?)`, suID, delegateSu, sdID)
+	return n > 0, err
+}
+
+// activeDelegates returns the users who may act for suID today on an item of sdID
+func activeDelegates(q sqlx.Queryer, suID int64, sdID interface{}) ([]int64, error) {
+	var ids []int64
+	err := sqlx.Select(q, &ids, `SELECT DISTINCT dl.sdl_delegate_su_id FROM sys_delegation dl
+		WHERE dl.su_id = ? AND dl.sdl_delegate_su_id <> dl.su_id AND `+delegationActiveSQL+`
+		  AND (dl.sd_id IS NULL OR dl.sd_id = ?)
+		ORDER BY dl.sdl_delegate_su_id`, suID, sdID)
+	return ids, err
+}
+
+// onBehalfName is the name of the approver a delegate acted for ("" for a decision on the own row)
+func onBehalfName(q sqlx.Queryer, suID int64) string {
+	if suID == 0 {
+		return ""
+	}
+	var first, last sql.NullString
+	if err := q.QueryRowx(`SELECT su_firstname, su_lastname FROM sys_user WHERE su_id = ?`, suID).Scan(&first, &last); err != nil {
+		return strconv.FormatInt(suID, 10)
+	}
+	return fullName(first, last)
+}
@@ -3,6 +3,7 @@ package handlers
 import (
 	"apiTrackingSystem/internal/utils"
 	"database/sql"
+	"net/url"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
@@ -17,6 +18,10 @@ type SysDepartment struct {
 	Email              utils.NullString `db:"sd_email" json:"sd_email"`
 	Status             utils.NullString `db:"sd_status" json:"sd_status"`
 	Code               utils.NullString `db:"sd_code" json:"sd_code"`
+	HeadSuID           utils.NullInt64  `db:"sd_head_su_id" json:"sd_head_su_id"`
+	WebhookType        utils.NullString `db:"sd_webhook_type" json:"sd_webhook_type"`
+	WebhookURL         utils.NullString `db:"sd_webhook_url" json:"sd_webhook_url"`
+	HasWebhookToken    bool             `db:"sd_has_webhook_token" json:"sd_has_webhook_token"`
 	CreatedAt          *time.Time       `db:"sd_created_at" json:"sd_created_at"`
 	CreatedBy          utils.NullString `db:"sd_created_by" json:"sd_created_by"`
 	UpdatedAt          *time.Time       `db:"sd_updated_at" json:"sd_updated_at"`
@@ -37,6 +42,10 @@ func ListDepartments(c *fiber.Ctx, db *sqlx.DB) error {
 				 sd_email AS sd_email,
 				 sd_status AS sd_status,
 				 sd_code AS sd_code,
+				 sd_head_su_id AS sd_head_su_id,
+				 sd_webhook_type AS sd_webhook_type,
+				 sd_webhook_url AS sd_webhook_url,
+				 COALESCE(sd_webhook_token, '') <> '' AS sd_has_webhook_token,
 				 sd_created_at AS sd_created_at,
 				 sd_created_by AS sd_created_by,
 				 sd_updated_at AS sd_updated_at,
@@ -62,33 +71,59 @@ func GetDepartment(c *fiber.Ctx, db *sqlx.DB) error {
 		return c.Status(400).JSON(fiber.Map{"error": "id required"})
 	}
 	var d SysDepartment
-	query := `SELECT sd_id AS sd_id, sd_name AS sd_name, sd_email AS sd_email, sd_status AS sd_status, sd_code AS sd_code, sd_created_at AS sd_created_at, sd_created_by AS sd_created_by, sd_updated_at AS sd_updated_at, sd_updated_by AS sd_updated_by FROM sys_department WHERE sd_id = ? LIMIT 1`
+	query := `SELECT sd_id AS sd_id, sd_name AS sd_name, sd_email AS sd_email, sd_status AS sd_status, sd_code AS sd_code, sd_head_su_id AS sd_head_su_id, sd_webhook_type AS sd_webhook_type, sd_webhook_url AS sd_webhook_url, COALESCE(sd_webhook_token, '') <> '' AS sd_has_webhook_token, sd_created_at AS sd_created_at, sd_created_by AS sd_created_by, sd_updated_at AS sd_updated_at, sd_updated_by AS sd_updated_by FROM sys_department WHERE sd_id = ? LIMIT 1`
 	if err := db.Get(&d, query, id); err != nil {
 		if err == sql.ErrNoRows {
 			return c.Status(404).JSON(fiber.Map{"error": "department not found"})
 		}
 		return c.Status(500).JSON(fiber.Map{"error": "query error", "detail": err.Error()})
 	}
+	setETag(c, db, departmentVersion, id)
 	return c.Status(200).JSON(d)
 }
 
 func UpdateDepartment(c *fiber.Ctx, db *sqlx.DB) error {
 	var body struct {
-		ID        int64  `json:"sd_id"`
-		Email     string `json:"sd_email"`
-		UpdatedBy string `json:"sd_updated_by"`
+		ID       int64  `json:"sd_id"`
+		Email    string `json:"sd_email"`
+		HeadSuID *int64 `json:"sd_head_su_id"`
+		// webhook settings are kept when not sent; an empty string clears them
+		WebhookType  *string `json:"sd_webhook_type"`
+		WebhookURL   *string `json:"sd_webhook_url"`
+		WebhookToken *string `json:"sd_webhook_token"`
+		UpdatedBy    string  `json:"sd_updated_by"`
 	}
 	if err := c.BodyParser(&body); err != nil {
 		return c.Status(400).JSON(fiber.Map{"error": "invalid request", "detail": err.Error()})
 	}
+	if body.WebhookType != nil && *body.WebhookType != "" && !validWebhookType(*body.WebhookType) {
+		return c.Status(400).JSON(fiber.Map{"error": "sd_webhook_type must be 'teams', 'slack', 'line' or 'generic'"})
+	}
+	if body.WebhookURL != nil && *body.WebhookURL != "" {
+		if u, err := url.Parse(*body.WebhookURL); err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+			return c.Status(400).JSON(fiber.Map{"error": "sd_webhook_url must be an http(s) URL"})
+		}
+	}
 	now := time.Now()
-	result, err := db.Exec(`UPDATE sys_department SET sd_email = ?, sd_updated_at = ?, sd_updated_by = ? WHERE sd_id = ?`,
+	// sd_head_su_id is kept when not sent
+	result, err := execVersioned(c, db, departmentVersion, body.ID, `UPDATE sys_department SET sd_email = ?, sd_head_su_id = COALESCE(?, sd_head_su_id),
+			sd_webhook_type = IF(? IS NULL, sd_webhook_type, NULLIF(?, '')),
+			sd_webhook_url = IF(? IS NULL, sd_webhook_url, NULLIF(?, '')),
+			sd_webhook_token = IF(? IS NULL, sd_webhook_token, NULLIF(?, '')),
+			sd_updated_at = ?, sd_updated_by = ? WHERE sd_id = ?`,
 		body.Email,
+		body.HeadSuID,
+		body.WebhookType, body.WebhookType,
+		body.WebhookURL, body.WebhookURL,
+		body.WebhookToken, body.WebhookToken,
 		now,
 		body.UpdatedBy,
 		body.ID,
 	)
 	if err != nil {
+		if isVersionError(err) {
+			return versionError(c, err)
+		}
 		return c.Status(500).JSON(fiber.Map{"error": "update error", "detail": err.Error()})
 	}
 	ra, _ := result.RowsAffected()
@@ -107,13 +142,16 @@ func UpdateDepartmentStatus(c *fiber.Ctx, db *sqlx.DB) error {
 		return c.Status(400).JSON(fiber.Map{"error": "invalid request", "detail": err.Error()})
 	}
 	now := time.Now()
-	result, err := db.Exec(`UPDATE sys_department SET sd_status = ?, sd_updated_at = ?, sd_updated_by = ? WHERE sd_id = ?`,
+	result, err := execVersioned(c, db, departmentVersion, body.ID, `UPDATE sys_department SET sd_status = ?, sd_updated_at = ?, sd_updated_by = ? WHERE sd_id = ?`,
 		body.Status,
 		now,
 		body.UpdatedBy,
 		body.ID,
 	)
 	if err != nil {
+		if isVersionError(err) {
+			return versionError(c, err)
+		}
 		return c.Status(500).JSON(fiber.Map{"error": "update error", "detail": err.Error()})
 	}
 	ra, _ := result.RowsAffected()
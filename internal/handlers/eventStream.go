@@ -0,0 +1,274 @@
+package handlers
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"apiTrackingSystem/internal/utils"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jmoiron/sqlx"
+)
+
+// stream event types
+const (
+	streamItemStatus    = "item_status"
+	streamItemSchedule  = "item_schedule"
+	streamFileUploaded  = "file_uploaded"
+	streamProjectStatus = "project_status"
+)
+
+const (
+	streamHeartbeat = 25 * time.Second
+	streamBuffer    = 32
+)
+
+// streamEvent is one server-sent event. It reaches the users in users (topic user:<su_id>)
+// and every subscriber of the project (topic project:<ip_id>).
+type streamEvent struct {
+	Type   string    `json:"type"`
+	IpID   int64     `json:"ip_id,omitempty"`
+	IpidID int64     `json:"ipid_id,omitempty"`
+	Status string    `json:"status,omitempty"`
+	By     string    `json:"by,omitempty"`
+	At     time.Time `json:"at"`
+	users  []int64
+}
+
+// streamSub is one connected client
+type streamSub struct {
+	suID     int64
+	projects map[int64]bool
+	ch       chan streamEvent
+}
+
+// eventHub fans events out to the connected clients of this process
+type eventHub struct {
+	mu   sync.RWMutex
+	subs map[*streamSub]struct{}
+}
+
+var streamHub = &eventHub{subs: map[*streamSub]struct{}{}}
+
+func (h *eventHub) subscribe(s *streamSub) {
+	h.mu.Lock()
+	h.subs[s] = struct{}{}
+	h.mu.Unlock()
+}
+
+func (h *eventHub) unsubscribe(s *streamSub) {
+	h.mu.Lock()
+	delete(h.subs, s)
+	h.mu.Unlock()
+}
+
+func (h *eventHub) empty() bool {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return len(h.subs) == 0
+}
+
+// publish delivers an event without blocking; a client whose buffer is full misses it
+func (h *eventHub) publish(ev streamEvent) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	for s := range h.subs {
+		if !s.wants(ev) {
+			continue
+		}
+		select {
+		case s.ch <- ev:
+		default:
+		}
+	}
+}
+
+func (s *streamSub) wants(ev streamEvent) bool {
+	if ev.IpID > 0 && s.projects[ev.IpID] {
+		return true
+	}
+	for _, u := range ev.users {
+		if u == s.suID {
+			return true
+		}
+	}
+	return false
+}
+
+// streamSecret signs the stream tokens (JWT_SECRET)
+func streamSecret() string {
+	return os.Getenv("JWT_SECRET")
+}
+
+// streamTokenTTL is STREAM_TOKEN_TTL (default 12h)
+func streamTokenTTL() time.Duration {
+	if d, err := time.ParseDuration(strings.TrimSpace(os.Getenv("STREAM_TOKEN_TTL"))); err == nil && d > 0 {
+		return d
+	}
+	return 12 * time.Hour
+}
+
+// streamProjects returns the projects a user may follow: those they own an item of, approve an item of
+// or created (trackingInvolvement), plus the projects with items assigned to their department
+func streamProjects(q sqlx.Queryer, suID int64) (map[int64]bool, error) {
+	var ids []int64
+	err := sqlx.Select(q, &ids, `SELECT i.ip_id FROM (`+involvementSelect+`) i WHERE i.su_id = ?
+		UNION
+		SELECT COALESCE(ai.ip_id, pi.ip_id) AS ip_id
+		FROM sys_user su
+		JOIN info_project_item_detail pid ON pid.sd_id = su.sd_id
+		LEFT JOIN info_apqp_item ai ON ai.iai_id = pid.ref_id AND pid.ipid_type = 'apqp'
+		LEFT JOIN info_ppap_item pi ON pi.ipi_id = pid.ref_id AND pid.ipid_type = 'ppap'
+		WHERE su.su_id = ? AND COALESCE(ai.ip_id, pi.ip_id) IS NOT NULL`, suID, suID)
+	if err != nil {
+		return nil, err
+	}
+	res := make(map[int64]bool, len(ids))
+	for _, id := range ids {
+		res[id] = true
+	}
+	return res, nil
+}
+
+// StreamEvents is the Server-Sent Events endpoint.
+// Query: token (from Login, or "Authorization: Bearer <token>"), projects=1,2 to follow projects
+// (limited to streamProjects).
+// The user always receives the events of the items they own or approve.
+func StreamEvents(c *fiber.Ctx, db *sqlx.DB) error {
+	token := c.Query("token")
+	if token == "" {
+		token = strings.TrimSpace(strings.TrimPrefix(c.Get(fiber.HeaderAuthorization), "Bearer "))
+	}
+	suID, err := utils.VerifyUserToken(streamSecret(), token, time.Now())
+	if err != nil {
+		if errors.Is(err, utils.ErrTokenExpired) {
+			return c.Status(401).JSON(fiber.Map{"error": "token expired"})
+		}
+		return c.Status(401).JSON(fiber.Map{"error": "invalid token"})
+	}
+
+	// only projects the user is involved in can be followed; others are dropped
+	allowed, err := streamProjects(db, suID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "query error", "detail": err.Error()})
+	}
+	sub := &streamSub{suID: suID, projects: map[int64]bool{}, ch: make(chan streamEvent, streamBuffer)}
+	for _, p := range strings.Split(c.Query("projects"), ",") {
+		if id, err := strconv.ParseInt(strings.TrimSpace(p), 10, 64); err == nil && allowed[id] {
+			sub.projects[id] = true
+		}
+	}
+
+	c.Set(fiber.HeaderContentType, "text/event-stream")
+	c.Set(fiber.HeaderCacheControl, "no-cache")
+	c.Set(fiber.HeaderConnection, "keep-alive")
+	c.Set("X-Accel-Buffering", "no")
+
+	streamHub.subscribe(sub)
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		defer streamHub.unsubscribe(sub)
+
+		ticker := time.NewTicker(streamHeartbeat)
+		defer ticker.Stop()
+
+		fmt.Fprintf(w, "retry: 5000\nevent: ready\ndata: {\"su_id\":%d}\n\n", suID)
+		if err := w.Flush(); err != nil {
+			return
+		}
+		for {
+			select {
+			case ev := <-sub.ch:
+				b, err := json.Marshal(ev)
+				if err != nil {
+					continue
+				}
+				fmt.Fprintf(w, "event: %s\ndata: %s\n\n", ev.Type, b)
+			case <-ticker.C:
+				fmt.Fprint(w, ": ping\n\n")
+			}
+			// a closed connection shows up as a flush error
+			if err := w.Flush(); err != nil {
+				return
+			}
+		}
+	})
+	return nil
+}
+
+// publishItemEvents pushes an event per item to its owner, its active approvers and the project topic.
+// Call it after the commit; the current item status is read back.
+func publishItemEvents(db *sqlx.DB, typ string, ipidIDs []int64, by string) {
+	if streamHub.empty() || len(ipidIDs) == 0 {
+		return
+	}
+	q, args, err := sqlx.In(`SELECT pid.ipid_id, COALESCE(ai.ip_id, pi.ip_id, 0) AS ip_id, COALESCE(pid.ipid_status, '') AS ipid_status, pid.su_id
+		FROM info_project_item_detail pid
+		LEFT JOIN info_apqp_item ai ON ai.iai_id = pid.ref_id AND pid.ipid_type = 'apqp'
+		LEFT JOIN info_ppap_item pi ON pi.ipi_id = pid.ref_id AND pid.ipid_type = 'ppap'
+		WHERE pid.ipid_id IN (?)`, ipidIDs)
+	if err != nil {
+		return
+	}
+	var items []struct {
+		IpidID int64           `db:"ipid_id"`
+		IpID   int64           `db:"ip_id"`
+		Status string          `db:"ipid_status"`
+		SuID   utils.NullInt64 `db:"su_id"`
+	}
+	if err := db.Select(&items, db.Rebind(q), args...); err != nil {
+		log.Printf("stream: load items: %v", err)
+		return
+	}
+
+	q, args, err = sqlx.In(`SELECT ipid_id, su_id FROM info_approval WHERE ipid_id IN (?) AND ia_status_flg = 'active'`, ipidIDs)
+	if err != nil {
+		return
+	}
+	var approvers []struct {
+		IpidID int64 `db:"ipid_id"`
+		SuID   int64 `db:"su_id"`
+	}
+	if err := db.Select(&approvers, db.Rebind(q), args...); err != nil {
+		log.Printf("stream: load approvers: %v", err)
+		return
+	}
+
+	now := time.Now()
+	for _, it := range items {
+		ev := streamEvent{Type: typ, IpID: it.IpID, IpidID: it.IpidID, Status: it.Status, By: by, At: now}
+		if it.SuID.Valid {
+			ev.users = append(ev.users, it.SuID.Int64)
+		}
+		for _, a := range approvers {
+			if a.IpidID == it.IpidID {
+				ev.users = append(ev.users, a.SuID)
+			}
+		}
+		streamHub.publish(ev)
+	}
+}
+
+// publishProjectEvent pushes a project status change to the project topic, its creator and its item owners
+func publishProjectEvent(db *sqlx.DB, ipID int64, status, by string) {
+	if streamHub.empty() || ipID <= 0 {
+		return
+	}
+	ev := streamEvent{Type: streamProjectStatus, IpID: ipID, Status: status, By: by, At: time.Now()}
+	if err := db.Select(&ev.users, `SELECT su_id FROM sys_user WHERE su_emp_code = (SELECT ip_created_by FROM info_project WHERE ip_id = ?)
+		UNION
+		SELECT pid.su_id FROM info_project_item_detail pid
+		LEFT JOIN info_apqp_item ai ON ai.iai_id = pid.ref_id AND pid.ipid_type = 'apqp'
+		LEFT JOIN info_ppap_item pi ON pi.ipi_id = pid.ref_id AND pid.ipid_type = 'ppap'
+		WHERE COALESCE(ai.ip_id, pi.ip_id) = ? AND pid.su_id IS NOT NULL`, ipID, ipID); err != nil {
+		log.Printf("stream: load project users: %v", err)
+	}
+	streamHub.publish(ev)
+}
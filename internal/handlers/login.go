@@ -4,10 +4,13 @@ import (
 	"bytes"
 	"database/sql"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 	"time"
 
 	"apiTrackingSystem/internal/models"
+	"apiTrackingSystem/internal/utils"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/jmoiron/sqlx"
@@ -23,28 +26,16 @@ func Login(c *fiber.Ctx, db *sqlx.DB) error {
 		return c.Status(400).JSON(fiber.Map{"error": "username and password required"})
 	}
 
-	// Prepare request to external auth service
-	extURL := "http://192.168.161.102:9999/login"
-	reqBody := map[string]string{
-		"username": loginReq.Username,
-		"password": loginReq.Password,
-	}
-	b, _ := json.Marshal(reqBody)
-
-	httpClient := &http.Client{Timeout: 10 * time.Second}
-	resp, err := httpClient.Post(extURL, "application/json", bytes.NewReader(b))
+	extResp, err := externalLogin(loginReq.Username, loginReq.Password)
 	if err != nil {
-		return c.Status(502).JSON(fiber.Map{"error": "failed to contact auth service", "detail": err.Error()})
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return c.Status(502).JSON(fiber.Map{"error": "auth service returned non-200", "status": resp.Status})
-	}
-
-	var extResp models.ExternalLoginResponse
-	if err := json.NewDecoder(resp.Body).Decode(&extResp); err != nil {
-		return c.Status(502).JSON(fiber.Map{"error": "invalid response from auth service", "detail": err.Error()})
+		switch {
+		case errors.Is(err, errAuthUnreachable):
+			return c.Status(502).JSON(fiber.Map{"error": "failed to contact auth service", "detail": err.Error()})
+		case errors.Is(err, errAuthRejected):
+			return c.Status(502).JSON(fiber.Map{"error": "auth service returned non-200", "detail": err.Error()})
+		default:
+			return c.Status(502).JSON(fiber.Map{"error": "invalid response from auth service", "detail": err.Error()})
+		}
 	}
 
 	// Use department fields
@@ -83,11 +74,12 @@ func Login(c *fiber.Ctx, db *sqlx.DB) error {
 	if err != nil {
 		if err == sql.ErrNoRows {
 			// insert new user, use default spgID
-			_, err := db.Exec(`INSERT INTO sys_user (su_username, su_emp_code, su_firstname, su_lastname, su_email, su_status, spg_id, sd_id, su_created_at, su_created_by, su_updated_at, su_updated_by) VALUES (?, ?, ?, ?, ?, 'active', ?, ?, ?, ?, ?, ?)`,
+			res, err := db.Exec(`INSERT INTO sys_user (su_username, su_emp_code, su_firstname, su_lastname, su_email, su_status, spg_id, sd_id, su_created_at, su_created_by, su_updated_at, su_updated_by) VALUES (?, ?, ?, ?, ?, 'active', ?, ?, ?, ?, ?, ?)`,
 				extResp.User.Username, extResp.User.EmployeeID, extResp.User.Name, extResp.User.Surname, extResp.User.Email, spgID, sdID, now, extResp.User.EmployeeID, now, extResp.User.EmployeeID)
 			if err != nil {
 				return c.Status(500).JSON(fiber.Map{"error": "failed to insert user", "detail": err.Error()})
 			}
+			suID, _ = res.LastInsertId()
 		} else {
 			return c.Status(500).JSON(fiber.Map{"error": "failed to query user", "detail": err.Error()})
 		}
@@ -105,6 +97,11 @@ func Login(c *fiber.Ctx, db *sqlx.DB) error {
 	// 	}
 	// }
 
+	streamToken, err := utils.SignUserToken(streamSecret(), suID, now.Add(streamTokenTTL()))
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to sign stream token", "detail": err.Error()})
+	}
+
 	// Return the required payload
 	out := fiber.Map{
 		"su_id":       suID,
@@ -113,7 +110,44 @@ func Login(c *fiber.Ctx, db *sqlx.DB) error {
 		"displayName": extResp.User.DisplayName,
 		"spg_id":      spgID,
 		"employeeID":  extResp.User.EmployeeID,
+		// token for the event stream (StreamEvents)
+		"stream_token":            streamToken,
+		"stream_token_expires_at": now.Add(streamTokenTTL()),
 	}
 
 	return c.Status(200).JSON(out)
 }
+
+// external auth service errors
+var (
+	errAuthUnreachable = errors.New("failed to contact auth service")
+	errAuthRejected    = errors.New("auth service returned non-200")
+	errAuthInvalid     = errors.New("invalid response from auth service")
+)
+
+// externalLogin checks username/password against the external auth service
+func externalLogin(username, password string) (models.ExternalLoginResponse, error) {
+	var extResp models.ExternalLoginResponse
+
+	extURL := "http://192.168.161.102:9999/login"
+	reqBody := map[string]string{
+		"username": username,
+		"password": password,
+	}
+	b, _ := json.Marshal(reqBody)
+
+	httpClient := &http.Client{Timeout: 10 * time.Second}
+	resp, err := httpClient.Post(extURL, "application/json", bytes.NewReader(b))
+	if err != nil {
+		return extResp, fmt.Errorf("%w: %v", errAuthUnreachable, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return extResp, fmt.Errorf("%w: %s", errAuthRejected, resp.Status)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&extResp); err != nil {
+		return extResp, fmt.Errorf("%w: %v", errAuthInvalid, err)
+	}
+	return extResp, nil
+}
@@ -0,0 +1,203 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"apiTrackingSystem/internal/utils"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jmoiron/sqlx"
+)
+
+// mail modes (MAIL_MODE)
+const (
+	mailModeLive     = "live"     // send to the real recipients
+	mailModeRedirect = "redirect" // send everything to MAIL_REDIRECT_TO instead
+	mailModeCapture  = "capture"  // send nothing, only write info_mail_log
+)
+
+// mail log statuses (info_mail_log.iml_status)
+const (
+	mailLogSent     = "sent"
+	mailLogPartial  = "partial" // some recipients were rejected
+	mailLogFailed   = "failed"
+	mailLogCaptured = "captured"
+)
+
+// mailMode returns MAIL_MODE (default live) and the redirect addresses.
+// redirect without MAIL_REDIRECT_TO falls back to capture so nothing reaches real users.
+func mailMode() (string, []string) {
+	mode := strings.ToLower(strings.TrimSpace(os.Getenv("MAIL_MODE")))
+	switch mode {
+	case mailModeRedirect:
+		var to []string
+		for _, a := range strings.Split(os.Getenv("MAIL_REDIRECT_TO"), ",") {
+			if a = strings.TrimSpace(a); a != "" {
+				to = append(to, a)
+			}
+		}
+		if len(to) == 0 {
+			log.Printf("mail: MAIL_MODE=redirect without MAIL_REDIRECT_TO, capturing instead")
+			return mailModeCapture, nil
+		}
+		return mailModeRedirect, to
+	case mailModeCapture:
+		return mailModeCapture, nil
+	}
+	return mailModeLive, nil
+}
+
+// mailAttachmentInfo is the attachment metadata kept in iml_attachments (the data is not stored)
+type mailAttachmentInfo struct {
+	Name        string `json:"name"`
+	ContentType string `json:"content_type"`
+	Size        int    `json:"size"`
+	Inline      bool   `json:"inline,omitempty"`
+}
+
+func mailAttachmentInfos(msg utils.MailMessage) []mailAttachmentInfo {
+	infos := []mailAttachmentInfo{}
+	for _, a := range msg.Inline {
+		infos = append(infos, mailAttachmentInfo{Name: a.Name, ContentType: a.ContentType, Size: len(a.Data), Inline: true})
+	}
+	for _, a := range msg.Attachments {
+		infos = append(infos, mailAttachmentInfo{Name: a.Name, ContentType: a.ContentType, Size: len(a.Data)})
+	}
+	return infos
+}
+
+// logMail writes the outbound mail log; a failure to log never fails the send
+func logMail(db sqlx.Execer, mode string, to []string, msg utils.MailMessage, res utils.MailResult, sendErr error) {
+	if db == nil {
+		return
+	}
+	status := mailLogSent
+	switch {
+	case mode == mailModeCapture:
+		status = mailLogCaptured
+	case sendErr != nil:
+		status = mailLogFailed
+	case len(res.Rejected) > 0:
+		status = mailLogPartial
+	}
+
+	var errText []string
+	if sendErr != nil {
+		errText = append(errText, sendErr.Error())
+	}
+	for _, r := range res.Rejected {
+		errText = append(errText, r.Error())
+	}
+	var delivered utils.NullString
+	if mode != mailModeCapture {
+		delivered = utils.NewNullString(strings.Join(msg.To, ", "))
+	}
+	attachments, _ := json.Marshal(mailAttachmentInfos(msg))
+
+	if _, err := db.Exec(`INSERT INTO info_mail_log (iml_mode, iml_to, iml_delivered_to, iml_subject, iml_content_type, iml_body, iml_attachments, iml_status, iml_message_id, iml_error, iml_created_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		mode, strings.Join(to, ", "), delivered, msg.Subject, msg.ContentType, msg.Body, string(attachments), status,
+		utils.NewNullString(res.MessageID), utils.NewNullString(strings.Join(errText, "\n")), time.Now()); err != nil {
+		log.Printf("mail: write mail log: %v", err)
+	}
+}
+
+// InfoMailLog is one outbound mail (body only in GetMailLog)
+type InfoMailLog struct {
+	ImlID       int64                `db:"iml_id" json:"iml_id"`
+	Mode        string               `db:"iml_mode" json:"iml_mode"`
+	To          string               `db:"iml_to" json:"iml_to"`
+	DeliveredTo utils.NullString     `db:"iml_delivered_to" json:"iml_delivered_to"`
+	Subject     string               `db:"iml_subject" json:"iml_subject"`
+	ContentType string               `db:"iml_content_type" json:"iml_content_type"`
+	Body        *string              `db:"iml_body" json:"iml_body,omitempty"`
+	RawAttach   sql.NullString       `db:"iml_attachments" json:"-"`
+	Attachments []mailAttachmentInfo `db:"-" json:"attachments"`
+	Status      string               `db:"iml_status" json:"iml_status"`
+	MessageID   utils.NullString     `db:"iml_message_id" json:"iml_message_id"`
+	Error       utils.NullString     `db:"iml_error" json:"iml_error"`
+	CreatedAt   time.Time            `db:"iml_created_at" json:"iml_created_at"`
+}
+
+func (m *InfoMailLog) decodeAttachments() {
+	m.Attachments = []mailAttachmentInfo{}
+	if m.RawAttach.Valid {
+		_ = json.Unmarshal([]byte(m.RawAttach.String), &m.Attachments)
+	}
+}
+
+// ListMailLog lists outbound mails, newest first.
+// Query: status (sent|partial|failed|captured), mode, to (part of an address), limit (default 100), before_id for the next page.
+func ListMailLog(c *fiber.Ctx, db *sqlx.DB) error {
+	limit := 100
+	if n, err := strconv.Atoi(c.Query("limit")); err == nil && n > 0 && n <= 500 {
+		limit = n
+	}
+	q := `SELECT iml_id, iml_mode, iml_to, iml_delivered_to, iml_subject, iml_content_type, iml_attachments, iml_status, iml_message_id, iml_error, iml_created_at
+		FROM info_mail_log WHERE 1 = 1`
+	args := []interface{}{}
+	if status := strings.TrimSpace(c.Query("status")); status != "" {
+		q += ` AND iml_status = ?`
+		args = append(args, status)
+	}
+	if mode := strings.TrimSpace(c.Query("mode")); mode != "" {
+		q += ` AND iml_mode = ?`
+		args = append(args, mode)
+	}
+	if to := strings.TrimSpace(c.Query("to")); to != "" {
+		q += ` AND iml_to LIKE ?`
+		args = append(args, "%"+to+"%")
+	}
+	if before, err := strconv.ParseInt(c.Query("before_id"), 10, 64); err == nil && before > 0 {
+		q += ` AND iml_id < ?`
+		args = append(args, before)
+	}
+	q += ` ORDER BY iml_id DESC LIMIT ?`
+	args = append(args, limit)
+
+	rows := []InfoMailLog{}
+	if err := db.Select(&rows, q, args...); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "query error", "detail": err.Error()})
+	}
+	for i := range rows {
+		rows[i].decodeAttachments()
+	}
+	mode, redirect := mailMode()
+	return c.Status(200).JSON(fiber.Map{"mode": mode, "redirect_to": redirect, "items": rows})
+}
+
+// GetMailLog returns one outbound mail with its rendered body (?iml_id=, ?format=html returns the body as a page)
+func GetMailLog(c *fiber.Ctx, db *sqlx.DB) error {
+	id, err := strconv.ParseInt(c.Query("iml_id"), 10, 64)
+	if err != nil || id <= 0 {
+		return c.Status(400).JSON(fiber.Map{"error": "iml_id is required"})
+	}
+	var row InfoMailLog
+	if err := db.Get(&row, `SELECT iml_id, iml_mode, iml_to, iml_delivered_to, iml_subject, iml_content_type, iml_body, iml_attachments, iml_status, iml_message_id, iml_error, iml_created_at
+		FROM info_mail_log WHERE iml_id = ?`, id); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return c.Status(404).JSON(fiber.Map{"error": "mail not found"})
+		}
+		return c.Status(500).JSON(fiber.Map{"error": "query error", "detail": err.Error()})
+	}
+	row.decodeAttachments()
+	if c.Query("format") == "html" {
+		body := ""
+		if row.Body != nil {
+			body = *row.Body
+		}
+		if strings.HasPrefix(row.ContentType, "text/html") {
+			c.Type("html", "utf-8")
+		} else {
+			c.Type("txt", "utf-8")
+		}
+		return c.SendString(body)
+	}
+	return c.Status(200).JSON(row)
+}
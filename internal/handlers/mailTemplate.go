@@ -0,0 +1,535 @@
+package handlers
+
+import (
+	"bytes"
+	"database/sql"
+	"embed"
+	"errors"
+	"html/template"
+	"os"
+	"strings"
+	texttemplate "text/template"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jmoiron/sqlx"
+)
+
+//go:embed mailtemplates
+var mailTemplateFS embed.FS
+
+// mail languages (sys_user.su_language)
+const (
+	mailLangEN = "en"
+	mailLangTH = "th"
+)
+
+const mailLoginURL = "http://192.168.161.205:4005/login"
+
+// mail template keys
+const (
+	mailWaitingUpload     = "waiting_upload"
+	mailWaitingApproval   = "waiting_approval"
+	mailItemApproved      = "item_approved"
+	mailItemRejected      = "item_rejected"
+	mailFileRejected      = "file_rejected"
+	mailFileApproved      = "file_approved"
+	mailFileApprovedPC    = "file_approved_pc"
+	mailApprovalResult    = "approval_result"
+	mailApprovalReminder  = "approval_reminder"
+	mailApprovalEscalated = "approval_escalated"
+	mailTrackingReport    = "tracking_report"
+	mailDigest            = "digest"
+)
+
+var mailTemplateKeys = []string{
+	mailWaitingUpload, mailWaitingApproval, mailItemApproved, mailItemRejected, mailFileRejected, mailFileApproved,
+	mailFileApprovedPC, mailApprovalResult, mailApprovalReminder, mailApprovalEscalated, mailTrackingReport,
+	mailDigest,
+}
+
+// mailSubjects are the built-in subjects (text/template over mailData)
+var mailSubjects = map[string]map[string]string{
+	mailWaitingUpload: {
+		mailLangEN: "TBKK Project Control Notification : waiting upload file",
+		mailLangTH: "TBKK Project Control แจ้งเตือน : รออัปโหลดไฟล์",
+	},
+	mailWaitingApproval: {
+		mailLangEN: "TBKK Project Control Notification : waiting {{if .Stage}}{{.Stage}} {{end}}Approval",
+		mailLangTH: "TBKK Project Control แจ้งเตือน : รอการอนุมัติ{{if .Stage}} ({{.Stage}}){{end}}",
+	},
+	mailItemApproved: {
+		mailLangEN: "TBKK Project Control Notification : Item Approved",
+		mailLangTH: "TBKK Project Control แจ้งเตือน : รายการได้รับการอนุมัติ",
+	},
+	mailItemRejected: {
+		mailLangEN: "TBKK Project Control Notification : Item Rejected",
+		mailLangTH: "TBKK Project Control แจ้งเตือน : รายการถูกปฏิเสธ",
+	},
+	mailFileRejected: {
+		mailLangEN: "TBKK Project Control Notification : Your project has been rejected",
+		mailLangTH: "TBKK Project Control แจ้งเตือน : โปรเจคของคุณถูกปฏิเสธ",
+	},
+	mailFileApproved: {
+		mailLangEN: "TBKK Project Control Notification : File Approved",
+		mailLangTH: "TBKK Project Control แจ้งเตือน : ไฟล์ได้รับการอนุมัติ",
+	},
+	mailFileApprovedPC: {
+		mailLangEN: "TBKK Project Control Notification : waiting Approval",
+		mailLangTH: "TBKK Project Control แจ้งเตือน : รอการอนุมัติ",
+	},
+	mailApprovalResult: {
+		mailLangEN: "TBKK Project Control Notification : Approval Result",
+		mailLangTH: "TBKK Project Control แจ้งเตือน : ผลการอนุมัติ",
+	},
+	mailApprovalReminder: {
+		mailLangEN: "TBKK Project Control Notification : Approval Reminder",
+		mailLangTH: "TBKK Project Control แจ้งเตือน : เตือนรายการรออนุมัติ",
+	},
+	mailApprovalEscalated: {
+		mailLangEN: "TBKK Project Control Notification : Escalated Approval",
+		mailLangTH: "TBKK Project Control แจ้งเตือน : รายการอนุมัติถูกส่งต่อ",
+	},
+	mailTrackingReport: {
+		mailLangEN: "Project Items Awaiting Your Approval",
+		mailLangTH: "รายการโปรเจคที่รอการอนุมัติ",
+	},
+	mailDigest: {
+		mailLangEN: "TBKK Project Control Notification : {{.Days}} notification(s) summary",
+		mailLangTH: "TBKK Project Control แจ้งเตือน : สรุป {{.Days}} การแจ้งเตือน",
+	},
+}
+
+// mailLabels are the fixed texts of the shared layout
+var mailLabels = map[string]map[string]string{
+	mailLangEN: {
+		"dear":                 "Dear, K.",
+		"project_detail":       "Project Detail",
+		"project_detail_sub":   "Item Information (ข้อมูลของรายการโปรเจค)",
+		"project_code":         "PROJECT CODE",
+		"model":                "MODEL",
+		"template":             "TEMPLATE",
+		"part_no":              "PART NO",
+		"part_name":            "PART NAME",
+		"no":                   "No.",
+		"item_name":            "Item Name",
+		"item_type":            "Item Type",
+		"start_date":           "Start Date",
+		"end_date":             "End Date",
+		"status":               "Status",
+		"note":                 "Note:",
+		"approval_note":        "Approval Note:",
+		"reason_for_rejection": "Reason for Rejection:",
+		"received_at":          "Received",
+		"open_project":         "Open Project Management",
+		"regards":              "Best Regards,",
+		"team":                 "System Service Department",
+	},
+	mailLangTH: {
+		"dear":                 "เรียน คุณ",
+		"project_detail":       "รายละเอียดโปรเจค",
+		"project_detail_sub":   "ข้อมูลของรายการโปรเจค",
+		"project_code":         "รหัสโปรเจค",
+		"model":                "โมเดล",
+		"template":             "เทมเพลต",
+		"part_no":              "หมายเลขชิ้นส่วน",
+		"part_name":            "ชื่อชิ้นส่วน",
+		"no":                   "ลำดับ",
+		"item_name":            "ชื่อรายการ",
+		"item_type":            "ประเภท",
+		"start_date":           "วันที่เริ่ม",
+		"end_date":             "วันที่สิ้นสุด",
+		"status":               "สถานะ",
+		"note":                 "หมายเหตุ:",
+		"approval_note":        "หมายเหตุการอนุมัติ:",
+		"reason_for_rejection": "เหตุผลที่ปฏิเสธ:",
+		"received_at":          "วันที่แจ้ง",
+		"open_project":         "เปิด Project Management",
+		"regards":              "ขอแสดงความนับถือ",
+		"team":                 "System Service Department",
+	},
+}
+
+// mailProject is the project card of a mail
+type mailProject struct {
+	Code     string
+	Model    string
+	PartNo   string
+	PartName string
+	Template string
+}
+
+// mailItem is one row of the item table
+type mailItem struct {
+	IpID        int64 // project of the row, used by the notification scope
+	ProjectCode string
+	PartNo      string
+	Name        string
+	Type        string
+	Start       string
+	End         string
+	Status      string
+}
+
+// mailSection is one event of a digest mail
+type mailSection struct {
+	Title   string
+	At      string
+	Project *mailProject
+	Items   []mailItem
+	Note    string
+}
+
+// mailData is what a mail template can use
+type mailData struct {
+	IpID               int64 // project the mail is about, used by the notification scope
+	IpidID             int64 // item of a single-item notification, linked from the inbox
+	Lang               string
+	RecipientName      string
+	ActorName          string
+	OnBehalfName       string // approver ActorName acted for through a delegation
+	Stage              string
+	Days               int
+	Note               string
+	NoteLabel          string // key of mailLabels shown above the note
+	NoteReject         bool
+	Project            *mailProject
+	Items              []mailItem
+	ShowProjectColumns bool
+	ShowDates          bool
+	ShowStatus         bool
+	Sections           []mailSection // events of a digest
+	LoginURL           string
+}
+
+// mailProjectOf builds the project card from the nullable columns used by the mail queries
+func mailProjectOf(code, model, partNo, partName sql.NullString) *mailProject {
+	return &mailProject{
+		Code:     getStringValue(code),
+		Model:    getStringValue(model),
+		PartNo:   getStringValue(partNo),
+		PartName: getStringValue(partName),
+	}
+}
+
+func validMailLang(lang string) bool {
+	return lang == mailLangEN || lang == mailLangTH
+}
+
+func validMailKey(key string) bool {
+	_, ok := mailSubjects[key]
+	return ok
+}
+
+// defaultMailLang is MAIL_DEFAULT_LANG (th / en, default en)
+func defaultMailLang() string {
+	if l := strings.ToLower(strings.TrimSpace(os.Getenv("MAIL_DEFAULT_LANG"))); validMailLang(l) {
+		return l
+	}
+	return mailLangEN
+}
+
+// userMailLang is the mail language of a user (sys_user.su_language, MAIL_DEFAULT_LANG when unset)
+func userMailLang(lang sql.NullString) string {
+	if l := strings.ToLower(strings.TrimSpace(lang.String)); validMailLang(l) {
+		return l
+	}
+	return defaultMailLang()
+}
+
+// builtinMailTemplate returns the built-in subject and body of a template
+func builtinMailTemplate(key, lang string) (string, string) {
+	subject := mailSubjects[key][lang]
+	body, err := mailTemplateFS.ReadFile("mailtemplates/" + lang + "/" + key + ".html")
+	if err != nil && lang != mailLangEN {
+		return builtinMailTemplate(key, mailLangEN)
+	}
+	return subject, string(body)
+}
+
+// mailTemplateSource returns the subject and body of a template: the active mst_email_template
+// override where set, the built-in text otherwise
+func mailTemplateSource(q sqlx.Queryer, key, lang string) (string, string, error) {
+	subject, body := builtinMailTemplate(key, lang)
+	var o struct {
+		Subject sql.NullString `db:"met_subject"`
+		Body    sql.NullString `db:"met_body"`
+	}
+	err := sqlx.Get(q, &o, `SELECT met_subject, met_body FROM mst_email_template WHERE met_key = ? AND met_lang = ? AND met_status = 'active' LIMIT 1`, key, lang)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return subject, body, err
+	}
+	if strings.TrimSpace(o.Subject.String) != "" {
+		subject = o.Subject.String
+	}
+	if strings.TrimSpace(o.Body.String) != "" {
+		body = o.Body.String
+	}
+	return subject, body, nil
+}
+
+// renderMailTemplate renders a subject (text) and a body (HTML inside the shared layout)
+func renderMailTemplate(subjectSrc, bodySrc, lang string, data mailData) (string, string, error) {
+	data.Lang = lang
+	if data.LoginURL == "" {
+		data.LoginURL = mailLoginURL
+	}
+	if data.NoteLabel == "" {
+		data.NoteLabel = "note"
+	}
+
+	st, err := texttemplate.New("subject").Parse(subjectSrc)
+	if err != nil {
+		return "", "", err
+	}
+	var subject bytes.Buffer
+	if err := st.Execute(&subject, data); err != nil {
+		return "", "", err
+	}
+
+	layout, err := mailTemplateFS.ReadFile("mailtemplates/layout.html")
+	if err != nil {
+		return "", "", err
+	}
+	labels := mailLabels[lang]
+	funcs := template.FuncMap{
+		"t": func(k string) string {
+			if v, ok := labels[k]; ok {
+				return v
+			}
+			return mailLabels[mailLangEN][k]
+		},
+		"inc":  func(i int) int { return i + 1 },
+		"even": func(i int) bool { return i%2 == 0 },
+	}
+	bt, err := template.New("layout").Funcs(funcs).Parse(string(layout))
+	if err != nil {
+		return "", "", err
+	}
+	if _, err := bt.New("content").Parse(bodySrc); err != nil {
+		return "", "", err
+	}
+	var body bytes.Buffer
+	if err := bt.ExecuteTemplate(&body, "layout", data); err != nil {
+		return "", "", err
+	}
+	return strings.TrimSpace(strings.ReplaceAll(subject.String(), "\n", " ")), body.String(), nil
+}
+
+// renderMail renders a template in the given language
+func renderMail(q sqlx.Queryer, key, lang string, data mailData) (string, string, error) {
+	subjectSrc, bodySrc, err := mailTemplateSource(q, key, lang)
+	if err != nil {
+		return "", "", err
+	}
+	return renderMailTemplate(subjectSrc, bodySrc, lang, data)
+}
+
+// sampleMailData is the data used by the preview
+func sampleMailData(key string) mailData {
+	d := mailData{
+		RecipientName: "Somchai",
+		ActorName:     "Suda Jaidee",
+		Stage:         "Leader",
+		Days:          3,
+		Project:       &mailProject{Code: "PJ-2025-001", Model: "XP-100", PartNo: "12345-ABC", PartName: "Bracket Assy"},
+		Items: []mailItem{
+			{ProjectCode: "PJ-2025-001", PartNo: "12345-ABC", Name: "Control Plan", Type: "ppap", Start: "2025-01-06", End: "2025-01-31", Status: "Approved"},
+			{ProjectCode: "PJ-2025-001", PartNo: "12345-ABC", Name: "PFMEA", Type: "apqp", Start: "2025-01-13", End: "2025-02-14", Status: "Approved - waiting PJ"},
+		},
+		ShowDates: true,
+	}
+	switch key {
+	case mailItemRejected, mailFileRejected:
+		d.Note, d.NoteLabel, d.NoteReject = "Please attach the signed version.", "reason_for_rejection", true
+	case mailFileApproved, mailFileApprovedPC:
+		d.Project.Template = "MITSUBISHI MOTOR"
+		d.Items = d.Items[:1]
+	case mailApprovalResult:
+		d.Note = "Checked against drawing rev. B"
+		d.ShowProjectColumns, d.ShowStatus, d.ShowDates = true, true, false
+		d.Project = nil
+	case mailApprovalReminder, mailApprovalEscalated:
+		d.ShowProjectColumns, d.ShowDates = true, false
+		d.Project = nil
+		d.Items = d.Items[:1]
+	case mailTrackingReport:
+		d.RecipientName = ""
+		d.Project, d.Items = nil, nil
+	case mailDigest:
+		d.Days = 2
+		d.Sections = []mailSection{
+			{Title: "TBKK Project Control Notification : waiting Leader Approval", At: "2025-01-06 09:15", Project: d.Project, Items: d.Items[:1]},
+			{Title: "TBKK Project Control Notification : Item Rejected", At: "2025-01-06 14:40", Project: d.Project, Items: d.Items[1:], Note: "Please attach the signed version."},
+		}
+		d.Project, d.Items = nil, nil
+	}
+	return d
+}
+
+// EmailTemplate is a template as shown to the admin
+type EmailTemplate struct {
+	Key            string     `json:"met_key"`
+	Lang           string     `json:"met_lang"`
+	Subject        string     `json:"met_subject"`
+	Body           string     `json:"met_body"`
+	DefaultSubject string     `json:"default_subject"`
+	DefaultBody    string     `json:"default_body"`
+	Overridden     bool       `json:"overridden"`
+	Status         string     `json:"met_status"`
+	UpdatedAt      *time.Time `json:"met_updated_at"`
+	UpdatedBy      string     `json:"met_updated_by"`
+}
+
+// ListEmailTemplate lists every template and language with the effective subject / body
+func ListEmailTemplate(c *fiber.Ctx, db *sqlx.DB) error {
+	var rows []struct {
+		Key       string         `db:"met_key"`
+		Lang      string         `db:"met_lang"`
+		Subject   sql.NullString `db:"met_subject"`
+		Body      sql.NullString `db:"met_body"`
+		Status    string         `db:"met_status"`
+		UpdatedAt *time.Time     `db:"met_updated_at"`
+		UpdatedBy sql.NullString `db:"met_updated_by"`
+	}
+	if err := db.Select(&rows, `SELECT met_key, met_lang, met_subject, met_body, met_status, COALESCE(met_updated_at, met_created_at) AS met_updated_at, COALESCE(met_updated_by, met_created_by) AS met_updated_by FROM mst_email_template`); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "query error", "detail": err.Error()})
+	}
+
+	res := make([]EmailTemplate, 0, len(mailTemplateKeys)*2)
+	for _, key := range mailTemplateKeys {
+		for _, lang := range []string{mailLangEN, mailLangTH} {
+			subject, body := builtinMailTemplate(key, lang)
+			t := EmailTemplate{Key: key, Lang: lang, Subject: subject, Body: body, DefaultSubject: subject, DefaultBody: body, Status: "active"}
+			for _, r := range rows {
+				if r.Key != key || r.Lang != lang {
+					continue
+				}
+				t.Status, t.UpdatedAt, t.UpdatedBy = r.Status, r.UpdatedAt, getStringValue(r.UpdatedBy)
+				if r.Status == "active" {
+					if strings.TrimSpace(r.Subject.String) != "" {
+						t.Subject, t.Overridden = r.Subject.String, true
+					}
+					if strings.TrimSpace(r.Body.String) != "" {
+						t.Body, t.Overridden = r.Body.String, true
+					}
+				}
+			}
+			res = append(res, t)
+		}
+	}
+	return c.Status(200).JSON(res)
+}
+
+// SaveEmailTemplate stores the subject / body override of a template; empty fields use the built-in text
+func SaveEmailTemplate(c *fiber.Ctx, db *sqlx.DB) error {
+	var body struct {
+		Key       string `json:"met_key"`
+		Lang      string `json:"met_lang"`
+		Subject   string `json:"met_subject"`
+		Body      string `json:"met_body"`
+		Status    string `json:"met_status"`
+		UpdatedBy string `json:"met_updated_by"`
+	}
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid request", "detail": err.Error()})
+	}
+	body.Lang = strings.ToLower(strings.TrimSpace(body.Lang))
+	if !validMailKey(body.Key) {
+		return c.Status(400).JSON(fiber.Map{"error": "unknown met_key"})
+	}
+	if !validMailLang(body.Lang) {
+		return c.Status(400).JSON(fiber.Map{"error": "met_lang must be 'th' or 'en'"})
+	}
+	if body.Status == "" {
+		body.Status = "active"
+	}
+	if body.Status != "active" && body.Status != "inactive" {
+		return c.Status(400).JSON(fiber.Map{"error": "met_status must be 'active' or 'inactive'"})
+	}
+
+	// the override must render with the preview data before it is saved
+	subject, tmpl := builtinMailTemplate(body.Key, body.Lang)
+	if strings.TrimSpace(body.Subject) != "" {
+		subject = body.Subject
+	}
+	if strings.TrimSpace(body.Body) != "" {
+		tmpl = body.Body
+	}
+	if _, _, err := renderMailTemplate(subject, tmpl, body.Lang, sampleMailData(body.Key)); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid template", "detail": err.Error()})
+	}
+
+	now := time.Now()
+	var id int64
+	err := db.Get(&id, `SELECT met_id FROM mst_email_template WHERE met_key = ? AND met_lang = ? LIMIT 1`, body.Key, body.Lang)
+	switch {
+	case err == nil:
+		_, err = execVersioned(c, db, emailTemplateVersion, id, `UPDATE mst_email_template SET met_subject = ?, met_body = ?, met_status = ?, met_updated_at = ?, met_updated_by = ? WHERE met_id = ?`,
+			nullIfBlank(body.Subject), nullIfBlank(body.Body), body.Status, now, body.UpdatedBy, id)
+		if isVersionError(err) {
+			return versionError(c, err)
+		}
+	case errors.Is(err, sql.ErrNoRows):
+		_, err = db.Exec(`INSERT INTO mst_email_template (met_key, met_lang, met_subject, met_body, met_status, met_created_at, met_created_by) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+			body.Key, body.Lang, nullIfBlank(body.Subject), nullIfBlank(body.Body), body.Status, now, body.UpdatedBy)
+	}
+	if err != nil {
+		return c.Status(500).JSON(5)
+	}
+	return c.Status(200).JSON(1)
+}
+
+func nullIfBlank(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: strings.TrimSpace(s) != ""}
+}
+
+// PreviewEmailTemplate renders a template with sample data.
+// GET ?met_key=&met_lang= renders the stored template; POST may send met_subject / met_body to preview unsaved edits.
+// ?format=html returns the body as a page instead of JSON.
+func PreviewEmailTemplate(c *fiber.Ctx, db *sqlx.DB) error {
+	var body struct {
+		Key     string `json:"met_key"`
+		Lang    string `json:"met_lang"`
+		Subject string `json:"met_subject"`
+		Body    string `json:"met_body"`
+	}
+	if c.Method() == fiber.MethodPost {
+		if err := c.BodyParser(&body); err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "invalid request", "detail": err.Error()})
+		}
+	}
+	if body.Key == "" {
+		body.Key = c.Query("met_key")
+	}
+	if body.Lang == "" {
+		body.Lang = c.Query("met_lang", defaultMailLang())
+	}
+	body.Lang = strings.ToLower(strings.TrimSpace(body.Lang))
+	if !validMailKey(body.Key) {
+		return c.Status(400).JSON(fiber.Map{"error": "unknown met_key"})
+	}
+	if !validMailLang(body.Lang) {
+		return c.Status(400).JSON(fiber.Map{"error": "met_lang must be 'th' or 'en'"})
+	}
+
+	subjectSrc, bodySrc, err := mailTemplateSource(db, body.Key, body.Lang)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "query error", "detail": err.Error()})
+	}
+	if strings.TrimSpace(body.Subject) != "" {
+		subjectSrc = body.Subject
+	}
+	if strings.TrimSpace(body.Body) != "" {
+		bodySrc = body.Body
+	}
+	subject, html, err := renderMailTemplate(subjectSrc, bodySrc, body.Lang, sampleMailData(body.Key))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid template", "detail": err.Error()})
+	}
+	if c.Query("format") == "html" {
+		c.Type("html", "utf-8")
+		return c.SendString(html)
+	}
+	return c.Status(200).JSON(fiber.Map{"met_key": body.Key, "met_lang": body.Lang, "subject": subject, "html": html})
+}
@@ -0,0 +1,34 @@
+package handlers
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDecisionMailOnBehalf(t *testing.T) {
+	tests := []struct {
+		key, lang, onBehalf, want string
+	}{
+		{mailItemApproved, mailLangEN, "Somsak Dee", "by K.Suda Jaidee on behalf of K.Somsak Dee"},
+		{mailItemRejected, mailLangTH, "Somsak Dee", "คุณSuda Jaidee แทน คุณSomsak Dee"},
+		{mailFileApproved, mailLangEN, "Somsak Dee", "by Suda Jaidee on behalf of Somsak Dee"},
+		{mailItemApproved, mailLangEN, "", "by K.Suda Jaidee</h4>"},
+	}
+	for _, tt := range tests {
+		data := sampleMailData(tt.key)
+		data.OnBehalfName = tt.onBehalf
+		subject, body := builtinMailTemplate(tt.key, tt.lang)
+		_, html, err := renderMailTemplate(subject, body, tt.lang, data)
+		if err != nil {
+			t.Fatalf("%s/%s: %v", tt.key, tt.lang, err)
+		}
+		if !strings.Contains(html, tt.want) {
+			t.Errorf("%s/%s with on behalf %q: body does not contain %q", tt.key, tt.lang, tt.onBehalf, tt.want)
+		}
+	}
+
+	text := notificationText(mailData{ActorName: "Suda Jaidee", OnBehalfName: "Somsak Dee"})
+	if !strings.HasPrefix(text, "By: Suda Jaidee on behalf of Somsak Dee") {
+		t.Errorf("notificationText = %q", text)
+	}
+}
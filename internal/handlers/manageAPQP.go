@@ -86,6 +86,7 @@ func GetAPQP(c *fiber.Ctx, db *sqlx.DB) error {
 	if err := db.Get(&a, query, id); err != nil {
 		return c.Status(500).JSON(fiber.Map{"error": "query error", "detail": err.Error()})
 	}
+	setETag(c, db, apqpVersion, id)
 	return c.Status(200).JSON(a)
 }
 
@@ -187,6 +188,9 @@ func UpdateAPQP(c *fiber.Ctx, db *sqlx.DB) error {
 	}
 
 	// update master
+	if err := checkVersion(c, tx, apqpVersion, body.ID); err != nil {
+		return versionError(c, err)
+	}
 	if _, err := tx.Exec(`UPDATE mst_apqp SET mpp_id = ?, ma_name = ?, ma_type = ?, ma_updated_at = ?, ma_updated_by = ? WHERE ma_id = ?`, body.MppID, body.Name, "text", now, body.UpdatedBy, body.ID); err != nil {
 		tx.Rollback()
 		return c.Status(500).JSON(5)
@@ -257,8 +261,11 @@ func UpdateAPQPStatus(c *fiber.Ctx, db *sqlx.DB) error {
 		return c.Status(400).JSON(fiber.Map{"error": "ma_updated_by is required"})
 	}
 	now := time.Now()
-	res, err := db.Exec(`UPDATE mst_apqp SET ma_status = ?, ma_updated_at = ?, ma_updated_by = ? WHERE ma_id = ?`, body.Status, now, body.UpdatedBy, body.ID)
+	res, err := execVersioned(c, db, apqpVersion, body.ID, `UPDATE mst_apqp SET ma_status = ?, ma_updated_at = ?, ma_updated_by = ? WHERE ma_id = ?`, body.Status, now, body.UpdatedBy, body.ID)
 	if err != nil {
+		if isVersionError(err) {
+			return versionError(c, err)
+		}
 		return c.Status(500).JSON(5)
 	}
 	ra, _ := res.RowsAffected()
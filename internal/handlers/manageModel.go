@@ -66,6 +66,7 @@ func GetModelMaster(c *fiber.Ctx, db *sqlx.DB) error {
 	if err := db.Get(&m, query, id); err != nil {
 		return c.Status(500).JSON(fiber.Map{"error": "query error", "detail": err.Error()})
 	}
+	setETag(c, db, modelMasterVersion, id)
 	return c.Status(200).JSON(m)
 }
 
@@ -153,6 +154,9 @@ func UpdateModelMaster(c *fiber.Ctx, db *sqlx.DB) error {
 	}
 	defer func() { _ = tx.Rollback() }()
 
+	if err := checkVersion(c, tx, modelMasterVersion, body.ID); err != nil {
+		return versionError(c, err)
+	}
 	res, err := tx.Exec(`UPDATE mst_model_master SET mmm_model = ?, mmm_customer_name = ?, mmm_updated_at = ?, mmm_updated_by = ? WHERE mmm_id = ?`, body.Model, body.CustomerName, now, body.UpdatedBy, body.ID)
 	if err != nil {
 		return c.Status(500).JSON(5.3)
@@ -241,8 +245,11 @@ func UpdateModelMasterStatus(c *fiber.Ctx, db *sqlx.DB) error {
 			return c.Status(400).JSON(fiber.Map{"error": "mmm_status must be 'active' or 'inactive'"})
 		}
 		now := time.Now()
-		res, err := db.Exec(`UPDATE mst_model_master SET mmm_status = ?, mmm_updated_at = ?, mmm_updated_by = ? WHERE mmm_id = ?`, body.Status, now, body.UpdatedBy, body.ID)
+		res, err := execVersioned(c, db, modelMasterVersion, body.ID, `UPDATE mst_model_master SET mmm_status = ?, mmm_updated_at = ?, mmm_updated_by = ? WHERE mmm_id = ?`, body.Status, now, body.UpdatedBy, body.ID)
 		if err != nil {
+			if isVersionError(err) {
+				return versionError(c, err)
+			}
 			return c.Status(500).JSON(5)
 		}
 		ra, _ := res.RowsAffected()
@@ -4,8 +4,6 @@ import (
 	"database/sql"
 	"fmt"
 	"html"
-	"log"
-	"os"
 	"strconv"
 	"strings"
 	"time"
@@ -115,8 +113,11 @@ func UpdatePPAPItem(c *fiber.Ctx, db *sqlx.DB) error {
 	}
 
 	now := time.Now()
-	res, err := db.Exec(`UPDATE mst_ppap_item SET mpi_name = ?, mpi_updated_at = ?, mpi_updated_by = ? WHERE mpi_id = ?`, body.Name, now, body.UpdatedBy, body.ID)
+	res, err := execVersioned(c, db, ppapItemVersion, body.ID, `UPDATE mst_ppap_item SET mpi_name = ?, mpi_updated_at = ?, mpi_updated_by = ? WHERE mpi_id = ?`, body.Name, now, body.UpdatedBy, body.ID)
 	if err != nil {
+		if isVersionError(err) {
+			return versionError(c, err)
+		}
 		return c.Status(500).JSON(5)
 	}
 	ra, _ := res.RowsAffected()
@@ -145,8 +146,11 @@ func UpdatePPAPItemStatus(c *fiber.Ctx, db *sqlx.DB) error {
 		return c.Status(400).JSON(fiber.Map{"error": "mpi_updated_by is required"})
 	}
 	now := time.Now()
-	res, err := db.Exec(`UPDATE mst_ppap_item SET mpi_status = ?, mpi_updated_at = ?, mpi_updated_by = ? WHERE mpi_id = ?`, body.Status, now, body.UpdatedBy, body.ID)
+	res, err := execVersioned(c, db, ppapItemVersion, body.ID, `UPDATE mst_ppap_item SET mpi_status = ?, mpi_updated_at = ?, mpi_updated_by = ? WHERE mpi_id = ?`, body.Status, now, body.UpdatedBy, body.ID)
 	if err != nil {
+		if isVersionError(err) {
+			return versionError(c, err)
+		}
 		return c.Status(500).JSON(5)
 	}
 	ra, _ := res.RowsAffected()
@@ -805,11 +809,7 @@ func InsertPPAPItemStep4(c *fiber.Ctx, db *sqlx.DB) error {
 		return c.Status(500).JSON(5)
 	}
 
-	if err := tx.Commit(); err != nil {
-		return c.Status(500).JSON(5)
-	}
-
-	// gather recipient users (su_id) for all ipid_ids touched, then send each user
+	// gather recipient users (su_id) for all ipid_ids touched and queue one mail per user
 	if len(results) > 0 {
 		ipidIDs := make([]int64, 0, len(results))
 		for _, r := range results {
@@ -821,12 +821,12 @@ func InsertPPAPItemStep4(c *fiber.Ctx, db *sqlx.DB) error {
 			// get distinct su_id values touched
 			q, args, err := sqlx.In(`SELECT DISTINCT su_id FROM info_project_item_detail WHERE ipid_id IN (?) AND su_id IS NOT NULL AND su_id <> 0`, ipidIDs)
 			if err == nil {
-				q = db.Rebind(q)
+				q = tx.Rebind(q)
 				var suIDs []int64
-				if err := db.Select(&suIDs, q, args...); err == nil && len(suIDs) > 0 {
+				if err := tx.Select(&suIDs, q, args...); err == nil && len(suIDs) > 0 {
 					// Get sender's first and last name from created_by
 					var senderFirstName, senderLastName sql.NullString
-					err := db.QueryRow(`SELECT su_firstname, su_lastname FROM sys_user WHERE su_emp_code = CAST(? AS SIGNED) LIMIT 1`, body.CreatedBy).Scan(&senderFirstName, &senderLastName)
+					err := tx.QueryRow(`SELECT su_firstname, su_lastname FROM sys_user WHERE su_emp_code = CAST(? AS SIGNED) LIMIT 1`, body.CreatedBy).Scan(&senderFirstName, &senderLastName)
 					var senderName string
 					if err == nil && (senderFirstName.Valid || senderLastName.Valid) {
 						if senderFirstName.Valid && senderLastName.Valid {
@@ -902,13 +902,13 @@ func InsertPPAPItemStep4(c *fiber.Ctx, db *sqlx.DB) error {
 					for _, suID := range suIDs {
 						// get user's email
 						var email string
-						if err := db.Get(&email, `SELECT su_email FROM sys_user WHERE su_id = ? AND su_status = 'active' AND su_email IS NOT NULL AND su_email <> '' LIMIT 1`, suID); err != nil || strings.TrimSpace(email) == "" {
+						if err := tx.Get(&email, `SELECT su_email FROM sys_user WHERE su_id = ? AND su_status = 'active' AND su_email IS NOT NULL AND su_email <> '' LIMIT 1`, suID); err != nil || strings.TrimSpace(email) == "" {
 							continue
 						}
 
 						// get recipient user's first and last name
 						var recFirstName, recLastName sql.NullString
-						db.QueryRow(`SELECT su_firstname, su_lastname FROM sys_user WHERE su_id = ? LIMIT 1`, suID).Scan(&recFirstName, &recLastName)
+						tx.QueryRow(`SELECT su_firstname, su_lastname FROM sys_user WHERE su_id = ? LIMIT 1`, suID).Scan(&recFirstName, &recLastName)
 						var recipientName string
 						if recFirstName.Valid && recLastName.Valid {
 							recipientName = recFirstName.String + " " + recLastName.String
@@ -921,15 +921,6 @@ func InsertPPAPItemStep4(c *fiber.Ctx, db *sqlx.DB) error {
 							recipientName = fmt.Sprintf("%v", suID)
 						}
 
-						// fetch project information
-						var projectDetail struct {
-							ProjectCode utils.NullString
-							PartName    utils.NullString
-							PartNo      utils.NullString
-							IpModel     utils.NullString
-						}
-						db.Get(&projectDetail, `SELECT ip_code, ip_part_name, ip_part_no, ip_model FROM info_project WHERE ip_id = ? LIMIT 1`, body.IpID)
-
 						// fetch project items for this su_id within the ip_id we just modified
 						var rows []struct {
 							IpCode     utils.NullString `db:"ip_code" json:"ip_code"`
@@ -945,128 +936,48 @@ func InsertPPAPItemStep4(c *fiber.Ctx, db *sqlx.DB) error {
 							CreatedBy utils.NullString `db:"created_by" json:"created_by"`
 							Status    utils.NullString `db:"ipid_status" json:"status"`
 						}
-						if err := db.Select(&rows, projQuery, body.IpID, body.IpID, suID); err != nil {
+						if err := tx.Select(&rows, projQuery, body.IpID, body.IpID, suID); err != nil {
 							continue
 						}
 						if len(rows) == 0 {
 							continue
 						}
 
-						// build modern HTML with card layout
-						var sb strings.Builder
-						var i int
-						sb.WriteString("<h3 style='font-family: Arial, sans-serif; color:#1f2d3d;'>Dear, K." + html.EscapeString(recipientName) + "</h3>")
-						sb.WriteString("<h4>You have new project please upload your <b style='color : #0952c0;'>file</b> in website Project Management</h4>")
-						sb.WriteString("<html><body style='font-family: Arial, sans-serif; background:#f6f8fb; padding:20px;'>")
-							
-						// Project Detail Card
-						sb.WriteString("<div style='margin:auto; background:#ffffff; border-radius:10px; border:1px solid #e0e6ed; padding:20px;'>")
-						sb.WriteString("<div style='font-size:18px; font-weight:bold; color:#1f2d3d;'>Project Detail</div>")
-						sb.WriteString("<div style='font-size:12px; color:#6b7280;'>PPAP Item Information (ข้อมูลของรายการโปรเจค)</div>")
-
-						sb.WriteString("<hr style='border:none; border-top:1px dashed #d1d5db; margin:15px 0;'>")
-
-						// Project Information 3-Column Layout
-						sb.WriteString("<table width='100%' cellpadding='10' cellspacing='0' style='border-collapse:collapse;'>")
-						sb.WriteString("<tr>")
-
-						sb.WriteString("<td style='width:33%; border:1px solid #e5e7eb; border-radius:8px; padding:12px;'>")
-						sb.WriteString("<div style='font-size:12px; color:#374151;'>PROJECT CODE</div>")
-						sb.WriteString("<div style='font-size:14px; font-weight:bold; color:#2563eb;'>#" + html.EscapeString(htmlEscapeNullString(rows[0].IpCode)) + "</div>")
-						sb.WriteString("</td>")
-
-						sb.WriteString("<td style='width:33%; border:1px solid #e5e7eb; border-radius:8px; padding:12px;'>")
-						sb.WriteString("<div style='font-size:12px; color:#374151;'>MODEL</div>")
-						sb.WriteString("<div style='font-size:14px; font-weight:bold; color:#2563eb;'>" + html.EscapeString(htmlEscapeNullString(rows[0].IpModel)) + "</div>")
-						sb.WriteString("</td>")
-
-						sb.WriteString("</tr>")
-						sb.WriteString("<tr>")
-
-						sb.WriteString("<td style='border:1px solid #e5e7eb; border-radius:8px; padding:12px;'>")
-						sb.WriteString("<div style='font-size:12px; color:#374151;'>PART NO</div>")
-						sb.WriteString("<div style='font-size:14px; font-weight:bold; color:#2563eb;'>" + html.EscapeString(htmlEscapeNullString(rows[0].IpPartNo)) + "</div>")
-						sb.WriteString("</td>")
-
-						sb.WriteString("<td colspan='2' style='border:1px solid #e5e7eb; border-radius:8px; padding:12px;'>")
-						sb.WriteString("<div style='font-size:12px; color:#374151;'>PART NAME</div>")
-						sb.WriteString("<div style='font-size:14px; font-weight:bold; color:#2563eb;'>" + html.EscapeString(htmlEscapeNullString(rows[0].IpPartName)) + "</div>")
-						sb.WriteString("</td>")
-
-						sb.WriteString("</tr>")
-						sb.WriteString("</table>")
-						sb.WriteString("<div style='margin-top:20px; font-size:14px; color:#374151;'>")
-						sb.WriteString("</div>")
-						sb.WriteString("</div><br>")
-						
-						// Items Table
-						sb.WriteString("<table width='100%' cellpadding='10' cellspacing='0' style='border-collapse:collapse; border:1px solid #e5e7eb;'>")
-						sb.WriteString("<thead><tr style='background:#f3f4f6; border-bottom:2px solid #d1d5db;'>")
-						cols := []string{"No.", "Item Name", "Item Type", "Start Date", "End Date"}
-						for _, c := range cols {
-							sb.WriteString("<th style='text-align:left; font-weight:bold; color:#374151; font-size:13px;'>" + html.EscapeString(c) + "</th>")
-						}
-						sb.WriteString("</tr></thead><tbody>")
-
+						data := mailData{
+							IpID:          body.IpID,
+							RecipientName: recipientName,
+							Project: &mailProject{
+								Code:     rows[0].IpCode.String,
+								Model:    rows[0].IpModel.String,
+								PartNo:   rows[0].IpPartNo.String,
+								PartName: rows[0].IpPartName.String,
+							},
+							ShowDates: true,
+						}
 						for _, r := range rows {
-							var startStr, endStr string
+							it := mailItem{Name: r.ItemName.String, Type: r.ItemType.String}
 							if r.StartDate != nil {
-								startStr = r.StartDate.Format("2006-01-02")
+								it.Start = r.StartDate.Format("2006-01-02")
 							}
 							if r.EndDate != nil {
-								endStr = r.EndDate.Format("2006-01-02")
+								it.End = r.EndDate.Format("2006-01-02")
 							}
-
-							rowBg := ""
-							if i%2 == 0 {
-								rowBg = " style='background:#fbfdff;'"
-							}
-							sb.WriteString("<tr" + rowBg + ">")
-							sb.WriteString("<td style='border-bottom:1px solid #e5e7eb; padding:10px; font-size:13px;'>" + strconv.Itoa(i+1) + "</td>")
-							sb.WriteString("<td style='border-bottom:1px solid #e5e7eb; padding:10px; font-size:13px;'>" + html.EscapeString(htmlEscapeNullString(r.ItemName)) + "</td>")
-							sb.WriteString("<td style='border-bottom:1px solid #e5e7eb; padding:10px; font-size:13px;'>" + html.EscapeString(htmlEscapeNullString(r.ItemType)) + "</td>")
-							sb.WriteString("<td style='border-bottom:1px solid #e5e7eb; padding:10px; font-size:13px;'>" + html.EscapeString(startStr) + "</td>")
-							sb.WriteString("<td style='border-bottom:1px solid #e5e7eb; padding:10px; font-size:13px;'>" + html.EscapeString(endStr) + "</td>")
-							sb.WriteString("</tr>")
-							i++
-						}
-
-						sb.WriteString("</tbody></table>")
-
-						sb.WriteString("<div style='margin-top:20px;'>")
-						sb.WriteString("<a href='http://192.168.161.205:4005/login' style='display:inline-block; padding:10px 20px; background:#2563eb; color:#fff; text-decoration:none; border-radius:6px; font-weight:bold; font-size:14px;'>Open Project Management</a>")
-						sb.WriteString("</div>")
-
-						sb.WriteString("<div style='margin-top:30px; padding-top:20px; border-top:1px solid #e5e7eb; font-size:13px; color:#6b7280;'>")
-						sb.WriteString("<p>Best Regards,<br><strong>System Service Department</strong></p>")
-						sb.WriteString("</div>")
-
-						sb.WriteString("</body></html>")
-
-						subject := "TBKK Project Control Notification : waiting upload file"
-						bodyHtml := sb.String()
-
-						// check SMTP config before sending
-						host := strings.TrimSpace(os.Getenv("SMTP_HOST"))
-						port := strings.TrimSpace(os.Getenv("SMTP_PORT"))
-						user := strings.TrimSpace(os.Getenv("SMTP_USER"))
-						pass := os.Getenv("SMTP_PASS")
-						if host == "" || port == "" || user == "" || pass == "" {
-							log.Printf("SendMail skipped: smtp configuration incomplete")
-							continue
+							data.Items = append(data.Items, it)
 						}
 
-						// send asynchronously to the single recipient
-						go func(to string) {
-							if err := SendMail([]string{to}, subject, bodyHtml, "text/html; charset=utf-8"); err != nil {
-								log.Printf("SendMail error: %v", err)
-							}
-						}(email)
+						// queued with the step 4 changes, sent by the notification dispatcher
+						if err := notifyUser(tx, email, mailWaitingUpload, data, now); err != nil {
+							return c.Status(500).JSON(5)
+						}
 					}
 				}
 			}
 		}
 	}
+	if err := tx.Commit(); err != nil {
+		return c.Status(500).JSON(5)
+	}
+	publishProjectEvent(db, body.IpID, "inprogress", body.CreatedBy)
 	return c.Status(201).JSON(1)
 
 }
@@ -1620,5 +1531,6 @@ func InsertPPAPItemStep4Draft(c *fiber.Ctx, db *sqlx.DB) error {
 	if err := tx.Commit(); err != nil {
 		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
 	}
+	publishProjectEvent(db, body.IpID, "draft", body.CreatedBy)
 	return c.Status(201).JSON(1)
 }
@@ -57,6 +57,7 @@ func GetProjectPhase(c *fiber.Ctx, db *sqlx.DB) error {
 		}
 		return c.Status(500).JSON(fiber.Map{"error": "query error", "detail": err.Error()})
 	}
+	setETag(c, db, projectPhaseVersion, id)
 	return c.Status(200).JSON(p)
 }
 
@@ -142,8 +143,11 @@ func UpdateProjectPhase(c *fiber.Ctx, db *sqlx.DB) error {
 	}
 
 	now := time.Now()
-	res, err := db.Exec(`UPDATE mst_project_phase SET mpp_name = ?, mpp_order = ?, mpp_updated_at = ?, mpp_updated_by = ? WHERE mpp_id = ?`, body.Name, order, now, body.UpdatedBy, body.ID)
+	res, err := execVersioned(c, db, projectPhaseVersion, body.ID, `UPDATE mst_project_phase SET mpp_name = ?, mpp_order = ?, mpp_updated_at = ?, mpp_updated_by = ? WHERE mpp_id = ?`, body.Name, order, now, body.UpdatedBy, body.ID)
 	if err != nil {
+		if isVersionError(err) {
+			return versionError(c, err)
+		}
 		return c.Status(500).JSON(5)
 	}
 	ra, _ := res.RowsAffected()
@@ -172,8 +176,11 @@ func UpdateProjectPhaseStatus(c *fiber.Ctx, db *sqlx.DB) error {
 		return c.Status(400).JSON(fiber.Map{"error": "mpp_updated_by is required"})
 	}
 	now := time.Now()
-	res, err := db.Exec(`UPDATE mst_project_phase SET mpp_status = ?, mpp_updated_at = ?, mpp_updated_by = ? WHERE mpp_id = ?`, body.Status, now, body.UpdatedBy, body.ID)
+	res, err := execVersioned(c, db, projectPhaseVersion, body.ID, `UPDATE mst_project_phase SET mpp_status = ?, mpp_updated_at = ?, mpp_updated_by = ? WHERE mpp_id = ?`, body.Status, now, body.UpdatedBy, body.ID)
 	if err != nil {
+		if isVersionError(err) {
+			return versionError(c, err)
+		}
 		return c.Status(500).JSON(5)
 	}
 	ra, _ := res.RowsAffected()
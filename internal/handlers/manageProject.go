@@ -4,8 +4,8 @@ import (
 	"database/sql"
 	"database/sql/driver"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"html"
 	"log"
 	"os"
 	"path/filepath"
@@ -223,6 +223,8 @@ type SysInfoProject struct {
 
 	MtID   int64            `json:"mt_id" db:"mt_id"`
 	MtName utils.NullString `json:"mt_name" db:"mt_name"`
+	McID   utils.NullInt64  `json:"mc_id" db:"mc_id"`         // plant calendar (NULL = default)
+	Health utils.NullString `json:"ip_health" db:"ip_health"` // set by the status roll-up
 
 	IceKKen1Date *Date `json:"ice_k_ken_1_date" db:"ice_k_ken_1_date"`
 	IceKKen2Date *Date `json:"ice_k_ken_2_date" db:"ice_k_ken_2_date"`
@@ -294,6 +296,8 @@ func ListInfoProjects(c *fiber.Ctx, db *sqlx.DB) error {
 					ice_pp_date AS ice_pp_date,
 					ice_sop_date AS ice_sop_date,
 					info_project.mt_id AS mt_id,
+					info_project.mc_id AS mc_id,
+					info_project.ip_health AS ip_health,
 					ipf.ipf_file_name AS ipf_file_name,
 					ipf.ipf_file_path AS ipf_file_path,
 					mt.mt_name AS mt_name,
@@ -349,6 +353,13 @@ func IssueInfoProject(c *fiber.Ctx, db *sqlx.DB) error {
 			}
 		}
 
+		// optional: plant calendar
+		if v := strings.TrimSpace(c.FormValue("mc_id")); v != "" {
+			if id, err := strconv.ParseInt(v, 10, 64); err == nil && id > 0 {
+				req.McID.Int64, req.McID.Valid = id, true
+			}
+		}
+
 		// optional: mdt_id provided by front for document type
 		if v := strings.TrimSpace(c.FormValue("mdt_id")); v != "" {
 			if id, err := strconv.ParseInt(v, 10, 64); err == nil {
@@ -435,15 +446,16 @@ func IssueInfoProject(c *fiber.Ctx, db *sqlx.DB) error {
 		"ip_updated_at":    now,
 		"ip_updated_by":    req.CreatedBy,
 		"ip_customer_name": req.CustomerName,
+		"mc_id":            req.McID,
 	}
 
 	res, err := tx.NamedExec(`
 		INSERT INTO info_project
 			(mdt_id, ip_model, ip_part_no, ip_part_name, ip_kickoff_date, ip_sop_date, ip_code, ip_pos,
-			 ip_document_no, ip_revision, ip_status, ip_created_at, ip_created_by, ip_updated_at, ip_updated_by, ip_customer_name, mt_id)
+			 ip_document_no, ip_revision, ip_status, ip_created_at, ip_created_by, ip_updated_at, ip_updated_by, ip_customer_name, mt_id, mc_id)
 		VALUES
 			(:mdt_id, :ip_model, :ip_part_no, :ip_part_name, :ip_kickoff_date, :ip_sop_date, :ip_code, :ip_pos,
-			 '-' , 0, 'added', :ip_created_at, :ip_created_by, :ip_updated_at, :ip_updated_by, :ip_customer_name, :mt_id)
+			 '-' , 0, 'added', :ip_created_at, :ip_created_by, :ip_updated_at, :ip_updated_by, :ip_customer_name, :mt_id, :mc_id)
 	`, projectParams)
 	if err != nil {
 		return c.Status(500).JSON(5.3)
@@ -524,10 +536,7 @@ func IssueInfoProject(c *fiber.Ctx, db *sqlx.DB) error {
 		return c.Status(500).JSON(5.5)
 	}
 
-	uploadBase := os.Getenv("UPLOAD_BASE")
-	if strings.TrimSpace(uploadBase) == "" {
-		uploadBase = `C:\inetpub\wwwroot\apiTrackingSystemUat\uploads`
-	}
+	uploadBase := uploadBaseDir()
 	var dbFileName string // ex: NORAPHATsongkran
 	var dbFilePath string // ex: uploads/<ip_code>/pos/NORAPHATsongkran.pdf
 
@@ -640,6 +649,14 @@ func UpdateInfoProject(c *fiber.Ctx, db *sqlx.DB) error {
 	}
 	defer func() { _ = tx.Rollback() }()
 
+	// optimistic locking: project (If-Match / version) and its customer events (ice_version)
+	if err := checkVersion(c, tx, projectVersion, req.IpID); err != nil {
+		return versionError(c, err)
+	}
+	if err := checkVersionField(c, tx, customerEventVersion, req.IpID, "ice_version"); err != nil {
+		return versionError(c, err)
+	}
+
 	// update info_project by ip_id
 	projectParams := map[string]any{
 		"ip_id":            req.IpID,
@@ -655,6 +672,7 @@ func UpdateInfoProject(c *fiber.Ctx, db *sqlx.DB) error {
 		"ip_updated_at":    now,
 		"ip_updated_by":    req.UpdatedBy,
 		"ip_customer_name": req.CustomerName,
+		"mc_id":            req.McID,
 	}
 
 	_, err = tx.NamedExec(`
@@ -670,7 +688,8 @@ func UpdateInfoProject(c *fiber.Ctx, db *sqlx.DB) error {
 			ip_updated_at = :ip_updated_at,
 			ip_updated_by = :ip_updated_by,
 			ip_customer_name = :ip_customer_name,
-			mt_id = :mt_id
+			mt_id = :mt_id,
+			mc_id = COALESCE(:mc_id, mc_id)
 		WHERE ip_id = :ip_id
 	`, projectParams)
 	if err != nil {
@@ -833,14 +852,18 @@ func UpdateStatusProject(c *fiber.Ctx, db *sqlx.DB) error {
 	}
 
 	now := time.Now()
-	res, err := db.Exec(`UPDATE info_project SET ip_status = ?, ip_updated_at = ?, ip_updated_by = ? WHERE ip_id = ?`, body.Status, now, body.UpdatedBy, body.ID)
+	res, err := execVersioned(c, db, projectVersion, body.ID, `UPDATE info_project SET ip_status = ?, ip_updated_at = ?, ip_updated_by = ? WHERE ip_id = ?`, body.Status, now, body.UpdatedBy, body.ID)
 	if err != nil {
+		if isVersionError(err) {
+			return versionError(c, err)
+		}
 		return c.Status(500).JSON(5)
 	}
 	ra, _ := res.RowsAffected()
 	if ra == 0 {
 		return c.Status(404).JSON(fiber.Map{"error": "project not found"})
 	}
+	publishProjectEvent(db, body.ID, body.Status, body.UpdatedBy)
 	return c.Status(200).JSON(1)
 }
 
@@ -895,6 +918,7 @@ func GetProjectStep2(c *fiber.Ctx, db *sqlx.DB) error {
 				WHERE info_project.ip_id = ?`, ipID); err != nil {
 		return c.Status(500).JSON(fiber.Map{"error": "query error", "detail": err.Error()})
 	}
+	setETag(c, db, projectVersion, ipID)
 	return c.Status(200).JSON(project)
 }
 
@@ -1188,6 +1212,11 @@ func InsertProjectStep3(c *fiber.Ctx, db *sqlx.DB) error {
 	}
 	defer func() { _ = tx.Rollback() }()
 
+	// optimistic locking on the item details of the project (ETag of GetListAPQPPPAPItem)
+	if err := checkVersion(c, tx, projectItemSetVersion, body.IpID); err != nil {
+		return versionError(c, err)
+	}
+
 	// cleanup: delete any existing info_apqp_item for this ip_id whose name is NOT in incoming list
 	incoming := map[string]struct{}{}
 	for _, nm := range body.MaName {
@@ -1449,35 +1478,8 @@ func InsertProjectStep3(c *fiber.Ctx, db *sqlx.DB) error {
 	return c.Status(201).JSON(1)
 }
 
-func CustomerEventGanttChart(c *fiber.Ctx, db *sqlx.DB) error {
-	ipIDStr := c.Query("ip_id")
-	if strings.TrimSpace(ipIDStr) == "" {
-		return c.Status(400).JSON(fiber.Map{"error": "ip_id required"})
-	}
-	ipID, err := strconv.ParseInt(ipIDStr, 10, 64)
-	if err != nil {
-		return c.Status(400).JSON(fiber.Map{"error": "invalid ip_id", "detail": err.Error()})
-	}
-
-	var out []struct {
-		Group  string `db:"group" json:"group"`
-		Name   string `db:"name" json:"name"`
-		Start  *Date  `db:"start" json:"start"`
-		End    *Date  `db:"end" json:"end"`
-		Status string `db:"status" json:"status"`
-	}
-
-	query := `SELECT
-  'Customer EVT Event' AS ` + "`group`" + `,
-  x.` + "`name`" + `,
-  x.` + "`start`" + `,
-  x.` + "`end`" + `,
-  CASE
-	WHEN x.` + "`start`" + ` IS NULL THEN ''
-	WHEN x.` + "`start`" + ` <= CURDATE() THEN 'Done'
-	ELSE 'In Process'
-  END AS ` + "`status`" + `
-	FROM (
+// customerEventsSelect lists the customer events of a project as name / start / end (args: ip_id x6)
+const customerEventsSelect = `
 	SELECT 'K-KEN#1' AS ` + "`name`" + `, ice.ice_k_ken_1_date AS ` + "`start`" + `, ice.ice_k_ken_1_end_date AS ` + "`end`" + `
 	FROM info_customer_event ice WHERE ice.ip_id = ?
 
@@ -1500,7 +1502,43 @@ func CustomerEventGanttChart(c *fiber.Ctx, db *sqlx.DB) error {
 	UNION ALL
 	SELECT 'SOP', ice.ice_sop_date, ice.ice_sop_end_date
 	FROM info_customer_event ice WHERE ice.ip_id = ?
-	) x
+	`
+
+// CustomerEventGanttChart returns the customer events of a project with their working days and,
+// when the project has a baseline (latest, or ?ipb_id=), the baseline dates and finish variance.
+// Customer events have no actual dates; the actual dates of plan rows and items are returned by
+// GetScheduleVariance.
+func CustomerEventGanttChart(c *fiber.Ctx, db *sqlx.DB) error {
+	ipIDStr := c.Query("ip_id")
+	if strings.TrimSpace(ipIDStr) == "" {
+		return c.Status(400).JSON(fiber.Map{"error": "ip_id required"})
+	}
+	ipID, err := strconv.ParseInt(ipIDStr, 10, 64)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid ip_id", "detail": err.Error()})
+	}
+
+	var out []struct {
+		Group  string `db:"group" json:"group"`
+		Name   string `db:"name" json:"name"`
+		Start  *Date  `db:"start" json:"start"`
+		End    *Date  `db:"end" json:"end"`
+		Status string `db:"-" json:"status"`
+		// working days of start..end and from today to the end on the project calendar
+		WorkingDays   int `db:"-" json:"working_days"`
+		RemainingDays int `db:"-" json:"remaining_working_days"`
+		// dates frozen in the baseline and the working days the end moved since (positive = later)
+		BaselineStart  *Date `db:"-" json:"baseline_start"`
+		BaselineEnd    *Date `db:"-" json:"baseline_end"`
+		FinishVariance *int  `db:"-" json:"finish_variance"`
+	}
+
+	query := `SELECT
+  'Customer EVT Event' AS ` + "`group`" + `,
+  x.` + "`name`" + `,
+  x.` + "`start`" + `,
+  x.` + "`end`" + `
+	FROM (` + customerEventsSelect + `) x
 	WHERE x.` + "`start`" + ` IS NOT NULL
 	ORDER BY x.` + "`name`" + `;`
 
@@ -1508,6 +1546,39 @@ func CustomerEventGanttChart(c *fiber.Ctx, db *sqlx.DB) error {
 		return c.Status(500).JSON(fiber.Map{"error": "query error", "detail": err.Error()})
 	}
 
+	// an event is done once its last working day has passed on the plant calendar
+	cal, err := projectCalendar(db, ipID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "query calendar failed", "detail": err.Error()})
+	}
+	base, err := baselineEvents(db, ipID, c.Query("ipb_id"))
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "query baseline failed", "detail": err.Error()})
+	}
+	today := dayOf(time.Now())
+	for i := range out {
+		start := out[i].Start.Time
+		end := start
+		if out[i].End != nil && !out[i].End.IsZero() {
+			end = out[i].End.Time
+		}
+		if b, ok := base[out[i].Name]; ok {
+			out[i].BaselineStart, out[i].BaselineEnd = b.Start, b.End
+			out[i].FinishVariance = workingDayDiff(cal, b.End, &Date{Time: end})
+		}
+		out[i].WorkingDays = cal.WorkingDays(start, end)
+		if cal.PrevWorkingDay(end).Before(today) {
+			out[i].Status = "Done"
+			continue
+		}
+		out[i].Status = "In Process"
+		from := start
+		if from.Before(today) {
+			from = today
+		}
+		out[i].RemainingDays = cal.WorkingDays(from, end)
+	}
+
 	return c.Status(200).JSON(out)
 }
 
@@ -1724,7 +1795,7 @@ func GetListAPQPPPAPItem(c *fiber.Ctx, db *sqlx.DB) error {
                         WHEN a.ia_status IS NULL AND a.ia_type IS NULL THEN 0
                         WHEN a.ia_status = 'waiting' AND a.ia_type = 'Leader' THEN 1
                         WHEN a.ia_status = 'waiting' AND a.ia_type = 'PJ' THEN 2
-                        WHEN a.ia_status = 'Approve' AND a.ia_type = 'PJ' THEN 3
+                        WHEN a.ia_status = 'approve' AND a.ia_type = 'PJ' THEN 3
                         WHEN a.ia_status = 'reject' AND a.ia_type = 'PJ' THEN 4
 						WHEN a.ia_status = 'reject' AND a.ia_type = 'Leader' THEN 5
                         ELSE NULL
@@ -1787,7 +1858,10 @@ func GetListAPQPPPAPItem(c *fiber.Ctx, db *sqlx.DB) error {
                         
 				) x
 				LEFT JOIN info_approval a
-					ON a.ipid_id = x.ipid_id AND a.ia_is_action = 1
+					ON a.ia_id = (
+						SELECT MIN(a_sub.ia_id) FROM info_approval a_sub
+						WHERE a_sub.ipid_id = x.ipid_id AND a_sub.ia_is_action = 1
+					)
 				LEFT JOIN sys_user su
 					ON su.su_id = x.owner_su_id
 				GROUP BY x.ref_id
@@ -1801,6 +1875,7 @@ func GetListAPQPPPAPItem(c *fiber.Ctx, db *sqlx.DB) error {
 	if err := db.Select(&out, query, args...); err != nil {
 		return c.Status(500).JSON(fiber.Map{"error": "query error", "detail": err.Error()})
 	}
+	setETag(c, db, projectItemSetVersion, ipID)
 	return c.Status(200).JSON(out)
 }
 
@@ -1809,6 +1884,7 @@ func UpdateStatusProjectItemDetail(c *fiber.Ctx, db *sqlx.DB) error {
 	status := c.Query("status")
 	note := c.Query("note")
 	UpdateBy := c.Query("updateBy")
+	updatedAt := c.Query("ipid_updated_at")
 
 	if ipidID == "" {
 		ipidID = c.FormValue("ipid_id")
@@ -1822,13 +1898,21 @@ func UpdateStatusProjectItemDetail(c *fiber.Ctx, db *sqlx.DB) error {
 	if UpdateBy == "" {
 		UpdateBy = c.FormValue("updateBy")
 	}
+	if updatedAt == "" {
+		updatedAt = c.FormValue("ipid_updated_at")
+	}
+	if updatedAt == "" {
+		updatedAt = c.Get(fiber.HeaderIfMatch)
+	}
 
 	// accept JSON body as fallback
-	if ipidID == "" || status == "" {
+	if ipidID == "" || status == "" || UpdateBy == "" || updatedAt == "" {
 		var body struct {
-			IpidID int64  `json:"ipid_id"`
-			Status string `json:"status"`
-			Note   string `json:"note"`
+			IpidID        int64  `json:"ipid_id"`
+			Status        string `json:"status"`
+			Note          string `json:"note"`
+			UpdateBy      string `json:"updateBy"`
+			IpidUpdatedAt string `json:"ipid_updated_at"`
 		}
 		if err := c.BodyParser(&body); err == nil {
 			if ipidID == "" && body.IpidID != 0 {
@@ -1840,6 +1924,12 @@ func UpdateStatusProjectItemDetail(c *fiber.Ctx, db *sqlx.DB) error {
 			if note == "" && body.Note != "" {
 				note = body.Note
 			}
+			if UpdateBy == "" && body.UpdateBy != "" {
+				UpdateBy = body.UpdateBy
+			}
+			if updatedAt == "" && body.IpidUpdatedAt != "" {
+				updatedAt = body.IpidUpdatedAt
+			}
 		}
 	}
 
@@ -1850,278 +1940,49 @@ func UpdateStatusProjectItemDetail(c *fiber.Ctx, db *sqlx.DB) error {
 	if err != nil {
 		return c.Status(400).JSON(fiber.Map{"error": "invalid ipid_id"})
 	}
-
-	// Get ref_id from the given ipid_id
-	var refID int64
-	var ipidType sql.NullString
-	if err := db.Get(&refID, `SELECT ref_id FROM info_project_item_detail WHERE ipid_id = ?`, id); err != nil {
-		return c.Status(400).JSON(fiber.Map{"error": "ipid_id not found"})
-	}
-
-	// Get ipid_type from the given ipid_id
-	if err := db.Get(&ipidType, `SELECT ipid_type FROM info_project_item_detail WHERE ipid_id = ?`, id); err != nil {
-		return c.Status(400).JSON(fiber.Map{"error": "ipid_type not found"})
-	}
-
-	// Get ia_type from info_approval for this ipid_id
-	var iaType sql.NullString
-	if err := db.Get(&iaType, `SELECT ia_type FROM info_approval WHERE ipid_id = ? AND ia_is_action = 1 LIMIT 1`, id); err != nil && err != sql.ErrNoRows {
-		return c.Status(500).JSON(fiber.Map{"error": "failed to get ia_type", "detail": err.Error()})
-	}
-
-	// Get all ipid_ids with the same ref_id
-	var ipidIDs []int64
-	if err := db.Select(&ipidIDs, `SELECT ipid_id FROM info_project_item_detail WHERE ref_id = ?`, refID); err != nil {
-		return c.Status(500).JSON(fiber.Map{"error": "failed to get related ipid_ids", "detail": err.Error()})
+	if strings.TrimSpace(UpdateBy) == "" {
+		return c.Status(400).JSON(fiber.Map{"error": "updateBy required"})
 	}
 
-	// Update all ipid_ids with the same ref_id
-	for _, ipidIDVal := range ipidIDs {
-		query := `UPDATE info_project_item_detail
-		SET ipid_status = ? , ipid_updated_at = ? , ipid_updated_by = ?
-		WHERE ipid_id = ?`
-
-		if _, err := db.Exec(query, status, time.Now(), UpdateBy, ipidIDVal); err != nil {
-			return c.Status(500).JSON(fiber.Map{"error": "query error", "detail": err.Error()})
+	req := itemStatusChange{IpidID: id, Status: status, Note: note, UpdateBy: UpdateBy}
+	if updatedAt != "" {
+		if req.Version, err = normalizeVersion(updatedAt); err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "invalid ipid_updated_at"})
 		}
 	}
-
-	newStatus := status
-	if status == "done" {
-		newStatus = "approve"
+	if !validItemStatus(status) {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid status"})
 	}
 
-	// If status is reject or approve, update info_approval table where ia_type matches
-	if status == "reject" || newStatus == "approve" {
-		// Build WHERE clause based on iaType
-		var updateApprovalQuery string
-		var args []interface{}
-
-		if iaType.Valid && iaType.String != "" {
-			// Update all approvals with same ref_id and ia_type
-			updateApprovalQuery = `UPDATE info_approval 
-			SET ia_status = ?, ia_updated_at = ?, ia_updated_by = ?, ia_note = ? 
-			WHERE ipid_id IN (SELECT ipid_id FROM info_project_item_detail WHERE ref_id = ?) 
-			AND ia_status = 'waiting' AND ia_is_action = 1 AND ia_type = ? AND ia_status_flg = 'active'`
-			now := time.Now()
-			args = []interface{}{newStatus, now, UpdateBy, note, refID, iaType.String}
-		} else {
-			// Fallback: update all approvals for these ipid_ids
-			updateApprovalQuery = `UPDATE info_approval 
-			SET ia_status = ?, ia_updated_at = ?, ia_updated_by = ?, ia_note = ? 
-			WHERE ipid_id IN (SELECT ipid_id FROM info_project_item_detail WHERE ref_id = ?) 
-			AND ia_status = 'waiting' AND ia_is_action = 1 AND ia_status_flg = 'active'`
-			now := time.Now()
-			args = []interface{}{newStatus, now, UpdateBy, note, refID}
+	// electronic signature: the approver re-confirms the password
+	if d := normalizeApprovalStatus(status); d == approvalApprove || d == approvalReject {
+		sign, err := requireApprovalSigning()
+		if err != nil {
+			return c.Status(503).JSON(fiber.Map{"error": "approval signing unavailable", "detail": err.Error()})
 		}
-
-		if _, err := db.Exec(updateApprovalQuery, args...); err != nil {
-			return c.Status(500).JSON(fiber.Map{"error": "failed to update approval status", "detail": err.Error()})
+		if sign {
+			if err := confirmSigner(db, UpdateBy, signaturePassword(c)); err != nil {
+				return c.Status(signerErrorStatus(err)).JSON(fiber.Map{"error": "signature not confirmed", "detail": err.Error()})
+			}
 		}
 	}
 
-	// Send email to the owner with new HTML format (for reject, approve, and done)
-	if status == "reject" || status == "done" || status == "approve" {
-		var detail struct {
-			ProjectCode sql.NullString `db:"ip_code"`
-			PartNo      sql.NullString `db:"ip_part_no"`
-			PartName    sql.NullString `db:"ip_part_name"`
-			IpModel     sql.NullString `db:"ip_model"`
-			OwnerSuID   sql.NullInt64  `db:"su_id"`
-		}
-
-		// Get project details (first item with same ref_id)
-		q := `SELECT
-		ip.ip_code,
-		ip.ip_part_no,
-		ip.ip_part_name,
-		ip.ip_model,
-		pid.su_id
-	FROM info_project_item_detail pid
-	LEFT JOIN info_apqp_item ai ON ai.iai_id = pid.ref_id AND pid.ipid_type = 'apqp'
-	LEFT JOIN info_ppap_item pi ON pi.ipi_id = pid.ref_id AND pid.ipid_type = 'ppap'
-	LEFT JOIN info_project ip ON ip.ip_id = COALESCE(ai.ip_id, pi.ip_id)
-	WHERE pid.ipid_id = ? LIMIT 1`
-
-		if err := db.Get(&detail, q, id); err == nil {
-			// Get owner email
-			var ownerEmail sql.NullString
-			if detail.OwnerSuID.Valid {
-				_ = db.Get(&ownerEmail, `SELECT su_email FROM sys_user WHERE su_id = ? AND su_status = 'active' AND su_email IS NOT NULL AND su_email <> '' LIMIT 1`, detail.OwnerSuID.Int64)
-			}
-
-			// Get all items with the same ref_id
-			type ItemDetail struct {
-				ItemName  sql.NullString `db:"item_name"`
-				ItemType  sql.NullString `db:"item_type"`
-				StartDate sql.NullTime   `db:"ipid_start_date"`
-				EndDate   sql.NullTime   `db:"ipid_end_date"`
-			}
-
-			var allItems []ItemDetail
-			qItems := `SELECT
-			COALESCE(ai.iai_name, pi.ipi_name) AS item_name,
-			pid.ipid_type AS item_type,
-			pid.ipid_start_date,
-			pid.ipid_end_date
-		FROM info_project_item_detail pid
-		LEFT JOIN info_apqp_item ai ON ai.iai_id = pid.ref_id AND pid.ipid_type = 'apqp'
-		LEFT JOIN info_ppap_item pi ON pi.ipi_id = pid.ref_id AND pid.ipid_type = 'ppap'
-		WHERE pid.ref_id = ? AND pid.ipid_type = ?
-		ORDER BY pid.ipid_id`
-
-			_ = db.Select(&allItems, qItems, refID, ipidType.String)
-
-			var sb strings.Builder
-
-			// Get owner firstname from sys_user using su_id from info_project_item_detail
-			var ownerFirstname sql.NullString
-			if detail.OwnerSuID.Valid {
-				_ = db.Get(&ownerFirstname, `SELECT su_firstname FROM sys_user WHERE su_id = ? AND su_status = 'active' LIMIT 1`, detail.OwnerSuID.Int64)
-			}
-
-			ownerStr := "User"
-			if ownerFirstname.Valid && strings.TrimSpace(ownerFirstname.String) != "" {
-				ownerStr = ownerFirstname.String
-			}
-
-			// Get approver's firstname and lastname (person who approved/rejected)
-			var approverFirstName, approverLastName sql.NullString
-			_ = db.QueryRow(`SELECT su_firstname, su_lastname FROM sys_user WHERE su_emp_code = ? AND su_status = 'active' LIMIT 1`, UpdateBy).Scan(&approverFirstName, &approverLastName)
-			var approverName string
-			if approverFirstName.Valid && approverLastName.Valid {
-				approverName = approverFirstName.String + " " + approverLastName.String
-			} else if approverFirstName.Valid {
-				approverName = approverFirstName.String
-			} else if approverLastName.Valid {
-				approverName = approverLastName.String
-			} else {
-				approverName = UpdateBy
-			}
-
-			sb.WriteString("<h3 style='font-family: Arial, sans-serif; color:#1f2d3d;'>Dear, " + html.EscapeString(ownerStr) + "</h3>")
-
-			// Determine status text based on status value
-			var statusText string
-
-			var reasonLabel string
-			if status == "reject" {
-				statusText = "<b style='color : #dc2626;'>rejected </b> by K." + html.EscapeString(approverName) + ""
-
-				reasonLabel = "Reason for Rejection:"
-			} else {
-				statusText = "<b style='color : #16a34a;'>approved </b> by K." + html.EscapeString(approverName) + ""
-
-				reasonLabel = "Approval Note:"
-			}
-
-			sb.WriteString("<h4>Your project item has been " + statusText + "</h4>")
-			// Only show note box for reject status
-			if status == "reject" && strings.TrimSpace(note) != "" {
-				sb.WriteString("<div style='margin-top:15px; padding:12px; background:#fee2e2; border-left:4px solid #dc2626; color:#7f1d1d; font-size:13px;'>")
-				sb.WriteString("<b>" + reasonLabel + "</b><br>")
-				sb.WriteString(html.EscapeString(note))
-				sb.WriteString("</div><br>")
-			}
-			sb.WriteString("<html><body style='font-family: Arial, sans-serif; background:#f6f8fb; padding:20px;'>")
-
-			// Project Detail Card
-			sb.WriteString("<div style='margin:auto; background:#ffffff; border-radius:10px; border:1px solid #e0e6ed; padding:20px;'>")
-			sb.WriteString("<div style='font-size:18px; font-weight:bold; color:#1f2d3d;'>Project Detail</div>")
-			sb.WriteString("<div style='font-size:12px; color:#6b7280;'>Item Information (ข้อมูลของรายการโปรเจค)</div>")
-
-			sb.WriteString("<hr style='border:none; border-top:1px dashed #d1d5db; margin:15px 0;'>")
-
-			// Project Information 2-Column Layout
-			sb.WriteString("<table width='100%' cellpadding='10' cellspacing='0' style='border-collapse:collapse;'>")
-			sb.WriteString("<tr>")
-
-			sb.WriteString("<td style='width:50%; border:1px solid #e5e7eb; border-radius:8px; padding:12px;'>")
-			sb.WriteString("<div style='font-size:12px; color:#374151;'>PROJECT CODE</div>")
-			sb.WriteString("<div style='font-size:14px; font-weight:bold; color:#2563eb;'>#" + html.EscapeString(getStringValue(detail.ProjectCode)) + "</div>")
-			sb.WriteString("</td>")
-
-			sb.WriteString("<td style='width:50%; border:1px solid #e5e7eb; border-radius:8px; padding:12px;'>")
-			sb.WriteString("<div style='font-size:12px; color:#374151;'>MODEL</div>")
-			sb.WriteString("<div style='font-size:14px; font-weight:bold; color:#2563eb;'>" + html.EscapeString(getStringValue(detail.IpModel)) + "</div>")
-			sb.WriteString("</td>")
-
-			sb.WriteString("</tr>")
-			sb.WriteString("<tr>")
-
-			sb.WriteString("<td style='border:1px solid #e5e7eb; border-radius:8px; padding:12px;'>")
-			sb.WriteString("<div style='font-size:12px; color:#374151;'>PART NO</div>")
-			sb.WriteString("<div style='font-size:14px; font-weight:bold; color:#2563eb;'>" + html.EscapeString(getStringValue(detail.PartNo)) + "</div>")
-			sb.WriteString("</td>")
-
-			sb.WriteString("<td colspan='1' style='border:1px solid #e5e7eb; border-radius:8px; padding:12px;'>")
-			sb.WriteString("<div style='font-size:12px; color:#374151;'>PART NAME</div>")
-			sb.WriteString("<div style='font-size:14px; font-weight:bold; color:#2563eb;'>" + html.EscapeString(getStringValue(detail.PartName)) + "</div>")
-			sb.WriteString("</td>")
-
-			sb.WriteString("</tr>")
-			sb.WriteString("</table>")
-			sb.WriteString("<div style='margin-top:20px; font-size:14px; color:#374151;'>")
-			sb.WriteString("</div>")
-			sb.WriteString("</div><br>")
-
-			// Items Table - show ALL items consolidated
-			sb.WriteString("<table width='100%' cellpadding='10' cellspacing='0' style='border-collapse:collapse; border:1px solid #e5e7eb;'>")
-			sb.WriteString("<thead><tr style='background:#f3f4f6; border-bottom:2px solid #d1d5db;'>")
-			cols := []string{"No.", "Item Name", "Item Type", "Start Date", "End Date"}
-			for _, c := range cols {
-				sb.WriteString("<th style='text-align:left; font-weight:bold; color:#374151; font-size:13px;'>" + html.EscapeString(c) + "</th>")
-			}
-			sb.WriteString("</tr></thead><tbody>")
-
-			for i, r := range allItems {
-				var startStr, endStr string
-				if r.StartDate.Valid {
-					startStr = r.StartDate.Time.Format("2006-01-02")
-				}
-				if r.EndDate.Valid {
-					endStr = r.EndDate.Time.Format("2006-01-02")
-				}
-
-				rowBg := ""
-				if i%2 == 0 {
-					rowBg = " style='background:#fbfdff;'"
-				}
-				sb.WriteString("<tr" + rowBg + ">")
-				sb.WriteString("<td style='border-bottom:1px solid #e5e7eb; padding:10px; font-size:13px;'>" + strconv.Itoa(i+1) + "</td>")
-				sb.WriteString("<td style='border-bottom:1px solid #e5e7eb; padding:10px; font-size:13px;'>" + html.EscapeString(getStringValue(r.ItemName)) + "</td>")
-				sb.WriteString("<td style='border-bottom:1px solid #e5e7eb; padding:10px; font-size:13px;'>" + html.EscapeString(getStringValue(r.ItemType)) + "</td>")
-				sb.WriteString("<td style='border-bottom:1px solid #e5e7eb; padding:10px; font-size:13px;'>" + html.EscapeString(startStr) + "</td>")
-				sb.WriteString("<td style='border-bottom:1px solid #e5e7eb; padding:10px; font-size:13px;'>" + html.EscapeString(endStr) + "</td>")
-				sb.WriteString("</tr>")
-			}
-
-			sb.WriteString("</tbody></table>")
-
-			sb.WriteString("<div style='margin-top:20px;'>")
-			sb.WriteString("<a href='http://192.168.161.205:4005/login' style='display:inline-block; padding:10px 20px; background:#2563eb; color:#fff; text-decoration:none; border-radius:6px; font-weight:bold; font-size:14px;'>Open Project Management</a>")
-			sb.WriteString("</div>")
-
-			sb.WriteString("<div style='margin-top:30px; padding-top:20px; border-top:1px solid #e5e7eb; font-size:13px; color:#6b7280;'>")
-			sb.WriteString("<p>Best Regards,<br><strong>System Service Department</strong></p>")
-			sb.WriteString("</div>")
-
-			sb.WriteString("</body></html>")
-
-			// Set subject based on status
-			var subject string
-			if status == "reject" {
-				subject = "TBKK Project Control Notification : Item Rejected"
-			} else {
-				subject = "TBKK Project Control Notification : Item Approved"
-			}
-
-			if ownerEmail.Valid && strings.TrimSpace(ownerEmail.String) != "" {
-				_ = SendMail([]string{ownerEmail.String}, subject, sb.String(), "text/html; charset=utf-8")
-			}
+	res, err := updateProjectItemStatus(db, req, time.Now())
+	if err != nil {
+		switch {
+		case errors.Is(err, errItemNotFound):
+			return c.Status(404).JSON(fiber.Map{"error": "ipid_id not found"})
+		case errors.Is(err, errItemStatusInvalid):
+			return c.Status(400).JSON(fiber.Map{"error": "invalid status"})
+		case errors.Is(err, errItemStale):
+			c.Set(fiber.HeaderETag, `"`+res.Version+`"`)
+			return c.Status(409).JSON(fiber.Map{"error": "item was changed by another user", "ipid_status": res.Status, "ipid_updated_at": res.UpdatedAt})
 		}
+		return c.Status(approvalErrorStatus(err)).JSON(fiber.Map{"error": "failed to update status", "detail": err.Error()})
 	}
+	publishItemEvents(db, streamItemStatus, []int64{id}, UpdateBy)
 
+	c.Set(fiber.HeaderETag, `"`+res.Version+`"`)
 	return c.Status(200).JSON(1)
 }
 
@@ -2179,6 +2040,9 @@ func UpdateStatusCompleteProject(c *fiber.Ctx, db *sqlx.DB) error {
 	}
 
 	// 1. Update info_project to 'finished'
+	if err := checkVersion(c, tx, projectVersion, body.IpID); err != nil {
+		return versionError(c, err)
+	}
 	if _, err := tx.Exec(`
 		UPDATE info_project 
 		SET ip_status = 'finished', ip_updated_at = ?, ip_updated_by = ?
@@ -2200,6 +2064,112 @@ func UpdateStatusCompleteProject(c *fiber.Ctx, db *sqlx.DB) error {
 	if err := tx.Commit(); err != nil {
 		return c.Status(500).JSON(fiber.Map{"error": "commit failed", "detail": err.Error()})
 	}
+	publishProjectEvent(db, body.IpID, "finished", body.UpdatedBy)
 
 	return c.Status(200).JSON(1)
 }
+
+// notifyProjectItemStatus queues the mail to the owner of an item group about the final approve / reject
+func notifyProjectItemStatus(tx *sqlx.Tx, id, refID int64, ipidType, decision, note, updateBy string, onBehalf int64, now time.Time) error {
+	var detail struct {
+		IpID        sql.NullInt64  `db:"ip_id"`
+		ProjectCode sql.NullString `db:"ip_code"`
+		PartNo      sql.NullString `db:"ip_part_no"`
+		PartName    sql.NullString `db:"ip_part_name"`
+		IpModel     sql.NullString `db:"ip_model"`
+		OwnerSuID   sql.NullInt64  `db:"su_id"`
+		SdID        sql.NullInt64  `db:"sd_id"`
+	}
+
+	// Get project details (first item with same ref_id)
+	q := `SELECT
+	ip.ip_id,
+	ip.ip_code,
+	ip.ip_part_no,
+	ip.ip_part_name,
+	ip.ip_model,
+	pid.su_id,
+	pid.sd_id
+FROM info_project_item_detail pid
+LEFT JOIN info_apqp_item ai ON ai.iai_id = pid.ref_id AND pid.ipid_type = 'apqp'
+LEFT JOIN info_ppap_item pi ON pi.ipi_id = pid.ref_id AND pid.ipid_type = 'ppap'
+LEFT JOIN info_project ip ON ip.ip_id = COALESCE(ai.ip_id, pi.ip_id)
+WHERE pid.ipid_id = ? LIMIT 1`
+
+	if err := tx.Get(&detail, q, id); err == nil {
+		// Get owner email
+		var ownerEmail sql.NullString
+		if detail.OwnerSuID.Valid {
+			_ = tx.Get(&ownerEmail, `SELECT su_email FROM sys_user WHERE su_id = ? AND su_status = 'active' AND su_email IS NOT NULL AND su_email <> '' LIMIT 1`, detail.OwnerSuID.Int64)
+		}
+
+		// Get all items with the same ref_id
+		type ItemDetail struct {
+			ItemName  sql.NullString `db:"item_name"`
+			ItemType  sql.NullString `db:"item_type"`
+			StartDate sql.NullTime   `db:"ipid_start_date"`
+			EndDate   sql.NullTime   `db:"ipid_end_date"`
+		}
+
+		var allItems []ItemDetail
+		qItems := `SELECT
+		COALESCE(ai.iai_name, pi.ipi_name) AS item_name,
+		pid.ipid_type AS item_type,
+		pid.ipid_start_date,
+		pid.ipid_end_date
+	FROM info_project_item_detail pid
+	LEFT JOIN info_apqp_item ai ON ai.iai_id = pid.ref_id AND pid.ipid_type = 'apqp'
+	LEFT JOIN info_ppap_item pi ON pi.ipi_id = pid.ref_id AND pid.ipid_type = 'ppap'
+	WHERE pid.ref_id = ? AND pid.ipid_type = ?
+	ORDER BY pid.ipid_id`
+
+		_ = tx.Select(&allItems, qItems, refID, ipidType)
+
+		// Get owner firstname from sys_user using su_id from info_project_item_detail
+		var ownerFirstname sql.NullString
+		if detail.OwnerSuID.Valid {
+			_ = tx.Get(&ownerFirstname, `SELECT su_firstname FROM sys_user WHERE su_id = ? AND su_status = 'active' LIMIT 1`, detail.OwnerSuID.Int64)
+		}
+
+		ownerStr := "User"
+		if ownerFirstname.Valid && strings.TrimSpace(ownerFirstname.String) != "" {
+			ownerStr = ownerFirstname.String
+		}
+
+		// Get approver's firstname and lastname (person who approved/rejected)
+		var approverFirstName, approverLastName sql.NullString
+		_ = tx.QueryRow(`SELECT su_firstname, su_lastname FROM sys_user WHERE su_emp_code = ? AND su_status = 'active' LIMIT 1`, updateBy).Scan(&approverFirstName, &approverLastName)
+		approverName := fullName(approverFirstName, approverLastName)
+		if approverName == "" {
+			approverName = updateBy
+		}
+
+		data := mailData{
+			IpID:          detail.IpID.Int64,
+			IpidID:        id,
+			RecipientName: ownerStr,
+			ActorName:     approverName,
+			OnBehalfName:  onBehalfName(tx, onBehalf),
+			Project:       mailProjectOf(detail.ProjectCode, detail.IpModel, detail.PartNo, detail.PartName),
+			ShowDates:     true,
+		}
+		for _, r := range allItems {
+			data.Items = append(data.Items, mailItem{Name: getStringValue(r.ItemName), Type: getStringValue(r.ItemType), Start: getDateValue(r.StartDate), End: getDateValue(r.EndDate)})
+		}
+
+		key := mailItemApproved
+		if decision == approvalReject {
+			// only a reject shows the note box
+			key = mailItemRejected
+			data.Note, data.NoteLabel, data.NoteReject = strings.TrimSpace(note), "reason_for_rejection", true
+			if err := notifyDepartment(tx, detail.SdID.Int64, key, data, now); err != nil {
+				return err
+			}
+		}
+
+		if ownerEmail.Valid && strings.TrimSpace(ownerEmail.String) != "" {
+			return notifyUser(tx, ownerEmail.String, key, data, now)
+		}
+	}
+	return nil
+}
@@ -114,6 +114,7 @@ func GetTemplateDetail(c *fiber.Ctx, db *sqlx.DB) error {
 	if err := row.MapScan(m); err != nil {
 		return c.Status(404).JSON(fiber.Map{"error": "not found", "detail": err.Error()})
 	}
+	setETag(c, db, templateDetailVersion, id)
 	return c.Status(200).JSON(m)
 }
 
@@ -185,8 +186,11 @@ func UpdateTemplateDetail(c *fiber.Ctx, db *sqlx.DB) error {
 	}
 
 	now := time.Now()
-	res, err := db.Exec(`UPDATE mst_template_detail SET mmp_id = ?, mtpd_updated_at = ?, mtpd_updated_by = ? WHERE mtpd_id = ?`, body.MmpID, now, body.UpdatedBy, body.ID)
+	res, err := execVersioned(c, db, templateDetailVersion, body.ID, `UPDATE mst_template_detail SET mmp_id = ?, mtpd_updated_at = ?, mtpd_updated_by = ? WHERE mtpd_id = ?`, body.MmpID, now, body.UpdatedBy, body.ID)
 	if err != nil {
+		if isVersionError(err) {
+			return versionError(c, err)
+		}
 		return c.Status(500).JSON(5)
 	}
 	ra, _ := res.RowsAffected()
@@ -215,8 +219,11 @@ func UpdateTemplateDetailStatus(c *fiber.Ctx, db *sqlx.DB) error {
 		return c.Status(400).JSON(fiber.Map{"error": "mtpd_updated_by is required"})
 	}
 	now := time.Now()
-	res, err := db.Exec(`UPDATE mst_template_detail SET mtpd_status = ?, mtpd_updated_at = ?, mtpd_updated_by = ? WHERE mtpd_id = ?`, body.Status, now, body.UpdatedBy, body.ID)
+	res, err := execVersioned(c, db, templateDetailVersion, body.ID, `UPDATE mst_template_detail SET mtpd_status = ?, mtpd_updated_at = ?, mtpd_updated_by = ? WHERE mtpd_id = ?`, body.Status, now, body.UpdatedBy, body.ID)
 	if err != nil {
+		if isVersionError(err) {
+			return versionError(c, err)
+		}
 		return c.Status(500).JSON(5)
 	}
 	ra, _ := res.RowsAffected()
@@ -124,8 +124,11 @@ func UpdatePPAPDetail(c *fiber.Ctx, db *sqlx.DB) error {
 	}
 
 	now := time.Now()
-	res, err := db.Exec(`UPDATE mst_ppap_detail SET mmm_id = ?, mpi_id = ?, mpd_updated_at = ?, mpd_updated_by = ? WHERE mpd_id = ?`, body.MmmID, body.MpiID, now, body.UpdatedBy, body.ID)
+	res, err := execVersioned(c, db, ppapDetailVersion, body.ID, `UPDATE mst_ppap_detail SET mmm_id = ?, mpi_id = ?, mpd_updated_at = ?, mpd_updated_by = ? WHERE mpd_id = ?`, body.MmmID, body.MpiID, now, body.UpdatedBy, body.ID)
 	if err != nil {
+		if isVersionError(err) {
+			return versionError(c, err)
+		}
 		return c.Status(500).JSON(5)
 	}
 	ra, _ := res.RowsAffected()
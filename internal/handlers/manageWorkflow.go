@@ -141,8 +141,11 @@ func UpdateWorkflow(c *fiber.Ctx, db *sqlx.DB) error {
 	}
 
 	now := time.Now()
-	res, err := db.Exec(`UPDATE sys_workflow SET sd_id = ?,su_id = ?, sw_order = ?, sw_updated_at = ?, sw_updated_by = ? WHERE sw_id = ?`, body.SdID, body.SuID, orderVal, now, body.UpdatedBy, body.ID)
+	res, err := execVersioned(c, db, workflowVersion, body.ID, `UPDATE sys_workflow SET sd_id = ?,su_id = ?, sw_order = ?, sw_updated_at = ?, sw_updated_by = ? WHERE sw_id = ?`, body.SdID, body.SuID, orderVal, now, body.UpdatedBy, body.ID)
 	if err != nil {
+		if isVersionError(err) {
+			return versionError(c, err)
+		}
 		return c.Status(500).JSON(5)
 	}
 	ra, _ := res.RowsAffected()
@@ -171,8 +174,11 @@ func UpdateWorkflowStatus(c *fiber.Ctx, db *sqlx.DB) error {
 		return c.Status(400).JSON(fiber.Map{"error": "sw_updated_by is required"})
 	}
 	now := time.Now()
-	res, err := db.Exec(`UPDATE sys_workflow SET sw_status = ?, sw_updated_at = ?, sw_updated_by = ? WHERE sw_id = ?`, body.Status, now, body.UpdatedBy, body.ID)
+	res, err := execVersioned(c, db, workflowVersion, body.ID, `UPDATE sys_workflow SET sw_status = ?, sw_updated_at = ?, sw_updated_by = ? WHERE sw_id = ?`, body.Status, now, body.UpdatedBy, body.ID)
 	if err != nil {
+		if isVersionError(err) {
+			return versionError(c, err)
+		}
 		return c.Status(500).JSON(5)
 	}
 	ra, _ := res.RowsAffected()
@@ -219,3 +225,238 @@ func SelectUserMW(c *fiber.Ctx, db *sqlx.DB) error {
 	}
 	return c.Status(200).JSON(users)
 }
+
+// SysApprovalStage represents a row in sys_approval_stage
+type SysApprovalStage struct {
+	ID        int64            `db:"sas_id" json:"sas_id"`
+	SdID      utils.NullInt64  `db:"sd_id" json:"sd_id"`
+	SdName    utils.NullString `db:"sd_name" json:"sd_name"`
+	ItemType  utils.NullString `db:"sas_item_type" json:"sas_item_type"`
+	Order     int64            `db:"sas_order" json:"sas_order"`
+	Type      string           `db:"sas_type" json:"sas_type"`
+	Source    string           `db:"sas_source" json:"sas_source"`
+	SuID      utils.NullInt64  `db:"su_id" json:"su_id"`
+	Status    string           `db:"sas_status" json:"sas_status"`
+	UpdatedAt *time.Time       `db:"sas_updated_at" json:"sas_updated_at"`
+	UpdatedBy utils.NullString `db:"sas_updated_by" json:"sas_updated_by"`
+}
+
+func ListApprovalStage(c *fiber.Ctx, db *sqlx.DB) error {
+	var res []SysApprovalStage
+	query := `SELECT sas.sas_id, sas.sd_id, sd.sd_name, sas.sas_item_type, sas.sas_order, sas.sas_type,
+					 sas.sas_source, sas.su_id, sas.sas_status, sas.sas_updated_at, sas.sas_updated_by
+				FROM sys_approval_stage sas
+				LEFT JOIN sys_department sd ON sd.sd_id = sas.sd_id`
+	var err error
+	if sdID := c.Query("sd_id"); sdID != "" {
+		query += ` WHERE sas.sd_id = ? ORDER BY sas.sas_item_type ASC, sas.sas_order ASC`
+		err = db.Select(&res, query, sdID)
+	} else {
+		query += ` ORDER BY sas.sd_id ASC, sas.sas_item_type ASC, sas.sas_order ASC`
+		err = db.Select(&res, query)
+	}
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "query error", "detail": err.Error()})
+	}
+	return c.Status(200).JSON(res)
+}
+
+type approvalStageBody struct {
+	ID        int64   `json:"sas_id"`
+	SdID      *int64  `json:"sd_id"`
+	ItemType  *string `json:"sas_item_type"`
+	Order     int64   `json:"sas_order"`
+	Type      string  `json:"sas_type"`
+	Source    string  `json:"sas_source"`
+	SuID      *int64  `json:"su_id"`
+	Status    string  `json:"sas_status"`
+	UpdatedBy string  `json:"sas_updated_by"`
+}
+
+func (b approvalStageBody) validate() string {
+	if b.Order <= 0 {
+		return "sas_order must be greater than 0"
+	}
+	if b.Type == "" {
+		return "sas_type is required"
+	}
+	switch b.Source {
+	case stageSourceWorkflow, stageSourceCreator:
+	case stageSourceUser:
+		if b.SuID == nil {
+			return "su_id is required when sas_source is 'user'"
+		}
+	default:
+		return "sas_source must be 'workflow', 'creator' or 'user'"
+	}
+	if b.ItemType != nil && *b.ItemType != "apqp" && *b.ItemType != "ppap" {
+		return "sas_item_type must be 'apqp' or 'ppap'"
+	}
+	return ""
+}
+
+func InsertApprovalStage(c *fiber.Ctx, db *sqlx.DB) error {
+	var body approvalStageBody
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid request", "detail": err.Error()})
+	}
+	if msg := body.validate(); msg != "" {
+		return c.Status(400).JSON(fiber.Map{"error": msg})
+	}
+
+	// duplicate check: same scope + order
+	var count int
+	if err := db.Get(&count, `SELECT COUNT(*) FROM sys_approval_stage WHERE sd_id <=> ? AND sas_item_type <=> ? AND sas_order = ? AND sas_status = 'active'`, body.SdID, body.ItemType, body.Order); err != nil {
+		return c.Status(500).JSON(5)
+	}
+	if count > 0 {
+		return c.Status(200).JSON(2)
+	}
+
+	now := time.Now()
+	if _, err := db.Exec(`INSERT INTO sys_approval_stage (sd_id, sas_item_type, sas_order, sas_type, sas_source, su_id, sas_status, sas_created_at, sas_created_by, sas_updated_at, sas_updated_by) VALUES (?, ?, ?, ?, ?, ?, 'active', ?, ?, ?, ?)`,
+		body.SdID, body.ItemType, body.Order, body.Type, body.Source, body.SuID, now, body.UpdatedBy, now, body.UpdatedBy); err != nil {
+		return c.Status(500).JSON(5)
+	}
+	return c.Status(201).JSON(1)
+}
+
+func UpdateApprovalStage(c *fiber.Ctx, db *sqlx.DB) error {
+	var body approvalStageBody
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid request", "detail": err.Error()})
+	}
+	if body.ID == 0 {
+		return c.Status(400).JSON(fiber.Map{"error": "sas_id is required"})
+	}
+	if msg := body.validate(); msg != "" {
+		return c.Status(400).JSON(fiber.Map{"error": msg})
+	}
+	if body.Status == "" {
+		body.Status = "active"
+	}
+	if body.Status != "active" && body.Status != "inactive" {
+		return c.Status(400).JSON(fiber.Map{"error": "sas_status must be 'active' or 'inactive'"})
+	}
+
+	var count int
+	if err := db.Get(&count, `SELECT COUNT(*) FROM sys_approval_stage WHERE sd_id <=> ? AND sas_item_type <=> ? AND sas_order = ? AND sas_status = 'active' AND sas_id <> ?`, body.SdID, body.ItemType, body.Order, body.ID); err != nil {
+		return c.Status(500).JSON(5)
+	}
+	if count > 0 && body.Status == "active" {
+		return c.Status(200).JSON(2)
+	}
+
+	res, err := execVersioned(c, db, approvalStageVersion, body.ID, `UPDATE sys_approval_stage SET sd_id = ?, sas_item_type = ?, sas_order = ?, sas_type = ?, sas_source = ?, su_id = ?, sas_status = ?, sas_updated_at = ?, sas_updated_by = ? WHERE sas_id = ?`,
+		body.SdID, body.ItemType, body.Order, body.Type, body.Source, body.SuID, body.Status, time.Now(), body.UpdatedBy, body.ID)
+	if err != nil {
+		if isVersionError(err) {
+			return versionError(c, err)
+		}
+		return c.Status(500).JSON(5)
+	}
+	ra, _ := res.RowsAffected()
+	if ra == 0 {
+		return c.Status(404).JSON(fiber.Map{"error": "approval stage not found"})
+	}
+	return c.Status(200).JSON(1)
+}
+
+// SysWorkflowRule represents a row in sys_workflow_rule (rule of one sd_id + sw_order level)
+type SysWorkflowRule struct {
+	ID        int64            `db:"swr_id" json:"swr_id"`
+	SdID      int64            `db:"sd_id" json:"sd_id"`
+	Order     int64            `db:"sw_order" json:"sw_order"`
+	Rule      string           `db:"swr_rule" json:"swr_rule"`
+	Quorum    utils.NullInt64  `db:"swr_quorum" json:"swr_quorum"`
+	Approvers int64            `db:"approvers" json:"approvers"`
+	Status    string           `db:"swr_status" json:"swr_status"`
+	UpdatedAt *time.Time       `db:"swr_updated_at" json:"swr_updated_at"`
+	UpdatedBy utils.NullString `db:"swr_updated_by" json:"swr_updated_by"`
+}
+
+func ListWorkflowRule(c *fiber.Ctx, db *sqlx.DB) error {
+	sdID := c.Query("sd_id")
+	if sdID == "" {
+		return c.Status(400).JSON(fiber.Map{"error": "sd_id query parameter is required"})
+	}
+	var res []SysWorkflowRule
+	query := `SELECT swr.swr_id, swr.sd_id, swr.sw_order, swr.swr_rule, swr.swr_quorum, swr.swr_status, swr.swr_updated_at, swr.swr_updated_by,
+					 (SELECT COUNT(*) FROM sys_workflow sw WHERE sw.sd_id = swr.sd_id AND sw.sw_order = swr.sw_order AND sw.sw_status = 'active') AS approvers
+				FROM sys_workflow_rule swr
+				WHERE swr.sd_id = ?
+				ORDER BY swr.sw_order ASC`
+	if err := db.Select(&res, query, sdID); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "query error", "detail": err.Error()})
+	}
+	return c.Status(200).JSON(res)
+}
+
+// SaveWorkflowRule inserts or replaces the rule of a level (sd_id + sw_order)
+func SaveWorkflowRule(c *fiber.Ctx, db *sqlx.DB) error {
+	var body struct {
+		SdID      int64  `json:"sd_id"`
+		Order     int64  `json:"sw_order"`
+		Rule      string `json:"swr_rule"`
+		Quorum    *int64 `json:"swr_quorum"`
+		UpdatedBy string `json:"swr_updated_by"`
+	}
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid request", "detail": err.Error()})
+	}
+	if body.SdID == 0 {
+		return c.Status(400).JSON(fiber.Map{"error": "sd_id is required"})
+	}
+	switch body.Rule {
+	case workflowRuleAny, workflowRuleAll:
+		body.Quorum = nil
+	case workflowRuleNofM:
+		if body.Quorum == nil || *body.Quorum < 1 {
+			return c.Status(400).JSON(fiber.Map{"error": "swr_quorum must be at least 1 for 'n_of_m'"})
+		}
+		var approvers int64
+		if err := db.Get(&approvers, `SELECT COUNT(*) FROM sys_workflow WHERE sd_id = ? AND sw_order = ? AND sw_status = 'active'`, body.SdID, body.Order); err != nil {
+			return c.Status(500).JSON(5)
+		}
+		if *body.Quorum > approvers {
+			return c.Status(400).JSON(fiber.Map{"error": "swr_quorum is greater than the approvers of this level", "approvers": approvers})
+		}
+	default:
+		return c.Status(400).JSON(fiber.Map{"error": "swr_rule must be 'any', 'all' or 'n_of_m'"})
+	}
+
+	now := time.Now()
+	if _, err := db.Exec(`INSERT INTO sys_workflow_rule (sd_id, sw_order, swr_rule, swr_quorum, swr_status, swr_created_at, swr_created_by, swr_updated_at, swr_updated_by)
+		VALUES (?, ?, ?, ?, 'active', ?, ?, ?, ?)
+		ON DUPLICATE KEY UPDATE swr_rule = VALUES(swr_rule), swr_quorum = VALUES(swr_quorum), swr_status = 'active', swr_updated_at = VALUES(swr_updated_at), swr_updated_by = VALUES(swr_updated_by)`,
+		body.SdID, body.Order, body.Rule, body.Quorum, now, body.UpdatedBy, now, body.UpdatedBy); err != nil {
+		return c.Status(500).JSON(5)
+	}
+	return c.Status(200).JSON(1)
+}
+
+func UpdateWorkflowRuleStatus(c *fiber.Ctx, db *sqlx.DB) error {
+	var body struct {
+		ID        int64  `json:"swr_id"`
+		Status    string `json:"swr_status"`
+		UpdatedBy string `json:"swr_updated_by"`
+	}
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid request body", "detail": err.Error()})
+	}
+	if body.ID == 0 {
+		return c.Status(400).JSON(fiber.Map{"error": "swr_id is required"})
+	}
+	if body.Status != "active" && body.Status != "inactive" {
+		return c.Status(400).JSON(fiber.Map{"error": "swr_status must be 'active' or 'inactive'"})
+	}
+	res, err := db.Exec(`UPDATE sys_workflow_rule SET swr_status = ?, swr_updated_at = ?, swr_updated_by = ? WHERE swr_id = ?`, body.Status, time.Now(), body.UpdatedBy, body.ID)
+	if err != nil {
+		return c.Status(500).JSON(5)
+	}
+	ra, _ := res.RowsAffected()
+	if ra == 0 {
+		return c.Status(404).JSON(fiber.Map{"error": "workflow rule not found"})
+	}
+	return c.Status(200).JSON(1)
+}
@@ -67,6 +67,7 @@ func GetMenuGroup(c *fiber.Ctx, db *sqlx.DB) error {
 		}
 		return c.Status(500).JSON(fiber.Map{"error": "query error", "detail": err.Error()})
 	}
+	setETag(c, db, menuGroupVersion, id)
 	return c.Status(200).JSON(m)
 }
 
@@ -131,9 +132,12 @@ func UpdateMenuGroupStatus(c *fiber.Ctx, db *sqlx.DB) error {
 	if err := c.BodyParser(&body); err != nil {
 		return c.Status(400).JSON(fiber.Map{"error": "invalid request body", "detail": err.Error()})
 	}
-	_, err := db.Exec(`UPDATE sys_menu SET sm_status = ?, sm_updated_at = ?, sm_updated_by = ? WHERE sm_id = ?`,
+	_, err := execVersioned(c, db, menuGroupVersion, body.SmID, `UPDATE sys_menu SET sm_status = ?, sm_updated_at = ?, sm_updated_by = ? WHERE sm_id = ?`,
 		body.Status, time.Now(), body.UpdatedBy, body.SmID)
 	if err != nil {
+		if isVersionError(err) {
+			return versionError(c, err)
+		}
 		return c.Status(200).JSON(0)
 	}
 	return c.Status(200).JSON(1)
@@ -168,9 +172,12 @@ func UpdateMenuGroup(c *fiber.Ctx, db *sqlx.DB) error {
 		}
 	}
 
-	_, err := db.Exec(`UPDATE sys_menu SET sm_name = ?, sm_icon = ?, sm_order = ?, sm_updated_at = ?, sm_updated_by = ? WHERE sm_id = ?`,
+	_, err := execVersioned(c, db, menuGroupVersion, body.ID, `UPDATE sys_menu SET sm_name = ?, sm_icon = ?, sm_order = ?, sm_updated_at = ?, sm_updated_by = ? WHERE sm_id = ?`,
 		body.Name, body.Icon, body.Order, time.Now(), body.UpdatedBy, body.ID)
 	if err != nil {
+		if isVersionError(err) {
+			return versionError(c, err)
+		}
 		return c.Status(500).JSON(5)
 	}
 	return c.Status(200).JSON(1)
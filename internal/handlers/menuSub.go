@@ -106,6 +106,7 @@ func GetSubMenu(c *fiber.Ctx, db *sqlx.DB) error {
 		}
 		return c.Status(500).JSON(fiber.Map{"error": "query error", "detail": err.Error()})
 	}
+	setETag(c, db, subMenuVersion, id)
 	return c.Status(200).JSON(sub)
 }
 
@@ -228,7 +229,7 @@ func UpdateMenuSub(c *fiber.Ctx, db *sqlx.DB) error {
 	}
 
 	now := time.Now()
-	res, err := db.Exec(`UPDATE sys_submenu SET ss_name = ?, ss_link = ?, ss_order = ?, ss_updated_at = ?, ss_updated_by = ? WHERE ss_id = ?`,
+	res, err := execVersioned(c, db, subMenuVersion, body.ID, `UPDATE sys_submenu SET ss_name = ?, ss_link = ?, ss_order = ?, ss_updated_at = ?, ss_updated_by = ? WHERE ss_id = ?`,
 		body.Name,
 		body.Link,
 		orderVal,
@@ -237,6 +238,9 @@ func UpdateMenuSub(c *fiber.Ctx, db *sqlx.DB) error {
 		body.ID,
 	)
 	if err != nil {
+		if isVersionError(err) {
+			return versionError(c, err)
+		}
 		return c.Status(500).JSON(fiber.Map{"error": "update error", "detail": err.Error()})
 	}
 	ra, _ := res.RowsAffected()
@@ -266,9 +270,12 @@ func UpdateMenuSubStatus(c *fiber.Ctx, db *sqlx.DB) error {
 		return c.Status(400).JSON(fiber.Map{"error": "ss_updated_by is required"})
 	}
 	now := time.Now()
-	res, err := db.Exec(`UPDATE sys_submenu SET ss_status = ?, ss_updated_at = ?, ss_updated_by = ? WHERE ss_id = ?`,
+	res, err := execVersioned(c, db, subMenuVersion, body.ID, `UPDATE sys_submenu SET ss_status = ?, ss_updated_at = ?, ss_updated_by = ? WHERE ss_id = ?`,
 		body.Status, now, body.UpdatedBy, body.ID)
 	if err != nil {
+		if isVersionError(err) {
+			return versionError(c, err)
+		}
 		return c.Status(500).JSON(fiber.Map{"error": "failed to update submenu status", "detail": err.Error()})
 	}
 	ra, _ := res.RowsAffected()
@@ -0,0 +1,129 @@
+package handlers
+
+import (
+	"strconv"
+	"time"
+
+	"apiTrackingSystem/internal/utils"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jmoiron/sqlx"
+)
+
+// InfoNotification represents a row in info_notification
+type InfoNotification struct {
+	ID        int64            `db:"in_id" json:"in_id"`
+	SuID      int64            `db:"su_id" json:"su_id"`
+	Type      string           `db:"in_type" json:"in_type"`
+	IpID      utils.NullInt64  `db:"ip_id" json:"ip_id"`
+	IpidID    utils.NullInt64  `db:"ipid_id" json:"ipid_id"`
+	IpCode    utils.NullString `db:"ip_code" json:"ip_code"`
+	Title     string           `db:"in_title" json:"in_title"`
+	Message   utils.NullString `db:"in_message" json:"in_message"`
+	IsRead    bool             `db:"in_is_read" json:"in_is_read"`
+	ReadAt    *time.Time       `db:"in_read_at" json:"in_read_at"`
+	CreatedAt time.Time        `db:"in_created_at" json:"in_created_at"`
+}
+
+// addInboxNotification stores an event in the inbox of a user (same transaction as the business change)
+func addInboxNotification(q sqlx.Execer, suID int64, event, title string, data mailData, now time.Time) error {
+	_, err := q.Exec(`INSERT INTO info_notification (su_id, in_type, ip_id, ipid_id, in_title, in_message, in_is_read, in_created_at) VALUES (?, ?, ?, ?, ?, ?, 0, ?)`,
+		suID, event, nullID(data.IpID), nullID(data.IpidID), title, notificationText(data), now)
+	return err
+}
+
+// nullID maps an unset id (0) to NULL
+func nullID(id int64) utils.NullInt64 {
+	var n utils.NullInt64
+	n.Int64, n.Valid = id, id > 0
+	return n
+}
+
+func unreadNotificationCount(q sqlx.Queryer, suID int64) (int, error) {
+	var n int
+	err := sqlx.Get(q, &n, `SELECT COUNT(*) FROM info_notification WHERE su_id = ? AND in_is_read = 0`, suID)
+	return n, err
+}
+
+// ListNotification lists the inbox of a user, newest first.
+// Query: su_id (required), unread=1 for unread only, limit (default 50), before_id for the next page.
+func ListNotification(c *fiber.Ctx, db *sqlx.DB) error {
+	suID, err := strconv.ParseInt(c.Query("su_id"), 10, 64)
+	if err != nil || suID <= 0 {
+		return c.Status(400).JSON(fiber.Map{"error": "su_id is required"})
+	}
+	limit, err := strconv.Atoi(c.Query("limit", "50"))
+	if err != nil || limit <= 0 || limit > 200 {
+		limit = 50
+	}
+
+	query := `SELECT n.in_id, n.su_id, n.in_type, n.ip_id, n.ipid_id, ip.ip_code, n.in_title, n.in_message, n.in_is_read, n.in_read_at, n.in_created_at
+		FROM info_notification n
+		LEFT JOIN info_project ip ON ip.ip_id = n.ip_id
+		WHERE n.su_id = ?`
+	args := []interface{}{suID}
+	if c.Query("unread") == "1" || c.Query("unread") == "true" {
+		query += ` AND n.in_is_read = 0`
+	}
+	if before, err := strconv.ParseInt(c.Query("before_id"), 10, 64); err == nil && before > 0 {
+		query += ` AND n.in_id < ?`
+		args = append(args, before)
+	}
+	query += ` ORDER BY n.in_id DESC LIMIT ?`
+	args = append(args, limit)
+
+	list := []InfoNotification{}
+	if err := db.Select(&list, query, args...); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "query error", "detail": err.Error()})
+	}
+	unread, err := unreadNotificationCount(db, suID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "query error", "detail": err.Error()})
+	}
+	return c.Status(200).JSON(fiber.Map{"items": list, "unread": unread})
+}
+
+// MarkNotificationRead marks notifications of a user as read.
+// Body: { "su_id": 1, "in_ids": [10, 11] }
+func MarkNotificationRead(c *fiber.Ctx, db *sqlx.DB) error {
+	var body struct {
+		SuID  int64   `json:"su_id"`
+		InIDs []int64 `json:"in_ids"`
+	}
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid request", "detail": err.Error()})
+	}
+	if body.SuID <= 0 || len(body.InIDs) == 0 {
+		return c.Status(400).JSON(fiber.Map{"error": "su_id and in_ids are required"})
+	}
+	q, args, err := sqlx.In(`UPDATE info_notification SET in_is_read = 1, in_read_at = ? WHERE su_id = ? AND in_is_read = 0 AND in_id IN (?)`, time.Now(), body.SuID, body.InIDs)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "update error", "detail": err.Error()})
+	}
+	res, err := db.Exec(db.Rebind(q), args...)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "update error", "detail": err.Error()})
+	}
+	n, _ := res.RowsAffected()
+	return c.Status(200).JSON(fiber.Map{"updated": n})
+}
+
+// MarkAllNotificationRead marks the whole inbox of a user as read.
+// Body: { "su_id": 1 }
+func MarkAllNotificationRead(c *fiber.Ctx, db *sqlx.DB) error {
+	var body struct {
+		SuID int64 `json:"su_id"`
+	}
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid request", "detail": err.Error()})
+	}
+	if body.SuID <= 0 {
+		return c.Status(400).JSON(fiber.Map{"error": "su_id is required"})
+	}
+	res, err := db.Exec(`UPDATE info_notification SET in_is_read = 1, in_read_at = ? WHERE su_id = ? AND in_is_read = 0`, time.Now(), body.SuID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "update error", "detail": err.Error()})
+	}
+	n, _ := res.RowsAffected()
+	return c.Status(200).JSON(fiber.Map{"updated": n})
+}
@@ -0,0 +1,440 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jmoiron/sqlx"
+)
+
+// notification modes (sys_notification_pref.snp_mode)
+const (
+	notifyImmediate = "immediate"
+	notifyDaily     = "daily"
+	notifyWeekly    = "weekly"
+	notifyOff       = "off"
+)
+
+// notification scopes (sys_notification_pref.snp_scope)
+const (
+	notifyScopeAll        = "all"
+	notifyScopeMine       = "mine"
+	notifyScopeDepartment = "department"
+)
+
+const digestPending, digestSent = "pending", "sent"
+
+// notificationPref is the effective preference of a user for one event
+type notificationPref struct {
+	Mode  string `db:"snp_mode" json:"snp_mode"`
+	Scope string `db:"snp_scope" json:"snp_scope"`
+}
+
+var defaultNotificationPref = notificationPref{Mode: notifyImmediate, Scope: notifyScopeAll}
+
+// notificationEvents are the events a user can configure (every mail except the digest itself)
+func notificationEvents() []string {
+	events := make([]string, 0, len(mailTemplateKeys))
+	for _, k := range mailTemplateKeys {
+		if k != mailDigest {
+			events = append(events, k)
+		}
+	}
+	return events
+}
+
+func validNotificationMode(event, mode string) bool {
+	switch mode {
+	case notifyImmediate, notifyOff:
+		return true
+	case notifyDaily, notifyWeekly:
+		// the tracking report is a periodic mail already
+		return event != mailTrackingReport
+	}
+	return false
+}
+
+func validNotificationScope(scope string) bool {
+	return scope == notifyScopeAll || scope == notifyScopeMine || scope == notifyScopeDepartment
+}
+
+// mailRecipient is the sys_user owning a mail address
+type mailRecipient struct {
+	SuID      int64          `db:"su_id"`
+	EmpCode   sql.NullString `db:"su_emp_code"`
+	SdID      sql.NullInt64  `db:"sd_id"`
+	FirstName sql.NullString `db:"su_firstname"`
+	Language  sql.NullString `db:"su_language"`
+}
+
+// loadMailRecipient finds the user of an address (false when it is not a user's address)
+func loadMailRecipient(q sqlx.Queryer, email string) (mailRecipient, bool, error) {
+	var r mailRecipient
+	err := sqlx.Get(q, &r, `SELECT su_id, su_emp_code, sd_id, su_firstname, su_language FROM sys_user WHERE su_email = ? ORDER BY su_status = 'active' DESC, su_id LIMIT 1`, strings.TrimSpace(email))
+	if errors.Is(err, sql.ErrNoRows) {
+		return r, false, nil
+	}
+	return r, err == nil, err
+}
+
+func (r mailRecipient) lang() string {
+	return userMailLang(r.Language)
+}
+
+// userNotificationPref returns the preference of a user for an event (default immediate / all)
+func userNotificationPref(q sqlx.Queryer, suID int64, event string) (notificationPref, error) {
+	p := defaultNotificationPref
+	err := sqlx.Get(q, &p, `SELECT snp_mode, snp_scope FROM sys_notification_pref WHERE su_id = ? AND snp_event = ? LIMIT 1`, suID, event)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return defaultNotificationPref, err
+	}
+	return p, nil
+}
+
+// projectInScope reports whether a project is one of the user's ("mine": owner, creator or approver
+// of an item) or belongs to the user's department ("department": an item assigned to it)
+func projectInScope(q sqlx.Queryer, r mailRecipient, scope string, ipID int64) (bool, error) {
+	if scope == notifyScopeAll || ipID == 0 {
+		return true, nil
+	}
+	items := `SELECT pid.ipid_id, pid.su_id, pid.sd_id, pid.ipid_created_by FROM info_project_item_detail pid
+		LEFT JOIN info_apqp_item ai ON ai.iai_id = pid.ref_id AND pid.ipid_type = 'apqp'
+		LEFT JOIN info_ppap_item pi ON pi.ipi_id = pid.ref_id AND pid.ipid_type = 'ppap'
+		WHERE COALESCE(ai.ip_id, pi.ip_id) = ?`
+	var n int
+	var err error
+	switch scope {
+	case notifyScopeMine:
+		err = sqlx.Get(q, &n, `SELECT
+			(SELECT COUNT(*) FROM info_project WHERE ip_id = ? AND ip_created_by = ?) +
+			(SELECT COUNT(*) FROM (`+items+`) x WHERE x.su_id = ? OR x.ipid_created_by = ?
+				OR EXISTS (SELECT 1 FROM info_approval ia WHERE ia.ipid_id = x.ipid_id AND ia.su_id = ?))`,
+			ipID, r.EmpCode.String, ipID, r.SuID, r.EmpCode.String, r.SuID)
+	case notifyScopeDepartment:
+		if !r.SdID.Valid {
+			return false, nil
+		}
+		err = sqlx.Get(q, &n, `SELECT COUNT(*) FROM (`+items+`) x WHERE x.sd_id = ?`, ipID, r.SdID.Int64)
+	}
+	return n > 0, err
+}
+
+// digestDueAt is when an event queued now goes out: the next NOTIFY_DIGEST_HOUR (default 8:00),
+// for weekly digests on the next Monday
+func digestDueAt(mode string, now time.Time) time.Time {
+	hour := 8
+	if h, err := strconv.Atoi(strings.TrimSpace(os.Getenv("NOTIFY_DIGEST_HOUR"))); err == nil && h >= 0 && h < 24 {
+		hour = h
+	}
+	due := time.Date(now.Year(), now.Month(), now.Day(), hour, 0, 0, 0, now.Location())
+	if !due.After(now) {
+		due = due.AddDate(0, 0, 1)
+	}
+	if mode == notifyWeekly {
+		for due.Weekday() != time.Monday {
+			due = due.AddDate(0, 0, 1)
+		}
+	}
+	return due
+}
+
+// notifyUser is the single entry point for event mails. It applies the recipient's preference:
+// the scope drops projects that are not theirs, the event goes to the user's inbox, then off drops
+// the mail, daily / weekly hold it for the digest and immediate queues it in the outbox.
+func notifyUser(q sqlx.Ext, to, event string, data mailData, now time.Time) error {
+	to = strings.TrimSpace(to)
+	if to == "" {
+		return nil
+	}
+	r, known, err := loadMailRecipient(q, to)
+	if err != nil {
+		return err
+	}
+	pref := defaultNotificationPref
+	if known {
+		if pref, err = userNotificationPref(q, r.SuID, event); err != nil {
+			return err
+		}
+	}
+	if known && pref.Scope != notifyScopeAll {
+		ok, err := projectInScope(q, r, pref.Scope, data.IpID)
+		if err != nil || !ok {
+			return err
+		}
+		if len(data.Items) > 0 {
+			kept := data.Items[:0:0]
+			for _, it := range data.Items {
+				in, err := projectInScope(q, r, pref.Scope, it.IpID)
+				if err != nil {
+					return err
+				}
+				if in {
+					kept = append(kept, it)
+				}
+			}
+			if len(kept) == 0 {
+				return nil
+			}
+			data.Items = kept
+		}
+	}
+
+	lang := data.Lang
+	if !validMailLang(lang) {
+		lang = defaultMailLang()
+		if known {
+			lang = r.lang()
+		}
+	}
+	subject, body, err := renderMail(q, event, lang, data)
+	if err != nil {
+		return err
+	}
+	if known {
+		if err := addInboxNotification(q, r.SuID, event, subject, data, now); err != nil {
+			return err
+		}
+	}
+	if pref.Mode == notifyOff {
+		return nil
+	}
+	if !known || pref.Mode == notifyImmediate {
+		return enqueueMail(q, []string{to}, subject, body, mailContentHTML, now)
+	}
+
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	_, err = q.Exec(`INSERT INTO info_notification_digest (su_id, ind_email, ind_event, ind_mode, ind_subject, ind_data, ind_status, ind_due_at, ind_created_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		r.SuID, to, event, pref.Mode, subject, string(raw), digestPending, digestDueAt(pref.Mode, now), now)
+	return err
+}
+
+// digestResult is the summary of one digest run
+type digestResult struct {
+	Users  int      `json:"users"`
+	Events int      `json:"events"`
+	Errors []string `json:"errors"`
+}
+
+// StartNotificationDigestScheduler builds due digests every NOTIFY_DIGEST_INTERVAL (default 15m, "off" disables)
+func StartNotificationDigestScheduler(db *sqlx.DB) {
+	raw := strings.TrimSpace(os.Getenv("NOTIFY_DIGEST_INTERVAL"))
+	if strings.EqualFold(raw, "off") || raw == "0" {
+		log.Printf("notification digest scheduler disabled")
+		return
+	}
+	interval := 15 * time.Minute
+	if raw != "" {
+		d, err := time.ParseDuration(raw)
+		if err != nil || d < time.Minute {
+			log.Printf("notification digest scheduler: invalid NOTIFY_DIGEST_INTERVAL %q, using 15m", raw)
+		} else {
+			interval = d
+		}
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			res := runNotificationDigest(db, time.Now())
+			if res.Users > 0 || len(res.Errors) > 0 {
+				log.Printf("notification digest: users=%d events=%d errors=%d", res.Users, res.Events, len(res.Errors))
+			}
+			<-ticker.C
+		}
+	}()
+}
+
+// RunNotificationDigest builds the due digests once (manual trigger)
+func RunNotificationDigest(c *fiber.Ctx, db *sqlx.DB) error {
+	return c.Status(200).JSON(runNotificationDigest(db, time.Now()))
+}
+
+func runNotificationDigest(db *sqlx.DB, now time.Time) digestResult {
+	res := digestResult{Errors: []string{}}
+
+	var users []struct {
+		SuID  int64  `db:"su_id"`
+		Email string `db:"ind_email"`
+	}
+	if err := db.Select(&users, `SELECT DISTINCT su_id, ind_email FROM info_notification_digest WHERE ind_status = ? AND ind_due_at <= ?`, digestPending, now); err != nil {
+		res.Errors = append(res.Errors, "query digest: "+err.Error())
+		return res
+	}
+	for _, u := range users {
+		n, err := sendUserDigest(db, u.SuID, u.Email, now)
+		if err != nil {
+			res.Errors = append(res.Errors, "digest su_id="+strconv.FormatInt(u.SuID, 10)+": "+err.Error())
+			continue
+		}
+		if n > 0 {
+			res.Users++
+			res.Events += n
+		}
+	}
+	return res
+}
+
+// sendUserDigest queues one mail with every due event of a user and marks the events sent
+func sendUserDigest(db *sqlx.DB, suID int64, email string, now time.Time) (int, error) {
+	tx, err := db.Beginx()
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	var rows []struct {
+		IndID     int64     `db:"ind_id"`
+		Subject   string    `db:"ind_subject"`
+		Data      string    `db:"ind_data"`
+		CreatedAt time.Time `db:"ind_created_at"`
+	}
+	if err := tx.Select(&rows, `SELECT ind_id, ind_subject, ind_data, ind_created_at FROM info_notification_digest
+		WHERE su_id = ? AND ind_email = ? AND ind_status = ? AND ind_due_at <= ?
+		ORDER BY ind_created_at, ind_id FOR UPDATE`, suID, email, digestPending, now); err != nil {
+		return 0, err
+	}
+	if len(rows) == 0 {
+		return 0, nil
+	}
+
+	r, _, err := loadMailRecipient(tx, email)
+	if err != nil {
+		return 0, err
+	}
+	data := mailData{RecipientName: r.FirstName.String, Days: len(rows)}
+	ids := make([]int64, 0, len(rows))
+	for _, row := range rows {
+		var ev mailData
+		if err := json.Unmarshal([]byte(row.Data), &ev); err != nil {
+			return 0, err
+		}
+		data.Sections = append(data.Sections, mailSection{
+			Title:   row.Subject,
+			At:      row.CreatedAt.Format("2006-01-02 15:04"),
+			Project: ev.Project,
+			Note:    ev.Note,
+			Items:   ev.Items,
+		})
+		ids = append(ids, row.IndID)
+	}
+
+	subject, body, err := renderMail(tx, mailDigest, r.lang(), data)
+	if err != nil {
+		return 0, err
+	}
+	if err := enqueueMail(tx, []string{email}, subject, body, mailContentHTML, now); err != nil {
+		return 0, err
+	}
+	q, args, err := sqlx.In(`UPDATE info_notification_digest SET ind_status = ?, ind_sent_at = ? WHERE ind_id IN (?)`, digestSent, now, ids)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := tx.Exec(tx.Rebind(q), args...); err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return len(rows), nil
+}
+
+// SysNotificationPref is the effective preference of a user for one event
+type SysNotificationPref struct {
+	Event string `json:"snp_event"`
+	notificationPref
+	Default bool `json:"default"`
+}
+
+// ListNotificationPref lists the preference of every event for a user (?su_id=)
+func ListNotificationPref(c *fiber.Ctx, db *sqlx.DB) error {
+	suID, err := strconv.ParseInt(c.Query("su_id"), 10, 64)
+	if err != nil || suID <= 0 {
+		return c.Status(400).JSON(fiber.Map{"error": "su_id is required"})
+	}
+	var rows []struct {
+		Event string `db:"snp_event"`
+		notificationPref
+	}
+	if err := db.Select(&rows, `SELECT snp_event, snp_mode, snp_scope FROM sys_notification_pref WHERE su_id = ?`, suID); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "query error", "detail": err.Error()})
+	}
+	stored := map[string]notificationPref{}
+	for _, r := range rows {
+		stored[r.Event] = r.notificationPref
+	}
+
+	events := notificationEvents()
+	res := make([]SysNotificationPref, 0, len(events))
+	for _, ev := range events {
+		p, ok := stored[ev]
+		if !ok {
+			p = defaultNotificationPref
+		}
+		res = append(res, SysNotificationPref{Event: ev, notificationPref: p, Default: !ok})
+	}
+	return c.Status(200).JSON(res)
+}
+
+// SaveNotificationPref stores the preferences of a user.
+// Body: { "su_id": 1, "prefs": [{ "snp_event": "waiting_approval", "snp_mode": "daily", "snp_scope": "mine" }], "updated_by": "" }
+func SaveNotificationPref(c *fiber.Ctx, db *sqlx.DB) error {
+	var body struct {
+		SuID  int64 `json:"su_id"`
+		Prefs []struct {
+			Event string `json:"snp_event"`
+			Mode  string `json:"snp_mode"`
+			Scope string `json:"snp_scope"`
+		} `json:"prefs"`
+		UpdatedBy string `json:"updated_by"`
+	}
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid request", "detail": err.Error()})
+	}
+	if body.SuID <= 0 {
+		return c.Status(400).JSON(fiber.Map{"error": "su_id is required"})
+	}
+	for i, p := range body.Prefs {
+		if !validMailKey(p.Event) || p.Event == mailDigest {
+			return c.Status(400).JSON(fiber.Map{"error": "unknown snp_event", "snp_event": p.Event})
+		}
+		if p.Scope == "" {
+			body.Prefs[i].Scope = notifyScopeAll
+		}
+		if !validNotificationMode(p.Event, p.Mode) {
+			return c.Status(400).JSON(fiber.Map{"error": "invalid snp_mode", "snp_event": p.Event})
+		}
+		if !validNotificationScope(body.Prefs[i].Scope) {
+			return c.Status(400).JSON(fiber.Map{"error": "snp_scope must be 'all', 'mine' or 'department'", "snp_event": p.Event})
+		}
+	}
+
+	tx, err := db.Beginx()
+	if err != nil {
+		return c.Status(500).JSON(5)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	now := time.Now()
+	for _, p := range body.Prefs {
+		if _, err := tx.Exec(`INSERT INTO sys_notification_pref (su_id, snp_event, snp_mode, snp_scope, snp_created_at, snp_created_by) VALUES (?, ?, ?, ?, ?, ?)
+			ON DUPLICATE KEY UPDATE snp_mode = VALUES(snp_mode), snp_scope = VALUES(snp_scope), snp_updated_at = ?, snp_updated_by = ?`,
+			body.SuID, p.Event, p.Mode, p.Scope, now, body.UpdatedBy, now, body.UpdatedBy); err != nil {
+			return c.Status(500).JSON(5)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return c.Status(500).JSON(5)
+	}
+	return c.Status(200).JSON(1)
+}
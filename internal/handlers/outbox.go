@@ -0,0 +1,292 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"apiTrackingSystem/internal/utils"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jmoiron/sqlx"
+)
+
+// outbox statuses (info_notification_outbox.ino_status)
+const (
+	outboxPending = "pending"
+	outboxSending = "sending"
+	outboxSent    = "sent"
+	outboxDead    = "dead"
+)
+
+const (
+	outboxChannelEmail   = "email"
+	outboxChannelWebhook = "webhook"
+	mailContentHTML      = "text/html; charset=utf-8"
+
+	// a row claimed by a dispatcher that never reported back is picked up again after the lease
+	outboxLease     = 5 * time.Minute
+	outboxBatchSize = 50
+	outboxMaxDelay  = 6 * time.Hour
+)
+
+// outboxMaxAttempts is NOTIFY_MAX_ATTEMPTS (default 6); the row is dead-lettered after that
+func outboxMaxAttempts() int {
+	if n, err := strconv.Atoi(strings.TrimSpace(os.Getenv("NOTIFY_MAX_ATTEMPTS"))); err == nil && n > 0 {
+		return n
+	}
+	return 6
+}
+
+// outboxBackoff is the delay before the next attempt: NOTIFY_RETRY_BASE (default 1m) doubled per failure, max 6h
+func outboxBackoff(attempts int) time.Duration {
+	base := time.Minute
+	if d, err := time.ParseDuration(strings.TrimSpace(os.Getenv("NOTIFY_RETRY_BASE"))); err == nil && d > 0 {
+		base = d
+	}
+	delay := base
+	for i := 1; i < attempts && delay < outboxMaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > outboxMaxDelay {
+		delay = outboxMaxDelay
+	}
+	return delay
+}
+
+// enqueueMail writes an email to the outbox. Pass the transaction of the business change
+// so the notification is stored (or rolled back) together with it.
+func enqueueMail(q sqlx.Execer, to []string, subject, body, contentType string, now time.Time) error {
+	list := make([]string, 0, len(to))
+	for _, t := range to {
+		if t = strings.TrimSpace(t); t != "" {
+			list = append(list, t)
+		}
+	}
+	if len(list) == 0 {
+		return nil
+	}
+	if contentType == "" {
+		contentType = mailContentHTML
+	}
+	_, err := q.Exec(`INSERT INTO info_notification_outbox (ino_channel, ino_to, ino_subject, ino_body, ino_content_type, ino_status, ino_attempts, ino_next_attempt_at, ino_created_at, ino_created_by) VALUES (?, ?, ?, ?, ?, ?, 0, ?, ?, ?)`,
+		outboxChannelEmail, strings.Join(list, ","), subject, body, contentType, outboxPending, now, now, "system")
+	return err
+}
+
+// outboxMessage is a claimed row sent by the dispatcher
+type outboxMessage struct {
+	InoID       int64  `db:"ino_id"`
+	Channel     string `db:"ino_channel"`
+	To          string `db:"ino_to"`
+	Subject     string `db:"ino_subject"`
+	Body        string `db:"ino_body"`
+	ContentType string `db:"ino_content_type"`
+	Attempts    int    `db:"ino_attempts"`
+}
+
+// dispatchResult is the summary of one dispatcher run
+type dispatchResult struct {
+	Claimed int      `json:"claimed"`
+	Sent    int      `json:"sent"`
+	Retry   int      `json:"retry"`
+	Dead    int      `json:"dead"`
+	Errors  []string `json:"errors"`
+}
+
+// StartNotificationDispatcher sends the outbox every NOTIFY_DISPATCH_INTERVAL (default 30s, "off" disables)
+func StartNotificationDispatcher(db *sqlx.DB) {
+	raw := strings.TrimSpace(os.Getenv("NOTIFY_DISPATCH_INTERVAL"))
+	if strings.EqualFold(raw, "off") || raw == "0" {
+		log.Printf("notification dispatcher disabled")
+		return
+	}
+	interval := 30 * time.Second
+	if raw != "" {
+		d, err := time.ParseDuration(raw)
+		if err != nil || d < time.Second {
+			log.Printf("notification dispatcher: invalid NOTIFY_DISPATCH_INTERVAL %q, using 30s", raw)
+		} else {
+			interval = d
+		}
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			res := runNotificationDispatch(db, time.Now())
+			if res.Claimed > 0 || len(res.Errors) > 0 {
+				log.Printf("notification dispatcher: claimed=%d sent=%d retry=%d dead=%d errors=%d", res.Claimed, res.Sent, res.Retry, res.Dead, len(res.Errors))
+			}
+			<-ticker.C
+		}
+	}()
+}
+
+// RunNotificationDispatch sends the due outbox rows once (manual trigger)
+func RunNotificationDispatch(c *fiber.Ctx, db *sqlx.DB) error {
+	return c.Status(200).JSON(runNotificationDispatch(db, time.Now()))
+}
+
+func runNotificationDispatch(db *sqlx.DB, now time.Time) dispatchResult {
+	res := dispatchResult{Errors: []string{}}
+
+	msgs, err := claimOutbox(db, now)
+	if err != nil {
+		res.Errors = append(res.Errors, "claim outbox: "+err.Error())
+		return res
+	}
+	res.Claimed = len(msgs)
+
+	maxAttempts := outboxMaxAttempts()
+	for _, m := range msgs {
+		ch, sendErr := outboxChannel(db, m)
+		if sendErr == nil {
+			sendErr = ch.Send(m)
+		}
+		done := time.Now()
+
+		// only the recipients that asked for a retry get the next attempt
+		to := m.To
+		var deferred *recipientsDeferredError
+		if errors.As(sendErr, &deferred) {
+			to = strings.Join(deferred.To, ",")
+		}
+
+		var err error
+		switch {
+		case sendErr == nil:
+			res.Sent++
+			_, err = db.Exec(`UPDATE info_notification_outbox SET ino_status = ?, ino_sent_at = ?, ino_last_error = NULL, ino_updated_at = ?, ino_updated_by = 'system' WHERE ino_id = ?`,
+				outboxSent, done, done, m.InoID)
+		case m.Attempts >= maxAttempts:
+			res.Dead++
+			log.Printf("notification %d dead after %d attempts: %v", m.InoID, m.Attempts, sendErr)
+			_, err = db.Exec(`UPDATE info_notification_outbox SET ino_status = ?, ino_to = ?, ino_last_error = ?, ino_updated_at = ?, ino_updated_by = 'system' WHERE ino_id = ?`,
+				outboxDead, to, sendErr.Error(), done, m.InoID)
+		default:
+			res.Retry++
+			_, err = db.Exec(`UPDATE info_notification_outbox SET ino_status = ?, ino_to = ?, ino_next_attempt_at = ?, ino_last_error = ?, ino_updated_at = ?, ino_updated_by = 'system' WHERE ino_id = ?`,
+				outboxPending, to, done.Add(outboxBackoff(m.Attempts)), sendErr.Error(), done, m.InoID)
+		}
+		if err != nil {
+			res.Errors = append(res.Errors, "update notification "+strconv.FormatInt(m.InoID, 10)+": "+err.Error())
+		}
+	}
+	return res
+}
+
+// claimOutbox locks the due rows, counts the attempt and leases them to this run
+func claimOutbox(db *sqlx.DB, now time.Time) ([]outboxMessage, error) {
+	tx, err := db.Beginx()
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	var msgs []outboxMessage
+	if err := tx.Select(&msgs, `SELECT ino_id, ino_channel, ino_to, ino_subject, ino_body, ino_content_type, ino_attempts
+		FROM info_notification_outbox
+		WHERE ino_status IN (?, ?) AND ino_next_attempt_at <= ?
+		ORDER BY ino_next_attempt_at, ino_id
+		LIMIT ? FOR UPDATE`, outboxPending, outboxSending, now, outboxBatchSize); err != nil {
+		return nil, err
+	}
+	if len(msgs) == 0 {
+		return nil, nil
+	}
+
+	ids := make([]int64, len(msgs))
+	for i := range msgs {
+		ids[i] = msgs[i].InoID
+		msgs[i].Attempts++
+	}
+	q, args, err := sqlx.In(`UPDATE info_notification_outbox SET ino_status = ?, ino_attempts = ino_attempts + 1, ino_next_attempt_at = ? WHERE ino_id IN (?)`,
+		outboxSending, now.Add(outboxLease), ids)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec(tx.Rebind(q), args...); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return msgs, nil
+}
+
+// InfoNotificationOutbox is one outbox row (body omitted)
+type InfoNotificationOutbox struct {
+	InoID         int64            `db:"ino_id" json:"ino_id"`
+	Channel       string           `db:"ino_channel" json:"ino_channel"`
+	To            string           `db:"ino_to" json:"ino_to"`
+	Subject       string           `db:"ino_subject" json:"ino_subject"`
+	Status        string           `db:"ino_status" json:"ino_status"`
+	Attempts      int              `db:"ino_attempts" json:"ino_attempts"`
+	NextAttemptAt time.Time        `db:"ino_next_attempt_at" json:"ino_next_attempt_at"`
+	LastError     utils.NullString `db:"ino_last_error" json:"ino_last_error"`
+	SentAt        *time.Time       `db:"ino_sent_at" json:"ino_sent_at"`
+	CreatedAt     time.Time        `db:"ino_created_at" json:"ino_created_at"`
+	UpdatedAt     *time.Time       `db:"ino_updated_at" json:"ino_updated_at"`
+	UpdatedBy     utils.NullString `db:"ino_updated_by" json:"ino_updated_by"`
+}
+
+// ListNotificationOutbox lists outbox rows, newest first (?status=pending|sending|sent|dead, ?limit=)
+func ListNotificationOutbox(c *fiber.Ctx, db *sqlx.DB) error {
+	limit := 100
+	if n, err := strconv.Atoi(c.Query("limit")); err == nil && n > 0 && n <= 500 {
+		limit = n
+	}
+	q := `SELECT ino_id, ino_channel, ino_to, ino_subject, ino_status, ino_attempts, ino_next_attempt_at, ino_last_error, ino_sent_at, ino_created_at, ino_updated_at, ino_updated_by
+		FROM info_notification_outbox`
+	args := []interface{}{}
+	if status := strings.TrimSpace(c.Query("status")); status != "" {
+		q += ` WHERE ino_status = ?`
+		args = append(args, status)
+	}
+	q += ` ORDER BY ino_id DESC LIMIT ?`
+	args = append(args, limit)
+
+	rows := []InfoNotificationOutbox{}
+	if err := db.Select(&rows, q, args...); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "query error", "detail": err.Error()})
+	}
+	return c.JSON(rows)
+}
+
+// ResendNotification puts a dead (or sent) notification back in the queue with fresh attempts
+func ResendNotification(c *fiber.Ctx, db *sqlx.DB) error {
+	var body struct {
+		InoID     int64  `json:"ino_id"`
+		UpdatedBy string `json:"updated_by"`
+	}
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid request", "detail": err.Error()})
+	}
+	if body.InoID <= 0 {
+		return c.Status(400).JSON(fiber.Map{"error": "ino_id is required"})
+	}
+
+	var status string
+	if err := db.Get(&status, `SELECT ino_status FROM info_notification_outbox WHERE ino_id = ?`, body.InoID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return c.Status(404).JSON(fiber.Map{"error": "notification not found"})
+		}
+		return c.Status(500).JSON(fiber.Map{"error": "query error", "detail": err.Error()})
+	}
+	if status == outboxSending {
+		return c.Status(409).JSON(fiber.Map{"error": "notification is being sent"})
+	}
+
+	now := time.Now()
+	if _, err := db.Exec(`UPDATE info_notification_outbox SET ino_status = ?, ino_attempts = 0, ino_next_attempt_at = ?, ino_sent_at = NULL, ino_updated_at = ?, ino_updated_by = ? WHERE ino_id = ? AND ino_status <> ?`,
+		outboxPending, now, now, body.UpdatedBy, body.InoID, outboxSending); err != nil {
+		return c.Status(500).JSON(5)
+	}
+	return c.Status(200).JSON(1)
+}
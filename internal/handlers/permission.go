@@ -138,6 +138,7 @@ func GetPermissionGroup(c *fiber.Ctx, db *sqlx.DB) error {
 		}
 		return c.Status(500).JSON(fiber.Map{"error": "query error", "detail": err.Error()})
 	}
+	setETag(c, db, permissionGroupVersion, id)
 	return c.Status(200).JSON(g)
 }
 
@@ -238,8 +239,11 @@ func UpdatePermissionGroup(c *fiber.Ctx, db *sqlx.DB) error {
 	}
 
 	now := time.Now()
-	_, err := db.Exec(`UPDATE sys_permission_group SET spg_name = ?, spg_updated_at = ?, spg_updated_by = ? WHERE spg_id = ?`, body.Name, now, body.UpdatedBy, body.ID)
+	_, err := execVersioned(c, db, permissionGroupVersion, body.ID, `UPDATE sys_permission_group SET spg_name = ?, spg_updated_at = ?, spg_updated_by = ? WHERE spg_id = ?`, body.Name, now, body.UpdatedBy, body.ID)
 	if err != nil {
+		if isVersionError(err) {
+			return versionError(c, err)
+		}
 		return c.Status(500).JSON(5)
 	}
 
@@ -265,8 +269,11 @@ func UpdatePermissionGroupStatus(c *fiber.Ctx, db *sqlx.DB) error {
 		return c.Status(400).JSON(fiber.Map{"error": "spg_updated_by is required"})
 	}
 	now := time.Now()
-	res, err := db.Exec(`UPDATE sys_permission_group SET spg_status = ?, spg_updated_at = ?, spg_updated_by = ? WHERE spg_id = ?`, body.Status, now, body.UpdatedBy, body.ID)
+	res, err := execVersioned(c, db, permissionGroupVersion, body.ID, `UPDATE sys_permission_group SET spg_status = ?, spg_updated_at = ?, spg_updated_by = ? WHERE spg_id = ?`, body.Status, now, body.UpdatedBy, body.ID)
 	if err != nil {
+		if isVersionError(err) {
+			return versionError(c, err)
+		}
 		return c.Status(500).JSON(fiber.Map{"error": "failed to update permission group", "detail": err.Error()})
 	}
 	ra, _ := res.RowsAffected()
@@ -154,6 +154,9 @@ func UpdateMasterPlan(c *fiber.Ctx, db *sqlx.DB) error {
 	}
 	defer func() { _ = tx.Rollback() }()
 
+	if err := checkVersion(c, tx, masterPlanVersion, body.ID); err != nil {
+		return versionError(c, err)
+	}
 	res, err := tx.Exec(`UPDATE mst_master_plan SET mmp_name = ?, mmp_type = ?, mmp_updated_at = ?, mmp_updated_by = ? WHERE mmp_id = ?`, body.Name, "text", now, body.UpdatedBy, body.ID)
 	if err != nil {
 		return c.Status(500).JSON(5)
@@ -235,8 +238,11 @@ func UpdateMasterPlanStatus(c *fiber.Ctx, db *sqlx.DB) error {
 		return c.Status(400).JSON(fiber.Map{"error": "mmp_status must be 'active' or 'inactive'"})
 	}
 	now := time.Now()
-	res, err := db.Exec(`UPDATE mst_master_plan SET mmp_status = ? , mmp_updated_by = ?, mmp_updated_at = ? WHERE mmp_id = ?`, body.Status, body.UpdatedBy, now, body.ID)
+	res, err := execVersioned(c, db, masterPlanVersion, body.ID, `UPDATE mst_master_plan SET mmp_status = ? , mmp_updated_by = ?, mmp_updated_at = ? WHERE mmp_id = ?`, body.Status, body.UpdatedBy, now, body.ID)
 	if err != nil {
+		if isVersionError(err) {
+			return versionError(c, err)
+		}
 		return c.Status(500).JSON(fiber.Map{"error": "failed to update status", "detail": err.Error()})
 	}
 	ra, _ := res.RowsAffected()
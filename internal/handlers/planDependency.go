@@ -0,0 +1,729 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"apiTrackingSystem/internal/utils"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jmoiron/sqlx"
+)
+
+// dependency types (mmpl_type / ipmpl_type); the lag is in working days of the project calendar
+const (
+	linkFinishStart  = "FS" // successor starts lag working days after the predecessor finishes
+	linkStartStart   = "SS" // successor starts lag working days after the predecessor starts
+	linkFinishFinish = "FF" // successor finishes lag working days after the predecessor finishes
+)
+
+// maxLinkLag keeps a typo from throwing a plan years out
+const maxLinkLag = 365
+
+// planPredecessor is one predecessor in SaveMasterPlanLink / SaveProjectPlanLink
+type planPredecessor struct {
+	ID   int64  `json:"id"`
+	Type string `json:"type"`
+	Lag  int    `json:"lag"`
+}
+
+// validatePredecessors fills the default type (FS) and checks type, lag and self links
+func validatePredecessors(self int64, preds []planPredecessor) string {
+	seen := map[int64]bool{}
+	for i := range preds {
+		p := &preds[i]
+		p.Type = strings.ToUpper(strings.TrimSpace(p.Type))
+		if p.Type == "" {
+			p.Type = linkFinishStart
+		}
+		switch {
+		case p.ID <= 0:
+			return "predecessor id is required"
+		case p.ID == self:
+			return "a milestone cannot depend on itself"
+		case seen[p.ID]:
+			return "duplicate predecessor " + strconv.FormatInt(p.ID, 10)
+		case p.Type != linkFinishStart && p.Type != linkStartStart && p.Type != linkFinishFinish:
+			return "type must be FS, SS or FF"
+		case p.Lag > maxLinkLag || p.Lag < -maxLinkLag:
+			return "lag must be within " + strconv.Itoa(maxLinkLag) + " working days"
+		}
+		seen[p.ID] = true
+	}
+	return ""
+}
+
+// planNode is one milestone of the dependency graph; Start / End are zero when the row has no dates
+type planNode struct {
+	ID     int64
+	Name   string
+	Status string
+	Start  time.Time
+	End    time.Time
+	Fixed  bool // done milestones keep their dates
+	Single bool // dated by ipmp_date only (not a date range)
+
+	lateStart  time.Time
+	lateFinish time.Time
+}
+
+func (n *planNode) dated() bool { return !n.Start.IsZero() }
+
+// duration in working days, at least one
+func (n *planNode) duration(cal *workCalendar) int {
+	if d := cal.WorkingDays(n.Start, n.End); d > 1 {
+		return d
+	}
+	return 1
+}
+
+// planEdge links a predecessor to a successor
+type planEdge struct {
+	Pred int64  `db:"pred_id"`
+	Succ int64  `db:"succ_id"`
+	Type string `db:"link_type"`
+	Lag  int    `db:"link_lag"`
+}
+
+// planGraph holds the milestones of one plan in dependency order
+type planGraph struct {
+	nodes map[int64]*planNode
+	order []int64
+	preds map[int64][]planEdge
+	succs map[int64][]planEdge
+}
+
+// planCycleError names the milestones in (or waiting behind) a dependency loop
+type planCycleError struct {
+	IDs   []int64
+	Names []string
+}
+
+func (e *planCycleError) Error() string {
+	return "dependency cycle between " + strings.Join(e.Names, ", ")
+}
+
+// newPlanGraph orders the nodes so every predecessor comes before its successors (nodes keep
+// their given order otherwise); links to unknown nodes are ignored. A cycle gives *planCycleError.
+func newPlanGraph(nodes []planNode, edges []planEdge) (*planGraph, error) {
+	g := &planGraph{nodes: map[int64]*planNode{}, preds: map[int64][]planEdge{}, succs: map[int64][]planEdge{}}
+	for i := range nodes {
+		g.nodes[nodes[i].ID] = &nodes[i]
+	}
+	indeg := map[int64]int{}
+	for _, e := range edges {
+		if g.nodes[e.Pred] == nil || g.nodes[e.Succ] == nil {
+			continue
+		}
+		g.preds[e.Succ] = append(g.preds[e.Succ], e)
+		g.succs[e.Pred] = append(g.succs[e.Pred], e)
+		indeg[e.Succ]++
+	}
+	var queue []int64
+	for _, n := range nodes {
+		if indeg[n.ID] == 0 {
+			queue = append(queue, n.ID)
+		}
+	}
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+		g.order = append(g.order, id)
+		for _, e := range g.succs[id] {
+			if indeg[e.Succ]--; indeg[e.Succ] == 0 {
+				queue = append(queue, e.Succ)
+			}
+		}
+	}
+	if len(g.order) < len(nodes) {
+		cycle := &planCycleError{}
+		for _, n := range nodes {
+			if indeg[n.ID] > 0 {
+				cycle.IDs = append(cycle.IDs, n.ID)
+				cycle.Names = append(cycle.Names, n.Name)
+			}
+		}
+		return nil, cycle
+	}
+	return g, nil
+}
+
+// earliestStart is the first start the predecessors allow (ok false without a dated predecessor)
+func (g *planGraph) earliestStart(cal *workCalendar, n *planNode, dur int) (time.Time, bool) {
+	var start time.Time
+	ok := false
+	for _, e := range g.preds[n.ID] {
+		p := g.nodes[e.Pred]
+		if !p.dated() {
+			continue
+		}
+		var s time.Time
+		switch e.Type {
+		case linkStartStart:
+			s = cal.AddWorkingDays(p.Start, e.Lag)
+		case linkFinishFinish:
+			s = cal.AddWorkingDays(cal.AddWorkingDays(p.End, e.Lag), -(dur - 1))
+		default:
+			s = cal.AddWorkingDays(p.End, 1+e.Lag)
+		}
+		if !ok || s.After(start) {
+			start, ok = s, true
+		}
+	}
+	return start, ok
+}
+
+// planChange is a milestone moved by forward scheduling
+type planChange struct {
+	IpmpID    int64  `json:"ipmp_id"`
+	Name      string `json:"ipmp_name"`
+	FromStart string `json:"from_start_date"`
+	FromEnd   string `json:"from_end_date"`
+	ToStart   string `json:"to_start_date"`
+	ToEnd     string `json:"to_end_date"`
+}
+
+// scheduleForward moves a dated milestone that starts before its predecessors allow to the earliest
+// allowed start, keeping its duration in working days. Milestones planned later than that keep their
+// dates (the slack is the planner's); milestones without predecessors and done ones do not move.
+func (g *planGraph) scheduleForward(cal *workCalendar) []planChange {
+	changes := []planChange{}
+	for _, id := range g.order {
+		n := g.nodes[id]
+		if n.Fixed || !n.dated() {
+			continue
+		}
+		dur := n.duration(cal)
+		start, ok := g.earliestStart(cal, n, dur)
+		if !ok {
+			continue
+		}
+		if !n.Start.Before(start) {
+			continue
+		}
+		end := cal.AddWorkingDays(start, dur-1)
+		changes = append(changes, planChange{
+			IpmpID: n.ID, Name: n.Name,
+			FromStart: n.Start.Format(dateKey), FromEnd: n.End.Format(dateKey),
+			ToStart: start.Format(dateKey), ToEnd: end.Format(dateKey),
+		})
+		n.Start, n.End = start, end
+	}
+	return changes
+}
+
+// scheduleBackward fills the late start / finish of the dated milestones against the plan finish
+// and returns that finish
+func (g *planGraph) scheduleBackward(cal *workCalendar) time.Time {
+	var finish time.Time
+	for _, n := range g.nodes {
+		if n.dated() && n.End.After(finish) {
+			finish = n.End
+		}
+	}
+	for i := len(g.order) - 1; i >= 0; i-- {
+		n := g.nodes[g.order[i]]
+		if !n.dated() {
+			continue
+		}
+		dur := n.duration(cal)
+		lf := finish
+		for _, e := range g.succs[n.ID] {
+			s := g.nodes[e.Succ]
+			if !s.dated() {
+				continue
+			}
+			var f time.Time
+			switch e.Type {
+			case linkStartStart:
+				f = cal.AddWorkingDays(cal.AddWorkingDays(s.lateStart, -e.Lag), dur-1)
+			case linkFinishFinish:
+				f = cal.AddWorkingDays(s.lateFinish, -e.Lag)
+			default:
+				f = cal.AddWorkingDays(s.lateStart, -(1 + e.Lag))
+			}
+			if f.Before(lf) {
+				lf = f
+			}
+		}
+		n.lateFinish = lf
+		n.lateStart = cal.AddWorkingDays(lf, -(dur - 1))
+	}
+	return finish
+}
+
+// float is the working days a scheduled milestone can slip before it delays the plan finish
+// (valid after scheduleBackward)
+func (g *planGraph) float(cal *workCalendar, n *planNode) int {
+	return cal.WorkingDaysBetween(n.End, n.lateFinish)
+}
+
+// loadPlanGraph loads the plan rows and links of a project; a row without a date range is a
+// one-day milestone on ipmp_date
+func loadPlanGraph(q sqlx.Queryer, ipID int64) (*planGraph, error) {
+	var rows []struct {
+		ID     int64            `db:"ipmp_id"`
+		Name   utils.NullString `db:"ipmp_name"`
+		Status utils.NullString `db:"ipmp_status"`
+		Date   *Date            `db:"ipmp_date"`
+		Start  *Date            `db:"ipmp_start_date"`
+		End    *Date            `db:"ipmp_end_date"`
+	}
+	if err := sqlx.Select(q, &rows, `SELECT ipmp_id, ipmp_name, ipmp_status, ipmp_date, ipmp_start_date, ipmp_end_date
+		FROM info_project_master_plan WHERE ip_id = ?
+		ORDER BY COALESCE(ipmp_start_date, ipmp_end_date, ipmp_date) IS NULL, COALESCE(ipmp_start_date, ipmp_end_date, ipmp_date), ipmp_id`, ipID); err != nil {
+		return nil, err
+	}
+	nodes := make([]planNode, 0, len(rows))
+	for _, r := range rows {
+		n := planNode{ID: r.ID, Name: r.Name.StringValue(), Status: r.Status.StringValue(), Fixed: r.Status.StringValue() == statusDone}
+		if r.Start != nil && !r.Start.IsZero() {
+			n.Start = dayOf(r.Start.Time)
+		}
+		if r.End != nil && !r.End.IsZero() {
+			n.End = dayOf(r.End.Time)
+		}
+		if n.Start.IsZero() && n.End.IsZero() && r.Date != nil && !r.Date.IsZero() {
+			n.Start, n.End, n.Single = dayOf(r.Date.Time), dayOf(r.Date.Time), true
+		}
+		// a single date is a one-day milestone
+		if n.Start.IsZero() {
+			n.Start = n.End
+		}
+		if n.End.IsZero() || n.End.Before(n.Start) {
+			n.End = n.Start
+		}
+		nodes = append(nodes, n)
+	}
+	var edges []planEdge
+	if err := sqlx.Select(q, &edges, `SELECT ipmpl_pred_ipmp_id AS pred_id, ipmp_id AS succ_id, ipmpl_type AS link_type, ipmpl_lag AS link_lag
+		FROM info_project_master_plan_link WHERE ip_id = ?`, ipID); err != nil {
+		return nil, err
+	}
+	return newPlanGraph(nodes, edges)
+}
+
+// reschedulePlan runs forward scheduling on a project plan and saves the moved milestones
+func reschedulePlan(q sqlx.Ext, ipID int64, by string, now time.Time) ([]planChange, error) {
+	cal, err := projectCalendar(q, ipID)
+	if err != nil {
+		return nil, err
+	}
+	g, err := loadPlanGraph(q, ipID)
+	if err != nil {
+		return nil, err
+	}
+	changes := g.scheduleForward(cal)
+	for _, ch := range changes {
+		n := g.nodes[ch.IpmpID]
+		if n.Single {
+			if _, err := q.Exec(`UPDATE info_project_master_plan SET ipmp_date = ?, ipmp_updated_at = ?, ipmp_updated_by = ? WHERE ipmp_id = ?`,
+				Date{Time: n.Start}, now, by, n.ID); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if _, err := q.Exec(`UPDATE info_project_master_plan SET ipmp_start_date = ?, ipmp_end_date = ?, ipmp_updated_at = ?, ipmp_updated_by = ? WHERE ipmp_id = ?`,
+			Date{Time: n.Start}, Date{Time: n.End}, now, by, n.ID); err != nil {
+			return nil, err
+		}
+	}
+	return changes, nil
+}
+
+// linkNewPlanRows drops the links of deleted plan rows and gives newly added rows the template links
+// (mst_master_plan_link, matched on the milestone name) to and from the other rows of the project
+func linkNewPlanRows(q sqlx.Ext, ipID int64, newIDs []int64, by string, now time.Time) error {
+	if _, err := q.Exec(`DELETE l FROM info_project_master_plan_link l
+		LEFT JOIN info_project_master_plan s ON s.ipmp_id = l.ipmp_id
+		LEFT JOIN info_project_master_plan p ON p.ipmp_id = l.ipmpl_pred_ipmp_id
+		WHERE l.ip_id = ? AND (s.ipmp_id IS NULL OR p.ipmp_id IS NULL)`, ipID); err != nil {
+		return err
+	}
+	if len(newIDs) == 0 {
+		return nil
+	}
+	query, args, err := sqlx.In(`INSERT IGNORE INTO info_project_master_plan_link (ip_id, ipmp_id, ipmpl_pred_ipmp_id, ipmpl_type, ipmpl_lag, ipmpl_created_at, ipmpl_created_by)
+		SELECT s.ip_id, s.ipmp_id, p.ipmp_id, l.mmpl_type, l.mmpl_lag, ?, ?
+		FROM mst_master_plan_link l
+		JOIN mst_master_plan ms ON ms.mmp_id = l.mmp_id AND ms.mmp_status = 'active'
+		JOIN mst_master_plan mp ON mp.mmp_id = l.mmpl_pred_mmp_id AND mp.mmp_status = 'active'
+		JOIN info_project_master_plan s ON s.ip_id = ? AND s.ipmp_name = ms.mmp_name
+		JOIN info_project_master_plan p ON p.ip_id = s.ip_id AND p.ipmp_name = mp.mmp_name
+		WHERE s.ipmp_id IN (?) OR p.ipmp_id IN (?)`, now, by, ipID, newIDs, newIDs)
+	if err != nil {
+		return err
+	}
+	_, err = q.Exec(query, args...)
+	return err
+}
+
+// planSaved runs after plan rows of a project are written: it links the new rows and, with
+// ?schedule=1, reschedules the plan (otherwise the saved dates are kept as sent)
+func planSaved(c *fiber.Ctx, q sqlx.Ext, ipID int64, newIDs []int64, by string, now time.Time) error {
+	if err := linkNewPlanRows(q, ipID, newIDs, by, now); err != nil {
+		return err
+	}
+	if !c.QueryBool("schedule") {
+		return nil
+	}
+	_, err := reschedulePlan(q, ipID, by, now)
+	return err
+}
+
+// MstMasterPlanLink is a template dependency between two master plan milestones
+type MstMasterPlanLink struct {
+	ID        int64            `db:"mmpl_id" json:"mmpl_id"`
+	MmpID     int64            `db:"mmp_id" json:"mmp_id"`
+	Name      string           `db:"mmp_name" json:"mmp_name"`
+	PredID    int64            `db:"mmpl_pred_mmp_id" json:"mmpl_pred_mmp_id"`
+	PredName  string           `db:"pred_name" json:"pred_name"`
+	Type      string           `db:"mmpl_type" json:"mmpl_type"`
+	Lag       int              `db:"mmpl_lag" json:"mmpl_lag"`
+	UpdatedAt *time.Time       `db:"mmpl_updated_at" json:"mmpl_updated_at"`
+	UpdatedBy utils.NullString `db:"mmpl_updated_by" json:"mmpl_updated_by"`
+}
+
+// ListMasterPlanLink lists the template dependencies (?mmp_id= for the predecessors of one milestone)
+func ListMasterPlanLink(c *fiber.Ctx, db *sqlx.DB) error {
+	query := `SELECT l.mmpl_id, l.mmp_id, ms.mmp_name, l.mmpl_pred_mmp_id, mp.mmp_name AS pred_name, l.mmpl_type, l.mmpl_lag, l.mmpl_updated_at, l.mmpl_updated_by
+		FROM mst_master_plan_link l
+		JOIN mst_master_plan ms ON ms.mmp_id = l.mmp_id
+		JOIN mst_master_plan mp ON mp.mmp_id = l.mmpl_pred_mmp_id
+		WHERE ms.mmp_status = 'active' AND mp.mmp_status = 'active'`
+	var args []interface{}
+	if id := strings.TrimSpace(c.Query("mmp_id")); id != "" {
+		query += ` AND l.mmp_id = ?`
+		args = append(args, id)
+	}
+	query += ` ORDER BY l.mmp_id, l.mmpl_pred_mmp_id`
+	res := []MstMasterPlanLink{}
+	if err := db.Select(&res, query, args...); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "query error", "detail": err.Error()})
+	}
+	return c.Status(200).JSON(res)
+}
+
+// SaveMasterPlanLink replaces the template predecessors of one milestone.
+// Body: { "mmp_id", "predecessors": [{ "id": mmp_id, "type": "FS|SS|FF", "lag": 0 }], "mmpl_updated_by" }
+func SaveMasterPlanLink(c *fiber.Ctx, db *sqlx.DB) error {
+	var body struct {
+		MmpID        int64             `json:"mmp_id"`
+		Predecessors []planPredecessor `json:"predecessors"`
+		UpdatedBy    string            `json:"mmpl_updated_by"`
+	}
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid request", "detail": err.Error()})
+	}
+	if body.MmpID <= 0 {
+		return c.Status(400).JSON(fiber.Map{"error": "mmp_id is required"})
+	}
+	if msg := validatePredecessors(body.MmpID, body.Predecessors); msg != "" {
+		return c.Status(400).JSON(fiber.Map{"error": msg})
+	}
+
+	var plans []struct {
+		ID   int64  `db:"mmp_id"`
+		Name string `db:"mmp_name"`
+	}
+	if err := db.Select(&plans, `SELECT mmp_id, mmp_name FROM mst_master_plan WHERE mmp_status = 'active' ORDER BY mmp_id`); err != nil {
+		return c.Status(500).JSON(5)
+	}
+	nodes := make([]planNode, 0, len(plans))
+	known := map[int64]bool{}
+	for _, p := range plans {
+		nodes = append(nodes, planNode{ID: p.ID, Name: p.Name})
+		known[p.ID] = true
+	}
+	if !known[body.MmpID] {
+		return c.Status(404).JSON(fiber.Map{"error": "master plan not found"})
+	}
+	var edges []planEdge
+	if err := db.Select(&edges, `SELECT mmpl_pred_mmp_id AS pred_id, mmp_id AS succ_id, mmpl_type AS link_type, mmpl_lag AS link_lag
+		FROM mst_master_plan_link WHERE mmp_id <> ?`, body.MmpID); err != nil {
+		return c.Status(500).JSON(5)
+	}
+	for _, p := range body.Predecessors {
+		if !known[p.ID] {
+			return c.Status(400).JSON(fiber.Map{"error": "unknown predecessor " + strconv.FormatInt(p.ID, 10)})
+		}
+		edges = append(edges, planEdge{Pred: p.ID, Succ: body.MmpID, Type: p.Type, Lag: p.Lag})
+	}
+	if _, err := newPlanGraph(nodes, edges); err != nil {
+		var cycle *planCycleError
+		if errors.As(err, &cycle) {
+			return c.Status(400).JSON(fiber.Map{"error": "dependency cycle", "mmp_ids": cycle.IDs, "mmp_names": cycle.Names})
+		}
+		return c.Status(500).JSON(5)
+	}
+
+	tx, err := db.Beginx()
+	if err != nil {
+		return c.Status(500).JSON(5)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	now := time.Now()
+	if _, err := tx.Exec(`DELETE FROM mst_master_plan_link WHERE mmp_id = ?`, body.MmpID); err != nil {
+		return c.Status(500).JSON(5)
+	}
+	for _, p := range body.Predecessors {
+		if _, err := tx.Exec(`INSERT INTO mst_master_plan_link (mmp_id, mmpl_pred_mmp_id, mmpl_type, mmpl_lag, mmpl_created_at, mmpl_created_by, mmpl_updated_at, mmpl_updated_by) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+			body.MmpID, p.ID, p.Type, p.Lag, now, body.UpdatedBy, now, body.UpdatedBy); err != nil {
+			return c.Status(500).JSON(5)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return c.Status(500).JSON(5)
+	}
+	return c.Status(200).JSON(1)
+}
+
+// InfoProjectPlanLink is a dependency between two plan rows of a project
+type InfoProjectPlanLink struct {
+	ID        int64            `db:"ipmpl_id" json:"ipmpl_id"`
+	IpID      int64            `db:"ip_id" json:"ip_id"`
+	IpmpID    int64            `db:"ipmp_id" json:"ipmp_id"`
+	Name      utils.NullString `db:"ipmp_name" json:"ipmp_name"`
+	PredID    int64            `db:"ipmpl_pred_ipmp_id" json:"ipmpl_pred_ipmp_id"`
+	PredName  utils.NullString `db:"pred_name" json:"pred_name"`
+	Type      string           `db:"ipmpl_type" json:"ipmpl_type"`
+	Lag       int              `db:"ipmpl_lag" json:"ipmpl_lag"`
+	CreatedAt *time.Time       `db:"ipmpl_created_at" json:"ipmpl_created_at"`
+	CreatedBy utils.NullString `db:"ipmpl_created_by" json:"ipmpl_created_by"`
+}
+
+// ListProjectPlanLink lists the dependencies of a project plan (?ip_id=)
+func ListProjectPlanLink(c *fiber.Ctx, db *sqlx.DB) error {
+	ipID, err := strconv.ParseInt(c.Query("ip_id"), 10, 64)
+	if err != nil || ipID <= 0 {
+		return c.Status(400).JSON(fiber.Map{"error": "ip_id is required"})
+	}
+	res := []InfoProjectPlanLink{}
+	if err := db.Select(&res, `SELECT l.ipmpl_id, l.ip_id, l.ipmp_id, s.ipmp_name, l.ipmpl_pred_ipmp_id, p.ipmp_name AS pred_name, l.ipmpl_type, l.ipmpl_lag, l.ipmpl_created_at, l.ipmpl_created_by
+		FROM info_project_master_plan_link l
+		JOIN info_project_master_plan s ON s.ipmp_id = l.ipmp_id
+		JOIN info_project_master_plan p ON p.ipmp_id = l.ipmpl_pred_ipmp_id
+		WHERE l.ip_id = ?
+		ORDER BY l.ipmp_id, l.ipmpl_pred_ipmp_id`, ipID); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "query error", "detail": err.Error()})
+	}
+	return c.Status(200).JSON(res)
+}
+
+// planCycleResponse answers 400 for a dependency cycle in a project plan
+func planCycleResponse(c *fiber.Ctx, ipID int64, err error) (bool, error) {
+	var cycle *planCycleError
+	if !errors.As(err, &cycle) {
+		return false, nil
+	}
+	return true, c.Status(400).JSON(fiber.Map{"error": "dependency cycle", "ip_id": ipID, "ipmp_ids": cycle.IDs, "ipmp_names": cycle.Names})
+}
+
+// SaveProjectPlanLink replaces the predecessors of one plan row and reschedules the project plan.
+// Body: { "ip_id", "ipmp_id", "predecessors": [{ "id": ipmp_id, "type": "FS|SS|FF", "lag": 0 }], "updated_by" }
+func SaveProjectPlanLink(c *fiber.Ctx, db *sqlx.DB) error {
+	var body struct {
+		IpID         int64             `json:"ip_id"`
+		IpmpID       int64             `json:"ipmp_id"`
+		Predecessors []planPredecessor `json:"predecessors"`
+		UpdatedBy    string            `json:"updated_by"`
+	}
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid request", "detail": err.Error()})
+	}
+	if body.IpID <= 0 || body.IpmpID <= 0 {
+		return c.Status(400).JSON(fiber.Map{"error": "ip_id and ipmp_id are required"})
+	}
+	if msg := validatePredecessors(body.IpmpID, body.Predecessors); msg != "" {
+		return c.Status(400).JSON(fiber.Map{"error": msg})
+	}
+
+	tx, err := db.Beginx()
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "begin tx failed", "detail": err.Error()})
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	// the dates of the whole plan may move
+	if err := checkVersion(c, tx, projectPlanSetVersion, body.IpID); err != nil {
+		return versionError(c, err)
+	}
+	var ids []int64
+	if err := tx.Select(&ids, `SELECT ipmp_id FROM info_project_master_plan WHERE ip_id = ?`, body.IpID); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "query error", "detail": err.Error()})
+	}
+	inPlan := map[int64]bool{}
+	for _, id := range ids {
+		inPlan[id] = true
+	}
+	if !inPlan[body.IpmpID] {
+		return c.Status(404).JSON(fiber.Map{"error": "plan row not found in project"})
+	}
+	for _, p := range body.Predecessors {
+		if !inPlan[p.ID] {
+			return c.Status(400).JSON(fiber.Map{"error": "predecessor " + strconv.FormatInt(p.ID, 10) + " is not in the project plan"})
+		}
+	}
+
+	now := time.Now()
+	if _, err := tx.Exec(`DELETE FROM info_project_master_plan_link WHERE ipmp_id = ?`, body.IpmpID); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "delete failed", "detail": err.Error()})
+	}
+	for _, p := range body.Predecessors {
+		if _, err := tx.Exec(`INSERT INTO info_project_master_plan_link (ip_id, ipmp_id, ipmpl_pred_ipmp_id, ipmpl_type, ipmpl_lag, ipmpl_created_at, ipmpl_created_by) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+			body.IpID, body.IpmpID, p.ID, p.Type, p.Lag, now, body.UpdatedBy); err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "insert failed", "detail": err.Error()})
+		}
+	}
+	changes, err := reschedulePlan(tx, body.IpID, body.UpdatedBy, now)
+	if err != nil {
+		if ok, resp := planCycleResponse(c, body.IpID, err); ok {
+			return resp
+		}
+		return c.Status(500).JSON(fiber.Map{"error": "schedule failed", "detail": err.Error()})
+	}
+	if err := tx.Commit(); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "commit failed", "detail": err.Error()})
+	}
+	return c.Status(200).JSON(fiber.Map{"ip_id": body.IpID, "changes": changes})
+}
+
+// ScheduleProjectPlan re-runs forward scheduling on a project plan (?dry_run=1 only reports the moves).
+// Body: { "ip_id", "updated_by" }
+func ScheduleProjectPlan(c *fiber.Ctx, db *sqlx.DB) error {
+	var body struct {
+		IpID      int64  `json:"ip_id"`
+		UpdatedBy string `json:"updated_by"`
+	}
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid request", "detail": err.Error()})
+	}
+	if body.IpID <= 0 {
+		return c.Status(400).JSON(fiber.Map{"error": "ip_id is required"})
+	}
+	dryRun := c.Query("dry_run") == "1" || c.Query("dry_run") == "true"
+
+	tx, err := db.Beginx()
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "begin tx failed", "detail": err.Error()})
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if !dryRun {
+		if err := checkVersion(c, tx, projectPlanSetVersion, body.IpID); err != nil {
+			return versionError(c, err)
+		}
+	}
+	changes, err := reschedulePlan(tx, body.IpID, body.UpdatedBy, time.Now())
+	if err != nil {
+		if ok, resp := planCycleResponse(c, body.IpID, err); ok {
+			return resp
+		}
+		return c.Status(500).JSON(fiber.Map{"error": "schedule failed", "detail": err.Error()})
+	}
+	if !dryRun {
+		if err := tx.Commit(); err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "commit failed", "detail": err.Error()})
+		}
+	}
+	return c.Status(200).JSON(fiber.Map{"ip_id": body.IpID, "dry_run": dryRun, "changes": changes})
+}
+
+// criticalPathNode is one milestone with its slack; float is in working days
+type criticalPathNode struct {
+	IpmpID       int64   `json:"ipmp_id"`
+	Name         string  `json:"ipmp_name"`
+	Status       string  `json:"ipmp_status"`
+	StartDate    string  `json:"start_date"`
+	EndDate      string  `json:"end_date"`
+	LateStart    string  `json:"late_start_date"`
+	LateFinish   string  `json:"late_end_date"`
+	Duration     int     `json:"duration"`
+	Float        int     `json:"float"`
+	Critical     bool    `json:"critical"`
+	Predecessors []int64 `json:"predecessors"`
+}
+
+// GetCriticalPath returns the critical path of a project plan (?ip_id=).
+// Rows that start before their predecessors allow are first moved in memory (pending_changes lists
+// them, ScheduleProjectPlan saves them); float is then measured on the planned dates, so only the
+// chain without slack up to the plan finish is critical.
+func GetCriticalPath(c *fiber.Ctx, db *sqlx.DB) error {
+	ipID, err := strconv.ParseInt(c.Query("ip_id"), 10, 64)
+	if err != nil || ipID <= 0 {
+		return c.Status(400).JSON(fiber.Map{"error": "ip_id is required"})
+	}
+	var exists int
+	if err := db.Get(&exists, `SELECT 1 FROM info_project WHERE ip_id = ?`, ipID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return c.Status(404).JSON(fiber.Map{"error": "project not found"})
+		}
+		return c.Status(500).JSON(fiber.Map{"error": "query error", "detail": err.Error()})
+	}
+	cal, err := projectCalendar(db, ipID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "query calendar failed", "detail": err.Error()})
+	}
+	g, err := loadPlanGraph(db, ipID)
+	if err != nil {
+		if ok, resp := planCycleResponse(c, ipID, err); ok {
+			return resp
+		}
+		return c.Status(500).JSON(fiber.Map{"error": "query error", "detail": err.Error()})
+	}
+	pending := g.scheduleForward(cal)
+	finish := g.scheduleBackward(cal)
+
+	nodes := []criticalPathNode{}
+	path := []criticalPathNode{}
+	unscheduled := []fiber.Map{}
+	var start time.Time
+	for _, id := range g.order {
+		n := g.nodes[id]
+		if !n.dated() {
+			unscheduled = append(unscheduled, fiber.Map{"ipmp_id": n.ID, "ipmp_name": n.Name})
+			continue
+		}
+		if start.IsZero() || n.Start.Before(start) {
+			start = n.Start
+		}
+		float := g.float(cal, n)
+		cn := criticalPathNode{
+			IpmpID: n.ID, Name: n.Name, Status: n.Status,
+			StartDate: n.Start.Format(dateKey), EndDate: n.End.Format(dateKey),
+			LateStart: n.lateStart.Format(dateKey), LateFinish: n.lateFinish.Format(dateKey),
+			Duration: n.duration(cal), Float: float, Critical: float <= 0,
+			Predecessors: []int64{},
+		}
+		for _, e := range g.preds[n.ID] {
+			cn.Predecessors = append(cn.Predecessors, e.Pred)
+		}
+		nodes = append(nodes, cn)
+		if cn.Critical {
+			path = append(path, cn)
+		}
+	}
+	sort.SliceStable(path, func(i, j int) bool { return path[i].StartDate < path[j].StartDate })
+
+	out := fiber.Map{
+		"ip_id":           ipID,
+		"critical_path":   path,
+		"nodes":           nodes,
+		"unscheduled":     unscheduled,
+		"pending_changes": pending,
+		"start_date":      nil,
+		"end_date":        nil,
+		"duration":        0,
+	}
+	if !start.IsZero() {
+		out["start_date"] = start.Format(dateKey)
+		out["end_date"] = finish.Format(dateKey)
+		out["duration"] = cal.WorkingDays(start, finish)
+	}
+	return c.Status(200).JSON(out)
+}
@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"testing"
+	"time"
+)
+
+func testCalendar() *workCalendar {
+	cal := &workCalendar{}
+	cal.weekend[time.Sunday], cal.weekend[time.Saturday] = true, true
+	return cal
+}
+
+func day(s string) time.Time {
+	t, err := time.Parse(dateKey, s)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func TestScheduleForwardKeepsSlack(t *testing.T) {
+	cal := testCalendar()
+	// 1 OTS (Mon-Fri) -> 2 PPAP planned a month later, 1 -> 3 overlapping OTS (violated)
+	g, err := newPlanGraph([]planNode{
+		{ID: 1, Name: "OTS", Start: day("2026-03-02"), End: day("2026-03-06")},
+		{ID: 2, Name: "PPAP", Start: day("2026-04-06"), End: day("2026-04-10")},
+		{ID: 3, Name: "Trial", Start: day("2026-03-04"), End: day("2026-03-05")},
+	}, []planEdge{
+		{Pred: 1, Succ: 2, Type: linkFinishStart},
+		{Pred: 1, Succ: 3, Type: linkFinishStart},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	changes := g.scheduleForward(cal)
+	if len(changes) != 1 || changes[0].IpmpID != 3 {
+		t.Fatalf("changes = %+v, want only milestone 3 moved", changes)
+	}
+	if got := changes[0]; got.ToStart != "2026-03-09" || got.ToEnd != "2026-03-10" {
+		t.Errorf("milestone 3 moved to %s..%s, want 2026-03-09..2026-03-10", got.ToStart, got.ToEnd)
+	}
+	if n := g.nodes[2]; !n.Start.Equal(day("2026-04-06")) || !n.End.Equal(day("2026-04-10")) {
+		t.Errorf("milestone 2 moved to %s..%s, want its planned dates", n.Start.Format(dateKey), n.End.Format(dateKey))
+	}
+}
+
+func TestCriticalPathFloat(t *testing.T) {
+	cal := testCalendar()
+	g, err := newPlanGraph([]planNode{
+		{ID: 1, Name: "OTS", Start: day("2026-03-02"), End: day("2026-03-06")},
+		{ID: 2, Name: "PPAP", Start: day("2026-04-06"), End: day("2026-04-10")},
+		{ID: 3, Name: "Trial", Start: day("2026-03-09"), End: day("2026-03-10")},
+		{ID: 4, Name: "SOP", Start: day("2026-04-13"), End: day("2026-04-13")},
+	}, []planEdge{
+		{Pred: 1, Succ: 2, Type: linkFinishStart},
+		{Pred: 1, Succ: 3, Type: linkFinishStart},
+		{Pred: 2, Succ: 4, Type: linkFinishStart},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changes := g.scheduleForward(cal); len(changes) != 0 {
+		t.Fatalf("changes = %+v, want none", changes)
+	}
+	if finish := g.scheduleBackward(cal); !finish.Equal(day("2026-04-13")) {
+		t.Fatalf("finish = %s", finish.Format(dateKey))
+	}
+	want := map[int64]int{
+		1: 20, // OTS may finish 20 working days later before PPAP has to move
+		2: 0,
+		3: 24,
+		4: 0,
+	}
+	for id, f := range want {
+		if got := g.float(cal, g.nodes[id]); got != f {
+			t.Errorf("float(%d) = %d, want %d", id, got, f)
+		}
+	}
+}
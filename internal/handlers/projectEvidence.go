@@ -0,0 +1,391 @@
+package handlers
+
+import (
+	"archive/zip"
+	"bufio"
+	"database/sql"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"apiTrackingSystem/internal/utils"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jmoiron/sqlx"
+	"github.com/xuri/excelize/v2"
+)
+
+// evidenceItem is one approved tracking file packed into the evidence ZIP
+type evidenceItem struct {
+	IpidID       int64            `db:"ipid_id"`
+	PhaseOrder   utils.NullInt64  `db:"phase_order"`
+	PhaseName    utils.NullString `db:"phase_name"`
+	ItemName     utils.NullString `db:"item_name"`
+	ItemType     utils.NullString `db:"item_type"`
+	Department   utils.NullString `db:"department"`
+	OwnerName    utils.NullString `db:"owner_name"`
+	ApproverName utils.NullString `db:"approver_name"`
+	ApprovedAt   *DateTime        `db:"approved_at"`
+	FileName     utils.NullString `db:"itf_file_name"`
+	FilePath     utils.NullString `db:"itf_file_path"`
+	SignerName   utils.NullString `db:"signer_name"`
+	SignedAt     *DateTime        `db:"ias_signed_at"`
+	FileSHA256   utils.NullString `db:"ias_file_sha256"`
+	Signature    utils.NullString `db:"ias_hmac"`
+	Entry        string           `db:"-"` // path inside the ZIP
+	Missing      bool             `db:"-"` // file not found on the server, left out of the ZIP
+}
+
+// uploadBaseDir returns the server folder that holds the "uploads" tree
+func uploadBaseDir() string {
+	uploadBase := os.Getenv("UPLOAD_BASE")
+	if strings.TrimSpace(uploadBase) == "" {
+		uploadBase = `C:\inetpub\wwwroot\apiTrackingSystemUat\uploads`
+	}
+	return uploadBase
+}
+
+// uploadDiskPath maps a DB path (uploads/<ip_code>/<type>/<file>) to the file on disk
+func uploadDiskPath(dbPath string) string {
+	rel := strings.TrimPrefix(filepath.ToSlash(strings.TrimSpace(dbPath)), "/")
+	rel = strings.TrimPrefix(rel, "uploads/")
+	return filepath.Join(uploadBaseDir(), filepath.FromSlash(rel))
+}
+
+var reZipName = regexp.MustCompile(`[\\/:*?"<>|]+`)
+
+// zipSafeName cleans a phase/item name so it can be used as a folder inside the ZIP
+func zipSafeName(s, fallback string) string {
+	s = strings.TrimSpace(reZipName.ReplaceAllString(s, "_"))
+	s = strings.Trim(s, ".")
+	if s == "" {
+		return fallback
+	}
+	return s
+}
+
+// markMissingEvidence flags the items whose file is not on the server and returns how many there are
+func markMissingEvidence(items []evidenceItem) int {
+	n := 0
+	for i := range items {
+		if _, err := os.Stat(uploadDiskPath(items[i].FilePath.StringValue())); err != nil {
+			items[i].Missing = true
+			n++
+		}
+	}
+	return n
+}
+
+// assignEvidenceEntries names the ZIP entry of each item <phase>/<item name>/<file>. Items sharing a
+// folder (same name in a phase) get their ipid_id appended to it, so no entry overwrites another;
+// reserved holds entries already taken (POS file). Missing items get no entry.
+func assignEvidenceEntries(items []evidenceItem, reserved ...string) {
+	folder := func(it evidenceItem) string {
+		phase := zipSafeName(it.PhaseName.StringValue(), "Unassigned")
+		if it.PhaseOrder.Valid {
+			phase = fmt.Sprintf("%02d_%s", it.PhaseOrder.Int64, phase)
+		}
+		return path.Join(phase, zipSafeName(it.ItemName.StringValue(), fmt.Sprintf("item_%d", it.IpidID)))
+	}
+	shared := map[string]int{}
+	for _, it := range items {
+		if !it.Missing {
+			shared[strings.ToLower(folder(it))]++
+		}
+	}
+	used := map[string]bool{}
+	for _, r := range reserved {
+		used[strings.ToLower(r)] = true
+	}
+	for i := range items {
+		if items[i].Missing {
+			continue
+		}
+		dir := folder(items[i])
+		if shared[strings.ToLower(dir)] > 1 {
+			dir = fmt.Sprintf("%s_%d", dir, items[i].IpidID)
+		}
+		file := zipSafeName(items[i].FileName.StringValue(), path.Base(filepath.ToSlash(items[i].FilePath.StringValue())))
+		entry := path.Join(dir, file)
+		ext := path.Ext(file)
+		for n := 2; used[strings.ToLower(entry)]; n++ {
+			entry = path.Join(dir, fmt.Sprintf("%s_%d%s", strings.TrimSuffix(file, ext), n, ext))
+		}
+		used[strings.ToLower(entry)] = true
+		items[i].Entry = entry
+	}
+}
+
+// ExportProjectEvidence streams a ZIP with every approved tracking file and the POS file of a project,
+// grouped as <phase>/<item name>/<file>, plus an index workbook listing owner and approver of each item
+func ExportProjectEvidence(c *fiber.Ctx, db *sqlx.DB) error {
+	ipIDStr := strings.TrimSpace(c.Query("ip_id"))
+	if ipIDStr == "" {
+		return c.Status(400).JSON(fiber.Map{"error": "ip_id required"})
+	}
+	ipID, err := strconv.ParseInt(ipIDStr, 10, 64)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid ip_id", "detail": err.Error()})
+	}
+
+	var project struct {
+		IpCode   utils.NullString `db:"ip_code"`
+		IpModel  utils.NullString `db:"ip_model"`
+		PartNo   utils.NullString `db:"ip_part_no"`
+		PartName utils.NullString `db:"ip_part_name"`
+	}
+	if err := db.Get(&project, `SELECT ip_code, ip_model, ip_part_no, ip_part_name FROM info_project WHERE ip_id = ? LIMIT 1`, ipID); err != nil {
+		if err == sql.ErrNoRows {
+			return c.Status(404).JSON(fiber.Map{"error": "project not found"})
+		}
+		return c.Status(500).JSON(fiber.Map{"error": "query error", "detail": err.Error()})
+	}
+
+	query := `SELECT
+					x.ipid_id,
+					x.phase_order,
+					x.phase_name,
+					x.item_name,
+					x.item_type,
+					sd.sd_dept_aname AS department,
+					CONCAT_WS(' ', su.su_firstname, su.su_lastname) AS owner_name,
+					CONCAT_WS(' ', asu.su_firstname, asu.su_lastname) AS approver_name,
+					ia.ia_updated_at AS approved_at,
+					tf.itf_file_name,
+					tf.itf_file_path,
+					CONCAT_WS(' ', ssu.su_firstname, ssu.su_lastname) AS signer_name,
+					ias.ias_signed_at,
+					ias.ias_file_sha256,
+					ias.ias_hmac
+				FROM
+				(
+					SELECT
+						pid.ipid_id,
+						pid.sd_id,
+						pid.su_id,
+						mpp.mpp_order AS phase_order,
+						mpp.mpp_name AS phase_name,
+						ai.iai_name AS item_name,
+						pid.ipid_type AS item_type
+					FROM info_project_item_detail pid
+					JOIN info_apqp_item ai ON ai.iai_id = pid.ref_id AND pid.ipid_type = 'apqp'
+					LEFT JOIN mst_project_phase mpp ON mpp.mpp_id = ai.mpp_id
+					WHERE ai.ip_id = ? AND pid.ipid_status = 'done'
+
+					UNION ALL
+
+					SELECT
+						pid.ipid_id,
+						pid.sd_id,
+						pid.su_id,
+						6 AS phase_order,
+						'Customer PPAP Status' AS phase_name,
+						pi.ipi_name AS item_name,
+						pid.ipid_type AS item_type
+					FROM info_project_item_detail pid
+					JOIN info_ppap_item pi ON pi.ipi_id = pid.ref_id AND pid.ipid_type = 'ppap'
+					WHERE pi.ip_id = ? AND pid.ipid_status = 'done'
+				) x
+				JOIN info_tracking_file tf
+					ON tf.itf_id = (SELECT MAX(tf_sub.itf_id) FROM info_tracking_file tf_sub WHERE tf_sub.ipid_id = x.ipid_id)
+				LEFT JOIN info_approval ia
+					ON ia.ia_id = (
+						SELECT ia_sub.ia_id FROM info_approval ia_sub
+						WHERE ia_sub.ipid_id = x.ipid_id AND ia_sub.ia_status = 'approve' AND ia_sub.ia_status_flg = 'active'
+						ORDER BY ia_sub.ia_updated_at DESC, ia_sub.ia_id DESC
+						LIMIT 1
+					)
+				LEFT JOIN sys_user asu ON asu.su_id = ia.su_id
+				LEFT JOIN info_approval_signature ias
+					ON ias.ias_id = (SELECT MAX(ias_sub.ias_id) FROM info_approval_signature ias_sub WHERE ias_sub.ia_id = ia.ia_id)
+				LEFT JOIN sys_user ssu ON ssu.su_id = ias.su_id
+				LEFT JOIN sys_user su ON su.su_id = x.su_id
+				LEFT JOIN sys_department sd ON sd.sd_id = x.sd_id
+				ORDER BY x.phase_order ASC, x.item_name ASC, x.ipid_id ASC`
+
+	var items []evidenceItem
+	if err := db.Select(&items, query, ipID, ipID); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "query error", "detail": err.Error()})
+	}
+
+	var pos struct {
+		FileName utils.NullString `db:"ipf_file_name"`
+		FilePath utils.NullString `db:"ipf_file_path"`
+	}
+	if err := db.Get(&pos, `SELECT ipf_file_name, ipf_file_path FROM info_pos_file WHERE ip_id = ? AND ipf_status = 'active' ORDER BY ipf_id DESC LIMIT 1`, ipID); err != nil && err != sql.ErrNoRows {
+		return c.Status(500).JSON(fiber.Map{"error": "query pos file failed", "detail": err.Error()})
+	}
+
+	if len(items) == 0 && !pos.FilePath.Valid {
+		return c.Status(404).JSON(fiber.Map{"error": "no approved evidence found for project"})
+	}
+
+	// files missing on the server are marked in the index instead of being listed with a ZIP entry
+	if pos.FilePath.Valid {
+		if _, err := os.Stat(uploadDiskPath(pos.FilePath.String)); err != nil {
+			log.Printf("ExportProjectEvidence - pos file: %v", err)
+			pos.FilePath.Valid = false
+		}
+	}
+	if n := markMissingEvidence(items); n > 0 {
+		c.Set("X-Evidence-Missing", strconv.Itoa(n))
+	}
+	posEntry := ""
+	if pos.FilePath.Valid {
+		posEntry = "POS/" + path.Base(filepath.ToSlash(pos.FilePath.String))
+	}
+	assignEvidenceEntries(items, "index.xlsx", posEntry)
+
+	index, err := buildEvidenceIndex(project.IpCode.StringValue(), items)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to build index workbook", "detail": err.Error()})
+	}
+
+	code := zipSafeName(project.IpCode.StringValue(), fmt.Sprintf("ip_%d", ipID))
+	c.Set(fiber.HeaderContentType, "application/zip")
+	c.Set(fiber.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="%s_evidence.zip"`, code))
+
+	// stream the archive so large projects are never held in memory
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		zw := zip.NewWriter(w)
+		defer func() {
+			if err := zw.Close(); err != nil {
+				log.Printf("ExportProjectEvidence - close zip: %v", err)
+			}
+			_ = w.Flush()
+		}()
+
+		if ew, err := zw.Create("index.xlsx"); err == nil {
+			if err := index.Write(ew); err != nil {
+				log.Printf("ExportProjectEvidence - write index: %v", err)
+			}
+		}
+		_ = index.Close()
+
+		if pos.FilePath.Valid {
+			if err := addFileToZip(zw, posEntry, uploadDiskPath(pos.FilePath.String)); err != nil {
+				log.Printf("ExportProjectEvidence - pos file: %v", err)
+			}
+		}
+
+		for _, it := range items {
+			if it.Missing {
+				continue
+			}
+			if err := addFileToZip(zw, it.Entry, uploadDiskPath(it.FilePath.StringValue())); err != nil {
+				log.Printf("ExportProjectEvidence - ipid_id=%d: %v", it.IpidID, err)
+			}
+			_ = w.Flush()
+		}
+	})
+	return nil
+}
+
+// addFileToZip copies a file from disk into the archive without buffering it
+func addFileToZip(zw *zip.Writer, entry, diskPath string) error {
+	f, err := os.Open(diskPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	hdr, err := zip.FileInfoHeader(info)
+	if err != nil {
+		return err
+	}
+	hdr.Name = entry
+	hdr.Method = zip.Deflate
+
+	dst, err := zw.CreateHeader(hdr)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(dst, f)
+	return err
+}
+
+// buildEvidenceIndex creates the index workbook listing each packed item
+func buildEvidenceIndex(projectCode string, items []evidenceItem) (*excelize.File, error) {
+	f := excelize.NewFile()
+	sheet := "Index"
+	if err := f.SetSheetName("Sheet1", sheet); err != nil {
+		return nil, err
+	}
+
+	baseStyle, titleStyle, headerStyle, _, _, _, _, _, err := buildStyles(f)
+	if err != nil {
+		return nil, err
+	}
+
+	_ = f.MergeCell(sheet, "A1", "M1")
+	_ = f.SetCellValue(sheet, "A1", "Project Evidence : "+projectCode)
+	_ = f.SetCellStyle(sheet, "A1", "M1", titleStyle)
+	_ = f.SetRowHeight(sheet, 1, 40)
+
+	headers := []string{"No.", "Phase", "Item Name", "Item Type", "Department", "Owner", "Approver", "Approval Date", "Signed By", "Signed At", "File SHA-256", "Signature (HMAC-SHA256)", "File in ZIP"}
+	for i, h := range headers {
+		cell, _ := excelize.CoordinatesToCellName(i+1, 3)
+		_ = f.SetCellValue(sheet, cell, h)
+	}
+	_ = f.SetCellStyle(sheet, "A3", "M3", headerStyle)
+
+	row := 4
+	for i, it := range items {
+		approvedAt := "-"
+		if it.ApprovedAt != nil && !it.ApprovedAt.Time.IsZero() {
+			approvedAt = it.ApprovedAt.Time.Format("2006-01-02 15:04")
+		}
+		signedAt := "-"
+		if it.SignedAt != nil && !it.SignedAt.Time.IsZero() {
+			signedAt = it.SignedAt.Time.Format("2006-01-02 15:04:05")
+		}
+		vals := []interface{}{
+			i + 1,
+			it.PhaseName.StringValue(),
+			it.ItemName.StringValue(),
+			it.ItemType.StringValue(),
+			it.Department.StringValue(),
+			it.OwnerName.StringValue(),
+			it.ApproverName.StringValue(),
+			approvedAt,
+			it.SignerName.StringValue(),
+			signedAt,
+			it.FileSHA256.StringValue(),
+			it.Signature.StringValue(),
+			it.Entry,
+		}
+		if it.Missing {
+			vals[len(vals)-1] = "(file missing on server)"
+		}
+		for col, v := range vals {
+			cell, _ := excelize.CoordinatesToCellName(col+1, row)
+			_ = f.SetCellValue(sheet, cell, v)
+		}
+		_ = f.SetCellStyle(sheet, fmt.Sprintf("A%d", row), fmt.Sprintf("M%d", row), baseStyle)
+		row++
+	}
+
+	_ = f.SetColWidth(sheet, "A", "A", 6)
+	_ = f.SetColWidth(sheet, "B", "B", 24)
+	_ = f.SetColWidth(sheet, "C", "C", 40)
+	_ = f.SetColWidth(sheet, "D", "E", 14)
+	_ = f.SetColWidth(sheet, "F", "G", 26)
+	_ = f.SetColWidth(sheet, "H", "H", 18)
+	_ = f.SetColWidth(sheet, "I", "I", 26)
+	_ = f.SetColWidth(sheet, "J", "J", 20)
+	_ = f.SetColWidth(sheet, "K", "L", 68)
+	_ = f.SetColWidth(sheet, "M", "M", 50)
+	_ = f.SetCellValue(sheet, "A2", "Generated "+time.Now().Format("2006-01-02 15:04"))
+	return f, nil
+}
@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"apiTrackingSystem/internal/utils"
+)
+
+func TestAssignEvidenceEntries(t *testing.T) {
+	item := func(id int64, phase, name, file string) evidenceItem {
+		return evidenceItem{
+			IpidID:     id,
+			PhaseOrder: utils.NewNullInt64(1),
+			PhaseName:  utils.NewNullString(phase),
+			ItemName:   utils.NewNullString(name),
+			FileName:   utils.NewNullString(file),
+			FilePath:   utils.NewNullString("uploads/1/apqp/" + file),
+		}
+	}
+	items := []evidenceItem{
+		item(10, "Plan", "DFMEA", "dfmea.pdf"),
+		item(11, "Plan", "Control Plan", "cp.xlsx"),
+		item(12, "Plan", "control plan", "cp.xlsx"), // same folder, other case
+		item(13, "Plan", "A/B", "x.pdf"),
+		item(14, "Plan", "A:B", "x.pdf"), // same folder once cleaned
+		item(15, "Build", "DFMEA", "dfmea.pdf"),
+	}
+	items[5].PhaseOrder = utils.NewNullInt64(2)
+	assignEvidenceEntries(items, "index.xlsx", "POS/pos.pdf")
+
+	want := []string{
+		"01_Plan/DFMEA/dfmea.pdf",
+		"01_Plan/Control Plan_11/cp.xlsx",
+		"01_Plan/control plan_12/cp.xlsx",
+		"01_Plan/A_B_13/x.pdf",
+		"01_Plan/A_B_14/x.pdf",
+		"02_Build/DFMEA/dfmea.pdf",
+	}
+	for i, it := range items {
+		if it.Entry != want[i] {
+			t.Errorf("ipid_id %d: entry = %q, want %q", it.IpidID, it.Entry, want[i])
+		}
+	}
+
+	// a suffixed folder that meets a real folder of that name still gets its own file
+	items = []evidenceItem{item(20, "Plan", "PFMEA_21", "f.pdf"), item(21, "Plan", "PFMEA", "f.pdf"), item(22, "Plan", "PFMEA", "f.pdf")}
+	assignEvidenceEntries(items)
+	if items[0].Entry != "01_Plan/PFMEA_21/f.pdf" || items[1].Entry != "01_Plan/PFMEA_21/f_2.pdf" || items[2].Entry != "01_Plan/PFMEA_22/f.pdf" {
+		t.Errorf("entries = %q, %q, %q", items[0].Entry, items[1].Entry, items[2].Entry)
+	}
+}
+
+func TestMissingEvidenceHasNoEntry(t *testing.T) {
+	base := t.TempDir()
+	t.Setenv("UPLOAD_BASE", base)
+	if err := os.MkdirAll(filepath.Join(base, "PJ1", "apqp"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(base, "PJ1", "apqp", "cp.xlsx"), []byte("x"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	items := []evidenceItem{
+		{IpidID: 1, ItemName: utils.NewNullString("Control Plan"), FileName: utils.NewNullString("cp.xlsx"), FilePath: utils.NewNullString("uploads/PJ1/apqp/cp.xlsx")},
+		{IpidID: 2, ItemName: utils.NewNullString("PFMEA"), FileName: utils.NewNullString("pfmea.xlsx"), FilePath: utils.NewNullString("uploads/PJ1/apqp/pfmea.xlsx")},
+	}
+	if n := markMissingEvidence(items); n != 1 {
+		t.Fatalf("missing = %d, want 1", n)
+	}
+	assignEvidenceEntries(items, "index.xlsx")
+	if items[0].Missing || items[0].Entry != "Unassigned/Control Plan/cp.xlsx" {
+		t.Errorf("present item: missing=%v entry=%q", items[0].Missing, items[0].Entry)
+	}
+	if !items[1].Missing || items[1].Entry != "" {
+		t.Errorf("missing item: missing=%v entry=%q", items[1].Missing, items[1].Entry)
+	}
+}
@@ -0,0 +1,180 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// manualItemStatuses can be set on an item group without going through the approval engine
+var manualItemStatuses = map[string]bool{
+	"inprogress": true,
+}
+
+// item status errors
+var (
+	errItemNotFound      = errors.New("ipid_id not found")
+	errItemStatusInvalid = errors.New("invalid status")
+	errItemStale         = errors.New("item was changed by another user")
+)
+
+// itemStatusChange is one status change request for an item group (same ref_id + ipid_type)
+type itemStatusChange struct {
+	IpidID   int64
+	Status   string
+	Note     string
+	UpdateBy string
+	Version  string // projectItemVersion token the client last read; "" skips the check
+}
+
+// itemStatusResult is the committed state after a change (or the current state on errItemStale)
+type itemStatusResult struct {
+	IpidID    int64
+	RefID     int64
+	IpidType  string
+	Status    string
+	Decision  string // approve / reject, "" for manual statuses
+	Outcome   approvalOutcome
+	UpdatedAt time.Time
+	Version   string // projectItemVersion token of the item
+}
+
+// validItemStatus reports whether status is an approval decision or a manual item status
+func validItemStatus(status string) bool {
+	d := normalizeApprovalStatus(status)
+	return d == approvalApprove || d == approvalReject || manualItemStatuses[strings.ToLower(strings.TrimSpace(status))]
+}
+
+// parseItemVersion reads ipid_updated_at as sent back by the client (RFC 3339, "2006-01-02 15:04:05" or an ETag in microseconds)
+func parseItemVersion(v string) (time.Time, error) {
+	v = strings.Trim(strings.TrimPrefix(strings.TrimSpace(v), "W/"), `"`)
+	if us, err := strconv.ParseInt(v, 10, 64); err == nil {
+		return time.UnixMicro(us), nil
+	}
+	if t, err := time.Parse(time.RFC3339Nano, v); err == nil {
+		return t, nil
+	}
+	return time.ParseInLocation("2006-01-02 15:04:05", v, time.Local)
+}
+
+// decideItemGroup applies a decision taken on ipidID to the other items of its group (same ref_id +
+// ipid_type, rows locked by the caller) waiting on the same stage and bumps ipid_updated_at of the
+// group. Siblings the actor cannot decide are skipped.
+func decideItemGroup(tx *sqlx.Tx, group []int64, ipidID, refID int64, ipidType, actor, decision, note string, now time.Time) ([]approvalOutcome, error) {
+	var outcomes []approvalOutcome
+	for _, sib := range group {
+		if sib == ipidID {
+			continue
+		}
+		out, err := decideApproval(tx, sib, actor, decision, note, now)
+		if err != nil {
+			if approvalErrorStatus(err) == 500 {
+				return nil, err
+			}
+			continue
+		}
+		if err := signApproval(tx, out, now); err != nil {
+			return nil, err
+		}
+		outcomes = append(outcomes, out)
+	}
+	if _, err := tx.Exec(`UPDATE info_project_item_detail SET ipid_updated_at = ?, ipid_updated_by = ? WHERE ref_id = ? AND ipid_type = ?`,
+		now, actor, refID, ipidType); err != nil {
+		return nil, err
+	}
+	return outcomes, nil
+}
+
+// updateProjectItemStatus changes the status of an item group in one transaction.
+// The group rows are locked, the item version is compared with the client version and
+// ipid_updated_at is bumped on success; approve / reject go through decideApproval for every item in the group.
+func updateProjectItemStatus(db *sqlx.DB, req itemStatusChange, now time.Time) (itemStatusResult, error) {
+	res := itemStatusResult{IpidID: req.IpidID}
+	if !validItemStatus(req.Status) {
+		return res, errItemStatusInvalid
+	}
+	// DATETIME(6) keeps microseconds; the returned version must match what is stored
+	now = now.Truncate(time.Microsecond)
+
+	tx, err := db.Beginx()
+	if err != nil {
+		return res, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	var item struct {
+		RefID     int64          `db:"ref_id"`
+		IpidType  sql.NullString `db:"ipid_type"`
+		Status    sql.NullString `db:"ipid_status"`
+		UpdatedAt sql.NullTime   `db:"ipid_updated_at"`
+	}
+	if err := tx.Get(&item, `SELECT ref_id, ipid_type, ipid_status, ipid_updated_at FROM info_project_item_detail WHERE ipid_id = ? FOR UPDATE`, req.IpidID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return res, errItemNotFound
+		}
+		return res, err
+	}
+	res.RefID, res.IpidType, res.Status, res.UpdatedAt = item.RefID, item.IpidType.String, item.Status.String, item.UpdatedAt.Time
+
+	var group []int64
+	if err := tx.Select(&group, `SELECT ipid_id FROM info_project_item_detail WHERE ref_id = ? AND ipid_type = ? ORDER BY ipid_id FOR UPDATE`, item.RefID, item.IpidType.String); err != nil {
+		return res, err
+	}
+
+	if res.Version, err = currentVersion(tx, projectItemVersion, req.IpidID); err != nil {
+		return res, err
+	}
+	if req.Version != "" && req.Version != res.Version {
+		return res, errItemStale
+	}
+
+	decision := normalizeApprovalStatus(req.Status)
+	if decision == approvalApprove || decision == approvalReject {
+		res.Decision = decision
+		outcome, err := decideApproval(tx, req.IpidID, req.UpdateBy, decision, req.Note, now)
+		if err != nil {
+			return res, err
+		}
+		if err := signApproval(tx, outcome, now); err != nil {
+			return res, err
+		}
+		res.Outcome = outcome
+
+		// the same decision applies to the other items of this ref_id waiting on the same stage
+		if _, err := decideItemGroup(tx, group, req.IpidID, item.RefID, item.IpidType.String, req.UpdateBy, decision, req.Note, now); err != nil {
+			return res, err
+		}
+	} else {
+		// manual status change without approval
+		if err := recordItemGroupStatus(tx, req.IpidID, strings.ToLower(strings.TrimSpace(req.Status)), statusSourceManual, req.UpdateBy, now); err != nil {
+			return res, err
+		}
+		if _, err := tx.Exec(`UPDATE info_project_item_detail SET ipid_status = ?, ipid_updated_at = ?, ipid_updated_by = ? WHERE ref_id = ? AND ipid_type = ?`,
+			strings.ToLower(strings.TrimSpace(req.Status)), now, req.UpdateBy, item.RefID, item.IpidType.String); err != nil {
+			return res, err
+		}
+		if err := recordItemGroupActual(tx, req.IpidID, strings.ToLower(strings.TrimSpace(req.Status)), now); err != nil {
+			return res, err
+		}
+	}
+
+	if err := tx.Get(&res.Status, `SELECT COALESCE(ipid_status, '') FROM info_project_item_detail WHERE ipid_id = ?`, req.IpidID); err != nil {
+		return res, err
+	}
+	// the owner is mailed once the chain is finished; the mail is queued with this transaction
+	if res.Decision != "" && (res.Outcome.Completed || res.Outcome.Rejected) {
+		if err := notifyProjectItemStatus(tx, req.IpidID, item.RefID, item.IpidType.String, res.Decision, req.Note, req.UpdateBy, res.Outcome.OnBehalf, now); err != nil {
+			return res, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return res, err
+	}
+	res.UpdatedAt = now
+	res.Version = strconv.FormatInt(now.UnixMicro(), 10)
+	return res, nil
+}
@@ -1,6 +1,8 @@
 package handlers
 
 import (
+	"database/sql"
+	"errors"
 	"strings"
 	"time"
 
@@ -21,12 +23,13 @@ type SysProjectMasterPlan struct {
 	Status    utils.NullString `db:"ipmp_status" json:"ipmp_status"`
 	CreatedAt *DateTime        `db:"ipmp_created_at" json:"ipmp_created_at"`
 	CreatedBy utils.NullString `db:"ipmp_created_by" json:"ipmp_created_by"`
+	UpdatedAt *DateTime        `db:"ipmp_updated_at" json:"ipmp_updated_at"`
 }
 
 // ListProjectMasterPlans returns master plans, optional filter by ip_id
 func ListProjectMasterPlans(c *fiber.Ctx, db *sqlx.DB) error {
 	ipID := c.Query("ip_id")
-	query := `SELECT ipmp_id, ip_id, ipmp_name, ipmp_date, ipmp_start_date, ipmp_end_date, ipmp_type, ipmp_status, ipmp_created_at, ipmp_created_by FROM info_project_master_plan WHERE 1=1`
+	query := `SELECT ipmp_id, ip_id, ipmp_name, ipmp_date, ipmp_start_date, ipmp_end_date, ipmp_type, ipmp_status, ipmp_created_at, ipmp_created_by, ipmp_updated_at FROM info_project_master_plan WHERE 1=1`
 	args := []interface{}{}
 	if ipID != "" {
 		query += " AND ip_id = ?"
@@ -38,6 +41,10 @@ func ListProjectMasterPlans(c *fiber.Ctx, db *sqlx.DB) error {
 	if err := db.Select(&list, query, args...); err != nil {
 		return c.Status(500).JSON(fiber.Map{"error": "query error", "detail": err.Error()})
 	}
+	// the plan of one project is saved as a set by InsertProjectMasterPlan
+	if ipID != "" {
+		setETag(c, db, projectPlanSetVersion, ipID)
+	}
 	return c.Status(200).JSON(list)
 }
 
@@ -48,9 +55,10 @@ func GetProjectMasterPlan(c *fiber.Ctx, db *sqlx.DB) error {
 		return c.Status(400).JSON(fiber.Map{"error": "id required"})
 	}
 	var item SysProjectMasterPlan
-	if err := db.Get(&item, `SELECT ipmp_id, ip_id, ipmp_name, ipmp_date, ipmp_start_date, ipmp_end_date, ipmp_type, ipmp_status, ipmp_created_at, ipmp_created_by FROM info_project_master_plan WHERE ipmp_id = ?`, id); err != nil {
+	if err := db.Get(&item, `SELECT ipmp_id, ip_id, ipmp_name, ipmp_date, ipmp_start_date, ipmp_end_date, ipmp_type, ipmp_status, ipmp_created_at, ipmp_created_by, ipmp_updated_at FROM info_project_master_plan WHERE ipmp_id = ?`, id); err != nil {
 		return c.Status(500).JSON(fiber.Map{"error": "query error", "detail": err.Error()})
 	}
+	setETag(c, db, projectMasterPlanVersion, id)
 	return c.Status(200).JSON(item)
 }
 
@@ -75,11 +83,12 @@ func InsertProjectMasterPlan(c *fiber.Ctx, db *sqlx.DB) error {
 	// safety (กันพลาด rollback) - commit แล้ว rollback จะไม่ทำงาน
 	defer func() { _ = tx.Rollback() }()
 
+	// ipmp_status is left to the status roll-up (inprogress / delay / done)
 	insertQuery := `
 		INSERT INTO info_project_master_plan
-			(ip_id, ipmp_name, ipmp_date, ipmp_start_date, ipmp_end_date, ipmp_type, ipmp_status, ipmp_created_at, ipmp_created_by)
+			(ip_id, ipmp_name, ipmp_date, ipmp_start_date, ipmp_end_date, ipmp_type, ipmp_created_at, ipmp_created_by)
 		VALUES
-			(:ip_id, :ipmp_name, :ipmp_date, :ipmp_start_date, :ipmp_end_date, :ipmp_type, :ipmp_status, :ipmp_created_at, :ipmp_created_by)
+			(:ip_id, :ipmp_name, :ipmp_date, :ipmp_start_date, :ipmp_end_date, :ipmp_type, :ipmp_created_at, :ipmp_created_by)
 	`
 
 	ids := []int64{}
@@ -102,6 +111,20 @@ func InsertProjectMasterPlan(c *fiber.Ctx, db *sqlx.DB) error {
 	}
 
 	for ipID, items := range groups {
+		// optimistic locking on the whole plan of the project (ETag of ListProjectMasterPlans?ip_id=)
+		if err := checkVersion(c, tx, projectPlanSetVersion, ipID); err != nil {
+			return versionError(c, err)
+		}
+		if bad, err := planDeadlinesOffCalendar(c, tx, ipID, items...); err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "query calendar failed", "detail": err.Error()})
+		} else if len(bad) > 0 {
+			return c.Status(400).JSON(fiber.Map{"error": "deadline falls on a non-working day", "ip_id": ipID, "dates": bad})
+		}
+
+		// rows added in this save get the template dependencies
+		newIDs := []int64{}
+		by := items[0].CreatedBy.StringValue()
+
 		// fetch existing rows for this ip_id
 		var existingRows []struct {
 			ID        int64            `db:"ipmp_id"`
@@ -170,7 +193,6 @@ func InsertProjectMasterPlan(c *fiber.Ctx, db *sqlx.DB) error {
 					"ipmp_start_date": it.StartDate,
 					"ipmp_end_date":   it.EndDate,
 					"ipmp_type":       "dateRange",
-					"ipmp_status":     "inprogress",
 					"ipmp_created_at": now,
 					"ipmp_created_by": it.CreatedBy,
 				}
@@ -181,6 +203,13 @@ func InsertProjectMasterPlan(c *fiber.Ctx, db *sqlx.DB) error {
 				}
 				id, _ := res.LastInsertId()
 				ids = append(ids, id)
+				newIDs = append(newIDs, id)
+			}
+			if err := planSaved(c, tx, ipID, newIDs, by, now); err != nil {
+				if ok, resp := planCycleResponse(c, ipID, err); ok {
+					return resp
+				}
+				return c.Status(500).JSON(fiber.Map{"error": "schedule failed", "detail": err.Error()})
 			}
 
 			// IMPORTANT: if replace whole set, no need to "delete missing" again (กรณี replace ไม่ต้องลบซ้ำ)
@@ -200,7 +229,8 @@ func InsertProjectMasterPlan(c *fiber.Ctx, db *sqlx.DB) error {
 						"ipmp_start_date": it.StartDate,
 						"ipmp_end_date":   it.EndDate,
 						"ipmp_type":       "dateRange",
-						"ipmp_status":     "inprogress",
+						"ipmp_updated_at": now,
+						"ipmp_updated_by": it.CreatedBy,
 					}
 
 					_, err := tx.NamedExec(`
@@ -209,7 +239,8 @@ func InsertProjectMasterPlan(c *fiber.Ctx, db *sqlx.DB) error {
 						    ipmp_start_date = :ipmp_start_date,
 						    ipmp_end_date = :ipmp_end_date,
 						    ipmp_type = :ipmp_type,
-						    ipmp_status = :ipmp_status
+						    ipmp_updated_at = :ipmp_updated_at,
+						    ipmp_updated_by = :ipmp_updated_by
 						WHERE ipmp_id = :ipmp_id
 					`, params)
 					if err != nil {
@@ -228,7 +259,6 @@ func InsertProjectMasterPlan(c *fiber.Ctx, db *sqlx.DB) error {
 				"ipmp_start_date": it.StartDate,
 				"ipmp_end_date":   it.EndDate,
 				"ipmp_type":       "dateRange",
-				"ipmp_status":     "inprogress",
 				"ipmp_created_at": now,
 				"ipmp_created_by": it.CreatedBy,
 			}
@@ -239,6 +269,7 @@ func InsertProjectMasterPlan(c *fiber.Ctx, db *sqlx.DB) error {
 			}
 			id, _ := res.LastInsertId()
 			ids = append(ids, id)
+			newIDs = append(newIDs, id)
 		}
 
 		// ✅ FIXED: delete existing rows that were not sent in the incoming list (per ip_id)
@@ -262,6 +293,13 @@ func InsertProjectMasterPlan(c *fiber.Ctx, db *sqlx.DB) error {
 				}
 			}
 		}
+
+		if err := planSaved(c, tx, ipID, newIDs, by, now); err != nil {
+			if ok, resp := planCycleResponse(c, ipID, err); ok {
+				return resp
+			}
+			return c.Status(500).JSON(fiber.Map{"error": "schedule failed", "detail": err.Error()})
+		}
 	}
 
 	if err := tx.Commit(); err != nil {
@@ -282,6 +320,27 @@ func UpdateProjectMasterPlan(c *fiber.Ctx, db *sqlx.DB) error {
 	if req.IpmpID == 0 {
 		return c.Status(400).JSON(fiber.Map{"error": "ipmp_id is required"})
 	}
+	tx, err := db.Beginx()
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "begin tx failed", "detail": err.Error()})
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if err := checkVersion(c, tx, projectMasterPlanVersion, req.IpmpID); err != nil {
+		return versionError(c, err)
+	}
+	var ipID int64
+	if err := tx.Get(&ipID, `SELECT ip_id FROM info_project_master_plan WHERE ipmp_id = ?`, req.IpmpID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return c.Status(404).JSON(fiber.Map{"error": "not found"})
+		}
+		return c.Status(500).JSON(fiber.Map{"error": "query error", "detail": err.Error()})
+	}
+	if bad, err := planDeadlinesOffCalendar(c, tx, ipID, req); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "query calendar failed", "detail": err.Error()})
+	} else if len(bad) > 0 {
+		return c.Status(400).JSON(fiber.Map{"error": "deadline falls on a non-working day", "ip_id": ipID, "dates": bad})
+	}
 
 	params := map[string]any{
 		"ipmp_id":         req.IpmpID,
@@ -290,17 +349,19 @@ func UpdateProjectMasterPlan(c *fiber.Ctx, db *sqlx.DB) error {
 		"ipmp_start_date": req.StartDate,
 		"ipmp_end_date":   req.EndDate,
 		"ipmp_type":       req.Type,
-		"ipmp_status":     "inprogress",
+		"ipmp_updated_at": time.Now(),
+		"ipmp_updated_by": req.CreatedBy,
 	}
 
-	res, err := db.NamedExec(`
+	res, err := tx.NamedExec(`
         UPDATE info_project_master_plan SET
             ipmp_name = :ipmp_name,
             ipmp_date = :ipmp_date,
             ipmp_start_date = :ipmp_start_date,
             ipmp_end_date = :ipmp_end_date,
             ipmp_type = :ipmp_type,
-            ipmp_status = :ipmp_status
+            ipmp_updated_at = :ipmp_updated_at,
+            ipmp_updated_by = :ipmp_updated_by
         WHERE ipmp_id = :ipmp_id
     `, params)
 	if err != nil {
@@ -309,5 +370,31 @@ func UpdateProjectMasterPlan(c *fiber.Ctx, db *sqlx.DB) error {
 	if ra, _ := res.RowsAffected(); ra == 0 {
 		return c.Status(404).JSON(fiber.Map{"error": "not found"})
 	}
+	if err := planSaved(c, tx, ipID, nil, req.CreatedBy.StringValue(), time.Now()); err != nil {
+		if ok, resp := planCycleResponse(c, ipID, err); ok {
+			return resp
+		}
+		return c.Status(500).JSON(fiber.Map{"error": "schedule failed", "detail": err.Error()})
+	}
+	if err := tx.Commit(); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "commit failed", "detail": err.Error()})
+	}
 	return c.Status(200).JSON(1)
 }
+
+// planDeadlinesOffCalendar returns the plan deadlines (ipmp_date / ipmp_end_date) that fall on
+// non-working days of the project calendar; ?allow_non_working=1 skips the check
+func planDeadlinesOffCalendar(c *fiber.Ctx, q sqlx.Queryer, ipID int64, plans ...SysProjectMasterPlan) ([]calendarDay, error) {
+	if c.Query("allow_non_working") == "1" || c.Query("allow_non_working") == "true" {
+		return nil, nil
+	}
+	cal, err := projectCalendar(q, ipID)
+	if err != nil {
+		return nil, err
+	}
+	var dates []*Date
+	for _, p := range plans {
+		dates = append(dates, p.Date, p.EndDate)
+	}
+	return cal.nonWorkingDates(dates...), nil
+}
@@ -0,0 +1,541 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"apiTrackingSystem/internal/utils"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jmoiron/sqlx"
+)
+
+// schedule anchors (mst_template_schedule.mts_anchor): the SOP and the customer events
+var scheduleAnchors = []string{"sop", "k_ken_1", "k_ken_2", "1pp", "2pp", "pp"}
+
+func validScheduleAnchor(a string) bool {
+	for _, s := range scheduleAnchors {
+		if s == a {
+			return true
+		}
+	}
+	return false
+}
+
+// maxScheduleDays bounds offsets and durations (working days)
+const maxScheduleDays = 1000
+
+// MstTemplateSchedule is the standard duration / offset of a template milestone (MaID null)
+// or of an APQP item of that milestone
+type MstTemplateSchedule struct {
+	ID        int64            `db:"mts_id" json:"mts_id"`
+	MtID      int64            `db:"mt_id" json:"mt_id"`
+	MmpID     int64            `db:"mmp_id" json:"mmp_id"`
+	MmpName   utils.NullString `db:"mmp_name" json:"mmp_name"`
+	MaID      utils.NullInt64  `db:"ma_id" json:"ma_id"`
+	MaName    utils.NullString `db:"ma_name" json:"ma_name"`
+	Anchor    string           `db:"mts_anchor" json:"mts_anchor"`
+	Offset    int              `db:"mts_offset" json:"mts_offset"`
+	Duration  int              `db:"mts_duration" json:"mts_duration"`
+	UpdatedAt *time.Time       `db:"mts_updated_at" json:"mts_updated_at"`
+	UpdatedBy utils.NullString `db:"mts_updated_by" json:"mts_updated_by"`
+}
+
+// ListTemplateSchedule lists the standard schedule of a template (?mt_id=)
+func ListTemplateSchedule(c *fiber.Ctx, db *sqlx.DB) error {
+	mtID, err := strconv.ParseInt(c.Query("mt_id"), 10, 64)
+	if err != nil || mtID <= 0 {
+		return c.Status(400).JSON(fiber.Map{"error": "mt_id is required"})
+	}
+	res := []MstTemplateSchedule{}
+	if err := db.Select(&res, `SELECT mts.mts_id, mts.mt_id, mts.mmp_id, mmp.mmp_name, mts.ma_id, ma.ma_name, mts.mts_anchor, mts.mts_offset, mts.mts_duration, mts.mts_updated_at, mts.mts_updated_by
+		FROM mst_template_schedule mts
+		LEFT JOIN mst_master_plan mmp ON mmp.mmp_id = mts.mmp_id
+		LEFT JOIN mst_apqp ma ON ma.ma_id = mts.ma_id
+		WHERE mts.mt_id = ?
+		ORDER BY mts.mmp_id, mts.ma_id IS NOT NULL, mts.ma_id`, mtID); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "query error", "detail": err.Error()})
+	}
+	return c.Status(200).JSON(res)
+}
+
+// SaveTemplateSchedule replaces the standard schedule of a template.
+// Body: { "mt_id", "rows": [{ "mmp_id", "ma_id": null, "mts_anchor": "sop", "mts_offset": 20, "mts_duration": 5 }], "mts_updated_by" }
+func SaveTemplateSchedule(c *fiber.Ctx, db *sqlx.DB) error {
+	var body struct {
+		MtID int64 `json:"mt_id"`
+		Rows []struct {
+			MmpID    int64  `json:"mmp_id"`
+			MaID     int64  `json:"ma_id"`
+			Anchor   string `json:"mts_anchor"`
+			Offset   int    `json:"mts_offset"`
+			Duration int    `json:"mts_duration"`
+		} `json:"rows"`
+		UpdatedBy string `json:"mts_updated_by"`
+	}
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid request", "detail": err.Error()})
+	}
+	if body.MtID <= 0 {
+		return c.Status(400).JSON(fiber.Map{"error": "mt_id is required"})
+	}
+
+	// milestones of the template and their APQP items
+	var allowed []struct {
+		MmpID int64           `db:"mmp_id"`
+		MaID  utils.NullInt64 `db:"ma_id"`
+	}
+	if err := db.Select(&allowed, `SELECT mtpd.mmp_id, mmpd.ma_id
+		FROM mst_template_detail mtpd
+		LEFT JOIN mst_master_plan_detail mmpd ON mmpd.mmp_id = mtpd.mmp_id AND mmpd.mmpd_status = 'active'
+		WHERE mtpd.mt_id = ? AND mtpd.mtpd_status = 'active'`, body.MtID); err != nil {
+		return c.Status(500).JSON(5)
+	}
+	milestones := map[int64]bool{}
+	items := map[[2]int64]bool{}
+	for _, a := range allowed {
+		milestones[a.MmpID] = true
+		if a.MaID.Valid {
+			items[[2]int64{a.MmpID, a.MaID.Int64}] = true
+		}
+	}
+
+	seen := map[[2]int64]bool{}
+	for i := range body.Rows {
+		r := &body.Rows[i]
+		key := [2]int64{r.MmpID, r.MaID}
+		r.Anchor = strings.ToLower(strings.TrimSpace(r.Anchor))
+		if r.Anchor == "" {
+			r.Anchor = "sop"
+		}
+		if r.Duration == 0 {
+			r.Duration = 1
+		}
+		switch {
+		case !milestones[r.MmpID]:
+			return c.Status(400).JSON(fiber.Map{"error": "milestone is not in the template", "mmp_id": r.MmpID})
+		case r.MaID != 0 && !items[key]:
+			return c.Status(400).JSON(fiber.Map{"error": "APQP item is not in the milestone", "mmp_id": r.MmpID, "ma_id": r.MaID})
+		case seen[key]:
+			return c.Status(400).JSON(fiber.Map{"error": "duplicate row", "mmp_id": r.MmpID, "ma_id": r.MaID})
+		case r.MaID == 0 && !validScheduleAnchor(r.Anchor):
+			return c.Status(400).JSON(fiber.Map{"error": "mts_anchor must be one of " + strings.Join(scheduleAnchors, ", ")})
+		case r.Duration < 1 || r.Duration > maxScheduleDays:
+			return c.Status(400).JSON(fiber.Map{"error": "mts_duration must be 1.." + strconv.Itoa(maxScheduleDays)})
+		case r.Offset > maxScheduleDays || r.Offset < -maxScheduleDays:
+			return c.Status(400).JSON(fiber.Map{"error": "mts_offset must be within " + strconv.Itoa(maxScheduleDays) + " working days"})
+		}
+		seen[key] = true
+	}
+
+	tx, err := db.Beginx()
+	if err != nil {
+		return c.Status(500).JSON(5)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	now := time.Now()
+	if _, err := tx.Exec(`DELETE FROM mst_template_schedule WHERE mt_id = ?`, body.MtID); err != nil {
+		return c.Status(500).JSON(5)
+	}
+	for _, r := range body.Rows {
+		var maID utils.NullInt64
+		if r.MaID != 0 {
+			maID = utils.NewNullInt64(r.MaID)
+		}
+		if _, err := tx.Exec(`INSERT INTO mst_template_schedule (mt_id, mmp_id, ma_id, mts_anchor, mts_offset, mts_duration, mts_created_at, mts_created_by, mts_updated_at, mts_updated_by) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			body.MtID, r.MmpID, maID, r.Anchor, r.Offset, r.Duration, now, body.UpdatedBy, now, body.UpdatedBy); err != nil {
+			return c.Status(500).JSON(5)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return c.Status(500).JSON(5)
+	}
+	return c.Status(200).JSON(1)
+}
+
+// scheduleMilestone is the proposed dates of one template milestone
+type scheduleMilestone struct {
+	MmpID        int64  `json:"mmp_id"`
+	IpmpID       *int64 `json:"ipmp_id"` // nil: the project plan has no row for it yet
+	Name         string `json:"ipmp_name"`
+	Anchor       string `json:"anchor"`
+	AnchorDate   string `json:"anchor_date"`
+	Offset       int    `json:"offset"`
+	Duration     int    `json:"duration"`
+	StartDate    string `json:"start_date"`
+	EndDate      string `json:"end_date"`
+	CurrentStart *Date  `json:"current_start_date"`
+	CurrentEnd   *Date  `json:"current_end_date"`
+	Done         bool   `json:"done"` // done milestones are not changed
+}
+
+// scheduleItem is the proposed dates of one APQP item; IpidIDs are its existing detail rows
+type scheduleItem struct {
+	MmpID     int64   `json:"mmp_id"`
+	MaID      int64   `json:"ma_id"`
+	Name      string  `json:"ma_name"`
+	Source    string  `json:"source"` // template: own schedule row, milestone: dates of its milestone
+	Offset    int     `json:"offset"`
+	Duration  int     `json:"duration"`
+	StartDate string  `json:"start_date"`
+	EndDate   string  `json:"end_date"`
+	IpidIDs   []int64 `json:"ipid_ids"`
+	Done      bool    `json:"done"` // under a done milestone: not changed
+}
+
+// scheduleProposal is the back-scheduled plan of a project
+type scheduleProposal struct {
+	IpID       int64               `json:"ip_id"`
+	MtID       int64               `json:"mt_id"`
+	Anchors    map[string]*string  `json:"anchors"`
+	Milestones []scheduleMilestone `json:"milestones"`
+	Items      []scheduleItem      `json:"items"`
+	Warnings   []string            `json:"warnings"`
+}
+
+var (
+	errScheduleNoProject  = errors.New("project not found")
+	errScheduleNoTemplate = errors.New("project has no template")
+)
+
+// buildScheduleProposal back-schedules the template milestones of a project from its SOP / customer
+// event dates on the project calendar, then the APQP items from their milestones
+func buildScheduleProposal(q sqlx.Queryer, ipID int64) (*scheduleProposal, error) {
+	var pj struct {
+		MtID   utils.NullInt64 `db:"mt_id"`
+		Sop    *Date           `db:"ip_sop_date"`
+		KKen1  *Date           `db:"ice_k_ken_1_date"`
+		KKen2  *Date           `db:"ice_k_ken_2_date"`
+		PP1    *Date           `db:"ice_1pp_date"`
+		PP2    *Date           `db:"ice_2pp_date"`
+		PP     *Date           `db:"ice_pp_date"`
+		IceSop *Date           `db:"ice_sop_date"`
+	}
+	if err := sqlx.Get(q, &pj, `SELECT ip.mt_id, ip.ip_sop_date, ice.ice_k_ken_1_date, ice.ice_k_ken_2_date, ice.ice_1pp_date, ice.ice_2pp_date, ice.ice_pp_date, ice.ice_sop_date
+		FROM info_project ip
+		LEFT JOIN info_customer_event ice ON ice.ip_id = ip.ip_id AND ice.ice_status = 'active'
+		WHERE ip.ip_id = ? LIMIT 1`, ipID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, errScheduleNoProject
+		}
+		return nil, err
+	}
+	if !pj.MtID.Valid || pj.MtID.Int64 <= 0 {
+		return nil, errScheduleNoTemplate
+	}
+	sop := pj.Sop
+	if sop == nil || sop.IsZero() {
+		sop = pj.IceSop
+	}
+	anchorDates := map[string]*Date{"sop": sop, "k_ken_1": pj.KKen1, "k_ken_2": pj.KKen2, "1pp": pj.PP1, "2pp": pj.PP2, "pp": pj.PP}
+
+	p := &scheduleProposal{IpID: ipID, MtID: pj.MtID.Int64, Anchors: map[string]*string{}, Milestones: []scheduleMilestone{}, Items: []scheduleItem{}, Warnings: []string{}}
+	for _, a := range scheduleAnchors {
+		if d := anchorDates[a]; d != nil && !d.IsZero() {
+			s := d.Format(dateKey)
+			p.Anchors[a] = &s
+		} else {
+			p.Anchors[a] = nil
+		}
+	}
+
+	cal, err := projectCalendar(q, ipID)
+	if err != nil {
+		return nil, err
+	}
+
+	var tmpl []struct {
+		MmpID int64  `db:"mmp_id"`
+		Name  string `db:"mmp_name"`
+	}
+	if err := sqlx.Select(q, &tmpl, `SELECT mmp.mmp_id, mmp.mmp_name
+		FROM mst_template_detail mtpd
+		JOIN mst_master_plan mmp ON mmp.mmp_id = mtpd.mmp_id AND mmp.mmp_status = 'active'
+		WHERE mtpd.mt_id = ? AND mtpd.mtpd_status = 'active'
+		ORDER BY mtpd.mtpd_id`, p.MtID); err != nil {
+		return nil, err
+	}
+	var rows []MstTemplateSchedule
+	if err := sqlx.Select(q, &rows, `SELECT mts_id, mt_id, mmp_id, ma_id, mts_anchor, mts_offset, mts_duration FROM mst_template_schedule WHERE mt_id = ?`, p.MtID); err != nil {
+		return nil, err
+	}
+	milestoneRow := map[int64]MstTemplateSchedule{}
+	itemRow := map[[2]int64]MstTemplateSchedule{}
+	for _, r := range rows {
+		if r.MaID.Valid {
+			itemRow[[2]int64{r.MmpID, r.MaID.Int64}] = r
+		} else {
+			milestoneRow[r.MmpID] = r
+		}
+	}
+
+	var plan []struct {
+		ID     int64            `db:"ipmp_id"`
+		Name   utils.NullString `db:"ipmp_name"`
+		Status utils.NullString `db:"ipmp_status"`
+		Start  *Date            `db:"ipmp_start_date"`
+		End    *Date            `db:"ipmp_end_date"`
+	}
+	if err := sqlx.Select(q, &plan, `SELECT ipmp_id, ipmp_name, ipmp_status, ipmp_start_date, ipmp_end_date FROM info_project_master_plan WHERE ip_id = ?`, ipID); err != nil {
+		return nil, err
+	}
+	planByName := map[string]int{}
+	for i, r := range plan {
+		planByName[strings.TrimSpace(r.Name.StringValue())] = i
+	}
+
+	// milestone end dates, for the items
+	ends := map[int64]time.Time{}
+	starts := map[int64]time.Time{}
+	ipmpByMmp := map[int64]int64{}
+	doneMmp := map[int64]bool{}
+	for _, t := range tmpl {
+		r, ok := milestoneRow[t.MmpID]
+		if !ok {
+			p.Warnings = append(p.Warnings, "no standard schedule for "+t.Name)
+			continue
+		}
+		anchor := anchorDates[r.Anchor]
+		if anchor == nil || anchor.IsZero() {
+			p.Warnings = append(p.Warnings, t.Name+": no "+r.Anchor+" date")
+			continue
+		}
+		end := cal.AddWorkingDays(cal.PrevWorkingDay(anchor.Time), -r.Offset)
+		start := cal.AddWorkingDays(end, -(r.Duration - 1))
+		m := scheduleMilestone{
+			MmpID: t.MmpID, Name: t.Name,
+			Anchor: r.Anchor, AnchorDate: anchor.Format(dateKey), Offset: r.Offset, Duration: r.Duration,
+			StartDate: start.Format(dateKey), EndDate: end.Format(dateKey),
+		}
+		if i, ok := planByName[strings.TrimSpace(t.Name)]; ok {
+			id := plan[i].ID
+			m.IpmpID = &id
+			m.CurrentStart, m.CurrentEnd = plan[i].Start, plan[i].End
+			m.Done = plan[i].Status.StringValue() == statusDone
+		}
+		p.Milestones = append(p.Milestones, m)
+		starts[t.MmpID], ends[t.MmpID] = start, end
+		if m.IpmpID != nil {
+			ipmpByMmp[t.MmpID] = *m.IpmpID
+		}
+		if m.Done {
+			doneMmp[t.MmpID] = true
+		}
+	}
+	if len(ends) == 0 {
+		return p, nil
+	}
+
+	var tmplItems []struct {
+		MmpID int64         `db:"mmp_id"`
+		MaID  int64         `db:"ma_id"`
+		Name  string        `db:"ma_name"`
+		MppID sql.NullInt64 `db:"mpp_id"`
+	}
+	mmpIDs := make([]int64, 0, len(ends))
+	for id := range ends {
+		mmpIDs = append(mmpIDs, id)
+	}
+	query, args, err := sqlx.In(`SELECT mmpd.mmp_id, ma.ma_id, ma.ma_name, ma.mpp_id
+		FROM mst_master_plan_detail mmpd
+		JOIN mst_apqp ma ON ma.ma_id = mmpd.ma_id AND ma.ma_status = 'active'
+		WHERE mmpd.mmpd_status = 'active' AND mmpd.mmp_id IN (?)
+		ORDER BY mmpd.mmp_id, mmpd.mmpd_id`, mmpIDs)
+	if err != nil {
+		return nil, err
+	}
+	if err := sqlx.Select(q, &tmplItems, query, args...); err != nil {
+		return nil, err
+	}
+
+	// an item detail belongs to the milestone its APQP item is set to (info_apqp_item.ipmp_id),
+	// else to the milestones listing an APQP item of the same name and phase; each detail is
+	// scheduled once (the first milestone in template order)
+	var details []struct {
+		IpidID int64         `db:"ipid_id"`
+		Name   string        `db:"iai_name"`
+		MppID  sql.NullInt64 `db:"mpp_id"`
+		IpmpID sql.NullInt64 `db:"ipmp_id"`
+	}
+	if err := sqlx.Select(q, &details, `SELECT pid.ipid_id, ai.iai_name, ai.mpp_id, ai.ipmp_id
+		FROM info_project_item_detail pid
+		JOIN info_apqp_item ai ON ai.iai_id = pid.ref_id AND pid.ipid_type = 'apqp'
+		WHERE ai.ip_id = ? AND COALESCE(pid.ipid_status, '') <> 'done'
+		ORDER BY pid.ipid_id`, ipID); err != nil {
+		return nil, err
+	}
+	type detailKey struct {
+		Name  string
+		MppID int64 // 0: the item has no phase
+		Ipmp  int64 // 0: not set to a plan row
+	}
+	detailsByKey := map[detailKey][]int64{}
+	for _, d := range details {
+		k := detailKey{Name: strings.TrimSpace(d.Name)}
+		if d.IpmpID.Valid {
+			k.Ipmp = d.IpmpID.Int64
+		} else if d.MppID.Valid {
+			k.MppID = d.MppID.Int64
+		}
+		detailsByKey[k] = append(detailsByKey[k], d.IpidID)
+	}
+	claimed := map[int64]bool{}
+
+	for _, t := range tmplItems {
+		it := scheduleItem{MmpID: t.MmpID, MaID: t.MaID, Name: t.Name, Source: "milestone", IpidIDs: []int64{}}
+		start, end := starts[t.MmpID], ends[t.MmpID]
+		if r, ok := itemRow[[2]int64{t.MmpID, t.MaID}]; ok {
+			it.Source, it.Offset, it.Duration = "template", r.Offset, r.Duration
+			end = cal.AddWorkingDays(end, -r.Offset)
+			start = cal.AddWorkingDays(end, -(r.Duration - 1))
+		} else {
+			it.Duration = cal.WorkingDays(start, end)
+		}
+		it.StartDate, it.EndDate = start.Format(dateKey), end.Format(dateKey)
+		name := strings.TrimSpace(t.Name)
+		keys := []detailKey{{Name: name, MppID: t.MppID.Int64}, {Name: name}}
+		if id, ok := ipmpByMmp[t.MmpID]; ok {
+			keys = append([]detailKey{{Name: name, Ipmp: id}}, keys...)
+		}
+		for _, k := range keys {
+			for _, id := range detailsByKey[k] {
+				if !claimed[id] {
+					claimed[id] = true
+					it.IpidIDs = append(it.IpidIDs, id)
+				}
+			}
+		}
+		it.Done = doneMmp[t.MmpID]
+		p.Items = append(p.Items, it)
+	}
+	return p, nil
+}
+
+// scheduleError answers a buildScheduleProposal error
+func scheduleError(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, errScheduleNoProject):
+		return c.Status(404).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, errScheduleNoTemplate):
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.Status(500).JSON(fiber.Map{"error": "schedule failed", "detail": err.Error()})
+}
+
+// GenerateProjectSchedule proposes the master plan and APQP item dates of a project from its
+// template's standard schedule (?ip_id=). Nothing is saved; the ETag is the plan version that
+// AcceptProjectSchedule checks.
+func GenerateProjectSchedule(c *fiber.Ctx, db *sqlx.DB) error {
+	ipID, err := strconv.ParseInt(c.Query("ip_id"), 10, 64)
+	if err != nil || ipID <= 0 {
+		return c.Status(400).JSON(fiber.Map{"error": "ip_id is required"})
+	}
+	p, err := buildScheduleProposal(db, ipID)
+	if err != nil {
+		return scheduleError(c, err)
+	}
+	setETag(c, db, projectPlanSetVersion, ipID)
+	return c.Status(200).JSON(p)
+}
+
+// AcceptProjectSchedule saves the generated schedule: plan rows are updated or added, the detail
+// rows of the APQP items get the item dates (done rows and the items of done milestones are kept). The proposal is built again,
+// so send If-Match with the ETag of GenerateProjectSchedule. Milestone dependencies are not applied
+// here; GetCriticalPath shows the rows they would move.
+// Body: { "ip_id", "updated_by", "mmp_ids": [] (optional subset), "ma_ids": [] (optional subset) }
+func AcceptProjectSchedule(c *fiber.Ctx, db *sqlx.DB) error {
+	var body struct {
+		IpID      int64   `json:"ip_id"`
+		UpdatedBy string  `json:"updated_by"`
+		MmpIDs    []int64 `json:"mmp_ids"`
+		MaIDs     []int64 `json:"ma_ids"`
+	}
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid request", "detail": err.Error()})
+	}
+	if body.IpID <= 0 {
+		return c.Status(400).JSON(fiber.Map{"error": "ip_id is required"})
+	}
+	pick := func(ids []int64) func(int64) bool {
+		set := map[int64]bool{}
+		for _, id := range ids {
+			set[id] = true
+		}
+		return func(id int64) bool { return len(set) == 0 || set[id] }
+	}
+	pickMilestone, pickItem := pick(body.MmpIDs), pick(body.MaIDs)
+
+	tx, err := db.Beginx()
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "begin tx failed", "detail": err.Error()})
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if err := checkVersion(c, tx, projectPlanSetVersion, body.IpID); err != nil {
+		return versionError(c, err)
+	}
+	p, err := buildScheduleProposal(tx, body.IpID)
+	if err != nil {
+		return scheduleError(c, err)
+	}
+
+	now := time.Now()
+	updated, added := 0, []int64{}
+	for _, m := range p.Milestones {
+		if m.Done || !pickMilestone(m.MmpID) {
+			continue
+		}
+		start, end := parseDatePtr(m.StartDate), parseDatePtr(m.EndDate)
+		if m.IpmpID != nil {
+			if _, err := tx.Exec(`UPDATE info_project_master_plan SET ipmp_start_date = ?, ipmp_end_date = ?, ipmp_type = 'dateRange', ipmp_updated_at = ?, ipmp_updated_by = ? WHERE ipmp_id = ?`,
+				start, end, now, body.UpdatedBy, *m.IpmpID); err != nil {
+				return c.Status(500).JSON(fiber.Map{"error": "update plan failed", "detail": err.Error()})
+			}
+			updated++
+			continue
+		}
+		res, err := tx.Exec(`INSERT INTO info_project_master_plan (ip_id, ipmp_name, ipmp_start_date, ipmp_end_date, ipmp_type, ipmp_status, ipmp_created_at, ipmp_created_by) VALUES (?, ?, ?, ?, 'dateRange', 'inprogress', ?, ?)`,
+			body.IpID, m.Name, start, end, now, body.UpdatedBy)
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "insert plan failed", "detail": err.Error()})
+		}
+		id, _ := res.LastInsertId()
+		added = append(added, id)
+	}
+	if err := linkNewPlanRows(tx, body.IpID, added, body.UpdatedBy, now); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "link plan failed", "detail": err.Error()})
+	}
+
+	items := []int64{}
+	for _, it := range p.Items {
+		if it.Done || len(it.IpidIDs) == 0 || !pickMilestone(it.MmpID) || !pickItem(it.MaID) {
+			continue
+		}
+		query, args, err := sqlx.In(`UPDATE info_project_item_detail SET ipid_start_date = ?, ipid_end_date = ?, ipid_updated_at = ?, ipid_updated_by = ? WHERE ipid_id IN (?)`,
+			parseDatePtr(it.StartDate), parseDatePtr(it.EndDate), now, body.UpdatedBy, it.IpidIDs)
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "update items failed", "detail": err.Error()})
+		}
+		if _, err := tx.Exec(query, args...); err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "update items failed", "detail": err.Error()})
+		}
+		items = append(items, it.IpidIDs...)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "commit failed", "detail": err.Error()})
+	}
+	publishItemEvents(db, streamItemSchedule, items, body.UpdatedBy)
+	setETag(c, db, projectPlanSetVersion, body.IpID)
+	return c.Status(200).JSON(fiber.Map{
+		"ip_id":              body.IpID,
+		"milestones_updated": updated,
+		"milestones_added":   len(added),
+		"items_updated":      len(items),
+		"warnings":           p.Warnings,
+	})
+}
@@ -4,7 +4,6 @@ import (
 	"database/sql"
 	"encoding/json"
 	"fmt"
-	"html"
 	"mime/multipart"
 	"os"
 	"path/filepath"
@@ -230,10 +229,10 @@ func GetListProjectTracking(c *fiber.Ctx, db *sqlx.DB) error {
 						WHEN ia.ia_status IS NULL AND ia.ia_type IS NULL AND tf.itf_file_path IS NOT NULL THEN 7
                         WHEN ia.ia_status IS NULL AND ia.ia_type IS NULL THEN 5
                         WHEN ia.ia_status = 'waiting' AND x.ipid_status = 'waiting' AND ia.ia_type = 'Leader' THEN 1
-                        WHEN ia.ia_status = 'Approve' AND x.ipid_status = 'waiting' AND ia.ia_type = 'Leader' THEN 2
+                        WHEN ia.ia_status = 'approve' AND x.ipid_status = 'waiting' AND ia.ia_type = 'Leader' THEN 2
                         WHEN ia.ia_status = 'reject' AND ia.ia_type = 'Leader' THEN 3
                         WHEN ia.ia_status = 'reject' AND ia.ia_type = 'PJ' THEN 4
-                        WHEN ia.ia_status = 'Approve' AND x.ipid_status = 'done' THEN 5
+                        WHEN ia.ia_status = 'approve' AND x.ipid_status = 'done' THEN 5
 						WHEN ia.ia_status = 'waiting' AND ia.ia_type = 'PJ' THEN 6
                         ELSE NULL
                     END AS status_approve,
@@ -330,7 +329,10 @@ func GetListProjectTracking(c *fiber.Ctx, db *sqlx.DB) error {
 					)
 
 					LEFT JOIN sys_user su ON su.su_id = x.owner_su_id
-					LEFT JOIN info_approval ia ON ia.ipid_id = x.ipid_id AND ia.ia_is_action = 1
+					LEFT JOIN info_approval ia ON ia.ia_id = (
+						SELECT MIN(ia_sub.ia_id) FROM info_approval ia_sub
+						WHERE ia_sub.ipid_id = x.ipid_id AND ia_sub.ia_is_action = 1
+					)
 				ORDER BY
 				x.item_type ASC,
 				x.start_date ASC,
@@ -528,6 +530,17 @@ func InsertProjectTracking(c *fiber.Ctx, db *sqlx.DB) error {
 		return c.Status(400).JSON(fiber.Map{"error": "no files uploaded", "detail": "at least one file is required for tracking"})
 	}
 
+	// previous versions moved to _history: old db path -> archived db path
+	archived := map[string]string{}
+	// new files are saved under a temporary name and moved into place after commit
+	var staged []stagedUpload
+	committed := false
+	defer func() {
+		if !committed {
+			discardStagedUploads(staged)
+		}
+	}()
+
 	// Save files (multipart only)
 	if len(uploadedFiles) > 0 {
 		// สร้าง slice copy เพื่อ track ไฟล์ที่ใช้แล้ว
@@ -535,10 +548,8 @@ func InsertProjectTracking(c *fiber.Ctx, db *sqlx.DB) error {
 		copy(remainingFiles, uploadedFiles)
 
 		// prepare upload base (server absolute path) from ENV with fallback
-		uploadBase := os.Getenv("UPLOAD_BASE")
-		if strings.TrimSpace(uploadBase) == "" {
-			uploadBase = `C:\inetpub\wwwroot\apiTrackingSystemUat\uploads`
-		}
+		uploadBase := uploadBaseDir()
+		stamp := time.Now().Format("20060102150405")
 		// cache for ip_id -> folder name
 		ipCodeCache := map[int64]string{}
 		// regexp for sanitizing folder names
@@ -602,11 +613,20 @@ func InsertProjectTracking(c *fiber.Ctx, db *sqlx.DB) error {
 				return c.Status(500).JSON(fiber.Map{"error": "could not create directories", "detail": err.Error()})
 			}
 
-			// save file
-			savedDiskPath := filepath.Join(destDir, it.FileName)
-			if err := c.SaveFile(matched, savedDiskPath); err != nil {
+			// save file (keep the previous version under _history so the timeline can still point at it)
+			up := stagedUpload{
+				Temp:  filepath.Join(destDir, "."+stamp+"_"+strconv.Itoa(len(staged))+"_"+it.FileName+".upload"),
+				Final: filepath.Join(destDir, it.FileName),
+			}
+			if _, err := os.Stat(up.Final); err == nil {
+				histName := stamp + "_" + it.FileName
+				up.History = filepath.Join(destDir, "_history", histName)
+				archived[filepath.ToSlash(filepath.Join("uploads", ipFolder, itfType, it.FileName))] = filepath.ToSlash(filepath.Join("uploads", ipFolder, itfType, "_history", histName))
+			}
+			if err := c.SaveFile(matched, up.Temp); err != nil {
 				return c.Status(500).JSON(fiber.Map{"error": "could not save uploaded file", "detail": err.Error()})
 			}
+			staged = append(staged, up)
 
 			// construct DB relative path under 'uploads'
 			it.FilePath = filepath.ToSlash(filepath.Join("uploads", ipFolder, itfType, it.FileName))
@@ -632,6 +652,16 @@ func InsertProjectTracking(c *fiber.Ctx, db *sqlx.DB) error {
 	updateTrackingStmt := `UPDATE info_tracking_file SET itf_file_name = ?, itf_file_path = ?, itf_type = ?, itf_updated_at = ?, itf_updated_by = ? WHERE itf_id = ?`
 	updateStmt := `UPDATE info_project_item_detail SET ipid_status = ? WHERE (ref_id, ipid_type) IN (SELECT ref_id, ipid_type FROM (SELECT ref_id, ipid_type FROM info_project_item_detail WHERE ipid_id = ?) AS sq)`
 
+	// earlier versions are moved to _history once this transaction commits
+	for oldPath, newPath := range archived {
+		if _, err := tx.Exec(`UPDATE info_tracking_file_history SET itfh_file_path = ? WHERE itfh_file_path = ?`, newPath, oldPath); err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "update file history failed", "detail": err.Error()})
+		}
+		if _, err := tx.Exec(`UPDATE info_approval_signature SET ias_file_path = ? WHERE ias_file_path = ?`, newPath, oldPath); err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "update signature file path failed", "detail": err.Error()})
+		}
+	}
+
 	// Track newly inserted items to send emails only for new items
 	newItemIpidIDs := map[int64]bool{}
 
@@ -654,66 +684,31 @@ func InsertProjectTracking(c *fiber.Ctx, db *sqlx.DB) error {
 			return c.Status(500).JSON(fiber.Map{"error": "select tracking error", "detail": errGet.Error()})
 		}
 
+		if err := recordItemGroupStatus(tx, it.IpidID, "waiting", statusSourceUpload, it.CreatedBy, now); err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "record status event failed", "detail": err.Error()})
+		}
 		if _, err := tx.Exec(updateStmt, "waiting", it.IpidID); err != nil {
 			return c.Status(500).JSON(fiber.Map{"error": "update ipid error", "detail": err.Error()})
 		}
-
-		// Insert info_approval entries based on workflow for the responsible department
-		// 1) find su_id for this ipid (from info_project_item_detail)
-		var ownerSu sql.NullInt64
-		if err := tx.Get(&ownerSu, `SELECT su_id FROM info_project_item_detail WHERE ipid_id = ? LIMIT 1`, it.IpidID); err != nil {
-			// non-fatal if not found; continue
-			if err != sql.ErrNoRows {
-				return c.Status(500).JSON(fiber.Map{"error": "query su_id failed", "detail": err.Error()})
-			}
+		if err := recordItemGroupActual(tx, it.IpidID, "waiting", now); err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "update actual dates failed", "detail": err.Error()})
 		}
-		if ownerSu.Valid {
-			// 2) get sd_id from sys_user for that su_id
-			var sdID sql.NullInt64
-			if err := tx.Get(&sdID, `SELECT sd_id FROM sys_user WHERE su_id = ? LIMIT 1`, ownerSu.Int64); err != nil && err != sql.ErrNoRows {
-				return c.Status(500).JSON(fiber.Map{"error": "query sd_id failed", "detail": err.Error()})
-			}
-			if sdID.Valid {
-				// remove existing approvals for this ipid to avoid duplicates
-				if _, err := tx.Exec(`UPDATE info_approval SET ia_status_flg = 'inactive', ia_is_action = 0, ia_updated_at = ?, ia_updated_by = ? WHERE ipid_id = ?`, now, it.CreatedBy, it.IpidID); err != nil {
-					return c.Status(500).JSON(fiber.Map{"error": "delete existing approvals failed", "detail": err.Error()})
-				}
 
-				// 3) query workflow rows for this department and insert approvals in order
-				var wfRows []struct {
-					SwOrder sql.NullInt64 `db:"sw_order"`
-					SuID    sql.NullInt64 `db:"su_id"`
-				}
-				if err := tx.Select(&wfRows, `SELECT sw_order, su_id FROM sys_workflow WHERE sd_id = ? AND sw_status = 'active' ORDER BY sw_order ASC`, sdID.Int64); err != nil {
-					return c.Status(500).JSON(fiber.Map{"error": "query workflow failed", "detail": err.Error()})
-				}
-				for idx, r := range wfRows {
-					if !r.SuID.Valid || !r.SwOrder.Valid {
-						continue
-					}
-					iaIsAction := 0
-					if idx == 0 {
-						iaIsAction = 1
-					}
-					// If an approval row for this ipid_id+su_id already exists with final status (approve/reject),
-					// mark the old row as inactive (archive it) before inserting a new approval row.
-					if _, err := tx.Exec(`UPDATE info_approval SET ia_status_flg = 'inactive', ia_updated_at = ?, ia_updated_by = ? WHERE ipid_id = ? AND su_id = ? AND ia_status IN ('approve','reject')`, now, it.CreatedBy, it.IpidID, r.SuID.Int64); err != nil {
-						return c.Status(500).JSON(fiber.Map{"error": "deactivate old approvals failed", "detail": err.Error()})
-					}
-					if _, err := tx.Exec(`INSERT INTO info_approval (ipid_id, su_id, ia_level, ia_status, ia_is_action, ia_round, ia_created_at, ia_created_by, ia_updated_at, ia_updated_by, ia_status_flg, ia_type) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
-						it.IpidID, r.SuID.Int64, r.SwOrder.Int64, "waiting", iaIsAction, 0, now, it.CreatedBy, now, it.CreatedBy, "active", "Leader"); err != nil {
-						return c.Status(500).JSON(fiber.Map{"error": "insert info_approval failed", "detail": err.Error()})
-					}
-				}
-			}
+		// open the approval chain (stages from sys_approval_stage, default Leader -> PJ)
+		round, _, _, err := startApproval(tx, it.IpidID, it.CreatedBy, now)
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "insert info_approval failed", "detail": err.Error()})
 		}
-	}
 
-	if err := tx.Commit(); err != nil {
-		return c.Status(500).JSON(fiber.Map{"error": "commit error", "detail": err.Error()})
+		// file version of this round
+		if _, err := tx.Exec(`INSERT INTO info_tracking_file_history (ip_id, ipid_id, itfh_round, itfh_file_name, itfh_file_path, itfh_created_at, itfh_created_by) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+			it.IpID, it.IpidID, round, it.FileName, it.FilePath, now, it.CreatedBy); err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "insert file history failed", "detail": err.Error()})
+		}
 	}
 
-	// If su_id provided, send notification email (behaviour from SaveFileSendEmail)
+	// Notify the approvers (behaviour from SaveFileSendEmail); the mails are queued in the outbox
+	// with this transaction and sent by the notification dispatcher
 	// Only send for newly inserted items, not for updates
 	if len(items) > 0 && len(newItemIpidIDs) > 0 {
 		ipID := items[0].IpID
@@ -753,13 +748,37 @@ func InsertProjectTracking(c *fiber.Ctx, db *sqlx.DB) error {
 			ORDER BY sw.sw_order ASC
 		`, sentIpidIDs)
 		if err == nil {
-			q = db.Rebind(q)
-			_ = db.Select(&approverSuIDs, q, args...)
+			q = tx.Rebind(q)
+			_ = tx.Select(&approverSuIDs, q, args...)
+		}
+
+		// Users standing in for an approver of the sent items (active delegation) are mailed too
+		var delegateSuIDs []int64
+		q, args, err = sqlx.In(`SELECT DISTINCT dl.sdl_delegate_su_id
+			FROM info_approval ia
+			JOIN info_project_item_detail pid ON pid.ipid_id = ia.ipid_id
+			JOIN sys_delegation dl ON dl.su_id = ia.su_id AND `+delegationActiveSQL+`
+				AND (dl.sd_id IS NULL OR dl.sd_id = pid.sd_id)
+			WHERE ia.ipid_id IN (?) AND ia.ia_status = 'waiting' AND ia.ia_is_action = 1`, sentIpidIDs)
+		if err == nil {
+			_ = tx.Select(&delegateSuIDs, tx.Rebind(q), args...)
+		}
+		for _, d := range delegateSuIDs {
+			known := false
+			for _, a := range approverSuIDs {
+				if a == d {
+					known = true
+					break
+				}
+			}
+			if !known {
+				approverSuIDs = append(approverSuIDs, d)
+			}
 		}
 
 		// For each approver, collect ONLY the sent items
 		for _, approverSuID := range approverSuIDs {
-			// Get items assigned to this approver - FILTERED to ONLY sent ipid_ids
+			// Get items waiting on this approver (or on someone they stand in for) - FILTERED to ONLY sent ipid_ids
 			q, args, err := sqlx.In(`SELECT DISTINCT
 					ip.ip_code,
 					ip.ip_part_name,
@@ -796,20 +815,27 @@ func InsertProjectTracking(c *fiber.Ctx, db *sqlx.DB) error {
 						WHERE pi.ip_id = ? AND pid.ipid_id IN (?)
 				) x
 				LEFT JOIN info_project ip ON x.ip_id = ip.ip_id
-				LEFT JOIN info_approval ia ON ia.ipid_id = x.ipid_id AND ia.su_id = ? AND ia_status = 'waiting'
-				WHERE ia.su_id IS NOT NULL
+				WHERE EXISTS (
+					SELECT 1 FROM info_approval ia
+					JOIN info_project_item_detail ipd ON ipd.ipid_id = ia.ipid_id
+					WHERE ia.ipid_id = x.ipid_id AND ia.ia_status = 'waiting' AND (ia.su_id = ? OR (ia.ia_is_action = 1 AND EXISTS (
+						SELECT 1 FROM sys_delegation dl
+						WHERE dl.su_id = ia.su_id AND dl.sdl_delegate_su_id = ? AND `+delegationActiveSQL+`
+						AND (dl.sd_id IS NULL OR dl.sd_id = ipd.sd_id)
+					)))
+				)
 				ORDER BY
 					x.item_type ASC,
 					x.start_date ASC,
-					x.item_name ASC`, ipID, sentIpidIDs, ipID, sentIpidIDs, approverSuID)
+					x.item_name ASC`, ipID, sentIpidIDs, ipID, sentIpidIDs, approverSuID, approverSuID)
 
 			if err != nil {
 				continue
 			}
-			q = db.Rebind(q)
+			q = tx.Rebind(q)
 
 			var list []MailData
-			if err := db.Select(&list, q, args...); err != nil || len(list) == 0 {
+			if err := tx.Select(&list, q, args...); err != nil || len(list) == 0 {
 				continue
 			}
 
@@ -821,13 +847,13 @@ func InsertProjectTracking(c *fiber.Ctx, db *sqlx.DB) error {
 		for approverSuID, allItems := range approverItems {
 			// Get approver email
 			var suEmail sql.NullString
-			if err := db.Get(&suEmail, `SELECT su_email FROM sys_user WHERE su_id = ? AND su_status = 'active' AND su_email IS NOT NULL AND su_email <> '' LIMIT 1`, approverSuID); err != nil || !suEmail.Valid {
+			if err := tx.Get(&suEmail, `SELECT su_email FROM sys_user WHERE su_id = ? AND su_status = 'active' AND su_email IS NOT NULL AND su_email <> '' LIMIT 1`, approverSuID); err != nil || !suEmail.Valid {
 				continue
 			}
 
 			// Get approver's first and last name
 			var approverFirstName, approverLastName sql.NullString
-			db.QueryRow(`SELECT su_firstname, su_lastname FROM sys_user WHERE su_id = ? LIMIT 1`, approverSuID).Scan(&approverFirstName, &approverLastName)
+			tx.QueryRow(`SELECT su_firstname, su_lastname FROM sys_user WHERE su_id = ? LIMIT 1`, approverSuID).Scan(&approverFirstName, &approverLastName)
 			var approverName string
 			if approverFirstName.Valid && approverLastName.Valid {
 				approverName = approverFirstName.String + " " + approverLastName.String
@@ -844,102 +870,73 @@ func InsertProjectTracking(c *fiber.Ctx, db *sqlx.DB) error {
 				continue
 			}
 
-			// Build HTML body with card layout showing first item's project details
-			var sb strings.Builder
-			var i int
-
-			sb.WriteString("<h3 style='font-family: Arial, sans-serif; color:#1f2d3d;'>Dear, K." + html.EscapeString(approverName) + "</h3>")
-			sb.WriteString("<h4>You have item for <b style='color : #089633;'>Approval</b> in website Project Management</h4>")
-			sb.WriteString("<html><body style='font-family: Arial, sans-serif; background:#f6f8fb; padding:20px;'>")
-
-			// Project Detail Card
-			sb.WriteString("<div style='margin:auto; background:#ffffff; border-radius:10px; border:1px solid #e0e6ed; padding:20px;'>")
-			sb.WriteString("<div style='font-size:18px; font-weight:bold; color:#1f2d3d;'>Project Detail</div>")
-			sb.WriteString("<div style='font-size:12px; color:#6b7280;'>Item Information (ข้อมูลของรายการโปรเจค)</div>")
-
-			sb.WriteString("<hr style='border:none; border-top:1px dashed #d1d5db; margin:15px 0;'>")
-
-			// Project Information 2-Column Layout
-			sb.WriteString("<table width='100%' cellpadding='10' cellspacing='0' style='border-collapse:collapse;'>")
-			sb.WriteString("<tr>")
-
-			sb.WriteString("<td style='width:50%; border:1px solid #e5e7eb; border-radius:8px; padding:12px;'>")
-			sb.WriteString("<div style='font-size:12px; color:#374151;'>PROJECT CODE</div>")
-			sb.WriteString("<div style='font-size:14px; font-weight:bold; color:#2563eb;'>#" + html.EscapeString(getStringValue(allItems[0].ProjectCode)) + "</div>")
-			sb.WriteString("</td>")
-
-			sb.WriteString("<td style='width:50%; border:1px solid #e5e7eb; border-radius:8px; padding:12px;'>")
-			sb.WriteString("<div style='font-size:12px; color:#374151;'>MODEL</div>")
-			sb.WriteString("<div style='font-size:14px; font-weight:bold; color:#2563eb;'>" + html.EscapeString(getStringValue(allItems[0].IpModel)) + "</div>")
-			sb.WriteString("</td>")
-
-			sb.WriteString("</tr>")
-			sb.WriteString("<tr>")
-
-			sb.WriteString("<td style='border:1px solid #e5e7eb; border-radius:8px; padding:12px;'>")
-			sb.WriteString("<div style='font-size:12px; color:#374151;'>PART NO</div>")
-			sb.WriteString("<div style='font-size:14px; font-weight:bold; color:#2563eb;'>" + html.EscapeString(getStringValue(allItems[0].PartNo)) + "</div>")
-			sb.WriteString("</td>")
-
-			sb.WriteString("<td colspan='1' style='border:1px solid #e5e7eb; border-radius:8px; padding:12px;'>")
-			sb.WriteString("<div style='font-size:12px; color:#374151;'>PART NAME</div>")
-			sb.WriteString("<div style='font-size:14px; font-weight:bold; color:#2563eb;'>" + html.EscapeString(getStringValue(allItems[0].PartName)) + "</div>")
-			sb.WriteString("</td>")
-
-			sb.WriteString("</tr>")
-			sb.WriteString("</table>")
-			sb.WriteString("<div style='margin-top:20px; font-size:14px; color:#374151;'>")
-			sb.WriteString("</div>")
-			sb.WriteString("</div><br>")
-
-			// Items Table - show ALL items consolidated
-			sb.WriteString("<table width='100%' cellpadding='10' cellspacing='0' style='border-collapse:collapse; border:1px solid #e5e7eb;'>")
-			sb.WriteString("<thead><tr style='background:#f3f4f6; border-bottom:2px solid #d1d5db;'>")
-			cols := []string{"No.", "Item Name", "Item Type", "Start Date", "End Date"}
-			for _, c := range cols {
-				sb.WriteString("<th style='text-align:left; font-weight:bold; color:#374151; font-size:13px;'>" + html.EscapeString(c) + "</th>")
+			data := mailData{
+				IpID:          ipID,
+				RecipientName: approverName,
+				Stage:         "Leader",
+				Project:       mailProjectOf(allItems[0].ProjectCode, allItems[0].IpModel, allItems[0].PartNo, allItems[0].PartName),
+				ShowDates:     true,
 			}
-			sb.WriteString("</tr></thead><tbody>")
-
 			for _, r := range allItems {
-				var startStr, endStr string
-				if r.StartDate.Valid {
-					startStr = r.StartDate.Time.Format("2006-01-02")
-				}
-				if r.EndDate.Valid {
-					endStr = r.EndDate.Time.Format("2006-01-02")
-				}
-
-				rowBg := ""
-				if i%2 == 0 {
-					rowBg = " style='background:#fbfdff;'"
-				}
-				sb.WriteString("<tr" + rowBg + ">")
-				sb.WriteString("<td style='border-bottom:1px solid #e5e7eb; padding:10px; font-size:13px;'>" + strconv.Itoa(i+1) + "</td>")
-				sb.WriteString("<td style='border-bottom:1px solid #e5e7eb; padding:10px; font-size:13px;'>" + html.EscapeString(getStringValue(r.ItemName)) + "</td>")
-				sb.WriteString("<td style='border-bottom:1px solid #e5e7eb; padding:10px; font-size:13px;'>" + html.EscapeString(getStringValue(r.ItemType)) + "</td>")
-				sb.WriteString("<td style='border-bottom:1px solid #e5e7eb; padding:10px; font-size:13px;'>" + html.EscapeString(startStr) + "</td>")
-				sb.WriteString("<td style='border-bottom:1px solid #e5e7eb; padding:10px; font-size:13px;'>" + html.EscapeString(endStr) + "</td>")
-				sb.WriteString("</tr>")
-				i++
+				data.Items = append(data.Items, mailItem{Name: getStringValue(r.ItemName), Type: getStringValue(r.ItemType), Start: getDateValue(r.StartDate), End: getDateValue(r.EndDate)})
 			}
+			if err := notifyUser(tx, suEmail.String, mailWaitingApproval, data, now); err != nil {
+				return c.Status(500).JSON(fiber.Map{"error": "queue notification failed", "detail": err.Error()})
+			}
+		}
 
-			sb.WriteString("</tbody></table>")
-
-			sb.WriteString("<div style='margin-top:20px;'>")
-			sb.WriteString("<a href='http://192.168.161.205:4005/login' style='display:inline-block; padding:10px 20px; background:#2563eb; color:#fff; text-decoration:none; border-radius:6px; font-weight:bold; font-size:14px;'>Open Project Management</a>")
-			sb.WriteString("</div>")
-
-			sb.WriteString("<div style='margin-top:30px; padding-top:20px; border-top:1px solid #e5e7eb; font-size:13px; color:#6b7280;'>")
-			sb.WriteString("<p>Best Regards,<br><strong>System Service Department</strong></p>")
-			sb.WriteString("</div>")
+		// Post the approval request to the channel of each department of the sent items
+		var deptItems []struct {
+			SdID int64 `db:"sd_id"`
+			MailData
+		}
+		q, args, err = sqlx.In(`SELECT pid.sd_id, ip.ip_code, ip.ip_part_name, ip.ip_part_no, ip.ip_model,
+				COALESCE(ai.iai_name, pi.ipi_name) AS item_name, pid.ipid_type AS item_type,
+				pid.ipid_start_date AS start_date, pid.ipid_end_date AS end_date
+			FROM info_project_item_detail pid
+			LEFT JOIN info_apqp_item ai ON ai.iai_id = pid.ref_id AND pid.ipid_type = 'apqp'
+			LEFT JOIN info_ppap_item pi ON pi.ipi_id = pid.ref_id AND pid.ipid_type = 'ppap'
+			LEFT JOIN info_project ip ON ip.ip_id = COALESCE(ai.ip_id, pi.ip_id)
+			WHERE pid.ipid_id IN (?) AND pid.sd_id IS NOT NULL
+			ORDER BY pid.sd_id, pid.ipid_id`, sentIpidIDs)
+		if err == nil {
+			err = tx.Select(&deptItems, tx.Rebind(q), args...)
+		}
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "queue notification failed", "detail": err.Error()})
+		}
+		for i := 0; i < len(deptItems); {
+			first := deptItems[i]
+			data := mailData{
+				IpID:      ipID,
+				Stage:     "Leader",
+				Project:   mailProjectOf(first.ProjectCode, first.IpModel, first.PartNo, first.PartName),
+				ShowDates: true,
+			}
+			for ; i < len(deptItems) && deptItems[i].SdID == first.SdID; i++ {
+				r := deptItems[i]
+				data.Items = append(data.Items, mailItem{Name: getStringValue(r.ItemName), Type: getStringValue(r.ItemType), Start: getDateValue(r.StartDate), End: getDateValue(r.EndDate)})
+			}
+			if err := notifyDepartment(tx, first.SdID, mailWaitingApproval, data, now); err != nil {
+				return c.Status(500).JSON(fiber.Map{"error": "queue notification failed", "detail": err.Error()})
+			}
+		}
+	}
 
-			sb.WriteString("</body></html>")
+	if err := tx.Commit(); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "commit error", "detail": err.Error()})
+	}
+	committed = true
+	if err := placeStagedUploads(staged); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "could not move uploaded file", "detail": err.Error()})
+	}
 
-			subject := "TBKK Project Control Notification : waiting Leader Approval"
-			body := sb.String()
-			_ = SendMail([]string{suEmail.String}, subject, body, "text/html; charset=utf-8")
+	if len(items) > 0 {
+		uploaded := make([]int64, 0, len(items))
+		for _, it := range items {
+			uploaded = append(uploaded, it.IpidID)
 		}
+		publishItemEvents(db, streamFileUploaded, uploaded, items[0].CreatedBy)
 	}
 
 	// done
@@ -948,3 +945,36 @@ func InsertProjectTracking(c *fiber.Ctx, db *sqlx.DB) error {
 	}
 	return c.Status(201).JSON(fiber.Map{"status": "ok", "inserted": len(items)})
 }
+
+// stagedUpload is an uploaded file saved under Temp until its rows are committed.
+// History is where the file currently at Final is archived ("" when there is none).
+type stagedUpload struct {
+	Temp    string
+	Final   string
+	History string
+}
+
+// placeStagedUploads archives the previous versions and moves the new files into place
+func placeStagedUploads(staged []stagedUpload) error {
+	for _, up := range staged {
+		if up.History != "" {
+			if err := os.MkdirAll(filepath.Dir(up.History), 0755); err != nil {
+				return err
+			}
+			if err := os.Rename(up.Final, up.History); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+		if err := os.Rename(up.Temp, up.Final); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// discardStagedUploads removes the temporary files of an upload that was not committed
+func discardStagedUploads(staged []stagedUpload) {
+	for _, up := range staged {
+		_ = os.Remove(up.Temp)
+	}
+}
@@ -0,0 +1,48 @@
+package handlers
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestStagedUploads(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, body string) string {
+		p := filepath.Join(dir, name)
+		if err := os.WriteFile(p, []byte(body), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+	read := func(p string) string {
+		b, err := os.ReadFile(p)
+		if err != nil {
+			return ""
+		}
+		return string(b)
+	}
+
+	// a rolled back upload leaves the current file alone
+	final := write("pfmea.xlsx", "v1")
+	up := stagedUpload{Temp: write(".1_0_pfmea.xlsx.upload", "v2"), Final: final, History: filepath.Join(dir, "_history", "1_pfmea.xlsx")}
+	discardStagedUploads([]stagedUpload{up})
+	if got := read(final); got != "v1" {
+		t.Errorf("after discard final = %q, want v1", got)
+	}
+	if _, err := os.Stat(up.Temp); !os.IsNotExist(err) {
+		t.Errorf("temp file still exists after discard: %v", err)
+	}
+
+	// a committed upload archives the previous version and takes its place
+	up.Temp = write(".1_0_pfmea.xlsx.upload", "v2")
+	if err := placeStagedUploads([]stagedUpload{up}); err != nil {
+		t.Fatal(err)
+	}
+	if got := read(final); got != "v2" {
+		t.Errorf("after place final = %q, want v2", got)
+	}
+	if got := read(up.History); got != "v1" {
+		t.Errorf("after place history = %q, want v1", got)
+	}
+}
@@ -0,0 +1,421 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"apiTrackingSystem/internal/utils"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jmoiron/sqlx"
+)
+
+// recordItemGroupActual keeps the actual dates of the item group (ref_id + ipid_type) of ipidID:
+// an upload ("waiting") starts it, done finishes it, any other status clears the finish.
+// Call it with the status UPDATE of the group.
+func recordItemGroupActual(q sqlx.Execer, ipidID int64, status string, now time.Time) error {
+	set := `ipid_actual_end_date = NULL`
+	args := []interface{}{}
+	switch status {
+	case "waiting":
+		set = `ipid_actual_start_date = COALESCE(ipid_actual_start_date, ?), ipid_actual_end_date = NULL`
+		args = append(args, now)
+	case statusDone:
+		set = `ipid_actual_start_date = COALESCE(ipid_actual_start_date, ?), ipid_actual_end_date = ?`
+		args = append(args, now, now)
+	}
+	args = append(args, ipidID)
+	_, err := q.Exec(`UPDATE info_project_item_detail SET `+set+` WHERE (ref_id, ipid_type) IN (SELECT ref_id, ipid_type FROM (SELECT ref_id, ipid_type FROM info_project_item_detail WHERE ipid_id = ?) AS sq)`, args...)
+	return err
+}
+
+// InfoProjectBaseline is a frozen copy of a project schedule
+type InfoProjectBaseline struct {
+	IpbID     int64            `db:"ipb_id" json:"ipb_id"`
+	IpID      int64            `db:"ip_id" json:"ip_id"`
+	No        int              `db:"ipb_no" json:"ipb_no"`
+	Name      utils.NullString `db:"ipb_name" json:"ipb_name"`
+	Note      utils.NullString `db:"ipb_note" json:"ipb_note"`
+	Plans     int              `db:"plans" json:"plans"`
+	Items     int              `db:"items" json:"items"`
+	CreatedAt time.Time        `db:"ipb_created_at" json:"ipb_created_at"`
+	CreatedBy utils.NullString `db:"ipb_created_by" json:"ipb_created_by"`
+}
+
+// baselineEntityEvent marks the customer events of a baseline (ref ip_id, matched on the event name)
+const baselineEntityEvent = "event"
+
+// planDatesSelect reads the dates of plan rows; a row without a date range is the one day of ipmp_date
+const planDatesSelect = `COALESCE(ipmp_start_date, ipmp_end_date, ipmp_date) AS ipmp_start_date, COALESCE(ipmp_end_date, ipmp_start_date, ipmp_date) AS ipmp_end_date`
+
+const baselineSelect = `SELECT b.ipb_id, b.ip_id, b.ipb_no, b.ipb_name, b.ipb_note, b.ipb_created_at, b.ipb_created_by,
+		(SELECT COUNT(*) FROM info_project_baseline_row r WHERE r.ipb_id = b.ipb_id AND r.ipbr_entity = 'plan') AS plans,
+		(SELECT COUNT(*) FROM info_project_baseline_row r WHERE r.ipb_id = b.ipb_id AND r.ipbr_entity = 'item') AS items
+	FROM info_project_baseline b`
+
+// ListProjectBaseline lists the baselines of a project, newest first (?ip_id=)
+func ListProjectBaseline(c *fiber.Ctx, db *sqlx.DB) error {
+	ipID, err := strconv.ParseInt(c.Query("ip_id"), 10, 64)
+	if err != nil || ipID <= 0 {
+		return c.Status(400).JSON(fiber.Map{"error": "ip_id is required"})
+	}
+	res := []InfoProjectBaseline{}
+	if err := db.Select(&res, baselineSelect+` WHERE b.ip_id = ? ORDER BY b.ipb_no DESC`, ipID); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "query error", "detail": err.Error()})
+	}
+	return c.Status(200).JSON(res)
+}
+
+// SaveProjectBaseline freezes the current plan rows and item dates of a project as its new baseline.
+// Body: { "ip_id", "ipb_name", "ipb_note", "ipb_created_by" }
+func SaveProjectBaseline(c *fiber.Ctx, db *sqlx.DB) error {
+	var body struct {
+		IpID      int64  `json:"ip_id"`
+		Name      string `json:"ipb_name"`
+		Note      string `json:"ipb_note"`
+		CreatedBy string `json:"ipb_created_by"`
+	}
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid request", "detail": err.Error()})
+	}
+	if body.IpID <= 0 {
+		return c.Status(400).JSON(fiber.Map{"error": "ip_id is required"})
+	}
+
+	tx, err := db.Beginx()
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "begin tx failed", "detail": err.Error()})
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	// lock the project so two baselines do not get the same number
+	var exists int
+	if err := tx.Get(&exists, `SELECT 1 FROM info_project WHERE ip_id = ? FOR UPDATE`, body.IpID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return c.Status(404).JSON(fiber.Map{"error": "project not found"})
+		}
+		return c.Status(500).JSON(fiber.Map{"error": "query error", "detail": err.Error()})
+	}
+	var no int
+	if err := tx.Get(&no, `SELECT COALESCE(MAX(ipb_no), 0) + 1 FROM info_project_baseline WHERE ip_id = ?`, body.IpID); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "query error", "detail": err.Error()})
+	}
+	name := strings.TrimSpace(body.Name)
+	if name == "" {
+		name = "Baseline " + strconv.Itoa(no)
+	}
+	now := time.Now()
+	res, err := tx.Exec(`INSERT INTO info_project_baseline (ip_id, ipb_no, ipb_name, ipb_note, ipb_created_at, ipb_created_by) VALUES (?, ?, ?, ?, ?, ?)`,
+		body.IpID, no, name, utils.NewNullString(strings.TrimSpace(body.Note)), now, body.CreatedBy)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "insert baseline failed", "detail": err.Error()})
+	}
+	ipbID, _ := res.LastInsertId()
+
+	if _, err := tx.Exec(`INSERT INTO info_project_baseline_row (ipb_id, ipbr_entity, ipbr_ref_id, ipbr_name, ipbr_start_date, ipbr_end_date)
+		SELECT ?, ?, ipmp_id, ipmp_name, `+planDatesSelect+` FROM info_project_master_plan WHERE ip_id = ?`,
+		ipbID, statusEntityPlan, body.IpID); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "copy plan failed", "detail": err.Error()})
+	}
+	if _, err := tx.Exec(`INSERT INTO info_project_baseline_row (ipb_id, ipbr_entity, ipbr_ref_id, ipbr_name, ipbr_start_date, ipbr_end_date)
+		SELECT ?, ?, pid.ipid_id, COALESCE(ai.iai_name, pi.ipi_name), pid.ipid_start_date, pid.ipid_end_date
+		FROM info_project_item_detail pid
+		LEFT JOIN info_apqp_item ai ON ai.iai_id = pid.ref_id AND pid.ipid_type = 'apqp'
+		LEFT JOIN info_ppap_item pi ON pi.ipi_id = pid.ref_id AND pid.ipid_type = 'ppap'
+		WHERE COALESCE(ai.ip_id, pi.ip_id) = ?`,
+		ipbID, statusEntityItem, body.IpID); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "copy items failed", "detail": err.Error()})
+	}
+	if _, err := tx.Exec(`INSERT INTO info_project_baseline_row (ipb_id, ipbr_entity, ipbr_ref_id, ipbr_name, ipbr_start_date, ipbr_end_date)
+		SELECT ?, ?, ?, x.`+"`name`"+`, x.`+"`start`"+`, COALESCE(x.`+"`end`"+`, x.`+"`start`"+`)
+		FROM (`+customerEventsSelect+`) x WHERE x.`+"`start`"+` IS NOT NULL`,
+		ipbID, baselineEntityEvent, body.IpID, body.IpID, body.IpID, body.IpID, body.IpID, body.IpID, body.IpID); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "copy customer events failed", "detail": err.Error()})
+	}
+
+	var out InfoProjectBaseline
+	if err := tx.Get(&out, baselineSelect+` WHERE b.ipb_id = ?`, ipbID); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "query error", "detail": err.Error()})
+	}
+	if err := tx.Commit(); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "commit failed", "detail": err.Error()})
+	}
+	return c.Status(201).JSON(out)
+}
+
+// scheduleVariance is the difference in working days to the baseline (positive = later)
+type scheduleVariance struct {
+	StartPlan    *int `json:"start_plan"`
+	FinishPlan   *int `json:"finish_plan"`
+	StartActual  *int `json:"start_actual"`
+	FinishActual *int `json:"finish_actual"`
+}
+
+// varianceRow is one plan row or item with its baseline, current plan and actual dates
+type varianceRow struct {
+	Entity        string           `json:"entity"` // plan or item
+	RefID         int64            `json:"ref_id"` // ipmp_id / ipid_id
+	Name          string           `json:"name"`
+	ItemType      utils.NullString `json:"ipid_type"`
+	LineCode      utils.NullString `json:"ipid_line_code"`
+	Status        utils.NullString `json:"status"`
+	BaselineStart *Date            `json:"baseline_start_date"`
+	BaselineEnd   *Date            `json:"baseline_end_date"`
+	PlanStart     *Date            `json:"plan_start_date"`
+	PlanEnd       *Date            `json:"plan_end_date"`
+	ActualStart   *Date            `json:"actual_start_date"`
+	ActualEnd     *Date            `json:"actual_end_date"`
+	Variance      scheduleVariance `json:"variance"`
+	InBaseline    bool             `json:"in_baseline"`
+	Removed       bool             `json:"removed"` // in the baseline, no longer in the plan
+}
+
+// workingDayDiff is the working days from base to d (nil when either is missing)
+func workingDayDiff(cal *workCalendar, base, d *Date) *int {
+	if base == nil || base.IsZero() || d == nil || d.IsZero() {
+		return nil
+	}
+	n := cal.WorkingDaysBetween(base.Time, d.Time)
+	return &n
+}
+
+// baselineRow is a plan row or item as frozen in a baseline
+type baselineRow struct {
+	Entity string           `db:"ipbr_entity"`
+	RefID  int64            `db:"ipbr_ref_id"`
+	Name   utils.NullString `db:"ipbr_name"`
+	Start  *Date            `db:"ipbr_start_date"`
+	End    *Date            `db:"ipbr_end_date"`
+}
+
+// baselineEvents returns the customer events of a baseline (ipbID, default the latest) by name
+func baselineEvents(q sqlx.Queryer, ipID int64, ipbID string) (map[string]baselineRow, error) {
+	query, args := `SELECT r.ipbr_entity, r.ipbr_ref_id, r.ipbr_name, r.ipbr_start_date, r.ipbr_end_date
+		FROM info_project_baseline_row r
+		WHERE r.ipbr_entity = ? AND r.ipb_id = (SELECT b.ipb_id FROM info_project_baseline b WHERE b.ip_id = ? ORDER BY b.ipb_no DESC LIMIT 1)`, []interface{}{baselineEntityEvent, ipID}
+	if id, err := strconv.ParseInt(ipbID, 10, 64); err == nil && id > 0 {
+		query, args = `SELECT r.ipbr_entity, r.ipbr_ref_id, r.ipbr_name, r.ipbr_start_date, r.ipbr_end_date
+		FROM info_project_baseline_row r JOIN info_project_baseline b ON b.ipb_id = r.ipb_id
+		WHERE r.ipbr_entity = ? AND b.ip_id = ? AND b.ipb_id = ?`, []interface{}{baselineEntityEvent, ipID, id}
+	}
+	var rows []baselineRow
+	if err := sqlx.Select(q, &rows, query, args...); err != nil {
+		return nil, err
+	}
+	byName := make(map[string]baselineRow, len(rows))
+	for _, r := range rows {
+		byName[r.Name.StringValue()] = r
+	}
+	return byName, nil
+}
+
+// matchBaseline sets the baseline dates and the variance of the rows found in the baseline and
+// appends the baseline rows no longer in the plan as removed. Plan rows are matched on ipmp_id,
+// then on the name (a replaced plan gets new ids); a baseline row is matched once.
+func matchBaseline(cal *workCalendar, rows []varianceRow, base []baselineRow) []varianceRow {
+	baseByRef := map[string]int{}
+	basePlanByName := map[string]int{}
+	for i, r := range base {
+		baseByRef[r.Entity+":"+strconv.FormatInt(r.RefID, 10)] = i
+		if r.Entity == statusEntityPlan {
+			basePlanByName[strings.TrimSpace(r.Name.StringValue())] = i
+		}
+	}
+	used := map[int]bool{}
+	for k := range rows {
+		row := &rows[k]
+		i, ok := baseByRef[row.Entity+":"+strconv.FormatInt(row.RefID, 10)]
+		if !ok && row.Entity == statusEntityPlan {
+			i, ok = basePlanByName[strings.TrimSpace(row.Name)]
+		}
+		if !ok || used[i] {
+			continue
+		}
+		used[i] = true
+		row.InBaseline = true
+		row.BaselineStart, row.BaselineEnd = base[i].Start, base[i].End
+		row.Variance = scheduleVariance{
+			StartPlan:    workingDayDiff(cal, row.BaselineStart, row.PlanStart),
+			FinishPlan:   workingDayDiff(cal, row.BaselineEnd, row.PlanEnd),
+			StartActual:  workingDayDiff(cal, row.BaselineStart, row.ActualStart),
+			FinishActual: workingDayDiff(cal, row.BaselineEnd, row.ActualEnd),
+		}
+	}
+	for i, r := range base {
+		if used[i] {
+			continue
+		}
+		rows = append(rows, varianceRow{Entity: r.Entity, RefID: r.RefID, Name: r.Name.StringValue(),
+			BaselineStart: r.Start, BaselineEnd: r.End, InBaseline: true, Removed: true})
+	}
+	return rows
+}
+
+// GetScheduleVariance returns the plan rows and items of a project with their baseline, current plan
+// and actual dates side by side, and the variance in working days of the project calendar.
+// Query: ip_id, ipb_id (default the latest baseline).
+func GetScheduleVariance(c *fiber.Ctx, db *sqlx.DB) error {
+	ipID, err := strconv.ParseInt(c.Query("ip_id"), 10, 64)
+	if err != nil || ipID <= 0 {
+		return c.Status(400).JSON(fiber.Map{"error": "ip_id is required"})
+	}
+
+	var baseline *InfoProjectBaseline
+	var b InfoProjectBaseline
+	query, args := baselineSelect+` WHERE b.ip_id = ? ORDER BY b.ipb_no DESC LIMIT 1`, []interface{}{ipID}
+	if id, err := strconv.ParseInt(c.Query("ipb_id"), 10, 64); err == nil && id > 0 {
+		query, args = baselineSelect+` WHERE b.ip_id = ? AND b.ipb_id = ?`, []interface{}{ipID, id}
+	}
+	switch err := db.Get(&b, query, args...); {
+	case err == nil:
+		baseline = &b
+	case errors.Is(err, sql.ErrNoRows):
+		if c.Query("ipb_id") != "" {
+			return c.Status(404).JSON(fiber.Map{"error": "baseline not found"})
+		}
+	default:
+		return c.Status(500).JSON(fiber.Map{"error": "query error", "detail": err.Error()})
+	}
+
+	cal, err := projectCalendar(db, ipID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "query calendar failed", "detail": err.Error()})
+	}
+
+	var plans []struct {
+		ID     int64            `db:"ipmp_id"`
+		Name   utils.NullString `db:"ipmp_name"`
+		Status utils.NullString `db:"ipmp_status"`
+		Start  *Date            `db:"ipmp_start_date"`
+		End    *Date            `db:"ipmp_end_date"`
+	}
+	if err := db.Select(&plans, `SELECT ipmp_id, ipmp_name, ipmp_status, `+planDatesSelect+`
+		FROM info_project_master_plan WHERE ip_id = ?
+		ORDER BY ipmp_start_date IS NULL, ipmp_start_date, ipmp_id`, ipID); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "query error", "detail": err.Error()})
+	}
+
+	var items []struct {
+		ID       int64            `db:"ipid_id"`
+		Name     utils.NullString `db:"item_name"`
+		Type     utils.NullString `db:"ipid_type"`
+		LineCode utils.NullString `db:"ipid_line_code"`
+		Status   utils.NullString `db:"ipid_status"`
+		Start    *Date            `db:"ipid_start_date"`
+		End      *Date            `db:"ipid_end_date"`
+		ActStart *Date            `db:"ipid_actual_start_date"`
+		ActEnd   *Date            `db:"ipid_actual_end_date"`
+	}
+	if err := db.Select(&items, `SELECT pid.ipid_id, COALESCE(ai.iai_name, pi.ipi_name) AS item_name, pid.ipid_type, pid.ipid_line_code, pid.ipid_status,
+			pid.ipid_start_date, pid.ipid_end_date, pid.ipid_actual_start_date, pid.ipid_actual_end_date
+		FROM info_project_item_detail pid
+		LEFT JOIN info_apqp_item ai ON ai.iai_id = pid.ref_id AND pid.ipid_type = 'apqp'
+		LEFT JOIN info_ppap_item pi ON pi.ipi_id = pid.ref_id AND pid.ipid_type = 'ppap'
+		WHERE COALESCE(ai.ip_id, pi.ip_id) = ?
+		ORDER BY pid.ipid_type, pid.ipid_start_date IS NULL, pid.ipid_start_date, pid.ipid_id`, ipID); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "query error", "detail": err.Error()})
+	}
+
+	// actual dates of a plan row from its APQP items (the roll-up mapping); it is finished when every item is
+	links, err := planItemLinks(db, ipID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "query error", "detail": err.Error()})
+	}
+	itemIndex := make(map[int64]int, len(items))
+	for i, it := range items {
+		itemIndex[it.ID] = i
+	}
+	type planActual struct {
+		Start, End *Date
+		Open       bool
+	}
+	actualByPlan := map[int64]*planActual{}
+	for _, l := range links {
+		i, ok := itemIndex[l.IpidID]
+		if !ok {
+			continue
+		}
+		it := items[i]
+		a := actualByPlan[l.IpmpID]
+		if a == nil {
+			a = &planActual{}
+			actualByPlan[l.IpmpID] = a
+		}
+		if it.ActStart != nil && !it.ActStart.IsZero() && (a.Start == nil || it.ActStart.Before(a.Start.Time)) {
+			a.Start = it.ActStart
+		}
+		if it.ActEnd == nil || it.ActEnd.IsZero() {
+			a.Open = true
+		} else if a.End == nil || it.ActEnd.After(a.End.Time) {
+			a.End = it.ActEnd
+		}
+	}
+
+	var base []baselineRow
+	if baseline != nil {
+		if err := db.Select(&base, `SELECT ipbr_entity, ipbr_ref_id, ipbr_name, ipbr_start_date, ipbr_end_date
+			FROM info_project_baseline_row WHERE ipb_id = ? AND ipbr_entity IN (?, ?) ORDER BY ipbr_id`, baseline.IpbID, statusEntityPlan, statusEntityItem); err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "query error", "detail": err.Error()})
+		}
+	}
+	rows := []varianceRow{}
+	for _, p := range plans {
+		row := varianceRow{Entity: statusEntityPlan, RefID: p.ID, Name: p.Name.StringValue(), Status: p.Status, PlanStart: p.Start, PlanEnd: p.End}
+		if a, ok := actualByPlan[p.ID]; ok {
+			row.ActualStart = a.Start
+			if !a.Open {
+				row.ActualEnd = a.End
+			}
+		}
+		rows = append(rows, row)
+	}
+	for _, it := range items {
+		row := varianceRow{Entity: statusEntityItem, RefID: it.ID, Name: it.Name.StringValue(), ItemType: it.Type, LineCode: it.LineCode, Status: it.Status,
+			PlanStart: it.Start, PlanEnd: it.End, ActualStart: it.ActStart, ActualEnd: it.ActEnd}
+		rows = append(rows, row)
+	}
+	rows = matchBaseline(cal, rows, base)
+
+	// late: finishes (actual, else planned) after the baseline
+	late, worst := 0, 0
+	var baseFinish, planFinish *Date
+	for _, r := range rows {
+		if r.Removed {
+			continue
+		}
+		v := r.Variance.FinishActual
+		if v == nil {
+			v = r.Variance.FinishPlan
+		}
+		if v != nil && *v > 0 {
+			late++
+			if *v > worst {
+				worst = *v
+			}
+		}
+		if r.Entity == statusEntityPlan {
+			if r.BaselineEnd != nil && !r.BaselineEnd.IsZero() && (baseFinish == nil || r.BaselineEnd.After(baseFinish.Time)) {
+				baseFinish = r.BaselineEnd
+			}
+			if r.PlanEnd != nil && !r.PlanEnd.IsZero() && (planFinish == nil || r.PlanEnd.After(planFinish.Time)) {
+				planFinish = r.PlanEnd
+			}
+		}
+	}
+
+	return c.Status(200).JSON(fiber.Map{
+		"ip_id":    ipID,
+		"baseline": baseline,
+		"rows":     rows,
+		"summary": fiber.Map{
+			"late":                    late,
+			"max_finish_variance":     worst,
+			"baseline_finish_date":    baseFinish,
+			"plan_finish_date":        planFinish,
+			"project_finish_variance": workingDayDiff(cal, baseFinish, planFinish),
+		},
+	})
+}
@@ -0,0 +1,127 @@
+package handlers
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"apiTrackingSystem/internal/utils"
+)
+
+func TestRecordItemGroupActual(t *testing.T) {
+	now := time.Date(2026, 4, 8, 10, 30, 0, 0, time.Local)
+	tests := []struct {
+		status string
+		set    string
+		args   []interface{}
+	}{
+		// the first upload starts the item, a re-upload keeps the start and reopens it
+		{"waiting", "ipid_actual_start_date = COALESCE(ipid_actual_start_date, ?), ipid_actual_end_date = NULL", []interface{}{now, int64(7)}},
+		// the final approval finishes it (and starts it when no upload was recorded)
+		{statusDone, "ipid_actual_start_date = COALESCE(ipid_actual_start_date, ?), ipid_actual_end_date = ?", []interface{}{now, now, int64(7)}},
+		// leaving done (reject, manual inprogress, delay) clears the finish only
+		{"reject", "SET ipid_actual_end_date = NULL WHERE", []interface{}{int64(7)}},
+		{statusInprogress, "SET ipid_actual_end_date = NULL WHERE", []interface{}{int64(7)}},
+	}
+	for _, tt := range tests {
+		rec := &execRecorder{}
+		if err := recordItemGroupActual(rec, 7, tt.status, now); err != nil {
+			t.Fatalf("%s: %v", tt.status, err)
+		}
+		if len(rec.queries) != 1 {
+			t.Fatalf("%s: %d statements, want 1", tt.status, len(rec.queries))
+		}
+		if !strings.Contains(rec.queries[0], tt.set) {
+			t.Errorf("%s: query %q does not contain %q", tt.status, rec.queries[0], tt.set)
+		}
+		if len(rec.args[0]) != len(tt.args) {
+			t.Errorf("%s: args = %v, want %v", tt.status, rec.args[0], tt.args)
+			continue
+		}
+		for i := range tt.args {
+			if rec.args[0][i] != tt.args[i] {
+				t.Errorf("%s: arg %d = %v, want %v", tt.status, i, rec.args[0][i], tt.args[i])
+			}
+		}
+	}
+}
+
+func TestWorkingDayDiff(t *testing.T) {
+	cal := songkranCalendar()
+	date := func(s string) *Date { return &Date{Time: day(s)} }
+	tests := []struct {
+		name    string
+		base, d *Date
+		want    *int
+	}{
+		{"later", date("2026-04-10"), date("2026-04-16"), intPtr(1)}, // over the weekend and Songkran
+		{"earlier", date("2026-04-10"), date("2026-04-06"), intPtr(-4)},
+		{"on time", date("2026-04-10"), date("2026-04-10"), intPtr(0)},
+		{"no baseline", nil, date("2026-04-10"), nil},
+		{"no date", date("2026-04-10"), &Date{}, nil},
+	}
+	for _, tt := range tests {
+		got := workingDayDiff(cal, tt.base, tt.d)
+		switch {
+		case got == nil && tt.want == nil:
+		case got == nil || tt.want == nil || *got != *tt.want:
+			t.Errorf("%s: got %v, want %v", tt.name, fmtIntPtr(got), fmtIntPtr(tt.want))
+		}
+	}
+}
+
+func TestMatchBaseline(t *testing.T) {
+	cal := testCalendar()
+	date := func(s string) *Date { return &Date{Time: day(s)} }
+	rows := []varianceRow{
+		{Entity: statusEntityPlan, RefID: 1, Name: "Kick Off", PlanStart: date("2026-04-06"), PlanEnd: date("2026-04-08")},
+		{Entity: statusEntityPlan, RefID: 9, Name: "Mold PO", PlanStart: date("2026-04-13"), PlanEnd: date("2026-04-17")}, // plan replaced: new id
+		{Entity: statusEntityPlan, RefID: 10, Name: "New Row"},
+		{Entity: statusEntityItem, RefID: 1, Name: "DFMEA", PlanEnd: date("2026-04-10"), ActualStart: date("2026-04-07"), ActualEnd: date("2026-04-09")},
+	}
+	base := []baselineRow{
+		{Entity: statusEntityPlan, RefID: 1, Name: utils.NewNullString("Kick Off"), Start: date("2026-04-06"), End: date("2026-04-07")},
+		{Entity: statusEntityPlan, RefID: 2, Name: utils.NewNullString("Mold PO"), Start: date("2026-04-13"), End: date("2026-04-17")},
+		{Entity: statusEntityItem, RefID: 1, Name: utils.NewNullString("DFMEA"), Start: date("2026-04-06"), End: date("2026-04-10")},
+		{Entity: statusEntityItem, RefID: 5, Name: utils.NewNullString("PFMEA"), End: date("2026-04-10")},
+	}
+	got := matchBaseline(cal, rows, base)
+	if len(got) != 5 {
+		t.Fatalf("%d rows, want 4 current + 1 removed", len(got))
+	}
+
+	if !got[0].InBaseline || *got[0].Variance.FinishPlan != 1 || *got[0].Variance.StartPlan != 0 {
+		t.Errorf("matched on id: %+v", got[0].Variance)
+	}
+	if !got[1].InBaseline || got[1].BaselineEnd != base[1].End || *got[1].Variance.FinishPlan != 0 {
+		t.Errorf("plan row matched on the name: in_baseline=%v variance=%+v", got[1].InBaseline, got[1].Variance)
+	}
+	if got[2].InBaseline || got[2].Variance.FinishPlan != nil {
+		t.Errorf("new row: in_baseline=%v", got[2].InBaseline)
+	}
+	if !got[3].InBaseline || *got[3].Variance.StartActual != 1 || *got[3].Variance.FinishActual != -1 {
+		t.Errorf("item actual variance: %+v", got[3].Variance)
+	}
+	if r := got[4]; r.Entity != statusEntityItem || r.RefID != 5 || !r.Removed || !r.InBaseline {
+		t.Errorf("removed row: %+v", r)
+	}
+
+	// an item is not matched on the name, and a baseline row is used once
+	got = matchBaseline(cal, []varianceRow{
+		{Entity: statusEntityItem, RefID: 2, Name: "DFMEA"},
+		{Entity: statusEntityPlan, RefID: 1, Name: "Kick Off"},
+		{Entity: statusEntityPlan, RefID: 3, Name: "Kick Off"},
+	}, base[:3])
+	if got[0].InBaseline || !got[1].InBaseline || got[2].InBaseline {
+		t.Errorf("in_baseline = %v, %v, %v; want false, true, false", got[0].InBaseline, got[1].InBaseline, got[2].InBaseline)
+	}
+}
+
+func intPtr(n int) *int { return &n }
+
+func fmtIntPtr(p *int) interface{} {
+	if p == nil {
+		return nil
+	}
+	return *p
+}
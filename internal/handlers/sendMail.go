@@ -2,17 +2,17 @@ package handlers
 
 import (
 	"bytes"
-	"crypto/tls"
 	"database/sql"
-	"encoding/base64"
+	"errors"
 	"fmt"
 	"log"
-	"net"
-	"net/smtp"
 	"os"
 	"regexp"
 	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"apiTrackingSystem/internal/utils"
 
@@ -36,90 +36,90 @@ type MailData struct {
 	OwnerSuIDs    sql.NullString `db:"owner_su_ids"`
 	OwnerNames    sql.NullString `db:"owner_names"`
 	OwnerEmpCodes sql.NullString `db:"owner_emp_codes"`
+	SdIDs         sql.NullString `db:"sd_ids"`
+	IpID          int64          `db:"ip_id"`
+	TemplateName  sql.NullString `db:"mt_name"`
 }
 
-func SendMail(to []string, subject, body, contentType string) error {
-	_ = godotenv.Load(".env")
-	host := strings.TrimSpace(os.Getenv("SMTP_HOST"))
-	port := strings.TrimSpace(os.Getenv("SMTP_PORT"))
-	user := strings.TrimSpace(os.Getenv("SMTP_USER"))
-	pass := os.Getenv("SMTP_PASS")
-	from := strings.TrimSpace(os.Getenv("SMTP_FROM"))
-
-	if from == "" {
-		from = user
-	}
-	if contentType == "" {
-		contentType = "text/plain; charset=utf-8"
-	}
-
-	if host == "" || port == "" || user == "" || pass == "" {
-		return fmt.Errorf("smtp configuration incomplete: host=%q port=%q user=%q from=%q", host, port, user, from)
-	}
-
-	addr := host + ":" + port
-	hdr := make(map[string]string)
-	hdr["From"] = from
-	hdr["To"] = strings.Join(to, ", ")
-	hdr["Subject"] = subject
-	hdr["MIME-Version"] = "1.0"
-	hdr["Content-Type"] = contentType
-
-	var msg strings.Builder
-	for k, v := range hdr {
-		msg.WriteString(k + ": " + v + "\r\n")
-	}
-	msg.WriteString("\r\n")
-	msg.WriteString(body)
-
-	// Dial and create client so we can STARTTLS before AUTH
-	conn, err := net.Dial("tcp", addr)
-	if err != nil {
-		return fmt.Errorf("failed to dial smtp server: %w", err)
-	}
-	client, err := smtp.NewClient(conn, host)
-	if err != nil {
-		return fmt.Errorf("failed to create smtp client: %w", err)
-	}
-	defer client.Close()
+// smtpMailer is the shared SMTP sender; its idle connections are reused between messages
+var (
+	smtpMailer     *utils.Mailer
+	smtpMailerOnce sync.Once
+)
 
-	// STARTTLS if supported
-	if ok, _ := client.Extension("STARTTLS"); ok {
-		tlsCfg := &tls.Config{ServerName: host}
-		if err := client.StartTLS(tlsCfg); err != nil {
-			return fmt.Errorf("starttls failed: %w", err)
+// mailer returns the SMTP sender configured by SMTP_HOST / SMTP_PORT / SMTP_USER / SMTP_PASS,
+// SMTP_DIAL_TIMEOUT, SMTP_TIMEOUT (per message) and SMTP_POOL_SIZE (idle connections kept).
+func mailer() (*utils.Mailer, error) {
+	smtpMailerOnce.Do(func() {
+		_ = godotenv.Load(".env")
+		smtpMailer = &utils.Mailer{
+			Host:        strings.TrimSpace(os.Getenv("SMTP_HOST")),
+			Port:        strings.TrimSpace(os.Getenv("SMTP_PORT")),
+			Username:    strings.TrimSpace(os.Getenv("SMTP_USER")),
+			Password:    os.Getenv("SMTP_PASS"),
+			DialTimeout: envDuration("SMTP_DIAL_TIMEOUT", utils.DefaultMailDialTimeout),
+			IOTimeout:   envDuration("SMTP_TIMEOUT", utils.DefaultMailIOTimeout),
 		}
+		if n, err := strconv.Atoi(strings.TrimSpace(os.Getenv("SMTP_POOL_SIZE"))); err == nil && n > 0 {
+			smtpMailer.PoolSize = n
+		}
+	})
+	m := smtpMailer
+	if m.Host == "" || m.Port == "" || m.Username == "" || m.Password == "" {
+		return nil, fmt.Errorf("smtp configuration incomplete: host=%q port=%q user=%q", m.Host, m.Port, m.Username)
 	}
+	return m, nil
+}
 
-	auth := utils.LoginAuth(user, pass, host)
-	if err := client.Auth(auth); err != nil {
-		return fmt.Errorf("authentication failed: %w", err)
-	}
-
-	if err := client.Mail(from); err != nil {
-		return fmt.Errorf("MAIL FROM failed: %w", err)
-	}
-	for _, rcpt := range to {
-		if err := client.Rcpt(rcpt); err != nil {
-			return fmt.Errorf("RCPT TO %s failed: %w", rcpt, err)
-		}
+// envDuration reads a duration such as "15s" from the environment
+func envDuration(key string, def time.Duration) time.Duration {
+	if d, err := time.ParseDuration(strings.TrimSpace(os.Getenv(key))); err == nil && d > 0 {
+		return d
 	}
+	return def
+}
 
-	w, err := client.Data()
+// sendMailMessage sends through the shared mailer from SMTP_FROM (or SMTP_USER), honouring MAIL_MODE,
+// and writes info_mail_log when db is set.
+// Recipients the server rejects are logged; the send only fails when nobody accepted it.
+func sendMailMessage(db sqlx.Execer, msg utils.MailMessage) (utils.MailResult, error) {
+	if msg.ContentType == "" {
+		msg.ContentType = "text/plain; charset=utf-8"
+	}
+	to := msg.To
+	mode, redirect := mailMode()
+	switch mode {
+	case mailModeCapture:
+		logMail(db, mode, to, msg, utils.MailResult{}, nil)
+		return utils.MailResult{}, nil
+	case mailModeRedirect:
+		msg.To = redirect
+		msg.Subject = "[to: " + strings.Join(to, ", ") + "] " + msg.Subject
+	}
+
+	m, err := mailer()
 	if err != nil {
-		return fmt.Errorf("DATA command failed: %w", err)
+		logMail(db, mode, to, msg, utils.MailResult{}, err)
+		return utils.MailResult{}, err
 	}
-	if _, err := w.Write([]byte(msg.String())); err != nil {
-		return fmt.Errorf("writing message failed: %w", err)
+	if msg.From == "" {
+		msg.From = strings.TrimSpace(os.Getenv("SMTP_FROM"))
 	}
-	if err := w.Close(); err != nil {
-		return fmt.Errorf("closing DATA writer failed: %w", err)
+	res, err := m.Send(msg)
+	logMail(db, mode, to, msg, res, err)
+	for _, r := range res.Rejected {
+		log.Printf("mail %s: recipient rejected: %v", res.MessageID, r)
 	}
-
-	if err := client.Quit(); err != nil {
-		log.Printf("warning: QUIT returned error: %v", err)
+	if errors.Is(err, utils.ErrNoRecipients) && len(res.Rejected) > 0 {
+		return res, fmt.Errorf("%w: %v", err, res.Rejected[0])
 	}
-	return nil
+	return res, err
+}
+
+// SendMail sends one message; db (optional) receives the info_mail_log row
+func SendMail(db sqlx.Execer, to []string, subject, body, contentType string) error {
+	_, err := sendMailMessage(db, utils.MailMessage{To: to, Subject: subject, Body: body, ContentType: contentType})
+	return err
 }
 
 func SendMailTest(c *fiber.Ctx) error {
@@ -130,124 +130,26 @@ func SendMailTest(c *fiber.Ctx) error {
 	subject := "Project Management"
 	body := "<html><body><h1>You have project to approve</h1><p>Please review and approve the project.</p></body></html>"
 
-	if err := SendMail(to, subject, body, "text/html; charset=utf-8"); err != nil {
+	if err := SendMail(nil, to, subject, body, "text/html; charset=utf-8"); err != nil {
 		return c.Status(500).JSON(fiber.Map{"error": "failed to send email", "detail": err.Error()})
 	}
 	return c.Status(200).JSON(fiber.Map{"message": "test email sent successfully"})
 }
 
-// SendMailWithAttachment sends an email with a single attachment (xlsx or other binary).
-func SendMailWithAttachment(to []string, subject, body, contentType, attachmentName string, attachmentData []byte) error {
-	_ = godotenv.Load(".env")
-	host := strings.TrimSpace(os.Getenv("SMTP_HOST"))
-	port := strings.TrimSpace(os.Getenv("SMTP_PORT"))
-	user := strings.TrimSpace(os.Getenv("SMTP_USER"))
-	pass := os.Getenv("SMTP_PASS")
-	from := strings.TrimSpace(os.Getenv("SMTP_FROM"))
-
-	if from == "" {
-		from = user
-	}
-	if contentType == "" {
-		contentType = "text/plain; charset=utf-8"
-	}
-
-	if host == "" || port == "" || user == "" || pass == "" {
-		return fmt.Errorf("smtp configuration incomplete: host=%q port=%q user=%q from=%q", host, port, user, from)
-	}
-
-	addr := host + ":" + port
-
-	// multipart/mixed with boundary
-	boundary := "====BOUNDARY======"
-
-	hdr := make(map[string]string)
-	hdr["From"] = from
-	hdr["To"] = strings.Join(to, ", ")
-	hdr["Subject"] = subject
-	hdr["MIME-Version"] = "1.0"
-	hdr["Content-Type"] = "multipart/mixed; boundary=" + boundary
-
-	var msg strings.Builder
-	for k, v := range hdr {
-		msg.WriteString(k + ": " + v + "\r\n")
-	}
-	msg.WriteString("\r\n")
-
-	// body part
-	msg.WriteString("--" + boundary + "\r\n")
-	msg.WriteString("Content-Type: " + contentType + "\r\n\r\n")
-	msg.WriteString(body)
-	msg.WriteString("\r\n")
-
-	// attachment part (base64)
-	msg.WriteString("--" + boundary + "\r\n")
+// SendMailWithAttachment sends an email with a single attachment (xlsx or other binary); db as in SendMail.
+func SendMailWithAttachment(db sqlx.Execer, to []string, subject, body, contentType, attachmentName string, attachmentData []byte) error {
 	mimeType := "application/octet-stream"
 	if strings.HasSuffix(strings.ToLower(attachmentName), ".xlsx") {
 		mimeType = "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
 	}
-	msg.WriteString("Content-Type: " + mimeType + "; name=\"" + attachmentName + "\"\r\n")
-	msg.WriteString("Content-Transfer-Encoding: base64\r\n")
-	msg.WriteString("Content-Disposition: attachment; filename=\"" + attachmentName + "\"\r\n\r\n")
-
-	enc := base64.StdEncoding.EncodeToString(attachmentData)
-	// wrap lines at 76 chars per RFC
-	for i := 0; i < len(enc); i += 76 {
-		end := i + 76
-		if end > len(enc) {
-			end = len(enc)
-		}
-		msg.WriteString(enc[i:end] + "\r\n")
-	}
-	msg.WriteString("\r\n--" + boundary + "--\r\n")
-
-	// send via SMTP client (so we can STARTTLS + custom auth)
-	conn, err := net.Dial("tcp", addr)
-	if err != nil {
-		return fmt.Errorf("failed to dial smtp server: %w", err)
-	}
-	client, err := smtp.NewClient(conn, host)
-	if err != nil {
-		return fmt.Errorf("failed to create smtp client: %w", err)
-	}
-	defer client.Close()
-
-	if ok, _ := client.Extension("STARTTLS"); ok {
-		tlsCfg := &tls.Config{ServerName: host}
-		if err := client.StartTLS(tlsCfg); err != nil {
-			return fmt.Errorf("starttls failed: %w", err)
-		}
-	}
-
-	auth := utils.LoginAuth(user, pass, host)
-	if err := client.Auth(auth); err != nil {
-		return fmt.Errorf("authentication failed: %w", err)
-	}
-
-	if err := client.Mail(from); err != nil {
-		return fmt.Errorf("MAIL FROM failed: %w", err)
-	}
-	for _, rcpt := range to {
-		if err := client.Rcpt(rcpt); err != nil {
-			return fmt.Errorf("RCPT TO %s failed: %w", rcpt, err)
-		}
-	}
-
-	w, err := client.Data()
-	if err != nil {
-		return fmt.Errorf("DATA command failed: %w", err)
-	}
-	if _, err := w.Write([]byte(msg.String())); err != nil {
-		return fmt.Errorf("writing message failed: %w", err)
-	}
-	if err := w.Close(); err != nil {
-		return fmt.Errorf("closing DATA writer failed: %w", err)
-	}
-
-	if err := client.Quit(); err != nil {
-		log.Printf("warning: QUIT returned error: %v", err)
-	}
-	return nil
+	_, err := sendMailMessage(db, utils.MailMessage{
+		To:          to,
+		Subject:     subject,
+		Body:        body,
+		ContentType: contentType,
+		Attachments: []utils.MailAttachment{{Name: attachmentName, ContentType: mimeType, Data: attachmentData}},
+	})
+	return err
 }
 
 // ============================================================================
@@ -578,106 +480,31 @@ func writeProjectBlock(
 // SendMailAuto Function
 // ============================================================================
 
+// SendMailAuto runs the tracking report now (manual trigger of the REPORT_CRON job)
 func SendMailAuto(c *fiber.Ctx, db *sqlx.DB) error {
+	run, err := runTrackingReport(db, reportTriggerManual, c.Query("by"), time.Now())
+	if err != nil {
+		if errors.Is(err, errReportRunning) {
+			return c.Status(409).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.Status(500).JSON(fiber.Map{"error": "tracking report failed", "detail": err.Error(), "run": run})
+	}
+	return c.Status(200).JSON(run)
+}
 
-	sqlQuery := `SELECT
-					ip.ip_code,
-					ip.ip_part_name,
-					ip.ip_part_no,
-					ip.ip_model,
-					x.item_name,
-					x.item_type,
-					x.start_date,
-					x.end_date,
-					x.ipid_status,
-					GROUP_CONCAT(DISTINCT x.owner_su_id ORDER BY x.owner_su_id SEPARATOR '/') AS owner_su_ids,
-					GROUP_CONCAT(
-						DISTINCT CONCAT('K.',su.su_firstname)
-						ORDER BY su.su_firstname
-						SEPARATOR '/'
-					) AS owner_names,
-					GROUP_CONCAT(
-						DISTINCT su.su_emp_code
-						ORDER BY su.su_emp_code
-						SEPARATOR '/'
-					) AS owner_emp_codes
-				FROM
-				(
-						SELECT
-							ai.ip_id                                   AS ip_id,
-							ai.iai_name                                AS item_name,
-							pid.ipid_type                              AS item_type,
-							COALESCE(pid.su_id, pid.ipid_line_code)    AS owner_su_id,
-							pid.ipid_start_date                        AS start_date,
-							pid.ipid_end_date                          AS end_date,
-							pid.ipid_id                                AS ipid_id,
-							pid.ipid_status                            AS ipid_status
-						FROM info_project_item_detail pid
-						JOIN info_apqp_item ai
-							ON ai.iai_id = pid.ref_id
-						   AND pid.ipid_type = 'apqp'
-
-						UNION ALL
-
-						SELECT
-							pi.ip_id                                   AS ip_id,
-							pi.ipi_name                                AS item_name,
-							pid.ipid_type                              AS item_type,
-							COALESCE(pid.su_id, pid.ipid_line_code)    AS owner_su_id,
-							pid.ipid_start_date                        AS start_date,
-							pid.ipid_end_date                          AS end_date,
-							pid.ipid_id                                AS ipid_id,
-							pid.ipid_status                            AS ipid_status
-						FROM info_project_item_detail pid
-						JOIN info_ppap_item pi
-							ON pi.ipi_id = pid.ref_id
-						   AND pid.ipid_type = 'ppap'
-				) x
-				LEFT JOIN sys_user su
-					ON su.su_id = x.owner_su_id
-				LEFT JOIN info_project ip
-					ON x.ip_id = ip.ip_id
-				GROUP BY
-					ip.ip_code,
-					ip.ip_part_name,
-					ip.ip_part_no,
-					ip.ip_model,
-					x.item_name,
-					x.item_type,
-					x.start_date,
-					x.end_date,
-					x.ipid_status
-				ORDER BY
-					x.item_type ASC,
-					x.start_date ASC,
-					x.item_name ASC`
-
-	var rows []MailData
-	if err := db.Select(&rows, sqlQuery); err != nil {
-		return c.Status(500).JSON(fiber.Map{"error": "failed to query data", "detail": err.Error()})
-	}
-	if len(rows) == 0 {
-		return c.Status(200).JSON(fiber.Map{"message": "no data to send"})
-	}
-
-	// Get all active users with email addresses
-	type User struct {
-		Email string `db:"su_email"`
-	}
-	var users []User
-	if err := db.Select(&users, `SELECT su_email FROM sys_user WHERE su_status = 'active' AND su_email IS NOT NULL AND su_email <> '' ORDER BY su_email`); err != nil {
-		return c.Status(500).JSON(fiber.Map{"error": "failed to query users", "detail": err.Error()})
-	}
-	if len(users) == 0 {
-		return c.Status(200).JSON(fiber.Map{"message": "no active users with email found"})
-	}
-
-	// Extract email list
-	emailList := make([]string, 0, len(users))
-	for _, u := range users {
-		emailList = append(emailList, u.Email)
+// containsID reports whether a "/" separated id list (GROUP_CONCAT) holds id
+func containsID(list sql.NullString, id int64) bool {
+	want := strconv.FormatInt(id, 10)
+	for _, s := range strings.Split(list.String, "/") {
+		if strings.TrimSpace(s) == want {
+			return true
+		}
 	}
+	return false
+}
 
+// buildTrackingWorkbook renders the tracking rows into the Excel report, one sheet per model
+func buildTrackingWorkbook(rows []MailData) ([]byte, error) {
 	// prepare sheet name sanitizer
 	reSheet := regexp.MustCompile(`[\\/:*?\[\]]`)
 	sanitize := func(s string) string {
@@ -697,7 +524,7 @@ func SendMailAuto(c *fiber.Ctx, db *sqlx.DB) error {
 	// Build styles upfront
 	baseStyle, titleStyle, headerStyle, stDone, stDelay, stInprog, stWaiting, stReject, err := buildStyles(f)
 	if err != nil {
-		return c.Status(500).JSON(fiber.Map{"error": "failed to build styles", "detail": err.Error()})
+		return nil, err
 	}
 
 	// Group items by model -> ip_code
@@ -753,8 +580,7 @@ func SendMailAuto(c *fiber.Ctx, db *sqlx.DB) error {
 			}
 			first := group[0]
 
-			// Placeholder for template name - fetch from DB if available
-			templateName := "MITSUBISHI MOTOR"
+			templateName := getStringValue(first.TemplateName)
 
 			// Use helper function to write complete project block
 			currentRow = writeProjectBlock(
@@ -773,18 +599,9 @@ func SendMailAuto(c *fiber.Ctx, db *sqlx.DB) error {
 
 	var buf bytes.Buffer
 	if _, err := f.WriteTo(&buf); err != nil {
-		return c.Status(500).JSON(fiber.Map{"error": "failed to write excel file", "detail": err.Error()})
+		return nil, err
 	}
-
-	// Send to all active users
-	subject := "Project Items Awaiting Your Approval"
-	attachName := "TrackingProjects.xlsx"
-	body := "Please find attached the project items in Excel format."
-	if err := SendMailWithAttachment(emailList, subject, body, "text/plain; charset=utf-8", attachName, buf.Bytes()); err != nil {
-		return c.Status(500).JSON(fiber.Map{"error": "failed to send email", "detail": err.Error()})
-	}
-
-	return c.Status(200).JSON(fiber.Map{"sent": 1, "recipients": len(emailList), "message": "Email sent to all active users"})
+	return buf.Bytes(), nil
 }
 
 func getStringValue(ns sql.NullString) string {
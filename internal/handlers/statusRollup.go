@@ -0,0 +1,445 @@
+package handlers
+
+import (
+	"database/sql"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"apiTrackingSystem/internal/utils"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jmoiron/sqlx"
+)
+
+// status values used by the roll-up
+const (
+	statusInprogress = "inprogress"
+	statusDelay      = "delay"
+	statusDone       = "done"
+)
+
+// project health (info_project.ip_health)
+const (
+	healthOnTrack = "on_track"
+	healthAtRisk  = "at_risk"
+	healthDelayed = "delayed"
+)
+
+// status event entities / sources (info_status_event)
+const (
+	statusEntityItem    = "item"
+	statusEntityPlan    = "plan"
+	statusEntityProject = "project"
+
+	statusSourceJob      = "job"
+	statusSourceApproval = "approval"
+	statusSourceUpload   = "upload"
+	statusSourceManual   = "manual"
+)
+
+const statusJobActor = "system"
+
+// statusRollupMu keeps one roll-up at a time (scheduler and manual trigger)
+var statusRollupMu sync.Mutex
+
+// statusRollupResult is the summary of one roll-up run
+type statusRollupResult struct {
+	Projects       int      `json:"projects"`
+	ItemsDelayed   int      `json:"items_delayed"`
+	ItemsRecovered int      `json:"items_recovered"`
+	PlansChanged   int      `json:"plans_changed"`
+	HealthChanged  int      `json:"health_changed"`
+	Errors         []string `json:"errors"`
+}
+
+// recordStatusEvent writes one status change
+func recordStatusEvent(q sqlx.Execer, entity string, refID, ipID int64, field, from, to, source, by string, now time.Time) error {
+	_, err := q.Exec(`INSERT INTO info_status_event (ise_entity, ise_ref_id, ip_id, ise_field, ise_from, ise_to, ise_source, ise_created_at, ise_created_by) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		entity, refID, nullID(ipID), field, utils.NewNullString(from), to, source, now, by)
+	return err
+}
+
+// recordItemGroupStatus logs the change of every item in the group (ref_id + ipid_type) of ipidID
+// whose status differs from to; call it before the UPDATE of the group
+func recordItemGroupStatus(q sqlx.Ext, ipidID int64, to, source, by string, now time.Time) error {
+	var rows []struct {
+		IpidID int64  `db:"ipid_id"`
+		IpID   int64  `db:"ip_id"`
+		Status string `db:"ipid_status"`
+	}
+	if err := sqlx.Select(q, &rows, `SELECT pid.ipid_id, COALESCE(ai.ip_id, pi.ip_id, 0) AS ip_id, COALESCE(pid.ipid_status, '') AS ipid_status
+		FROM info_project_item_detail g
+		JOIN info_project_item_detail pid ON pid.ref_id = g.ref_id AND pid.ipid_type = g.ipid_type
+		LEFT JOIN info_apqp_item ai ON ai.iai_id = pid.ref_id AND pid.ipid_type = 'apqp'
+		LEFT JOIN info_ppap_item pi ON pi.ipi_id = pid.ref_id AND pid.ipid_type = 'ppap'
+		WHERE g.ipid_id = ? AND COALESCE(pid.ipid_status, '') <> ?`, ipidID, to); err != nil {
+		return err
+	}
+	for _, r := range rows {
+		if err := recordStatusEvent(q, statusEntityItem, r.IpidID, r.IpID, "status", r.Status, to, source, by, now); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// statusRiskDays is HEALTH_RISK_DAYS (default 3): an open item due within that many working days puts the project at risk
+func statusRiskDays() int {
+	if n, err := strconv.Atoi(strings.TrimSpace(os.Getenv("HEALTH_RISK_DAYS"))); err == nil && n >= 0 {
+		return n
+	}
+	return 3
+}
+
+// StartStatusRollupScheduler marks overdue work and rolls statuses up every STATUS_ROLLUP_INTERVAL (default 1h, "off" disables)
+func StartStatusRollupScheduler(db *sqlx.DB) {
+	raw := strings.TrimSpace(os.Getenv("STATUS_ROLLUP_INTERVAL"))
+	if strings.EqualFold(raw, "off") || raw == "0" {
+		log.Printf("status roll-up scheduler disabled")
+		return
+	}
+	interval := time.Hour
+	if raw != "" {
+		d, err := time.ParseDuration(raw)
+		if err != nil || d < time.Minute {
+			log.Printf("status roll-up scheduler: invalid STATUS_ROLLUP_INTERVAL %q, using 1h", raw)
+		} else {
+			interval = d
+		}
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			res := runStatusRollup(db, time.Now())
+			if res.ItemsDelayed > 0 || res.ItemsRecovered > 0 || res.PlansChanged > 0 || res.HealthChanged > 0 || len(res.Errors) > 0 {
+				log.Printf("status roll-up: projects=%d delayed=%d recovered=%d plans=%d health=%d errors=%d",
+					res.Projects, res.ItemsDelayed, res.ItemsRecovered, res.PlansChanged, res.HealthChanged, len(res.Errors))
+			}
+			<-ticker.C
+		}
+	}()
+}
+
+// RunStatusRollup runs the delay detection / roll-up once (manual trigger)
+func RunStatusRollup(c *fiber.Ctx, db *sqlx.DB) error {
+	return c.Status(200).JSON(runStatusRollup(db, time.Now()))
+}
+
+func runStatusRollup(db *sqlx.DB, now time.Time) statusRollupResult {
+	res := statusRollupResult{Errors: []string{}}
+	statusRollupMu.Lock()
+	defer statusRollupMu.Unlock()
+
+	var projects []struct {
+		IpID   int64          `db:"ip_id"`
+		McID   sql.NullInt64  `db:"mc_id"`
+		Health sql.NullString `db:"ip_health"`
+	}
+	if err := db.Select(&projects, `SELECT ip_id, mc_id, ip_health FROM info_project WHERE ip_status = 'inprogress'`); err != nil {
+		res.Errors = append(res.Errors, "query projects: "+err.Error())
+		return res
+	}
+
+	calendars := map[int64]*workCalendar{}
+	for _, p := range projects {
+		cal, ok := calendars[p.McID.Int64]
+		if !ok {
+			var err error
+			if cal, err = loadCalendar(db, p.McID.Int64); err != nil {
+				res.Errors = append(res.Errors, "query calendar: "+err.Error())
+				return res
+			}
+			calendars[p.McID.Int64] = cal
+		}
+		changed, err := rollupProject(db, p.IpID, p.Health.String, cal, now, &res)
+		if err != nil {
+			res.Errors = append(res.Errors, "project "+strconv.FormatInt(p.IpID, 10)+": "+err.Error())
+			continue
+		}
+		res.Projects++
+		publishItemEvents(db, streamItemStatus, changed, statusJobActor)
+	}
+	return res
+}
+
+// rollupItem is an item detail of a project as seen by the roll-up
+type rollupItem struct {
+	IpidID int64  `db:"ipid_id"`
+	Status string `db:"ipid_status"`
+	End    *Date  `db:"ipid_end_date"`
+}
+
+// planItemLink ties an APQP item detail to a master plan row of its project
+type planItemLink struct {
+	IpmpID int64 `db:"ipmp_id"`
+	IpidID int64 `db:"ipid_id"`
+}
+
+// planItemLinks maps the APQP item details of a project to its master plan rows: an item set to
+// a row (info_apqp_item.ipmp_id) belongs to it, any other item belongs to every row whose milestone
+// (matched on the name) lists the APQP item of the same name and phase in mst_master_plan_detail
+func planItemLinks(q sqlx.Queryer, ipID int64) ([]planItemLink, error) {
+	var links []planItemLink
+	err := sqlx.Select(q, &links, `SELECT ai.ipmp_id, pid.ipid_id
+		FROM info_apqp_item ai
+		JOIN info_project_master_plan ipmp ON ipmp.ipmp_id = ai.ipmp_id AND ipmp.ip_id = ai.ip_id
+		JOIN info_project_item_detail pid ON pid.ref_id = ai.iai_id AND pid.ipid_type = 'apqp'
+		WHERE ai.ip_id = ?
+		UNION
+		SELECT ipmp.ipmp_id, pid.ipid_id
+		FROM info_project_master_plan ipmp
+		JOIN mst_master_plan mmp ON mmp.mmp_name = ipmp.ipmp_name AND mmp.mmp_status = 'active'
+		JOIN mst_master_plan_detail mmpd ON mmpd.mmp_id = mmp.mmp_id AND mmpd.mmpd_status = 'active'
+		JOIN mst_apqp ma ON ma.ma_id = mmpd.ma_id
+		JOIN info_apqp_item ai ON ai.ip_id = ipmp.ip_id AND ai.ipmp_id IS NULL
+			AND ai.iai_name = ma.ma_name AND (ai.mpp_id IS NULL OR ai.mpp_id = ma.mpp_id)
+		JOIN info_project_item_detail pid ON pid.ref_id = ai.iai_id AND pid.ipid_type = 'apqp'
+		WHERE ipmp.ip_id = ?
+		ORDER BY ipmp_id, ipid_id`, ipID, ipID)
+	return links, err
+}
+
+// itemsByPlan groups the items of a project by master plan row
+func itemsByPlan(items []rollupItem, links []planItemLink) map[int64][]rollupItem {
+	byID := make(map[int64]int, len(items))
+	for i, it := range items {
+		byID[it.IpidID] = i
+	}
+	byPlan := map[int64][]rollupItem{}
+	for _, l := range links {
+		if i, ok := byID[l.IpidID]; ok {
+			byPlan[l.IpmpID] = append(byPlan[l.IpmpID], items[i])
+		}
+	}
+	return byPlan
+}
+
+// overdue - the deadline (moved to the next working day when it is not one) has passed
+func overdue(cal *workCalendar, end *Date, today time.Time) bool {
+	return end != nil && !end.IsZero() && today.After(cal.NextWorkingDay(end.Time))
+}
+
+// rollupProject runs the roll-up of one project in one transaction and returns the changed items.
+//  1. open items past their deadline become delay; delayed items whose deadline moved out go back to inprogress
+//  2. a master plan row is done when all its items are, delay when an item is delayed or the row is overdue
+//  3. the project is delayed / at risk / on track
+func rollupProject(db *sqlx.DB, ipID int64, health string, cal *workCalendar, now time.Time, res *statusRollupResult) ([]int64, error) {
+	today := dayOf(now)
+
+	tx, err := db.Beginx()
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	var items []rollupItem
+	if err := tx.Select(&items, `SELECT pid.ipid_id, COALESCE(pid.ipid_status, '') AS ipid_status, pid.ipid_end_date
+		FROM info_project_item_detail pid
+		LEFT JOIN info_apqp_item ai ON ai.iai_id = pid.ref_id AND pid.ipid_type = 'apqp'
+		LEFT JOIN info_ppap_item pi ON pi.ipi_id = pid.ref_id AND pid.ipid_type = 'ppap'
+		WHERE COALESCE(ai.ip_id, pi.ip_id) = ?`, ipID); err != nil {
+		return nil, err
+	}
+
+	var changed []int64
+	delayed, recovered := 0, 0
+	for i, it := range items {
+		to := ""
+		switch {
+		case it.Status == statusInprogress && overdue(cal, it.End, today):
+			to = statusDelay
+		case it.Status == statusDelay && !overdue(cal, it.End, today):
+			to = statusInprogress
+		}
+		if to == "" {
+			continue
+		}
+		r, err := tx.Exec(`UPDATE info_project_item_detail SET ipid_status = ?, ipid_updated_at = ?, ipid_updated_by = ? WHERE ipid_id = ? AND ipid_status = ?`,
+			to, now, statusJobActor, it.IpidID, it.Status)
+		if err != nil {
+			return nil, err
+		}
+		if n, _ := r.RowsAffected(); n == 0 {
+			continue
+		}
+		if err := recordStatusEvent(tx, statusEntityItem, it.IpidID, ipID, "status", it.Status, to, statusSourceJob, statusJobActor, now); err != nil {
+			return nil, err
+		}
+		items[i].Status = to
+		changed = append(changed, it.IpidID)
+		if to == statusDelay {
+			delayed++
+		} else {
+			recovered++
+		}
+	}
+
+	var plans []struct {
+		IpmpID int64  `db:"ipmp_id"`
+		Status string `db:"ipmp_status"`
+		End    *Date  `db:"ipmp_end_date"`
+	}
+	if err := tx.Select(&plans, `SELECT ipmp_id, COALESCE(ipmp_status, '') AS ipmp_status, ipmp_end_date FROM info_project_master_plan WHERE ip_id = ?`, ipID); err != nil {
+		return nil, err
+	}
+	links, err := planItemLinks(tx, ipID)
+	if err != nil {
+		return nil, err
+	}
+	byPlan := itemsByPlan(items, links)
+	plansChanged, planDelayed := 0, false
+	for _, p := range plans {
+		to := planRollupStatus(p.Status, overdue(cal, p.End, today), byPlan[p.IpmpID])
+		if to == statusDelay {
+			planDelayed = true
+		}
+		if to == p.Status {
+			continue
+		}
+		if _, err := tx.Exec(`UPDATE info_project_master_plan SET ipmp_status = ?, ipmp_updated_at = ?, ipmp_updated_by = ? WHERE ipmp_id = ?`,
+			to, now, statusJobActor, p.IpmpID); err != nil {
+			return nil, err
+		}
+		if err := recordStatusEvent(tx, statusEntityPlan, p.IpmpID, ipID, "status", p.Status, to, statusSourceJob, statusJobActor, now); err != nil {
+			return nil, err
+		}
+		plansChanged++
+	}
+
+	newHealth := projectHealth(items, planDelayed, cal, today, statusRiskDays())
+	healthChanged := 0
+	if newHealth != health {
+		if _, err := tx.Exec(`UPDATE info_project SET ip_health = ?, ip_health_updated_at = ? WHERE ip_id = ?`, newHealth, now, ipID); err != nil {
+			return nil, err
+		}
+		if err := recordStatusEvent(tx, statusEntityProject, ipID, ipID, "health", health, newHealth, statusSourceJob, statusJobActor, now); err != nil {
+			return nil, err
+		}
+		healthChanged = 1
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	res.ItemsDelayed += delayed
+	res.ItemsRecovered += recovered
+	res.PlansChanged += plansChanged
+	res.HealthChanged += healthChanged
+	return changed, nil
+}
+
+// planRollupStatus is the status of a master plan row from its items; a row without items
+// keeps its status except for becoming delay when overdue (and leaving delay when no longer overdue);
+// a new row without a status starts as inprogress
+func planRollupStatus(current string, rowOverdue bool, items []rollupItem) string {
+	if len(items) == 0 {
+		switch {
+		case current == statusDone:
+			return current
+		case rowOverdue:
+			return statusDelay
+		case current == statusDelay, current == "":
+			return statusInprogress
+		}
+		return current
+	}
+	allDone, anyDelay := true, false
+	for _, it := range items {
+		if it.Status != statusDone {
+			allDone = false
+		}
+		if it.Status == statusDelay {
+			anyDelay = true
+		}
+	}
+	switch {
+	case allDone:
+		return statusDone
+	case anyDelay || rowOverdue:
+		return statusDelay
+	}
+	return statusInprogress
+}
+
+// projectHealth - delayed when an item or plan row is delayed, at risk when an open item is due
+// within riskDays working days, else on track
+func projectHealth(items []rollupItem, planDelayed bool, cal *workCalendar, today time.Time, riskDays int) string {
+	if planDelayed {
+		return healthDelayed
+	}
+	atRisk := false
+	for _, it := range items {
+		if it.Status == statusDelay {
+			return healthDelayed
+		}
+		if it.Status == statusDone || it.End == nil || it.End.IsZero() {
+			continue
+		}
+		if cal.WorkingDaysBetween(today, cal.NextWorkingDay(it.End.Time)) <= riskDays {
+			atRisk = true
+		}
+	}
+	if atRisk {
+		return healthAtRisk
+	}
+	return healthOnTrack
+}
+
+// InfoStatusEvent represents a row in info_status_event
+type InfoStatusEvent struct {
+	ID        int64            `db:"ise_id" json:"ise_id"`
+	Entity    string           `db:"ise_entity" json:"ise_entity"`
+	RefID     int64            `db:"ise_ref_id" json:"ise_ref_id"`
+	IpID      utils.NullInt64  `db:"ip_id" json:"ip_id"`
+	Field     string           `db:"ise_field" json:"ise_field"`
+	From      utils.NullString `db:"ise_from" json:"ise_from"`
+	To        string           `db:"ise_to" json:"ise_to"`
+	Source    string           `db:"ise_source" json:"ise_source"`
+	CreatedAt time.Time        `db:"ise_created_at" json:"ise_created_at"`
+	CreatedBy utils.NullString `db:"ise_created_by" json:"ise_created_by"`
+}
+
+// ListStatusEvent lists status changes, newest first.
+// Query: ip_id, entity (item|plan|project), ref_id, source, limit (default 100), before_id for the next page.
+func ListStatusEvent(c *fiber.Ctx, db *sqlx.DB) error {
+	limit := 100
+	if n, err := strconv.Atoi(c.Query("limit")); err == nil && n > 0 && n <= 500 {
+		limit = n
+	}
+	q := `SELECT ise_id, ise_entity, ise_ref_id, ip_id, ise_field, ise_from, ise_to, ise_source, ise_created_at, ise_created_by FROM info_status_event WHERE 1 = 1`
+	args := []interface{}{}
+	if id, err := strconv.ParseInt(c.Query("ip_id"), 10, 64); err == nil && id > 0 {
+		q += ` AND ip_id = ?`
+		args = append(args, id)
+	}
+	if entity := strings.TrimSpace(c.Query("entity")); entity != "" {
+		q += ` AND ise_entity = ?`
+		args = append(args, entity)
+	}
+	if id, err := strconv.ParseInt(c.Query("ref_id"), 10, 64); err == nil && id > 0 {
+		q += ` AND ise_ref_id = ?`
+		args = append(args, id)
+	}
+	if source := strings.TrimSpace(c.Query("source")); source != "" {
+		q += ` AND ise_source = ?`
+		args = append(args, source)
+	}
+	if before, err := strconv.ParseInt(c.Query("before_id"), 10, 64); err == nil && before > 0 {
+		q += ` AND ise_id < ?`
+		args = append(args, before)
+	}
+	q += ` ORDER BY ise_id DESC LIMIT ?`
+	args = append(args, limit)
+
+	rows := []InfoStatusEvent{}
+	if err := db.Select(&rows, q, args...); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "query error", "detail": err.Error()})
+	}
+	return c.Status(200).JSON(rows)
+}
@@ -0,0 +1,48 @@
+package handlers
+
+import "testing"
+
+func TestPlanRollupFromLinkedItems(t *testing.T) {
+	items := []rollupItem{
+		{IpidID: 11, Status: statusDone},
+		{IpidID: 12, Status: statusDone},
+		{IpidID: 21, Status: statusDelay},
+		{IpidID: 22, Status: statusInprogress},
+		{IpidID: 31, Status: statusInprogress},
+	}
+	links := []planItemLink{
+		{IpmpID: 1, IpidID: 11},
+		{IpmpID: 1, IpidID: 12},
+		{IpmpID: 2, IpidID: 21},
+		{IpmpID: 2, IpidID: 22},
+		{IpmpID: 3, IpidID: 31},
+		{IpmpID: 3, IpidID: 99}, // detail of another project
+	}
+	byPlan := itemsByPlan(items, links)
+	if len(byPlan[3]) != 1 {
+		t.Fatalf("row 3 has %d items, want 1", len(byPlan[3]))
+	}
+
+	tests := []struct {
+		name    string
+		ipmpID  int64
+		current string
+		overdue bool
+		want    string
+	}{
+		{"all items done", 1, statusInprogress, false, statusDone},
+		{"an item delayed", 2, statusInprogress, false, statusDelay},
+		{"open items, row overdue", 3, statusInprogress, true, statusDelay},
+		{"open items, delay cleared", 3, statusDelay, false, statusInprogress},
+		{"done row reopened by an open item", 3, statusDone, false, statusInprogress},
+		{"row without items keeps done", 4, statusDone, true, statusDone},
+		{"row without items overdue", 4, statusInprogress, true, statusDelay},
+		{"new row without items", 4, "", false, statusInprogress},
+		{"new row with open items", 3, "", false, statusInprogress},
+	}
+	for _, tt := range tests {
+		if got := planRollupStatus(tt.current, tt.overdue, byPlan[tt.ipmpID]); got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
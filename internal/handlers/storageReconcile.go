@@ -0,0 +1,166 @@
+package handlers
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jmoiron/sqlx"
+)
+
+const quarantineDirName = "_quarantine"
+
+// storageRef is one DB row that points at a file inside the upload store
+type storageRef struct {
+	Source   string `db:"source" json:"source"`
+	RowID    int64  `db:"row_id" json:"row_id"`
+	IpID     int64  `db:"ip_id" json:"ip_id"`
+	FilePath string `db:"file_path" json:"file_path"`
+}
+
+type orphanFile struct {
+	FilePath    string    `json:"file_path"`
+	Size        int64     `json:"size"`
+	ModifiedAt  time.Time `json:"modified_at"`
+	Quarantined bool      `json:"quarantined"`
+	MovedTo     string    `json:"moved_to,omitempty"`
+	Error       string    `json:"error,omitempty"`
+}
+
+// storageKey normalizes "uploads/<ip>/<type>/<file>" and disk-relative paths to the same key
+func storageKey(p string) string {
+	p = strings.TrimPrefix(filepath.ToSlash(strings.TrimSpace(p)), "/")
+	p = strings.TrimPrefix(p, "uploads/")
+	if runtime.GOOS == "windows" {
+		p = strings.ToLower(p)
+	}
+	return p
+}
+
+// ReconcileStorage compares the upload store with info_pos_file / info_tracking_file (+ history).
+// GET only reports. POST with quarantine=true moves orphans older than grace_hours (default 72)
+// to uploads/_quarantine/<timestamp>/
+func ReconcileStorage(c *fiber.Ctx, db *sqlx.DB) error {
+	doQuarantine := strings.EqualFold(c.Query("quarantine"), "true") || c.Query("quarantine") == "1"
+	if doQuarantine && c.Method() != fiber.MethodPost {
+		return c.Status(405).JSON(fiber.Map{"error": "quarantine requires POST"})
+	}
+	graceHours := 72
+	if v := strings.TrimSpace(c.Query("grace_hours")); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return c.Status(400).JSON(fiber.Map{"error": "invalid grace_hours"})
+		}
+		graceHours = n
+	}
+
+	var refs []storageRef
+	query := `SELECT 'info_pos_file' AS source, ipf_id AS row_id, ip_id, ipf_file_path AS file_path
+				FROM info_pos_file
+				WHERE ipf_file_path IS NOT NULL AND ipf_file_path <> ''
+				UNION ALL
+				SELECT 'info_tracking_file' AS source, itf_id AS row_id, ip_id, itf_file_path AS file_path
+				FROM info_tracking_file
+				WHERE itf_file_path IS NOT NULL AND itf_file_path <> ''
+				UNION ALL
+				SELECT 'info_tracking_file_history' AS source, itfh_id AS row_id, ip_id, itfh_file_path AS file_path
+				FROM info_tracking_file_history
+				WHERE itfh_file_path IS NOT NULL AND itfh_file_path <> ''`
+	if err := db.Select(&refs, query); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "query error", "detail": err.Error()})
+	}
+
+	referenced := make(map[string]bool, len(refs))
+	for _, r := range refs {
+		referenced[storageKey(r.FilePath)] = true
+	}
+
+	base := uploadBaseDir()
+	onDisk := map[string]bool{}
+	orphans := []orphanFile{}
+	var orphanInfos []fs.FileInfo
+	walkErr := filepath.WalkDir(base, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if d.Name() == quarantineDirName && p != base {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		rel, err := filepath.Rel(base, p)
+		if err != nil {
+			return nil
+		}
+		key := storageKey(rel)
+		onDisk[key] = true
+		if referenced[key] {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		orphans = append(orphans, orphanFile{
+			FilePath:   "uploads/" + filepath.ToSlash(rel),
+			Size:       info.Size(),
+			ModifiedAt: info.ModTime(),
+		})
+		orphanInfos = append(orphanInfos, info)
+		return nil
+	})
+	if walkErr != nil && !os.IsNotExist(walkErr) {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to scan upload store", "detail": walkErr.Error()})
+	}
+
+	missing := []storageRef{}
+	for _, r := range refs {
+		if !onDisk[storageKey(r.FilePath)] {
+			missing = append(missing, r)
+		}
+	}
+
+	// move orphans that survived the grace period (a failed request may still be retried inside it)
+	quarantined := 0
+	if doQuarantine {
+		cutoff := time.Now().Add(-time.Duration(graceHours) * time.Hour)
+		stamp := time.Now().Format("20060102_150405")
+		for i := range orphans {
+			if orphanInfos[i].ModTime().After(cutoff) {
+				continue
+			}
+			rel := strings.TrimPrefix(orphans[i].FilePath, "uploads/")
+			src := filepath.Join(base, filepath.FromSlash(rel))
+			dst := filepath.Join(base, quarantineDirName, stamp, filepath.FromSlash(rel))
+			if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+				orphans[i].Error = err.Error()
+				continue
+			}
+			if err := os.Rename(src, dst); err != nil {
+				orphans[i].Error = err.Error()
+				continue
+			}
+			orphans[i].Quarantined = true
+			orphans[i].MovedTo = "uploads/" + filepath.ToSlash(filepath.Join(quarantineDirName, stamp, rel))
+			quarantined++
+		}
+	}
+
+	return c.JSON(fiber.Map{
+		"scanned_files": len(onDisk),
+		"db_references": len(refs),
+		"missing_count": len(missing),
+		"missing":       missing,
+		"orphan_count":  len(orphans),
+		"orphans":       orphans,
+		"quarantine":    doQuarantine,
+		"grace_hours":   graceHours,
+		"quarantined":   quarantined,
+	})
+}
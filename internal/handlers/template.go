@@ -58,6 +58,7 @@ func GetTemplate(c *fiber.Ctx, db *sqlx.DB) error {
 		}
 		return c.Status(500).JSON(fiber.Map{"error": "query error", "detail": err.Error()})
 	}
+	setETag(c, db, templateVersion, id)
 	return c.Status(200).JSON(t)
 }
 
@@ -123,8 +124,11 @@ func UpdateTemplate(c *fiber.Ctx, db *sqlx.DB) error {
 	}
 
 	now := time.Now()
-	res, err := db.Exec(`UPDATE mst_template SET mt_name = ?, mt_updated_at = ?, mt_updated_by = ? WHERE mt_id = ?`, body.Name, now, body.UpdatedBy, body.ID)
+	res, err := execVersioned(c, db, templateVersion, body.ID, `UPDATE mst_template SET mt_name = ?, mt_updated_at = ?, mt_updated_by = ? WHERE mt_id = ?`, body.Name, now, body.UpdatedBy, body.ID)
 	if err != nil {
+		if isVersionError(err) {
+			return versionError(c, err)
+		}
 		return c.Status(500).JSON(fiber.Map{"error": "failed to update template", "detail": err.Error()})
 	}
 	ra, _ := res.RowsAffected()
@@ -153,9 +157,12 @@ func UpdateTemplateStatus(c *fiber.Ctx, db *sqlx.DB) error {
 		return c.Status(400).JSON(fiber.Map{"error": "mt_updated_by is required"})
 	}
 	now := time.Now()
-	res, err := db.Exec(`UPDATE mst_template SET mt_status = ?, mt_updated_at = ?, mt_updated_by = ? WHERE mt_id = ?`,
+	res, err := execVersioned(c, db, templateVersion, body.ID, `UPDATE mst_template SET mt_status = ?, mt_updated_at = ?, mt_updated_by = ? WHERE mt_id = ?`,
 		body.Status, now, body.UpdatedBy, body.ID)
 	if err != nil {
+		if isVersionError(err) {
+			return versionError(c, err)
+		}
 		return c.Status(500).JSON(fiber.Map{"error": "failed to update template status", "detail": err.Error()})
 	}
 	ra, _ := res.RowsAffected()
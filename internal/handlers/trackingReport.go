@@ -0,0 +1,368 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"apiTrackingSystem/internal/utils"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jmoiron/sqlx"
+)
+
+const reportTracking = "tracking"
+
+// report triggers (info_report_run.irr_trigger)
+const (
+	reportTriggerSchedule = "schedule"
+	reportTriggerManual   = "manual"
+)
+
+// report run / recipient statuses
+const (
+	reportRunning = "running"
+	reportSuccess = "success"
+	reportPartial = "partial"
+	reportFailed  = "failed"
+	reportSent    = "sent"
+)
+
+var errReportRunning = errors.New("tracking report is already running")
+
+// trackingReportMu keeps the scheduler and the manual trigger from sending the same report twice
+var trackingReportMu sync.Mutex
+
+// InfoReportRun represents a row in info_report_run
+type InfoReportRun struct {
+	ID         int64                    `db:"irr_id" json:"irr_id"`
+	Report     string                   `db:"irr_report" json:"irr_report"`
+	Trigger    string                   `db:"irr_trigger" json:"irr_trigger"`
+	Status     string                   `db:"irr_status" json:"irr_status"`
+	Recipients int                      `db:"irr_recipients" json:"irr_recipients"`
+	Sent       int                      `db:"irr_sent" json:"irr_sent"`
+	Failed     int                      `db:"irr_failed" json:"irr_failed"`
+	Error      utils.NullString         `db:"irr_error" json:"irr_error"`
+	StartedAt  time.Time                `db:"irr_started_at" json:"irr_started_at"`
+	FinishedAt *time.Time               `db:"irr_finished_at" json:"irr_finished_at"`
+	CreatedBy  utils.NullString         `db:"irr_created_by" json:"irr_created_by"`
+	Recipient  []InfoReportRunRecipient `db:"-" json:"recipients,omitempty"`
+}
+
+// InfoReportRunRecipient represents a row in info_report_run_recipient
+type InfoReportRunRecipient struct {
+	ID       int64            `db:"irrr_id" json:"irrr_id"`
+	RunID    int64            `db:"irr_id" json:"irr_id"`
+	SuID     int64            `db:"su_id" json:"su_id"`
+	Email    string           `db:"irrr_email" json:"irrr_email"`
+	Projects int              `db:"irrr_projects" json:"irrr_projects"`
+	Items    int              `db:"irrr_items" json:"irrr_items"`
+	Status   string           `db:"irrr_status" json:"irrr_status"`
+	Error    utils.NullString `db:"irrr_error" json:"irrr_error"`
+	SentAt   *time.Time       `db:"irrr_sent_at" json:"irrr_sent_at"`
+}
+
+// StartTrackingReportScheduler sends the tracking report on the REPORT_CRON schedule
+// (5-field cron, e.g. "0 8 * * 1-5"; empty or "off" disables)
+func StartTrackingReportScheduler(db *sqlx.DB) {
+	raw := strings.TrimSpace(os.Getenv("REPORT_CRON"))
+	if raw == "" || strings.EqualFold(raw, "off") {
+		log.Printf("tracking report scheduler disabled")
+		return
+	}
+	sched, err := utils.ParseCron(raw)
+	if err != nil {
+		log.Printf("tracking report scheduler disabled: invalid REPORT_CRON: %v", err)
+		return
+	}
+
+	go func() {
+		for {
+			next := sched.Next(time.Now())
+			if next.IsZero() {
+				log.Printf("tracking report scheduler: REPORT_CRON %q never fires", raw)
+				return
+			}
+			time.Sleep(time.Until(next))
+			run, err := runTrackingReport(db, reportTriggerSchedule, "system", time.Now())
+			if err != nil {
+				log.Printf("tracking report: run=%d failed: %v", run.ID, err)
+				continue
+			}
+			log.Printf("tracking report: run=%d status=%s recipients=%d sent=%d failed=%d", run.ID, run.Status, run.Recipients, run.Sent, run.Failed)
+		}
+	}()
+}
+
+// trackingRecipient is an active user who may receive the tracking report
+type trackingRecipient struct {
+	SuID  int64            `db:"su_id"`
+	Email string           `db:"su_email"`
+	SdID  utils.NullInt64  `db:"sd_id"`
+	Lang  utils.NullString `db:"su_language"`
+}
+
+// runTrackingReport sends every active user a workbook of the projects they are involved in
+// (owner, approver or creator of the project, scope "mine") and of the items of their department
+// (scope "department"); scope "all" gets both. The run and each recipient are recorded.
+func runTrackingReport(db *sqlx.DB, trigger, by string, now time.Time) (InfoReportRun, error) {
+	run := InfoReportRun{Report: reportTracking, Trigger: trigger, Status: reportRunning, StartedAt: now, CreatedBy: utils.NewNullString(by)}
+	if !trackingReportMu.TryLock() {
+		return run, errReportRunning
+	}
+	defer trackingReportMu.Unlock()
+
+	res, err := db.Exec(`INSERT INTO info_report_run (irr_report, irr_trigger, irr_status, irr_started_at, irr_created_by) VALUES (?, ?, ?, ?, ?)`,
+		run.Report, run.Trigger, run.Status, run.StartedAt, run.CreatedBy)
+	if err != nil {
+		return run, err
+	}
+	run.ID, _ = res.LastInsertId()
+
+	if err := sendTrackingReport(db, &run); err != nil {
+		run.Status = reportFailed
+		run.Error = utils.NewNullString(err.Error())
+	} else {
+		switch {
+		case run.Failed == 0:
+			run.Status = reportSuccess
+		case run.Sent > 0:
+			run.Status = reportPartial
+		default:
+			run.Status = reportFailed
+		}
+	}
+	finished := time.Now()
+	run.FinishedAt = &finished
+	if _, uerr := db.Exec(`UPDATE info_report_run SET irr_status = ?, irr_recipients = ?, irr_sent = ?, irr_failed = ?, irr_error = ?, irr_finished_at = ? WHERE irr_id = ?`,
+		run.Status, run.Recipients, run.Sent, run.Failed, run.Error, finished, run.ID); uerr != nil && err == nil {
+		err = uerr
+	}
+	if run.Status == reportFailed && err == nil && run.Error.Valid {
+		err = errors.New(run.Error.String)
+	}
+	return run, err
+}
+
+func sendTrackingReport(db *sqlx.DB, run *InfoReportRun) error {
+	var rows []MailData
+	if err := db.Select(&rows, trackingReportQuery); err != nil {
+		return err
+	}
+	involved, err := trackingInvolvement(db)
+	if err != nil {
+		return err
+	}
+	var users []trackingRecipient
+	if err := db.Select(&users, `SELECT su_id, su_email, sd_id, su_language FROM sys_user WHERE su_status = 'active' AND su_email IS NOT NULL AND su_email <> '' ORDER BY su_email`); err != nil {
+		return err
+	}
+
+	attachName := "TrackingProjects.xlsx"
+	for _, u := range users {
+		pref, err := userNotificationPref(db, u.SuID, mailTrackingReport)
+		if err != nil {
+			return err
+		}
+		if pref.Mode == notifyOff {
+			continue
+		}
+
+		own := make([]MailData, 0)
+		projects := map[int64]bool{}
+		for _, it := range rows {
+			mine := involved[u.SuID][it.IpID]
+			dept := u.SdID.Valid && containsID(it.SdIDs, u.SdID.Int64)
+			if (pref.Scope == notifyScopeMine && mine) || (pref.Scope == notifyScopeDepartment && dept) || (pref.Scope == notifyScopeAll && (mine || dept)) {
+				own = append(own, it)
+				projects[it.IpID] = true
+			}
+		}
+		if len(own) == 0 {
+			continue
+		}
+
+		run.Recipients++
+		rcpt := InfoReportRunRecipient{RunID: run.ID, SuID: u.SuID, Email: u.Email, Projects: len(projects), Items: len(own), Status: reportSent}
+		file, err := buildTrackingWorkbook(own)
+		if err == nil {
+			var subject, body string
+			subject, body, err = renderMail(db, mailTrackingReport, userMailLang(u.Lang.NullString), mailData{})
+			if err == nil {
+				err = SendMailWithAttachment(db, []string{u.Email}, subject, body, mailContentHTML, attachName, file)
+			}
+		}
+		if err != nil {
+			rcpt.Status, rcpt.Error = reportFailed, utils.NewNullString(err.Error())
+			run.Failed++
+		} else {
+			sentAt := time.Now()
+			rcpt.SentAt = &sentAt
+			run.Sent++
+		}
+		if _, err := db.Exec(`INSERT INTO info_report_run_recipient (irr_id, su_id, irrr_email, irrr_projects, irrr_items, irrr_status, irrr_error, irrr_sent_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+			rcpt.RunID, rcpt.SuID, rcpt.Email, rcpt.Projects, rcpt.Items, rcpt.Status, rcpt.Error, rcpt.SentAt); err != nil {
+			return err
+		}
+		run.Recipient = append(run.Recipient, rcpt)
+	}
+	return nil
+}
+
+// involvementSelect lists (su_id, ip_id) for every project a user owns an item of, approves an item of or created
+const involvementSelect = `SELECT DISTINCT x.su_id, x.ip_id FROM (
+			SELECT pid.su_id, COALESCE(ai.ip_id, pi.ip_id) AS ip_id
+			FROM info_project_item_detail pid
+			LEFT JOIN info_apqp_item ai ON ai.iai_id = pid.ref_id AND pid.ipid_type = 'apqp'
+			LEFT JOIN info_ppap_item pi ON pi.ipi_id = pid.ref_id AND pid.ipid_type = 'ppap'
+			WHERE pid.su_id IS NOT NULL
+			UNION
+			SELECT ia.su_id, COALESCE(ai.ip_id, pi.ip_id) AS ip_id
+			FROM info_approval ia
+			JOIN info_project_item_detail pid ON pid.ipid_id = ia.ipid_id
+			LEFT JOIN info_apqp_item ai ON ai.iai_id = pid.ref_id AND pid.ipid_type = 'apqp'
+			LEFT JOIN info_ppap_item pi ON pi.ipi_id = pid.ref_id AND pid.ipid_type = 'ppap'
+			WHERE ia.ia_status_flg = 'active'
+			UNION
+			SELECT su.su_id, ip.ip_id
+			FROM info_project ip
+			JOIN sys_user su ON su.su_emp_code = ip.ip_created_by
+		) x WHERE x.ip_id IS NOT NULL`
+
+// trackingInvolvement maps su_id -> ip_id of every project a user owns an item of, approves an item of or created
+func trackingInvolvement(q sqlx.Queryer) (map[int64]map[int64]bool, error) {
+	var rows []struct {
+		SuID int64 `db:"su_id"`
+		IpID int64 `db:"ip_id"`
+	}
+	if err := sqlx.Select(q, &rows, involvementSelect); err != nil {
+		return nil, err
+	}
+	res := map[int64]map[int64]bool{}
+	for _, r := range rows {
+		if res[r.SuID] == nil {
+			res[r.SuID] = map[int64]bool{}
+		}
+		res[r.SuID][r.IpID] = true
+	}
+	return res, nil
+}
+
+// ListReportRun lists the latest report runs (?limit=, default 50)
+func ListReportRun(c *fiber.Ctx, db *sqlx.DB) error {
+	limit, err := strconv.Atoi(c.Query("limit", "50"))
+	if err != nil || limit <= 0 || limit > 500 {
+		limit = 50
+	}
+	runs := []InfoReportRun{}
+	if err := db.Select(&runs, `SELECT irr_id, irr_report, irr_trigger, irr_status, irr_recipients, irr_sent, irr_failed, irr_error, irr_started_at, irr_finished_at, irr_created_by
+		FROM info_report_run ORDER BY irr_id DESC LIMIT ?`, limit); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "query error", "detail": err.Error()})
+	}
+	return c.Status(200).JSON(runs)
+}
+
+// GetReportRun returns one run with its recipients (?irr_id=)
+func GetReportRun(c *fiber.Ctx, db *sqlx.DB) error {
+	id, err := strconv.ParseInt(c.Query("irr_id"), 10, 64)
+	if err != nil || id <= 0 {
+		return c.Status(400).JSON(fiber.Map{"error": "irr_id is required"})
+	}
+	var run InfoReportRun
+	if err := db.Get(&run, `SELECT irr_id, irr_report, irr_trigger, irr_status, irr_recipients, irr_sent, irr_failed, irr_error, irr_started_at, irr_finished_at, irr_created_by
+		FROM info_report_run WHERE irr_id = ?`, id); err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "report run not found"})
+	}
+	run.Recipient = []InfoReportRunRecipient{}
+	if err := db.Select(&run.Recipient, `SELECT irrr_id, irr_id, su_id, irrr_email, irrr_projects, irrr_items, irrr_status, irrr_error, irrr_sent_at
+		FROM info_report_run_recipient WHERE irr_id = ? ORDER BY irrr_email`, id); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "query error", "detail": err.Error()})
+	}
+	return c.Status(200).JSON(run)
+}
+
+// trackingReportQuery lists every APQP / PPAP item with its project, template, owners and departments
+var trackingReportQuery = `SELECT
+					x.ip_id,
+					ip.ip_code,
+					ip.ip_part_name,
+					ip.ip_part_no,
+					ip.ip_model,
+					x.item_name,
+					x.item_type,
+					x.start_date,
+					x.end_date,
+					x.ipid_status,
+					mt.mt_name,
+					GROUP_CONCAT(DISTINCT x.owner_su_id ORDER BY x.owner_su_id SEPARATOR '/') AS owner_su_ids,
+					GROUP_CONCAT(
+						DISTINCT CONCAT('K.',su.su_firstname)
+						ORDER BY su.su_firstname
+						SEPARATOR '/'
+					) AS owner_names,
+					GROUP_CONCAT(
+						DISTINCT su.su_emp_code
+						ORDER BY su.su_emp_code
+						SEPARATOR '/'
+					) AS owner_emp_codes,
+					GROUP_CONCAT(DISTINCT x.sd_id ORDER BY x.sd_id SEPARATOR '/') AS sd_ids
+				FROM
+				(
+						SELECT
+							ai.ip_id                                   AS ip_id,
+							ai.iai_name                                AS item_name,
+							pid.ipid_type                              AS item_type,
+							COALESCE(pid.su_id, pid.ipid_line_code)    AS owner_su_id,
+							pid.ipid_start_date                        AS start_date,
+							pid.ipid_end_date                          AS end_date,
+							pid.ipid_id                                AS ipid_id,
+							pid.ipid_status                            AS ipid_status,
+							pid.sd_id                                  AS sd_id
+						FROM info_project_item_detail pid
+						JOIN info_apqp_item ai
+							ON ai.iai_id = pid.ref_id
+						   AND pid.ipid_type = 'apqp'
+
+						UNION ALL
+
+						SELECT
+							pi.ip_id                                   AS ip_id,
+							pi.ipi_name                                AS item_name,
+							pid.ipid_type                              AS item_type,
+							COALESCE(pid.su_id, pid.ipid_line_code)    AS owner_su_id,
+							pid.ipid_start_date                        AS start_date,
+							pid.ipid_end_date                          AS end_date,
+							pid.ipid_id                                AS ipid_id,
+							pid.ipid_status                            AS ipid_status,
+							pid.sd_id                                  AS sd_id
+						FROM info_project_item_detail pid
+						JOIN info_ppap_item pi
+							ON pi.ipi_id = pid.ref_id
+						   AND pid.ipid_type = 'ppap'
+				) x
+				LEFT JOIN sys_user su
+					ON su.su_id = x.owner_su_id
+				LEFT JOIN info_project ip
+					ON x.ip_id = ip.ip_id
+				LEFT JOIN mst_template mt
+					ON mt.mt_id = ip.mt_id
+				GROUP BY
+					x.ip_id,
+					ip.ip_code,
+					ip.ip_part_name,
+					ip.ip_part_no,
+					ip.ip_model,
+					x.item_name,
+					x.item_type,
+					x.start_date,
+					x.end_date,
+					x.ipid_status,
+					mt.mt_name
+				ORDER BY
+					x.item_type ASC,
+					x.start_date ASC,
+					x.item_name ASC`
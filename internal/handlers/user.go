@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"database/sql"
+	"strings"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
@@ -27,6 +28,7 @@ type SysUser struct {
 	CreatedAt          *time.Time    `db:"su_created_at" json:"created_at"`
 	UpdatedAt          *time.Time    `db:"su_updated_at" json:"updated_at"`
 	UpdatedBy          string        `db:"su_updated_by" json:"updated_by"`
+	Language           string        `db:"su_language" json:"language"`
 }
 
 // GetUser fetches a single user by username and returns JSON to the frontend
@@ -37,7 +39,7 @@ func GetUser(c *fiber.Ctx, db *sqlx.DB) error {
 	}
 
 	var u SysUser
-	err := db.Get(&u, `SELECT su.su_id AS su_id, su.su_username AS su_username, su.su_emp_code AS su_emp_code, su.su_firstname AS su_firstname, su.su_lastname AS su_lastname, su.su_email AS su_email, su.su_status AS su_status, su.spg_id AS spg_id, su.sd_id AS sd_id, d.sd_name AS sd_name, su.su_created_at AS su_created_at, su.su_updated_at AS su_updated_at FROM sys_user su LEFT JOIN sys_department d ON su.sd_id = d.sd_id WHERE su.su_username = ? LIMIT 1`, username)
+	err := db.Get(&u, `SELECT su.su_id AS su_id, su.su_username AS su_username, su.su_emp_code AS su_emp_code, su.su_firstname AS su_firstname, su.su_lastname AS su_lastname, su.su_email AS su_email, su.su_status AS su_status, su.spg_id AS spg_id, su.sd_id AS sd_id, d.sd_name AS sd_name, su.su_created_at AS su_created_at, su.su_updated_at AS su_updated_at, COALESCE(su.su_language, '') AS su_language FROM sys_user su LEFT JOIN sys_department d ON su.sd_id = d.sd_id WHERE su.su_username = ? LIMIT 1`, username)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return c.Status(404).JSON(fiber.Map{"error": "user not found"})
@@ -146,6 +148,40 @@ func UpdatePermissionGroupUser(c *fiber.Ctx, db *sqlx.DB) error {
 	return c.Status(200).JSON(1)
 }
 
+// UpdateUserLanguage sets the language of the user's notification mails
+// Expects JSON: { "su_id": 123, "su_language": "th|en", "updated_by": "optional" }
+func UpdateUserLanguage(c *fiber.Ctx, db *sqlx.DB) error {
+	var body struct {
+		ID        int64  `json:"su_id"`
+		Language  string `json:"su_language"`
+		UpdatedBy string `json:"updated_by"`
+	}
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid request body", "detail": err.Error()})
+	}
+	if body.ID == 0 {
+		return c.Status(400).JSON(fiber.Map{"error": "su_id is required"})
+	}
+	lang := strings.ToLower(strings.TrimSpace(body.Language))
+	if !validMailLang(lang) {
+		return c.Status(400).JSON(fiber.Map{"error": "su_language must be 'th' or 'en'"})
+	}
+	if body.UpdatedBy == "" {
+		body.UpdatedBy = "system"
+	}
+	now := time.Now()
+
+	res, err := db.Exec(`UPDATE sys_user SET su_language = ?, su_updated_at = ?, su_updated_by = ? WHERE su_id = ?`, lang, now, body.UpdatedBy, body.ID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to update user language", "detail": err.Error()})
+	}
+	ra, _ := res.RowsAffected()
+	if ra == 0 {
+		return c.Status(404).JSON(0)
+	}
+	return c.Status(200).JSON(1)
+}
+
 func GetUserByDepartment(c *fiber.Ctx, db *sqlx.DB) error {
 	sdID := c.Query("sd_id")
 	if sdID == "" {
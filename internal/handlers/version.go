@@ -0,0 +1,264 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jmoiron/sqlx"
+)
+
+// recordVersion names the optimistic-lock column of a table.
+// The version is *_updated_at (falling back to *_created_at) in microseconds; for a Set it
+// covers every row sharing IDCol and also changes when rows are added or removed.
+type recordVersion struct {
+	Table  string
+	IDCol  string
+	Column string
+	Set    bool
+	Lock   string // row locked (FOR UPDATE) before a derived Table is read, "" locks the rows read
+}
+
+// versioned records
+var (
+	projectVersion           = recordVersion{Table: "info_project", IDCol: "ip_id", Column: "ip_updated_at"}
+	customerEventVersion     = recordVersion{Table: "info_customer_event", IDCol: "ip_id", Column: "ice_updated_at"}
+	projectItemVersion       = recordVersion{Table: "info_project_item_detail", IDCol: "ipid_id", Column: "ipid_updated_at"}
+	projectMasterPlanVersion = recordVersion{Table: "info_project_master_plan", IDCol: "ipmp_id", Column: "ipmp_updated_at"}
+	projectPlanSetVersion    = recordVersion{Table: "info_project_master_plan", IDCol: "ip_id", Column: "ipmp_updated_at", Set: true}
+	masterPlanVersion        = recordVersion{Table: "mst_master_plan", IDCol: "mmp_id", Column: "mmp_updated_at"}
+	modelMasterVersion       = recordVersion{Table: "mst_model_master", IDCol: "mmm_id", Column: "mmm_updated_at"}
+	templateVersion          = recordVersion{Table: "mst_template", IDCol: "mt_id", Column: "mt_updated_at"}
+	templateDetailVersion    = recordVersion{Table: "mst_template_detail", IDCol: "mtpd_id", Column: "mtpd_updated_at"}
+	ppapDetailVersion        = recordVersion{Table: "mst_ppap_detail", IDCol: "mpd_id", Column: "mpd_updated_at"}
+	apqpVersion              = recordVersion{Table: "mst_apqp", IDCol: "ma_id", Column: "ma_updated_at"}
+	ppapItemVersion          = recordVersion{Table: "mst_ppap_item", IDCol: "mpi_id", Column: "mpi_updated_at"}
+	projectPhaseVersion      = recordVersion{Table: "mst_project_phase", IDCol: "mpp_id", Column: "mpp_updated_at"}
+	workflowVersion          = recordVersion{Table: "sys_workflow", IDCol: "sw_id", Column: "sw_updated_at"}
+	approvalStageVersion     = recordVersion{Table: "sys_approval_stage", IDCol: "sas_id", Column: "sas_updated_at"}
+	departmentVersion        = recordVersion{Table: "sys_department", IDCol: "sd_id", Column: "sd_updated_at"}
+	menuGroupVersion         = recordVersion{Table: "sys_menu", IDCol: "sm_id", Column: "sm_updated_at"}
+	subMenuVersion           = recordVersion{Table: "sys_submenu", IDCol: "ss_id", Column: "ss_updated_at"}
+	permissionGroupVersion   = recordVersion{Table: "sys_permission_group", IDCol: "spg_id", Column: "spg_updated_at"}
+	holidayVersion           = recordVersion{Table: "mst_holiday", IDCol: "mh_id", Column: "mh_updated_at"}
+	calendarVersion          = recordVersion{Table: "mst_calendar", IDCol: "mc_id", Column: "mc_updated_at"}
+	calendarHolidayVersion   = recordVersion{Table: "mst_calendar_holiday", IDCol: "mch_id", Column: "mch_updated_at"}
+	emailTemplateVersion     = recordVersion{Table: "mst_email_template", IDCol: "met_id", Column: "met_updated_at"}
+)
+
+// item details of a project (ip_id comes from the APQP / PPAP item)
+var projectItemSetVersion = recordVersion{Table: `(SELECT pid.ipid_id, pid.ref_id, pid.ipid_type, pid.ipid_start_date, pid.ipid_end_date, pid.ipid_status,
+			pid.ipid_created_at, pid.ipid_updated_at, COALESCE(ai.ip_id, pi.ip_id) AS ip_id
+		FROM info_project_item_detail pid
+		LEFT JOIN info_apqp_item ai ON ai.iai_id = pid.ref_id AND pid.ipid_type = 'apqp'
+		LEFT JOIN info_ppap_item pi ON pi.ipi_id = pid.ref_id AND pid.ipid_type = 'ppap') x`, IDCol: "ip_id", Column: "ipid_updated_at", Set: true,
+	Lock: `SELECT ip_id FROM info_project WHERE ip_id = ? FOR UPDATE`}
+
+var (
+	errVersionInvalid  = errors.New("invalid version")
+	errVersionNotFound = errors.New("record not found")
+	reSetVersion       = regexp.MustCompile(`^\d+-\d+$`)
+)
+
+// versionConflictError carries the current state returned with 409
+type versionConflictError struct {
+	ETag    string
+	Current interface{}
+}
+
+func (e *versionConflictError) Error() string { return "record was changed by another user" }
+
+// currentVersion returns the stored version token ("" when the record does not exist).
+// Inside a transaction the record is locked until commit.
+func currentVersion(q sqlx.Queryer, v recordVersion, id interface{}) (string, error) {
+	created := strings.TrimSuffix(v.Column, "_updated_at") + "_created_at"
+	query := fmt.Sprintf(`SELECT COUNT(*) AS n, MAX(COALESCE(%s, %s)) AS ts FROM %s WHERE %s = ?`, v.Column, created, v.Table, v.IDCol)
+	if _, ok := q.(*sqlx.Tx); ok {
+		if v.Lock != "" {
+			var locked int64
+			if err := sqlx.Get(q, &locked, v.Lock, id); err != nil && !errors.Is(err, sql.ErrNoRows) {
+				return "", err
+			}
+		} else {
+			query += " FOR UPDATE"
+		}
+	}
+	var row struct {
+		N  int          `db:"n"`
+		TS sql.NullTime `db:"ts"`
+	}
+	if err := sqlx.Get(q, &row, query, id); err != nil {
+		return "", err
+	}
+	var ts int64
+	if row.TS.Valid {
+		ts = row.TS.Time.UnixMicro()
+	}
+	if v.Set {
+		return fmt.Sprintf("%d-%d", row.N, ts), nil
+	}
+	if row.N == 0 {
+		return "", nil
+	}
+	return strconv.FormatInt(ts, 10), nil
+}
+
+// normalizeVersion turns an ETag or a *_updated_at timestamp into a version token
+func normalizeVersion(s string) (string, error) {
+	s = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(s), "W/"))
+	s = strings.Trim(s, `"`)
+	if _, err := strconv.ParseInt(s, 10, 64); err == nil || reSetVersion.MatchString(s) {
+		return s, nil
+	}
+	t, err := parseItemVersion(s)
+	if err != nil {
+		return "", errVersionInvalid
+	}
+	return strconv.FormatInt(t.UnixMicro(), 10), nil
+}
+
+// clientVersion reads the version sent with an update: If-Match header (for "version"),
+// then the field in query, form or JSON body. "" means the client did not send one.
+func clientVersion(c *fiber.Ctx, field string) string {
+	if field == "version" {
+		if h := strings.TrimSpace(c.Get(fiber.HeaderIfMatch)); h != "" && h != "*" {
+			return h
+		}
+	}
+	if v := c.Query(field); v != "" {
+		return v
+	}
+	if strings.HasPrefix(string(c.Request().Header.ContentType()), fiber.MIMEApplicationJSON) {
+		var body map[string]interface{}
+		if err := json.Unmarshal(c.Body(), &body); err == nil {
+			switch t := body[field].(type) {
+			case string:
+				return t
+			case float64:
+				return strconv.FormatInt(int64(t), 10)
+			}
+		}
+		return ""
+	}
+	return c.FormValue(field)
+}
+
+// checkVersion compares the client version (If-Match / "version") with the stored record.
+// The record stays locked until tx ends, so write it in the same transaction.
+// Requests without a version are accepted unchanged.
+func checkVersion(c *fiber.Ctx, tx *sqlx.Tx, v recordVersion, id interface{}) error {
+	return checkVersionField(c, tx, v, id, "version")
+}
+
+// checkVersionField is checkVersion for a record whose version comes in another field
+func checkVersionField(c *fiber.Ctx, tx *sqlx.Tx, v recordVersion, id interface{}, field string) error {
+	sent := clientVersion(c, field)
+	if sent == "" {
+		return nil
+	}
+	want, err := normalizeVersion(sent)
+	if err != nil {
+		return err
+	}
+	got, err := currentVersion(tx, v, id)
+	if err != nil {
+		return err
+	}
+	if got == "" {
+		return errVersionNotFound
+	}
+	if got == want {
+		return nil
+	}
+	current, err := currentRecord(tx, v, id)
+	if err != nil {
+		return err
+	}
+	return &versionConflictError{ETag: `"` + got + `"`, Current: current}
+}
+
+// currentRecord loads the stored row(s) for a 409 response
+func currentRecord(q sqlx.Queryer, v recordVersion, id interface{}) (interface{}, error) {
+	rows, err := q.Queryx(fmt.Sprintf(`SELECT * FROM %s WHERE %s = ?`, v.Table, v.IDCol), id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	list := []map[string]interface{}{}
+	for rows.Next() {
+		m := map[string]interface{}{}
+		if err := rows.MapScan(m); err != nil {
+			return nil, err
+		}
+		for k, val := range m {
+			if b, ok := val.([]byte); ok {
+				m[k] = string(b)
+			}
+		}
+		list = append(list, m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if !v.Set && len(list) > 0 {
+		return list[0], nil
+	}
+	return list, nil
+}
+
+// execVersioned checks the version of one record and runs its UPDATE in one transaction.
+// Check errors are reported by isVersionError.
+func execVersioned(c *fiber.Ctx, db *sqlx.DB, v recordVersion, id interface{}, query string, args ...interface{}) (sql.Result, error) {
+	tx, err := db.Beginx()
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = tx.Rollback() }()
+	if err := checkVersion(c, tx, v, id); err != nil {
+		return nil, &versionCheckError{err}
+	}
+	res, err := tx.Exec(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	return res, tx.Commit()
+}
+
+// versionCheckError wraps a checkVersion error returned by execVersioned
+type versionCheckError struct{ err error }
+
+func (e *versionCheckError) Error() string { return e.err.Error() }
+func (e *versionCheckError) Unwrap() error { return e.err }
+
+// isVersionError reports whether an execVersioned error comes from the version check
+func isVersionError(err error) bool {
+	var vc *versionCheckError
+	return errors.As(err, &vc)
+}
+
+// versionError writes the response for a checkVersion error
+func versionError(c *fiber.Ctx, err error) error {
+	var vc *versionConflictError
+	switch {
+	case errors.As(err, &vc):
+		c.Set(fiber.HeaderETag, vc.ETag)
+		return c.Status(409).JSON(fiber.Map{"error": vc.Error(), "etag": vc.ETag, "current": vc.Current})
+	case errors.Is(err, errVersionInvalid):
+		return c.Status(400).JSON(fiber.Map{"error": "invalid version / If-Match value"})
+	case errors.Is(err, errVersionNotFound):
+		return c.Status(404).JSON(fiber.Map{"error": "not found"})
+	}
+	return c.Status(500).JSON(fiber.Map{"error": "version check failed", "detail": err.Error()})
+}
+
+// setETag exposes the version of a record on a GET response
+func setETag(c *fiber.Ctx, q sqlx.Queryer, v recordVersion, id interface{}) {
+	if tok, err := currentVersion(q, v, id); err == nil && tok != "" {
+		c.Set(fiber.HeaderETag, `"`+tok+`"`)
+	}
+}
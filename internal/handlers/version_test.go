@@ -0,0 +1,43 @@
+package handlers
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestNormalizeVersion(t *testing.T) {
+	// 2025-10-09T08:53:20Z is 1760000000
+	tests := []struct {
+		in, want string
+	}{
+		{`"1760000000123456"`, "1760000000123456"},
+		{`W/"3-1760000000123456"`, "3-1760000000123456"},
+		{"2025-10-09T08:53:20.123456Z", "1760000000123456"},
+		{"2025-10-09T08:53:20.5Z", "1760000000500000"},
+		{"2025-10-09T08:53:20Z", "1760000000000000"},
+	}
+	for _, tt := range tests {
+		got, err := normalizeVersion(tt.in)
+		if err != nil || got != tt.want {
+			t.Errorf("normalizeVersion(%q) = %q, %v; want %q", tt.in, got, err, tt.want)
+		}
+	}
+	if _, err := normalizeVersion("yesterday"); !errors.Is(err, errVersionInvalid) {
+		t.Errorf("normalizeVersion(yesterday) error = %v, want errVersionInvalid", err)
+	}
+}
+
+func TestParseItemVersionETag(t *testing.T) {
+	// an item ETag parses back to the microsecond it was issued for
+	want := time.Date(2025, 10, 9, 8, 53, 20, 123456000, time.UTC)
+	got, err := parseItemVersion(`W/"` + strconv.FormatInt(want.UnixMicro(), 10) + `"`)
+	if err != nil || !got.Equal(want) {
+		t.Errorf("parseItemVersion(ETag) = %v, %v; want %v", got, err, want)
+	}
+	tok, err := normalizeVersion(got.Format(time.RFC3339Nano))
+	if err != nil || tok != strconv.FormatInt(want.UnixMicro(), 10) {
+		t.Errorf("normalizeVersion(%v) = %q, %v; want the same token", got, tok, err)
+	}
+}
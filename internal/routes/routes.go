@@ -18,6 +18,7 @@ func Setup(app *fiber.App, db *sqlx.DB) {
 	app.Get("/apiTrackingSystem/users", func(c *fiber.Ctx) error { return handlers.ListUsers(c, db) })
 	app.Post("/apiTrackingSystem/user/updateUserStatus", func(c *fiber.Ctx) error { return handlers.UpdateUserStatus(c, db) })
 	app.Post("/apiTrackingSystem/user/UpdatePermissionGroupUser", func(c *fiber.Ctx) error { return handlers.UpdatePermissionGroupUser(c, db) })
+	app.Post("/apiTrackingSystem/user/UpdateUserLanguage", func(c *fiber.Ctx) error { return handlers.UpdateUserLanguage(c, db) })
 	// Permission group routes
 	app.Get("/apiTrackingSystem/permission/ListPermissionGroups", func(c *fiber.Ctx) error { return handlers.ListPermissionGroups(c, db) })
 	app.Get("/apiTrackingSystem/permission/GetSelectPermissionGroups", func(c *fiber.Ctx) error { return handlers.GetSelectPermissionGroups(c, db) })
@@ -64,6 +65,8 @@ func Setup(app *fiber.App, db *sqlx.DB) {
 	app.Get("/apiTrackingSystem/masterPlan/GetMasterPlanStep2", func(c *fiber.Ctx) error { return handlers.GetMasterPlanStep2(c, db) })
 	app.Get("/apiTrackingSystem/masterPlan/GetMasterPlanStep2T", func(c *fiber.Ctx) error { return handlers.GetMasterPlanStep2T(c, db) })
 	app.Get("/apiTrackingSystem/masterPlan/GetMasterPlanStep3", func(c *fiber.Ctx) error { return handlers.GetMasterPlanStep3(c, db) })
+	app.Get("/apiTrackingSystem/masterPlan/ListMasterPlanLink", func(c *fiber.Ctx) error { return handlers.ListMasterPlanLink(c, db) })
+	app.Post("/apiTrackingSystem/masterPlan/SaveMasterPlanLink", func(c *fiber.Ctx) error { return handlers.SaveMasterPlanLink(c, db) })
 
 	app.Get("/apiTrackingSystem/manageTemplate/ListTemplateDetails", func(c *fiber.Ctx) error { return handlers.ListTemplateDetails(c, db) })
 	app.Get("/apiTrackingSystem/manageTemplate/SelectTemplate", func(c *fiber.Ctx) error { return handlers.SelectTemplate(c, db) })
@@ -71,6 +74,8 @@ func Setup(app *fiber.App, db *sqlx.DB) {
 	app.Post("/apiTrackingSystem/manageTemplate/InsertTemplateDetail", func(c *fiber.Ctx) error { return handlers.InsertTemplateDetail(c, db) })
 	app.Post("/apiTrackingSystem/manageTemplate/UpdateTemplateDetail", func(c *fiber.Ctx) error { return handlers.UpdateTemplateDetail(c, db) })
 	app.Post("/apiTrackingSystem/manageTemplate/UpdateTemplateDetailStatus", func(c *fiber.Ctx) error { return handlers.UpdateTemplateDetailStatus(c, db) })
+	app.Get("/apiTrackingSystem/manageTemplate/ListTemplateSchedule", func(c *fiber.Ctx) error { return handlers.ListTemplateSchedule(c, db) })
+	app.Post("/apiTrackingSystem/manageTemplate/SaveTemplateSchedule", func(c *fiber.Ctx) error { return handlers.SaveTemplateSchedule(c, db) })
 
 	app.Get("/apiTrackingSystem/manageWorkflow/ListWorkflow", func(c *fiber.Ctx) error { return handlers.ListWorkflow(c, db) })
 	app.Get("/apiTrackingSystem/manageWorkflow/SelectDepartmentMW", func(c *fiber.Ctx) error { return handlers.SelectDepartmentMW(c, db) })
@@ -78,6 +83,12 @@ func Setup(app *fiber.App, db *sqlx.DB) {
 	app.Post("/apiTrackingSystem/manageWorkflow/UpdateWorkflow", func(c *fiber.Ctx) error { return handlers.UpdateWorkflow(c, db) })
 	app.Post("/apiTrackingSystem/manageWorkflow/UpdateWorkflowStatus", func(c *fiber.Ctx) error { return handlers.UpdateWorkflowStatus(c, db) })
 	app.Get("/apiTrackingSystem/manageWorkflow/SelectUserMW", func(c *fiber.Ctx) error { return handlers.SelectUserMW(c, db) })
+	app.Get("/apiTrackingSystem/manageWorkflow/ListApprovalStage", func(c *fiber.Ctx) error { return handlers.ListApprovalStage(c, db) })
+	app.Post("/apiTrackingSystem/manageWorkflow/InsertApprovalStage", func(c *fiber.Ctx) error { return handlers.InsertApprovalStage(c, db) })
+	app.Post("/apiTrackingSystem/manageWorkflow/UpdateApprovalStage", func(c *fiber.Ctx) error { return handlers.UpdateApprovalStage(c, db) })
+	app.Get("/apiTrackingSystem/manageWorkflow/ListWorkflowRule", func(c *fiber.Ctx) error { return handlers.ListWorkflowRule(c, db) })
+	app.Post("/apiTrackingSystem/manageWorkflow/SaveWorkflowRule", func(c *fiber.Ctx) error { return handlers.SaveWorkflowRule(c, db) })
+	app.Post("/apiTrackingSystem/manageWorkflow/UpdateWorkflowRuleStatus", func(c *fiber.Ctx) error { return handlers.UpdateWorkflowRuleStatus(c, db) })
 
 	app.Get("/apiTrackingSystem/manageAPQP/ListAPQP", func(c *fiber.Ctx) error { return handlers.ListAPQP(c, db) })
 	app.Post("/apiTrackingSystem/manageAPQP/InsertAPQP", func(c *fiber.Ctx) error { return handlers.InsertAPQP(c, db) })
@@ -129,6 +140,7 @@ func Setup(app *fiber.App, db *sqlx.DB) {
 	app.Post("/apiTrackingSystem/manageProject/InsertProjectStep3", func(c *fiber.Ctx) error { return handlers.InsertProjectStep3(c, db) })
 	app.Post("/apiTrackingSystem/manageProject/UpdateStatusProjectItemDetail", func(c *fiber.Ctx) error { return handlers.UpdateStatusProjectItemDetail(c, db) })
 	app.Post("/apiTrackingSystem/manageProject/UpdateStatusCompleteProject", func(c *fiber.Ctx) error { return handlers.UpdateStatusCompleteProject(c, db) })
+	app.Get("/apiTrackingSystem/manageProject/ExportProjectEvidence", func(c *fiber.Ctx) error { return handlers.ExportProjectEvidence(c, db) })
 
 	app.Get("/apiTrackingSystem/menu/GetUserMenu", func(c *fiber.Ctx) error { return handlers.GetUserMenu(c, db) })
 
@@ -136,9 +148,19 @@ func Setup(app *fiber.App, db *sqlx.DB) {
 	app.Get("/apiTrackingSystem/manageProjectTracking/CountProjectTracking", func(c *fiber.Ctx) error { return handlers.CountProjectTracking(c, db) })
 	app.Get("/apiTrackingSystem/manageProjectTracking/GetListProjectTracking", func(c *fiber.Ctx) error { return handlers.GetListProjectTracking(c, db) })
 	app.Post("/apiTrackingSystem/manageProjectTracking/InsertProjectTracking", func(c *fiber.Ctx) error { return handlers.InsertProjectTracking(c, db) })
+	app.Get("/apiTrackingSystem/manageProjectTracking/GetApprovalTimeline", func(c *fiber.Ctx) error { return handlers.GetApprovalTimeline(c, db) })
 	// app.Get("/apiTrackingSystem/manageProjectTracking/SaveFileSendEmail", func(c *fiber.Ctx) error { return handlers.SaveFileSendEmail(c, db) })
 
 	app.Post("/apiTrackingSystem/projectMasterPlan/InsertProjectMasterPlan", func(c *fiber.Ctx) error { return handlers.InsertProjectMasterPlan(c, db) })
+	app.Get("/apiTrackingSystem/projectMasterPlan/ListProjectPlanLink", func(c *fiber.Ctx) error { return handlers.ListProjectPlanLink(c, db) })
+	app.Post("/apiTrackingSystem/projectMasterPlan/SaveProjectPlanLink", func(c *fiber.Ctx) error { return handlers.SaveProjectPlanLink(c, db) })
+	app.Post("/apiTrackingSystem/projectMasterPlan/ScheduleProjectPlan", func(c *fiber.Ctx) error { return handlers.ScheduleProjectPlan(c, db) })
+	app.Get("/apiTrackingSystem/projectMasterPlan/GetCriticalPath", func(c *fiber.Ctx) error { return handlers.GetCriticalPath(c, db) })
+	app.Get("/apiTrackingSystem/projectMasterPlan/GenerateProjectSchedule", func(c *fiber.Ctx) error { return handlers.GenerateProjectSchedule(c, db) })
+	app.Post("/apiTrackingSystem/projectMasterPlan/AcceptProjectSchedule", func(c *fiber.Ctx) error { return handlers.AcceptProjectSchedule(c, db) })
+	app.Get("/apiTrackingSystem/projectMasterPlan/ListProjectBaseline", func(c *fiber.Ctx) error { return handlers.ListProjectBaseline(c, db) })
+	app.Post("/apiTrackingSystem/projectMasterPlan/SaveProjectBaseline", func(c *fiber.Ctx) error { return handlers.SaveProjectBaseline(c, db) })
+	app.Get("/apiTrackingSystem/projectMasterPlan/GetScheduleVariance", func(c *fiber.Ctx) error { return handlers.GetScheduleVariance(c, db) })
 
 	app.Get("/apiTrackingSystem/remainTask/ListRemainTasks", func(c *fiber.Ctx) error { return handlers.ListRemainTasks(c, db) })
 	app.Get("/apiTrackingSystem/remainTask/NotifyRemainTasks", func(c *fiber.Ctx) error { return handlers.NotifyRemainTasks(c, db) })
@@ -147,8 +169,62 @@ func Setup(app *fiber.App, db *sqlx.DB) {
 	app.Get("/apiTrackingSystem/remainTask/SelectKickOffDateRT", func(c *fiber.Ctx) error { return handlers.SelectKickOffDateRT(c, db) })
 	app.Get("/apiTrackingSystem/remainTask/GetCountItem", func(c *fiber.Ctx) error { return handlers.GetCountItem(c, db) })
 	app.Post("/apiTrackingSystem/remainTask/UpdateStatusFileProject", func(c *fiber.Ctx) error { return handlers.UpdateStatusFileProject(c, db) })
+	app.Post("/apiTrackingSystem/remainTask/BulkUpdateApprovalStatus", func(c *fiber.Ctx) error { return handlers.BulkUpdateApprovalStatus(c, db) })
+
+	app.Get("/apiTrackingSystem/delegation/ListDelegation", func(c *fiber.Ctx) error { return handlers.ListDelegation(c, db) })
+	app.Post("/apiTrackingSystem/delegation/InsertDelegation", func(c *fiber.Ctx) error { return handlers.InsertDelegation(c, db) })
+	app.Post("/apiTrackingSystem/delegation/UpdateDelegationStatus", func(c *fiber.Ctx) error { return handlers.UpdateDelegationStatus(c, db) })
+
+	app.Get("/apiTrackingSystem/approvalSLA/ListWorkflowSLA", func(c *fiber.Ctx) error { return handlers.ListWorkflowSLA(c, db) })
+	app.Post("/apiTrackingSystem/approvalSLA/SaveWorkflowSLA", func(c *fiber.Ctx) error { return handlers.SaveWorkflowSLA(c, db) })
+	app.Post("/apiTrackingSystem/approvalSLA/RunApprovalSLA", func(c *fiber.Ctx) error { return handlers.RunApprovalSLA(c, db) })
+
+	app.Post("/apiTrackingSystem/statusRollup/RunStatusRollup", func(c *fiber.Ctx) error { return handlers.RunStatusRollup(c, db) })
+	app.Get("/apiTrackingSystem/statusRollup/ListStatusEvent", func(c *fiber.Ctx) error { return handlers.ListStatusEvent(c, db) })
+
+	app.Get("/apiTrackingSystem/calendar/ListHoliday", func(c *fiber.Ctx) error { return handlers.ListHoliday(c, db) })
+	app.Post("/apiTrackingSystem/calendar/InsertHoliday", func(c *fiber.Ctx) error { return handlers.InsertHoliday(c, db) })
+	app.Post("/apiTrackingSystem/calendar/UpdateHolidayStatus", func(c *fiber.Ctx) error { return handlers.UpdateHolidayStatus(c, db) })
+	app.Get("/apiTrackingSystem/calendar/ListCalendar", func(c *fiber.Ctx) error { return handlers.ListCalendar(c, db) })
+	app.Post("/apiTrackingSystem/calendar/InsertCalendar", func(c *fiber.Ctx) error { return handlers.InsertCalendar(c, db) })
+	app.Post("/apiTrackingSystem/calendar/UpdateCalendar", func(c *fiber.Ctx) error { return handlers.UpdateCalendar(c, db) })
+	app.Get("/apiTrackingSystem/calendar/ListCalendarHoliday", func(c *fiber.Ctx) error { return handlers.ListCalendarHoliday(c, db) })
+	app.Post("/apiTrackingSystem/calendar/InsertCalendarHoliday", func(c *fiber.Ctx) error { return handlers.InsertCalendarHoliday(c, db) })
+	app.Post("/apiTrackingSystem/calendar/UpdateCalendarHoliday", func(c *fiber.Ctx) error { return handlers.UpdateCalendarHoliday(c, db) })
+	app.Get("/apiTrackingSystem/calendar/CalendarWorkingDays", func(c *fiber.Ctx) error { return handlers.CalendarWorkingDays(c, db) })
+	app.Get("/apiTrackingSystem/calendar/CalendarShiftDate", func(c *fiber.Ctx) error { return handlers.CalendarShiftDate(c, db) })
+	app.Post("/apiTrackingSystem/calendar/CheckCalendarDates", func(c *fiber.Ctx) error { return handlers.CheckCalendarDates(c, db) })
+
+	app.Get("/apiTrackingSystem/approvalSignature/ListApprovalSignature", func(c *fiber.Ctx) error { return handlers.ListApprovalSignature(c, db) })
+	app.Get("/apiTrackingSystem/approvalSignature/VerifyApprovalSignature", func(c *fiber.Ctx) error { return handlers.VerifyApprovalSignature(c, db) })
+	app.Get("/apiTrackingSystem/approvalSignature/GetApprovalSigningStatus", func(c *fiber.Ctx) error { return handlers.GetApprovalSigningStatus(c) })
+
+	app.Get("/apiTrackingSystem/notification/ListNotificationOutbox", func(c *fiber.Ctx) error { return handlers.ListNotificationOutbox(c, db) })
+	app.Post("/apiTrackingSystem/notification/ResendNotification", func(c *fiber.Ctx) error { return handlers.ResendNotification(c, db) })
+	app.Get("/apiTrackingSystem/notification/ListMailLog", func(c *fiber.Ctx) error { return handlers.ListMailLog(c, db) })
+	app.Get("/apiTrackingSystem/notification/GetMailLog", func(c *fiber.Ctx) error { return handlers.GetMailLog(c, db) })
+	app.Post("/apiTrackingSystem/notification/RunNotificationDispatch", func(c *fiber.Ctx) error { return handlers.RunNotificationDispatch(c, db) })
+	app.Get("/apiTrackingSystem/notification/ListNotificationPref", func(c *fiber.Ctx) error { return handlers.ListNotificationPref(c, db) })
+	app.Post("/apiTrackingSystem/notification/SaveNotificationPref", func(c *fiber.Ctx) error { return handlers.SaveNotificationPref(c, db) })
+	app.Post("/apiTrackingSystem/notification/RunNotificationDigest", func(c *fiber.Ctx) error { return handlers.RunNotificationDigest(c, db) })
+	app.Get("/apiTrackingSystem/notification/ListNotification", func(c *fiber.Ctx) error { return handlers.ListNotification(c, db) })
+	app.Post("/apiTrackingSystem/notification/MarkNotificationRead", func(c *fiber.Ctx) error { return handlers.MarkNotificationRead(c, db) })
+	app.Post("/apiTrackingSystem/notification/MarkAllNotificationRead", func(c *fiber.Ctx) error { return handlers.MarkAllNotificationRead(c, db) })
+
+	app.Get("/apiTrackingSystem/emailTemplate/ListEmailTemplate", func(c *fiber.Ctx) error { return handlers.ListEmailTemplate(c, db) })
+	app.Post("/apiTrackingSystem/emailTemplate/SaveEmailTemplate", func(c *fiber.Ctx) error { return handlers.SaveEmailTemplate(c, db) })
+	app.Get("/apiTrackingSystem/emailTemplate/PreviewEmailTemplate", func(c *fiber.Ctx) error { return handlers.PreviewEmailTemplate(c, db) })
+	app.Post("/apiTrackingSystem/emailTemplate/PreviewEmailTemplate", func(c *fiber.Ctx) error { return handlers.PreviewEmailTemplate(c, db) })
 
 	app.Get("/apiTrackingSystem/sendMail/SendMailAuto", func(c *fiber.Ctx) error { return handlers.SendMailAuto(c, db) })
+	app.Get("/apiTrackingSystem/sendMail/ListReportRun", func(c *fiber.Ctx) error { return handlers.ListReportRun(c, db) })
+	app.Get("/apiTrackingSystem/sendMail/GetReportRun", func(c *fiber.Ctx) error { return handlers.GetReportRun(c, db) })
+
+	// Event stream (Server-Sent Events)
+	app.Get("/apiTrackingSystem/stream/StreamEvents", func(c *fiber.Ctx) error { return handlers.StreamEvents(c, db) })
+
+	app.Get("/apiTrackingSystem/storage/ReconcileStorage", func(c *fiber.Ctx) error { return handlers.ReconcileStorage(c, db) })
+	app.Post("/apiTrackingSystem/storage/ReconcileStorage", func(c *fiber.Ctx) error { return handlers.ReconcileStorage(c, db) })
 
 	app.Get("/apiTrackingSystem/dashboard/ListInprogressProjects", func(c *fiber.Ctx) error { return handlers.ListInprogressProjects(c, db) })
 	app.Get("/apiTrackingSystem/dashboard/MasterPlanSummary", func(c *fiber.Ctx) error { return handlers.ListMasterPlanSummary(c, db) })
@@ -0,0 +1,100 @@
+package utils
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseCron(t *testing.T) {
+	tests := []struct {
+		expr  string
+		field func(s *CronSchedule) uint64
+		want  []int
+	}{
+		{"5 * * * *", func(s *CronSchedule) uint64 { return s.minute }, []int{5}},
+		{"0,15,45 * * * *", func(s *CronSchedule) uint64 { return s.minute }, []int{0, 15, 45}},
+		{"*/20 * * * *", func(s *CronSchedule) uint64 { return s.minute }, []int{0, 20, 40}},
+		{"50/5 * * * *", func(s *CronSchedule) uint64 { return s.minute }, []int{50, 55}},
+		{"0 8-18/2 * * *", func(s *CronSchedule) uint64 { return s.hour }, []int{8, 10, 12, 14, 16, 18}},
+		{"0 0,22-23 * * *", func(s *CronSchedule) uint64 { return s.hour }, []int{0, 22, 23}},
+		{"0 0 * * 1-5", func(s *CronSchedule) uint64 { return s.dow }, []int{1, 2, 3, 4, 5}},
+		{"0 0 * * 7", func(s *CronSchedule) uint64 { return s.dow }, []int{0, 7}},
+		{"0 0 * * 5-7", func(s *CronSchedule) uint64 { return s.dow }, []int{0, 5, 6, 7}},
+		{"@monthly", func(s *CronSchedule) uint64 { return s.dom }, []int{1}},
+	}
+	for _, tt := range tests {
+		s, err := ParseCron(tt.expr)
+		if err != nil {
+			t.Errorf("ParseCron(%q): %v", tt.expr, err)
+			continue
+		}
+		var want uint64
+		for _, v := range tt.want {
+			want |= 1 << uint(v)
+		}
+		if got := tt.field(s); got != want {
+			t.Errorf("ParseCron(%q) = %b, want %b", tt.expr, got, want)
+		}
+	}
+
+	for _, expr := range []string{
+		"", "* * * *", "* * * * * *", "60 * * * *", "* 24 * * *", "* * 0 * *", "* * * 13 *", "* * * * 8",
+		"5-1 * * * *", "*/0 * * * *", "a * * * *", "1-x * * * *", "@yearly",
+	} {
+		if _, err := ParseCron(expr); err == nil {
+			t.Errorf("ParseCron(%q) accepted an invalid expression", expr)
+		}
+	}
+}
+
+func TestCronNext(t *testing.T) {
+	at := func(s string) time.Time {
+		v, err := time.Parse("2006-01-02 15:04", s)
+		if err != nil {
+			panic(err)
+		}
+		return v
+	}
+	// 2026-03-02 is a Monday
+	tests := []struct {
+		name, expr, from, want string
+	}{
+		{"next minute", "* * * * *", "2026-03-02 10:15", "2026-03-02 10:16"},
+		{"later the same hour", "30 * * * *", "2026-03-02 10:15", "2026-03-02 10:30"},
+		{"exact time is not repeated", "15 10 * * *", "2026-03-02 10:15", "2026-03-03 10:15"},
+		{"step through the hours", "0 8-18/2 * * *", "2026-03-02 10:01", "2026-03-02 12:00"},
+		{"after the last hour of a range", "0 8-18/2 * * *", "2026-03-02 18:00", "2026-03-03 08:00"},
+		{"weekdays skip the weekend", "0 7 * * 1-5", "2026-03-06 08:00", "2026-03-09 07:00"},
+		{"dow 7 is Sunday", "0 9 * * 7", "2026-03-02 00:00", "2026-03-08 09:00"},
+		{"dow 0 is Sunday", "0 9 * * 0", "2026-03-02 00:00", "2026-03-08 09:00"},
+		{"dom or dow: dow first", "0 0 15 * 5", "2026-03-02 00:00", "2026-03-06 00:00"},
+		{"dom or dow: dom first", "0 0 3 * 5", "2026-03-02 00:00", "2026-03-03 00:00"},
+		{"dom with any dow", "0 0 15 * *", "2026-03-02 00:00", "2026-03-15 00:00"},
+		{"month rollover", "0 0 1 * *", "2026-03-15 12:00", "2026-04-01 00:00"},
+		{"year rollover", "30 6 1 1 *", "2026-03-02 00:00", "2027-01-01 06:30"},
+		{"31st skips short months", "0 0 31 * *", "2026-03-31 00:00", "2026-05-31 00:00"},
+		{"leap day", "0 0 29 2 *", "2026-03-01 00:00", "2028-02-29 00:00"},
+		{"end of day rolls to the next", "59 23 * * *", "2026-12-31 23:59", "2027-01-01 23:59"},
+	}
+	for _, tt := range tests {
+		s, err := ParseCron(tt.expr)
+		if err != nil {
+			t.Fatalf("%s: ParseCron(%q): %v", tt.name, tt.expr, err)
+		}
+		if got := s.Next(at(tt.from)); !got.Equal(at(tt.want)) {
+			t.Errorf("%s: Next(%s) of %q = %s, want %s", tt.name, tt.from, tt.expr, got.Format("2006-01-02 15:04"), tt.want)
+		}
+	}
+
+	if got, _ := ParseCron("* * * * *"); !got.Next(at("2026-03-02 10:15").Add(42 * time.Second)).Equal(at("2026-03-02 10:16")) {
+		t.Error("Next does not drop the seconds")
+	}
+
+	// dates that never come: zero time after the 5 year search
+	for _, expr := range []string{"0 0 30 2 *", "0 0 31 4,6,9,11 *"} {
+		s, _ := ParseCron(expr)
+		if got := s.Next(at("2026-03-02 00:00")); !got.IsZero() {
+			t.Errorf("Next of %q = %s, want zero time", expr, got)
+		}
+	}
+}
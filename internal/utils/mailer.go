@@ -0,0 +1,510 @@
+package utils
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// mailer defaults
+const (
+	DefaultMailDialTimeout = 10 * time.Second
+	DefaultMailIOTimeout   = 30 * time.Second
+	DefaultMailIdleTimeout = 60 * time.Second
+	DefaultMailPoolSize    = 2
+)
+
+// ErrNoRecipients is returned when every recipient of a message was rejected
+var ErrNoRecipients = errors.New("smtp: no recipient accepted")
+
+// MailAttachment is a file part of a message. With ContentID set it is an inline part
+// referenced from the html body as cid:<ContentID>.
+type MailAttachment struct {
+	Name        string
+	ContentType string
+	ContentID   string
+	Data        []byte
+}
+
+// MailMessage is one email
+type MailMessage struct {
+	From        string // empty uses Mailer.From
+	To          []string
+	Subject     string
+	ContentType string // of Body, default text/plain; charset=utf-8
+	Body        string
+	Inline      []MailAttachment
+	Attachments []MailAttachment
+}
+
+// RecipientError is the rejection of one RCPT TO
+type RecipientError struct {
+	Address string
+	Code    int
+	Message string
+}
+
+func (e RecipientError) Error() string {
+	return fmt.Sprintf("RCPT TO %s: %d %s", e.Address, e.Code, e.Message)
+}
+
+// Temporary reports a 4xx reply (mailbox busy, greylisting, ...): the recipient may accept a retry
+func (e RecipientError) Temporary() bool {
+	return e.Code >= 400 && e.Code < 500
+}
+
+// MailResult reports the recipients the server accepted and the ones it rejected
+type MailResult struct {
+	MessageID string
+	Accepted  []string
+	Rejected  []RecipientError
+}
+
+// Deferred lists the recipients that were rejected temporarily
+func (r MailResult) Deferred() []string {
+	var to []string
+	for _, e := range r.Rejected {
+		if e.Temporary() {
+			to = append(to, e.Address)
+		}
+	}
+	return to
+}
+
+// Mailer sends mail over authenticated SMTP connections that are kept open and reused.
+// It is safe for concurrent use.
+type Mailer struct {
+	Host        string
+	Port        string
+	Username    string
+	Password    string
+	From        string
+	DialTimeout time.Duration
+	IOTimeout   time.Duration // deadline of one message (MAIL .. end of DATA)
+	IdleTimeout time.Duration // idle connections older than this are closed
+	PoolSize    int           // idle connections kept open
+
+	mu   sync.Mutex
+	idle []*mailConn
+}
+
+type mailConn struct {
+	conn     net.Conn
+	client   *smtp.Client
+	dsn      bool
+	lastUsed time.Time
+}
+
+// Send delivers a message. A recipient rejected at RCPT TO does not stop the send; it is
+// reported in MailResult.Rejected (MailResult.Deferred for the temporary rejects). The error is
+// set when the message could not be sent at all (ErrNoRecipients when every recipient was rejected).
+func (m *Mailer) Send(msg MailMessage) (MailResult, error) {
+	var res MailResult
+	if len(msg.To) == 0 {
+		return res, ErrNoRecipients
+	}
+	from := msg.From
+	if from == "" {
+		from = m.From
+	}
+	if from == "" {
+		from = m.Username
+	}
+	fromAddr, err := mail.ParseAddress(from)
+	if err != nil {
+		return res, fmt.Errorf("invalid sender %q: %w", from, err)
+	}
+
+	res.MessageID = newMessageID(fromAddr.Address)
+	data, err := BuildMailMessage(msg, fromAddr, res.MessageID, time.Now())
+	if err != nil {
+		return res, err
+	}
+
+	mc, err := m.get()
+	if err != nil {
+		return res, err
+	}
+	res, err = m.send(mc, fromAddr.Address, msg.To, data, res)
+	if errors.Is(err, ErrNoRecipients) {
+		// the transaction was reset, the connection is still good
+		m.put(mc)
+		return res, err
+	}
+	if err != nil {
+		// the connection state is unknown after a failure
+		mc.close()
+		return res, err
+	}
+	m.put(mc)
+	return res, nil
+}
+
+func (m *Mailer) send(mc *mailConn, from string, to []string, data []byte, res MailResult) (MailResult, error) {
+	_ = mc.conn.SetDeadline(time.Now().Add(durationOr(m.IOTimeout, DefaultMailIOTimeout)))
+	defer mc.conn.SetDeadline(time.Time{})
+
+	mailCmd := "MAIL FROM:<%s>"
+	if mc.dsn {
+		mailCmd += " RET=HDRS"
+	}
+	if err := mc.cmd(250, mailCmd, from); err != nil {
+		return res, fmt.Errorf("MAIL FROM failed: %w", err)
+	}
+
+	rcptCmd := "RCPT TO:<%s>"
+	if mc.dsn {
+		// ask for a bounce on failure / delay only
+		rcptCmd += " NOTIFY=FAILURE,DELAY"
+	}
+	for _, rcpt := range to {
+		rcpt = strings.TrimSpace(rcpt)
+		if rcpt == "" {
+			continue
+		}
+		err := mc.cmd(25, rcptCmd, rcpt)
+		var perr *textproto.Error
+		switch {
+		case err == nil:
+			res.Accepted = append(res.Accepted, rcpt)
+		case errors.As(err, &perr):
+			res.Rejected = append(res.Rejected, RecipientError{Address: rcpt, Code: perr.Code, Message: perr.Msg})
+		default:
+			return res, fmt.Errorf("RCPT TO %s failed: %w", rcpt, err)
+		}
+	}
+	if len(res.Accepted) == 0 {
+		// keep the connection usable for the next message
+		_ = mc.cmd(250, "RSET")
+		return res, ErrNoRecipients
+	}
+
+	w, err := mc.client.Data()
+	if err != nil {
+		return res, fmt.Errorf("DATA command failed: %w", err)
+	}
+	if _, err := w.Write(data); err != nil {
+		return res, fmt.Errorf("writing message failed: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return res, fmt.Errorf("closing DATA writer failed: %w", err)
+	}
+	return res, nil
+}
+
+// get takes an idle connection that still answers NOOP, or dials a new one
+func (m *Mailer) get() (*mailConn, error) {
+	idleTimeout := durationOr(m.IdleTimeout, DefaultMailIdleTimeout)
+	for {
+		m.mu.Lock()
+		if len(m.idle) == 0 {
+			m.mu.Unlock()
+			break
+		}
+		mc := m.idle[len(m.idle)-1]
+		m.idle = m.idle[:len(m.idle)-1]
+		m.mu.Unlock()
+
+		if time.Since(mc.lastUsed) > idleTimeout {
+			mc.quit()
+			continue
+		}
+		_ = mc.conn.SetDeadline(time.Now().Add(durationOr(m.DialTimeout, DefaultMailDialTimeout)))
+		err := mc.client.Noop()
+		_ = mc.conn.SetDeadline(time.Time{})
+		if err != nil {
+			mc.close()
+			continue
+		}
+		return mc, nil
+	}
+	return m.dial()
+}
+
+func (m *Mailer) put(mc *mailConn) {
+	mc.lastUsed = time.Now()
+	size := m.PoolSize
+	if size == 0 {
+		size = DefaultMailPoolSize
+	}
+	m.mu.Lock()
+	if len(m.idle) < size {
+		m.idle = append(m.idle, mc)
+		mc = nil
+	}
+	m.mu.Unlock()
+	if mc != nil {
+		mc.quit()
+	}
+}
+
+// Close quits the idle connections
+func (m *Mailer) Close() {
+	m.mu.Lock()
+	idle := m.idle
+	m.idle = nil
+	m.mu.Unlock()
+	for _, mc := range idle {
+		mc.quit()
+	}
+}
+
+func (m *Mailer) dial() (*mailConn, error) {
+	if m.Host == "" || m.Port == "" {
+		return nil, fmt.Errorf("smtp configuration incomplete: host=%q port=%q", m.Host, m.Port)
+	}
+	dialTimeout := durationOr(m.DialTimeout, DefaultMailDialTimeout)
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort(m.Host, m.Port), dialTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("failed to dial smtp server: %w", err)
+	}
+	// greeting, EHLO, STARTTLS and AUTH share the dial timeout
+	_ = conn.SetDeadline(time.Now().Add(dialTimeout))
+
+	client, err := smtp.NewClient(conn, m.Host)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to create smtp client: %w", err)
+	}
+	mc := &mailConn{conn: conn, client: client}
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err := client.StartTLS(&tls.Config{ServerName: m.Host}); err != nil {
+			mc.close()
+			return nil, fmt.Errorf("starttls failed: %w", err)
+		}
+	}
+	if m.Username != "" {
+		if err := client.Auth(LoginAuth(m.Username, m.Password, m.Host)); err != nil {
+			mc.close()
+			return nil, fmt.Errorf("authentication failed: %w", err)
+		}
+	}
+	mc.dsn, _ = client.Extension("DSN")
+	_ = conn.SetDeadline(time.Time{})
+	return mc, nil
+}
+
+// cmd sends a raw command; MAIL / RCPT go through here so DSN parameters can be added
+func (mc *mailConn) cmd(expect int, format string, args ...interface{}) error {
+	id, err := mc.client.Text.Cmd(format, args...)
+	if err != nil {
+		return err
+	}
+	mc.client.Text.StartResponse(id)
+	defer mc.client.Text.EndResponse(id)
+	_, _, err = mc.client.Text.ReadResponse(expect)
+	return err
+}
+
+func (mc *mailConn) quit() {
+	_ = mc.conn.SetDeadline(time.Now().Add(5 * time.Second))
+	_ = mc.client.Quit()
+	mc.close()
+}
+
+func (mc *mailConn) close() {
+	_ = mc.client.Close()
+}
+
+func durationOr(d, def time.Duration) time.Duration {
+	if d > 0 {
+		return d
+	}
+	return def
+}
+
+func newMessageID(from string) string {
+	domain := "localhost"
+	if i := strings.LastIndex(from, "@"); i >= 0 && i < len(from)-1 {
+		domain = from[i+1:]
+	}
+	b := make([]byte, 12)
+	_, _ = rand.Read(b)
+	return "<" + strconv.FormatInt(time.Now().UnixNano(), 36) + "." + hex.EncodeToString(b) + "@" + domain + ">"
+}
+
+// BuildMailMessage renders a message as RFC 5322 text: headers in a fixed order, RFC 2047
+// encoded subject and names, a quoted-printable body and base64 file parts.
+// The structure is multipart/mixed( multipart/related( body, inline... ), attachments... ),
+// with the multipart levels left out when they have no parts.
+func BuildMailMessage(msg MailMessage, from *mail.Address, messageID string, now time.Time) ([]byte, error) {
+	to := make([]string, 0, len(msg.To))
+	for _, rcpt := range msg.To {
+		rcpt = strings.TrimSpace(rcpt)
+		if rcpt == "" {
+			continue
+		}
+		if a, err := mail.ParseAddress(rcpt); err == nil {
+			to = append(to, a.String())
+		} else {
+			to = append(to, rcpt)
+		}
+	}
+
+	var buf bytes.Buffer
+	writeHeader(&buf, "From", from.String())
+	writeHeader(&buf, "To", strings.Join(to, ", "))
+	writeHeader(&buf, "Subject", mime.BEncoding.Encode("utf-8", msg.Subject))
+	writeHeader(&buf, "Date", now.Format(time.RFC1123Z))
+	writeHeader(&buf, "Message-ID", messageID)
+	writeHeader(&buf, "MIME-Version", "1.0")
+
+	contentType := msg.ContentType
+	if contentType == "" {
+		contentType = "text/plain; charset=utf-8"
+	}
+
+	if len(msg.Attachments) == 0 {
+		if len(msg.Inline) == 0 {
+			writeTextPart(&buf, contentType, msg.Body)
+			return buf.Bytes(), nil
+		}
+		if err := writeRelated(&buf, contentType, msg.Body, msg.Inline); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+
+	mixed := multipart.NewWriter(&buf)
+	writeHeader(&buf, "Content-Type", "multipart/mixed; boundary="+mixed.Boundary())
+	buf.WriteString("\r\n")
+
+	if len(msg.Inline) == 0 {
+		pw, err := mixed.CreatePart(textPartHeader(contentType))
+		if err != nil {
+			return nil, err
+		}
+		if err := writeQuotedPrintable(pw, msg.Body); err != nil {
+			return nil, err
+		}
+	} else {
+		var rel bytes.Buffer
+		related := multipart.NewWriter(&rel)
+		pw, err := mixed.CreatePart(textproto.MIMEHeader{"Content-Type": {"multipart/related; boundary=" + related.Boundary()}})
+		if err != nil {
+			return nil, err
+		}
+		if err := writeRelatedParts(related, contentType, msg.Body, msg.Inline); err != nil {
+			return nil, err
+		}
+		if _, err := pw.Write(rel.Bytes()); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, a := range msg.Attachments {
+		if err := writeFilePart(mixed, a, "attachment"); err != nil {
+			return nil, err
+		}
+	}
+	if err := mixed.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func writeRelated(buf *bytes.Buffer, contentType, body string, inline []MailAttachment) error {
+	related := multipart.NewWriter(buf)
+	writeHeader(buf, "Content-Type", "multipart/related; boundary="+related.Boundary())
+	buf.WriteString("\r\n")
+	return writeRelatedParts(related, contentType, body, inline)
+}
+
+func writeRelatedParts(related *multipart.Writer, contentType, body string, inline []MailAttachment) error {
+	pw, err := related.CreatePart(textPartHeader(contentType))
+	if err != nil {
+		return err
+	}
+	if err := writeQuotedPrintable(pw, body); err != nil {
+		return err
+	}
+	for _, a := range inline {
+		if err := writeFilePart(related, a, "inline"); err != nil {
+			return err
+		}
+	}
+	return related.Close()
+}
+
+func textPartHeader(contentType string) textproto.MIMEHeader {
+	return textproto.MIMEHeader{
+		"Content-Type":              {contentType},
+		"Content-Transfer-Encoding": {"quoted-printable"},
+	}
+}
+
+func writeTextPart(buf *bytes.Buffer, contentType, body string) {
+	writeHeader(buf, "Content-Type", contentType)
+	writeHeader(buf, "Content-Transfer-Encoding", "quoted-printable")
+	buf.WriteString("\r\n")
+	_ = writeQuotedPrintable(buf, body)
+}
+
+func writeQuotedPrintable(w io.Writer, body string) error {
+	qp := quotedprintable.NewWriter(w)
+	if _, err := qp.Write([]byte(body)); err != nil {
+		return err
+	}
+	return qp.Close()
+}
+
+func writeFilePart(mw *multipart.Writer, a MailAttachment, disposition string) error {
+	contentType := a.ContentType
+	if contentType == "" {
+		contentType = mime.TypeByExtension(fileExt(a.Name))
+	}
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	h := textproto.MIMEHeader{}
+	h.Set("Content-Type", mime.FormatMediaType(contentType, map[string]string{"name": a.Name}))
+	h.Set("Content-Transfer-Encoding", "base64")
+	h.Set("Content-Disposition", mime.FormatMediaType(disposition, map[string]string{"filename": a.Name}))
+	if a.ContentID != "" {
+		h.Set("Content-ID", "<"+a.ContentID+">")
+	}
+	pw, err := mw.CreatePart(h)
+	if err != nil {
+		return err
+	}
+	enc := base64.StdEncoding.EncodeToString(a.Data)
+	// wrap lines at 76 chars per RFC
+	for i := 0; i < len(enc); i += 76 {
+		end := i + 76
+		if end > len(enc) {
+			end = len(enc)
+		}
+		if _, err := pw.Write([]byte(enc[i:end] + "\r\n")); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func fileExt(name string) string {
+	if i := strings.LastIndex(name, "."); i >= 0 {
+		return strings.ToLower(name[i:])
+	}
+	return ""
+}
+
+func writeHeader(buf *bytes.Buffer, key, value string) {
+	buf.WriteString(key + ": " + value + "\r\n")
+}
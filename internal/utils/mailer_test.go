@@ -0,0 +1,348 @@
+package utils
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/mail"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// smtpStub is a minimal SMTP server: no TLS, no AUTH. RCPT replies come from Replies
+// (address -> "550 no such user"), everything else is accepted.
+type smtpStub struct {
+	ln       net.Listener
+	Replies  map[string]string
+	StallOn  string // command prefix after which the stub stops answering ("" never)
+	Greeting bool   // false: accept connections but never greet
+
+	mu       sync.Mutex
+	conns    int
+	messages []stubMessage
+	release  chan struct{}
+}
+
+type stubMessage struct {
+	From string
+	To   []string
+	Data string
+}
+
+// newSMTPStub starts a stub; configure (optional) sets it up before it serves
+func newSMTPStub(t *testing.T, configure func(s *smtpStub)) *smtpStub {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &smtpStub{ln: ln, Replies: map[string]string{}, Greeting: true, release: make(chan struct{})}
+	if configure != nil {
+		configure(s)
+	}
+	go s.serve()
+	t.Cleanup(func() {
+		close(s.release)
+		ln.Close()
+	})
+	return s
+}
+
+func (s *smtpStub) mailer() *Mailer {
+	host, port, _ := net.SplitHostPort(s.ln.Addr().String())
+	return &Mailer{Host: host, Port: port, From: "tracking@example.com", DialTimeout: time.Second, IOTimeout: time.Second}
+}
+
+func (s *smtpStub) connCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.conns
+}
+
+func (s *smtpStub) sent() []stubMessage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]stubMessage(nil), s.messages...)
+}
+
+func (s *smtpStub) serve() {
+	for {
+		conn, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		s.conns++
+		s.mu.Unlock()
+		go s.handle(conn)
+	}
+}
+
+func (s *smtpStub) handle(conn net.Conn) {
+	defer conn.Close()
+	if !s.Greeting {
+		<-s.release
+		return
+	}
+	r := bufio.NewReader(conn)
+	reply := func(line string) { _, _ = io.WriteString(conn, line+"\r\n") }
+	reply("220 stub ESMTP")
+	var cur stubMessage
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		cmd := strings.ToUpper(line)
+		if s.StallOn != "" && strings.HasPrefix(cmd, s.StallOn) {
+			<-s.release
+			return
+		}
+		switch {
+		case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+			reply("250-stub")
+			reply("250 8BITMIME")
+		case strings.HasPrefix(cmd, "MAIL FROM:"):
+			cur = stubMessage{From: addrParam(line[len("MAIL FROM:"):])}
+			reply("250 ok")
+		case strings.HasPrefix(cmd, "RCPT TO:"):
+			addr := addrParam(line[len("RCPT TO:"):])
+			if rep, ok := s.Replies[addr]; ok {
+				reply(rep)
+				continue
+			}
+			cur.To = append(cur.To, addr)
+			reply("250 ok")
+		case cmd == "DATA":
+			if s.StallOn == "." {
+				// answer DATA, then never confirm the message
+				reply("354 go ahead")
+				for {
+					if l, err := r.ReadString('\n'); err != nil || l == ".\r\n" {
+						break
+					}
+				}
+				<-s.release
+				return
+			}
+			reply("354 go ahead")
+			var data strings.Builder
+			for {
+				l, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if l == ".\r\n" {
+					break
+				}
+				data.WriteString(strings.TrimPrefix(l, "."))
+			}
+			cur.Data = data.String()
+			s.mu.Lock()
+			s.messages = append(s.messages, cur)
+			s.mu.Unlock()
+			reply("250 queued")
+		case cmd == "RSET":
+			cur = stubMessage{}
+			reply("250 ok")
+		case cmd == "NOOP":
+			reply("250 ok")
+		case cmd == "QUIT":
+			reply("221 bye")
+			return
+		default:
+			reply("502 not implemented")
+		}
+	}
+}
+
+// addrParam reads the address of "<a@b> PARAMS"
+func addrParam(s string) string {
+	s = strings.TrimSpace(s)
+	if i := strings.Index(s, ">"); strings.HasPrefix(s, "<") && i > 0 {
+		return s[1:i]
+	}
+	return s
+}
+
+func TestMailerReusesConnections(t *testing.T) {
+	stub := newSMTPStub(t, nil)
+	m := stub.mailer()
+	defer m.Close()
+
+	for i := 0; i < 3; i++ {
+		res, err := m.Send(MailMessage{To: []string{"a@example.com"}, Subject: "s", Body: "b"})
+		if err != nil {
+			t.Fatalf("send %d: %v", i, err)
+		}
+		if len(res.Accepted) != 1 || res.MessageID == "" {
+			t.Fatalf("send %d: result %+v", i, res)
+		}
+	}
+	if n := stub.connCount(); n != 1 {
+		t.Errorf("server saw %d connections, want 1 reused connection", n)
+	}
+	if n := len(stub.sent()); n != 3 {
+		t.Errorf("server got %d messages, want 3", n)
+	}
+}
+
+func TestMailerRejectedRecipient(t *testing.T) {
+	stub := newSMTPStub(t, func(s *smtpStub) {
+		s.Replies["gone@example.com"] = "550 5.1.1 no such user"
+		s.Replies["busy@example.com"] = "452 4.2.2 mailbox full"
+	})
+	m := stub.mailer()
+	defer m.Close()
+
+	res, err := m.Send(MailMessage{To: []string{"a@example.com", "gone@example.com", "busy@example.com", "b@example.com"}, Subject: "s", Body: "b"})
+	if err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	if strings.Join(res.Accepted, ",") != "a@example.com,b@example.com" {
+		t.Errorf("accepted = %v", res.Accepted)
+	}
+	if len(res.Rejected) != 2 {
+		t.Fatalf("rejected = %+v", res.Rejected)
+	}
+	if r := res.Rejected[0]; r.Address != "gone@example.com" || r.Code != 550 || r.Temporary() {
+		t.Errorf("rejected[0] = %+v, want a permanent 550", r)
+	}
+	if r := res.Rejected[1]; r.Address != "busy@example.com" || r.Code != 452 || !r.Temporary() {
+		t.Errorf("rejected[1] = %+v, want a temporary 452", r)
+	}
+	if d := res.Deferred(); len(d) != 1 || d[0] != "busy@example.com" {
+		t.Errorf("deferred = %v", d)
+	}
+	sent := stub.sent()
+	if len(sent) != 1 || strings.Join(sent[0].To, ",") != "a@example.com,b@example.com" {
+		t.Errorf("server got %+v", sent)
+	}
+}
+
+func TestMailerNoRecipients(t *testing.T) {
+	stub := newSMTPStub(t, func(s *smtpStub) { s.Replies["gone@example.com"] = "550 no such user" })
+	m := stub.mailer()
+	defer m.Close()
+
+	if _, err := m.Send(MailMessage{Subject: "s"}); !errors.Is(err, ErrNoRecipients) {
+		t.Errorf("empty To: err = %v, want ErrNoRecipients", err)
+	}
+	res, err := m.Send(MailMessage{To: []string{"gone@example.com"}, Subject: "s", Body: "b"})
+	if !errors.Is(err, ErrNoRecipients) {
+		t.Fatalf("all rejected: err = %v, want ErrNoRecipients", err)
+	}
+	if len(res.Rejected) != 1 {
+		t.Errorf("rejected = %+v", res.Rejected)
+	}
+	// the connection was reset and goes back to the pool
+	if _, err := m.Send(MailMessage{To: []string{"a@example.com"}, Subject: "s", Body: "b"}); err != nil {
+		t.Fatalf("send after reject: %v", err)
+	}
+	if n := stub.connCount(); n != 1 {
+		t.Errorf("server saw %d connections, want 1", n)
+	}
+}
+
+func TestMailerDialTimeout(t *testing.T) {
+	stub := newSMTPStub(t, func(s *smtpStub) { s.Greeting = false })
+	m := stub.mailer()
+	m.DialTimeout = 100 * time.Millisecond
+
+	start := time.Now()
+	if _, err := m.Send(MailMessage{To: []string{"a@example.com"}, Subject: "s"}); err == nil {
+		t.Fatal("Send returned nil for a server that never greets")
+	}
+	if d := time.Since(start); d > 2*time.Second {
+		t.Errorf("Send took %s, want the dial timeout", d)
+	}
+}
+
+func TestMailerIOTimeout(t *testing.T) {
+	stub := newSMTPStub(t, func(s *smtpStub) { s.StallOn = "." })
+	m := stub.mailer()
+	m.IOTimeout = 100 * time.Millisecond
+
+	start := time.Now()
+	if _, err := m.Send(MailMessage{To: []string{"a@example.com"}, Subject: "s", Body: "b"}); err == nil {
+		t.Fatal("Send returned nil for a server that never confirms the message")
+	}
+	if d := time.Since(start); d > 2*time.Second {
+		t.Errorf("Send took %s, want the io timeout", d)
+	}
+	m.mu.Lock()
+	idle := len(m.idle)
+	m.mu.Unlock()
+	if idle != 0 {
+		t.Errorf("%d idle connections, want the timed out one closed", idle)
+	}
+}
+
+func TestBuildMailMessage(t *testing.T) {
+	from := &mail.Address{Name: "ระบบติดตาม", Address: "tracking@example.com"}
+	msg := MailMessage{
+		To:          []string{"Somchai <somchai@example.com>"},
+		Subject:     "แจ้งเตือน: รออนุมัติ",
+		ContentType: "text/html; charset=utf-8",
+		Body:        `<p>Logo <img src="cid:logo"></p>`,
+		Inline:      []MailAttachment{{Name: "logo.png", ContentType: "image/png", ContentID: "logo", Data: []byte("png-bytes")}},
+	}
+	data, err := BuildMailMessage(msg, from, "<id@example.com>", time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC))
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := mail.ReadMessage(strings.NewReader(string(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	raw := parsed.Header.Get("Subject")
+	if !strings.HasPrefix(raw, "=?utf-8?b?") {
+		t.Errorf("subject %q is not RFC 2047 encoded", raw)
+	}
+	if subject, err := new(mime.WordDecoder).DecodeHeader(raw); err != nil || subject != msg.Subject {
+		t.Errorf("subject decodes to %q, %v", subject, err)
+	}
+	if got := parsed.Header.Get("Message-ID"); got != "<id@example.com>" {
+		t.Errorf("Message-ID = %q", got)
+	}
+
+	mediaType, params, err := mime.ParseMediaType(parsed.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/related" {
+		t.Fatalf("content type = %q, %v; want multipart/related", mediaType, err)
+	}
+	mr := multipart.NewReader(parsed.Body, params["boundary"])
+	body, err := mr.NextPart()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ct := body.Header.Get("Content-Type"); ct != msg.ContentType {
+		t.Errorf("body part content type = %q", ct)
+	}
+	text, _ := io.ReadAll(body) // multipart decodes quoted-printable
+	if string(text) != msg.Body {
+		t.Errorf("body = %q", text)
+	}
+	img, err := mr.NextPart()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cid := img.Header.Get("Content-ID"); cid != "<logo>" {
+		t.Errorf("Content-ID = %q", cid)
+	}
+	if disp := img.Header.Get("Content-Disposition"); !strings.HasPrefix(disp, "inline") {
+		t.Errorf("Content-Disposition = %q", disp)
+	}
+	if enc := img.Header.Get("Content-Transfer-Encoding"); enc != "base64" {
+		t.Errorf("Content-Transfer-Encoding = %q", enc)
+	}
+	if _, err := mr.NextPart(); err != io.EOF {
+		t.Errorf("extra part after the inline image: %v", err)
+	}
+}
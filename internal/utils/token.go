@@ -0,0 +1,55 @@
+package utils
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// token errors
+var (
+	ErrTokenInvalid = errors.New("invalid token")
+	ErrTokenExpired = errors.New("token expired")
+	ErrTokenSecret  = errors.New("token secret is not set")
+)
+
+// SignUserToken returns an HMAC-SHA256 signed token "<su_id>.<unix expiry>.<signature>" for a user
+// (ErrTokenSecret without a secret, a token signed with an empty key could be forged by anyone)
+func SignUserToken(secret string, suID int64, expires time.Time) (string, error) {
+	if secret == "" {
+		return "", ErrTokenSecret
+	}
+	payload := strconv.FormatInt(suID, 10) + "." + strconv.FormatInt(expires.Unix(), 10)
+	return payload + "." + tokenSignature(secret, payload), nil
+}
+
+// VerifyUserToken checks the signature and expiry of a token and returns its su_id
+func VerifyUserToken(secret, token string, now time.Time) (int64, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 || secret == "" {
+		return 0, ErrTokenInvalid
+	}
+	payload := parts[0] + "." + parts[1]
+	if !hmac.Equal([]byte(parts[2]), []byte(tokenSignature(secret, payload))) {
+		return 0, ErrTokenInvalid
+	}
+	suID, err1 := strconv.ParseInt(parts[0], 10, 64)
+	exp, err2 := strconv.ParseInt(parts[1], 10, 64)
+	if err1 != nil || err2 != nil || suID <= 0 {
+		return 0, ErrTokenInvalid
+	}
+	if now.Unix() >= exp {
+		return 0, ErrTokenExpired
+	}
+	return suID, nil
+}
+
+func tokenSignature(secret, payload string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,27 @@
+package utils
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestUserToken(t *testing.T) {
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	token, err := SignUserToken("secret", 42, now.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id, err := VerifyUserToken("secret", token, now); err != nil || id != 42 {
+		t.Errorf("VerifyUserToken = %d, %v; want 42", id, err)
+	}
+	if _, err := VerifyUserToken("other", token, now); !errors.Is(err, ErrTokenInvalid) {
+		t.Errorf("wrong secret: err = %v, want ErrTokenInvalid", err)
+	}
+	if _, err := VerifyUserToken("secret", token, now.Add(2*time.Hour)); !errors.Is(err, ErrTokenExpired) {
+		t.Errorf("expired: err = %v, want ErrTokenExpired", err)
+	}
+	if _, err := SignUserToken("", 42, now.Add(time.Hour)); !errors.Is(err, ErrTokenSecret) {
+		t.Errorf("empty secret: err = %v, want ErrTokenSecret", err)
+	}
+}
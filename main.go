@@ -7,6 +7,7 @@ import (
 
 	"apiTrackingSystem/config"
 	"apiTrackingSystem/database"
+	"apiTrackingSystem/internal/handlers"
 	"apiTrackingSystem/internal/routes"
 
 	"github.com/gofiber/fiber/v2"
@@ -37,13 +38,23 @@ func main() {
 	app.Use(cors.New(cors.Config{
 		AllowOrigins:     "http://192.168.161.205:4009",
 		AllowMethods:     "GET,POST,HEAD,PUT,DELETE,OPTIONS",
-		AllowHeaders:     "Origin, Content-Type, Accept, Authorization",
+		AllowHeaders:     "Origin, Content-Type, Accept, Authorization, If-Match",
+		ExposeHeaders:    "ETag",
 		AllowCredentials: true,
 	}))
 
 	// Setup all routes (pass db)
 	routes.Setup(app, db)
 
+	handlers.LogApprovalSigning()
+
+	// background jobs
+	handlers.StartApprovalSLAScheduler(db)
+	handlers.StartNotificationDispatcher(db)
+	handlers.StartNotificationDigestScheduler(db)
+	handlers.StartTrackingReportScheduler(db)
+	handlers.StartStatusRollupScheduler(db)
+
 	// รันเซิร์ฟเวอร์
 	addr := cfg.AppAddr
 	if addr == "" {